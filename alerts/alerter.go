@@ -0,0 +1,187 @@
+package alerts
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+)
+
+const (
+	// Deliveries that may wait for a worker. Alerts fired while
+	// the queue is full are dropped, and fire again at the rule's
+	// next check.
+	QUEUE_SIZE = 256
+	// Webhooks delivered at once.
+	WORKERS = 4
+)
+
+// Defines the database operations alerting depends on.
+// Satisfied by db.DBManager, which should be the primary.
+type Store interface {
+	ReturnActiveAlertRulesForTicker(tickerId int) ([]db.AlertRule, error)
+	ReturnSentimentHistory(id int, fromTime int64) []db.IntervalQuote
+	ReturnMentionHistory(id int, fromTime int64) []db.IntervalQuote
+	UpdateAlertRuleFired(id int, firedAt, observedAt int64) error
+}
+
+// A fired rule waiting to be sent.
+type delivery struct {
+	rule   db.AlertRule
+	event  Event
+	logger *slog.Logger
+	// When the rule fired.
+	firedAt int64
+}
+
+// Ties rule evaluation to the database and the Notifier.
+// One Alerter is shared by every consumer. Check() only
+// evaluates rules; fired rules are queued and their webhooks
+// sent by the workers started by Run(), so that a slow or
+// failing webhook never holds up a consumer.
+type Alerter struct {
+	store    Store
+	notifier *Notifier
+	queue    chan delivery
+
+	mu sync.Mutex
+	// Rules queued or being sent, which are not queued again
+	// until they are done.
+	pending map[int]bool
+	// The observation each rule last reported, in case a check
+	// read the rule before its firing was recorded.
+	delivered map[int]int64
+}
+
+// Creates an Alerter that reads rules and history from
+// the given store. This should be the primary, since it
+// also records when rules have fired.
+func NewAlerter(store Store, n *Notifier) *Alerter {
+	return &Alerter{
+		store:     store,
+		notifier:  n,
+		queue:     make(chan delivery, QUEUE_SIZE),
+		pending:   make(map[int]bool),
+		delivered: make(map[int]int64),
+	}
+}
+
+// Evaluates every active rule for a ticker and queues a webhook
+// for each rule that fires. A rule is skipped while it is
+// cooling down or its last webhook is still queued, and never
+// fires twice for the same hour. Called by the consumer after
+// each push to the database, with the logger of the message
+// being processed.
+func (a *Alerter) Check(logger *slog.Logger, tickerId int, ticker string) {
+	d := a.store
+	if m, ok := d.(db.DBManager); ok {
+		d = m.WithLogger(logger)
+	}
+	rules, err := d.ReturnActiveAlertRulesForTicker(tickerId)
+	if err != nil {
+		logger.Error("failed to retrieve alert rules", "err", err)
+		return
+	}
+	if len(rules) == 0 {
+		return
+	}
+
+	now := time.Now().Unix()
+	var longestWindow int
+	for _, r := range rules {
+		if r.WindowHours > longestWindow {
+			longestWindow = r.WindowHours
+		}
+	}
+	if longestWindow == 0 {
+		longestWindow = defaultWindowHours
+	}
+	sentiments := d.ReturnSentimentHistory(tickerId, now-2*24*hour)
+	mentions := d.ReturnMentionHistory(tickerId, now-int64(longestWindow+1)*hour)
+
+	for _, r := range rules {
+		e, fired := Evaluate(r, ticker, sentiments, mentions)
+		if !fired {
+			continue
+		}
+		if !shouldNotify(r, e, now) {
+			continue
+		}
+		a.enqueue(delivery{rule: r, event: e, logger: logger, firedAt: now})
+	}
+}
+
+// Queues a delivery unless its rule already has one queued or
+// has reported the observation, or the queue is full.
+func (a *Alerter) enqueue(d delivery) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pending[d.rule.Id] || d.event.TimeStamp <= a.delivered[d.rule.Id] {
+		return
+	}
+	select {
+	case a.queue <- d:
+		a.pending[d.rule.Id] = true
+	default:
+		d.logger.Warn("alert queue full, dropping alert", "rule_id", d.rule.Id)
+	}
+}
+
+// Sends queued webhooks with the given number of workers until
+// ctx is done.
+func (a *Alerter) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case d := <-a.queue:
+					a.deliver(d)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Sends a webhook, recording the rule as fired only once it has
+// been delivered so that a failed delivery fires again at the
+// rule's next check.
+func (a *Alerter) deliver(d delivery) {
+	defer func() {
+		a.mu.Lock()
+		delete(a.pending, d.rule.Id)
+		a.mu.Unlock()
+	}()
+	r, e := d.rule, d.event
+	if err := a.notifier.Send(r.WebhookURL, r.Format, r.Secret, e); err != nil {
+		d.logger.Error("failed to send alert", "rule_id", r.Id, "err", err)
+		return
+	}
+	d.logger.Info("alert fired", "rule_id", r.Id, "kind", r.Kind, "value", e.Value)
+	a.mu.Lock()
+	a.delivered[r.Id] = e.TimeStamp
+	a.mu.Unlock()
+	if err := a.store.UpdateAlertRuleFired(r.Id, d.firedAt, e.TimeStamp); err != nil {
+		d.logger.Error("failed to record alert firing", "rule_id", r.Id, "err", err)
+	}
+}
+
+// Reports whether a fired rule should actually notify. The same
+// observation is only ever reported once, and a rule stays quiet
+// for CooldownSeconds after it last fired.
+func shouldNotify(r db.AlertRule, e Event, now int64) bool {
+	if r.LastObserved != 0 && e.TimeStamp <= r.LastObserved {
+		return false
+	}
+	if r.LastFired != 0 && now < r.LastFired+r.CooldownSeconds {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,292 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/logging"
+)
+
+func TestEvaluateSentimentThresholds(t *testing.T) {
+	// ReturnSentimentHistory() hands us the newest entry first.
+	history := []db.IntervalQuote{
+		{TimeStamp: 3 * hour, CurrentPrice: 0.6},
+		{TimeStamp: 2 * hour, CurrentPrice: 0.1},
+	}
+	above := db.AlertRule{Kind: SENTIMENT_ABOVE, Threshold: 0.5}
+	if e, fired := Evaluate(above, "AMD", history, nil); !fired || e.Value != 0.6 || e.TimeStamp != 3*hour {
+		t.Errorf("sentiment_above: got %+v, fired %v", e, fired)
+	}
+	below := db.AlertRule{Kind: SENTIMENT_BELOW, Threshold: 0.5}
+	if _, fired := Evaluate(below, "AMD", history, nil); fired {
+		t.Errorf("sentiment_below fired on the latest value 0.6 against 0.5")
+	}
+}
+
+func TestEvaluateSentimentFlip(t *testing.T) {
+	r := db.AlertRule{Kind: SENTIMENT_FLIP, Threshold: 0.3}
+	flipped := []db.IntervalQuote{{TimeStamp: hour, CurrentPrice: 0.2}, {TimeStamp: 2 * hour, CurrentPrice: -0.2}}
+	if _, fired := Evaluate(r, "AMD", flipped, nil); !fired {
+		t.Errorf("expected flip from 0.2 to -0.2 to fire")
+	}
+	small := []db.IntervalQuote{{TimeStamp: hour, CurrentPrice: 0.1}, {TimeStamp: 2 * hour, CurrentPrice: -0.1}}
+	if _, fired := Evaluate(r, "AMD", small, nil); fired {
+		t.Errorf("flip smaller than the threshold fired")
+	}
+}
+
+func TestEvaluateVolumeZScore(t *testing.T) {
+	var mentions []db.IntervalQuote
+	for i := int64(0); i < 24; i++ {
+		mentions = append(mentions, db.IntervalQuote{TimeStamp: i * hour, CurrentPrice: float64(10 + i%2)})
+	}
+	mentions = append(mentions, db.IntervalQuote{TimeStamp: 24 * hour, CurrentPrice: 40})
+
+	r := db.AlertRule{Kind: VOLUME_ZSCORE, Threshold: 3, WindowHours: 24}
+	e, fired := Evaluate(r, "GME", nil, mentions)
+	if !fired {
+		t.Fatalf("expected a spike to 40 mentions to fire, z was %.2f", e.Value)
+	}
+	if e.TimeStamp != 24*hour {
+		t.Errorf("expected the event to be stamped with the latest hour, got %d", e.TimeStamp)
+	}
+
+	flat := []db.IntervalQuote{{TimeStamp: 5 * hour, CurrentPrice: 3}}
+	if _, fired := Evaluate(r, "GME", nil, flat); fired {
+		t.Errorf("a window with no variance should never fire")
+	}
+}
+
+func TestShouldNotify(t *testing.T) {
+	now := int64(10 * hour)
+	r := db.AlertRule{CooldownSeconds: hour, LastFired: now - 30*60, LastObserved: 9 * hour}
+	if shouldNotify(r, Event{TimeStamp: 10 * hour}, now) {
+		t.Errorf("rule fired during its cooldown")
+	}
+	r.LastFired = now - 2*hour
+	if shouldNotify(r, Event{TimeStamp: 9 * hour}, now) {
+		t.Errorf("rule fired twice for the same observation")
+	}
+	if !shouldNotify(r, Event{TimeStamp: 10 * hour}, now) {
+		t.Errorf("rule should fire for a new observation after its cooldown")
+	}
+}
+
+func TestPayloadFormats(t *testing.T) {
+	e := Event{RuleId: 1, Ticker: "AMD", Message: "AMD is up"}
+	for format, key := range map[string]string{FORMAT_SLACK: "text", FORMAT_DISCORD: "content", FORMAT_JSON: "message"} {
+		body, err := Payload(format, e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded map[string]interface{}
+		if err := json.Unmarshal(body, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded[key] != "AMD is up" {
+			t.Errorf("%s payload missing %q: %s", format, key, body)
+		}
+	}
+	if _, err := Payload("teams", e); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
+
+func TestSendSignsAndRetries(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		ts, _ := strconv.ParseInt(r.Header.Get(TIMESTAMP_HEADER), 10, 64)
+		if r.Header.Get(SIGNATURE_HEADER) != Sign("s3cret", ts, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	n := &Notifier{Client: srv.Client(), MaxRetries: 2, Backoff: time.Millisecond}
+	if err := n.Send(srv.URL, FORMAT_JSON, "s3cret", Event{Message: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("expected one retry, got %d calls", calls)
+	}
+}
+
+func TestSendDoesNotRetryClientErrors(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	n := &Notifier{Client: srv.Client(), MaxRetries: 3, Backoff: time.Millisecond}
+	if err := n.Send(srv.URL, FORMAT_SLACK, "", Event{Message: "hi"}); err == nil {
+		t.Fatal("expected an error for a 400 response")
+	}
+	if calls != 1 {
+		t.Errorf("expected a single attempt, got %d", calls)
+	}
+}
+
+// Serves a fixed set of rules and sentiment history, and records
+// which rules have fired.
+type fakeStore struct {
+	rules      []db.AlertRule
+	sentiments []db.IntervalQuote
+
+	mu    sync.Mutex
+	fired map[int]int64
+}
+
+func (s *fakeStore) ReturnActiveAlertRulesForTicker(tickerId int) ([]db.AlertRule, error) {
+	return s.rules, nil
+}
+
+func (s *fakeStore) ReturnSentimentHistory(id int, fromTime int64) []db.IntervalQuote {
+	return s.sentiments
+}
+
+func (s *fakeStore) ReturnMentionHistory(id int, fromTime int64) []db.IntervalQuote {
+	return nil
+}
+
+func (s *fakeStore) UpdateAlertRuleFired(id int, firedAt, observedAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fired[id] = observedAt
+	return nil
+}
+
+func (s *fakeStore) firedAt(id int) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	observed, ok := s.fired[id]
+	return observed, ok
+}
+
+func newFakeStore(url string, rules int) *fakeStore {
+	s := &fakeStore{
+		sentiments: []db.IntervalQuote{{TimeStamp: 3 * hour, CurrentPrice: 0.6}},
+		fired:      make(map[int]int64),
+	}
+	for id := 1; id <= rules; id++ {
+		s.rules = append(s.rules, db.AlertRule{Id: id, Kind: SENTIMENT_ABOVE, Threshold: 0.5, WebhookURL: url, Format: FORMAT_JSON})
+	}
+	return s
+}
+
+func TestCheckDoesNotWaitForWebhooks(t *testing.T) {
+	release := make(chan struct{})
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	store := newFakeStore(srv.URL, 1)
+	a := NewAlerter(store, &Notifier{Client: srv.Client(), MaxRetries: 0, Backoff: time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go a.Run(ctx, 1)
+
+	done := make(chan struct{})
+	go func() {
+		// The rule is still being sent, so the second check must not
+		// queue it again.
+		a.Check(logging.Discard(), 1, "AMD")
+		for atomic.LoadInt32(&calls) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		a.Check(logging.Discard(), 1, "AMD")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Check() waited for the webhook")
+	}
+	if len(a.queue) != 0 {
+		t.Errorf("rule was queued again while its webhook was pending")
+	}
+	if _, ok := store.firedAt(1); ok {
+		t.Errorf("rule recorded as fired before its webhook was delivered")
+	}
+}
+
+func TestCheckRecordsDeliveredAlerts(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if fail.Load() {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	store := newFakeStore(srv.URL, 1)
+	a := NewAlerter(store, &Notifier{Client: srv.Client(), MaxRetries: 0, Backoff: time.Millisecond})
+	// Sends the queued deliveries and waits until they are done.
+	flush := func() {
+		for len(a.queue) > 0 {
+			a.deliver(<-a.queue)
+		}
+	}
+
+	a.Check(logging.Discard(), 1, "AMD")
+	flush()
+	if _, ok := store.firedAt(1); ok {
+		t.Fatal("failed delivery recorded as fired")
+	}
+
+	fail.Store(false)
+	a.Check(logging.Discard(), 1, "AMD")
+	flush()
+	if observed, ok := store.firedAt(1); !ok || observed != 3*hour {
+		t.Fatalf("expected the rule recorded at %d, got %d (%v)", 3*hour, observed, ok)
+	}
+
+	// The fake store never updates the rule it serves, so only the
+	// delivered observation stops the same hour firing again.
+	a.Check(logging.Discard(), 1, "AMD")
+	if len(a.queue) != 0 {
+		t.Errorf("delivered observation was queued again")
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 webhook calls, got %d", calls)
+	}
+}
+
+func TestCheckDropsWhenQueueFull(t *testing.T) {
+	store := newFakeStore("http://127.0.0.1:0", QUEUE_SIZE+10)
+	a := NewAlerter(store, NewNotifier())
+	a.Check(logging.Discard(), 1, "AMD")
+	if len(a.queue) != QUEUE_SIZE {
+		t.Errorf("expected a full queue of %d, got %d", QUEUE_SIZE, len(a.queue))
+	}
+	if len(a.pending) != QUEUE_SIZE {
+		t.Errorf("dropped alerts were marked pending: %d pending", len(a.pending))
+	}
+}
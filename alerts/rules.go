@@ -0,0 +1,160 @@
+package alerts
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+)
+
+// Defines the kinds of alert rules we know how to evaluate.
+const (
+	// Fires when the latest hourly sentiment is above Threshold.
+	SENTIMENT_ABOVE = "sentiment_above"
+	// Fires when the latest hourly sentiment is below Threshold.
+	SENTIMENT_BELOW = "sentiment_below"
+	// Fires when the z-score of the latest hour's mention count,
+	// against the WindowHours before it, is above Threshold.
+	VOLUME_ZSCORE = "volume_zscore"
+	// Fires when the sign of the hourly sentiment flips and the
+	// move between the two hours is at least Threshold.
+	SENTIMENT_FLIP = "sentiment_flip"
+)
+
+const (
+	hour = 3600
+	// Used when a volume rule does not specify its own window.
+	defaultWindowHours = 24
+)
+
+// Defines a fired rule, ready to be handed to a Notifier.
+type Event struct {
+	RuleId    int     `json:"rule_id"`
+	TickerId  int     `json:"ticker_id"`
+	Ticker    string  `json:"ticker"`
+	Kind      string  `json:"kind"`
+	Value     float64 `json:"value"`
+	Threshold float64 `json:"threshold"`
+	TimeStamp int64   `json:"time_stamp"`
+	Message   string  `json:"message"`
+}
+
+// Validates that a rule can be evaluated. Used by the API
+// before a rule is written to the database.
+func ValidateRule(r db.AlertRule) error {
+	switch r.Kind {
+	case SENTIMENT_ABOVE, SENTIMENT_BELOW, SENTIMENT_FLIP:
+	case VOLUME_ZSCORE:
+		if r.WindowHours < 0 {
+			return fmt.Errorf("window_hours must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown alert kind %q", r.Kind)
+	}
+	if r.WebhookURL == "" {
+		return fmt.Errorf("webhook_url is required")
+	}
+	switch r.Format {
+	case "", FORMAT_JSON, FORMAT_SLACK, FORMAT_DISCORD:
+	default:
+		return fmt.Errorf("unknown webhook format %q", r.Format)
+	}
+	if r.CooldownSeconds < 0 {
+		return fmt.Errorf("cooldown_seconds must not be negative")
+	}
+	return nil
+}
+
+// Evaluates a single rule against the sentiment and mention
+// histories of its ticker. Both histories may be in any order.
+// Returns the event and true if the rule fires.
+func Evaluate(r db.AlertRule, ticker string, sentiments, mentions []db.IntervalQuote) (Event, bool) {
+	e := Event{
+		RuleId:    r.Id,
+		TickerId:  r.TickerId,
+		Ticker:    ticker,
+		Kind:      r.Kind,
+		Threshold: r.Threshold,
+	}
+	switch r.Kind {
+	case SENTIMENT_ABOVE, SENTIMENT_BELOW:
+		s := sortedByTime(sentiments)
+		if len(s) == 0 {
+			return e, false
+		}
+		latest := s[len(s)-1]
+		e.Value, e.TimeStamp = latest.CurrentPrice, latest.TimeStamp
+		if r.Kind == SENTIMENT_ABOVE && latest.CurrentPrice > r.Threshold {
+			e.Message = fmt.Sprintf("%s hourly sentiment %.3f is above %.3f", ticker, e.Value, r.Threshold)
+			return e, true
+		}
+		if r.Kind == SENTIMENT_BELOW && latest.CurrentPrice < r.Threshold {
+			e.Message = fmt.Sprintf("%s hourly sentiment %.3f is below %.3f", ticker, e.Value, r.Threshold)
+			return e, true
+		}
+	case SENTIMENT_FLIP:
+		s := sortedByTime(sentiments)
+		if len(s) < 2 {
+			return e, false
+		}
+		prev, latest := s[len(s)-2], s[len(s)-1]
+		e.Value, e.TimeStamp = latest.CurrentPrice, latest.TimeStamp
+		if prev.CurrentPrice*latest.CurrentPrice < 0 && math.Abs(latest.CurrentPrice-prev.CurrentPrice) >= r.Threshold {
+			e.Message = fmt.Sprintf("%s hourly sentiment flipped from %.3f to %.3f", ticker, prev.CurrentPrice, latest.CurrentPrice)
+			return e, true
+		}
+	case VOLUME_ZSCORE:
+		window := r.WindowHours
+		if window == 0 {
+			window = defaultWindowHours
+		}
+		ts, z, ok := volumeZScore(mentions, window)
+		if !ok {
+			return e, false
+		}
+		e.Value, e.TimeStamp = z, ts
+		if z > r.Threshold {
+			e.Message = fmt.Sprintf("%s mention volume z-score %.2f is above %.2f", ticker, z, r.Threshold)
+			return e, true
+		}
+	}
+	return e, false
+}
+
+// Computes the z-score of the most recent hour's mention count
+// against the `window` hours that precede it. Hours missing from
+// the history are treated as having zero mentions. Returns false
+// if there is no history or the window has no variance.
+func volumeZScore(mentions []db.IntervalQuote, window int) (int64, float64, bool) {
+	m := sortedByTime(mentions)
+	if len(m) == 0 || window < 2 {
+		return 0, 0, false
+	}
+	latest := m[len(m)-1]
+	counts := make(map[int64]float64, len(m))
+	for _, q := range m {
+		counts[q.TimeStamp-q.TimeStamp%hour] += q.CurrentPrice
+	}
+	latestHour := latest.TimeStamp - latest.TimeStamp%hour
+
+	var sum, sumSq float64
+	for i := 1; i <= window; i++ {
+		c := counts[latestHour-int64(i)*hour]
+		sum += c
+		sumSq += c * c
+	}
+	mean := sum / float64(window)
+	variance := sumSq/float64(window) - mean*mean
+	if variance <= 0 {
+		return 0, 0, false
+	}
+	return latestHour, (counts[latestHour] - mean) / math.Sqrt(variance), true
+}
+
+func sortedByTime(qs []db.IntervalQuote) []db.IntervalQuote {
+	s := make([]db.IntervalQuote, len(qs))
+	copy(s, qs)
+	sort.Slice(s, func(i, j int) bool { return s[i].TimeStamp < s[j].TimeStamp })
+	return s
+}
@@ -0,0 +1,114 @@
+package alerts
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Defines the webhook payload formats a rule can request.
+const (
+	FORMAT_JSON    = "json"
+	FORMAT_SLACK   = "slack"
+	FORMAT_DISCORD = "discord"
+)
+
+// Headers attached to every webhook so that receivers can
+// verify the payload came from us and has not been replayed.
+const (
+	SIGNATURE_HEADER = "X-Watchdog-Signature"
+	TIMESTAMP_HEADER = "X-Watchdog-Timestamp"
+)
+
+// Sends fired alerts to their webhook, retrying failed
+// deliveries with an exponential backoff.
+type Notifier struct {
+	Client     *http.Client
+	MaxRetries int
+	Backoff    time.Duration
+}
+
+// Returns a Notifier with sensible defaults for production use.
+func NewNotifier() *Notifier {
+	return &Notifier{
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		MaxRetries: 3,
+		Backoff:    2 * time.Second,
+	}
+}
+
+// Builds the request body for an event in the requested format.
+// Slack and Discord only render their own text fields, so those
+// payloads carry the human readable message.
+func Payload(format string, e Event) ([]byte, error) {
+	switch format {
+	case FORMAT_SLACK:
+		return json.Marshal(map[string]string{"text": e.Message})
+	case FORMAT_DISCORD:
+		return json.Marshal(map[string]string{"content": e.Message})
+	case FORMAT_JSON, "":
+		return json.Marshal(e)
+	}
+	return nil, fmt.Errorf("unknown webhook format %q", format)
+}
+
+// Signs a timestamped payload with HMAC-SHA256. Receivers should
+// recompute the signature over `timestamp + "." + body`.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Delivers a payload to url. Any 2xx response is a success,
+// 4xx responses other than 429 are not retried since sending
+// the same body again will not change the outcome.
+func (n *Notifier) Send(url, format, secret string, e Event) error {
+	body, err := Payload(format, e)
+	if err != nil {
+		return err
+	}
+	backoff := n.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(url, secret, body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= n.MaxRetries {
+			return fmt.Errorf("webhook delivery failed after %d attempts: %w", attempt+1, err)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (n *Notifier) post(url, secret string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret != "" {
+		ts := time.Now().Unix()
+		req.Header.Set(TIMESTAMP_HEADER, strconv.FormatInt(ts, 10))
+		req.Header.Set(SIGNATURE_HEADER, Sign(secret, ts, body))
+	}
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+}
@@ -0,0 +1,350 @@
+package api
+
+import "time"
+
+// The request and response bodies of the REST API. Handlers return
+// these rather than internal types, and the OpenAPI document is
+// generated from them, so that a change to a body is a change to
+// the contract. Some keys are capitalised because the frontend was
+// written against the untagged structs they replace.
+
+// The body of every failed request.
+type Error struct {
+	Error string `json:"error"`
+}
+
+// The body of a write that has nothing else to return.
+type Success struct {
+	Success bool `json:"success"`
+}
+
+// Returned by /api/.
+type Ping struct {
+	Message string `json:"message"`
+}
+
+// Returned by /healthz.
+type Health struct {
+	Status string `json:"status"`
+}
+
+// Returned by /readyz. Ready is false if any required check failed.
+type Readiness struct {
+	Ready  bool    `json:"ready"`
+	Checks []Check `json:"checks"`
+}
+
+// The outcome of a single readiness check.
+type Check struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Latency string `json:"latency"`
+	// Optional checks are reported but do not affect readiness.
+	Optional bool `json:"optional,omitempty"`
+}
+
+// Returned by /api/status. Either ConsumerGroup or
+// ConsumerGroupError is set.
+type Status struct {
+	Tickers            []TickerStatus   `json:"tickers"`
+	ConsumerGroup      *ConsumerGroup   `json:"consumer_group,omitempty"`
+	ConsumerGroupError string           `json:"consumer_group_error,omitempty"`
+	Scheduler          *SchedulerStatus `json:"scheduler,omitempty"`
+	Replicas           []Replica        `json:"replicas"`
+}
+
+// An active ticker's entry in Status.
+type TickerStatus struct {
+	Id             int       `json:"id"`
+	Name           string    `json:"name"`
+	LastScrapeTime time.Time `json:"last_scrape_time"`
+	// Seconds since the last successful scrape, or -1 if
+	// the ticker has never been scraped.
+	SinceLastScrape int64 `json:"since_last_scrape_seconds"`
+}
+
+// The state of the Kafka consumer group, such as Stable.
+type ConsumerGroup struct {
+	GroupID string        `json:"group_id"`
+	State   string        `json:"state"`
+	Members []GroupMember `json:"members"`
+}
+
+// A member of the consumer group and the partitions it owns,
+// by topic.
+type GroupMember struct {
+	ClientID   string           `json:"client_id"`
+	ClientHost string           `json:"client_host"`
+	Partitions map[string][]int `json:"partitions"`
+}
+
+// Whether this instance holds the scheduler's lease and when
+// it last fired, -1 seconds ago if it never has.
+type SchedulerStatus struct {
+	Leader         bool       `json:"leader"`
+	LastFired      *time.Time `json:"last_fired,omitempty"`
+	SinceLastFired int64      `json:"since_last_fired_seconds"`
+}
+
+// A read replica and how far it lags the primary.
+type Replica struct {
+	URL       string    `json:"url"`
+	Serving   bool      `json:"serving"`
+	Lag       float64   `json:"lag_seconds"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// An active ticker in the list returned by /api/tickers.
+type TickerSummary struct {
+	Name            string    `json:"Name"`
+	LastScrapeTime  time.Time `json:"LastScrapeTime"`
+	HourlySentiment float64   `json:"HourlySentiment"`
+	Id              int       `json:"Id"`
+	// The current price.
+	Quote float64 `json:"Quote"`
+	// Seconds between scrapes, 0 for the priority's default.
+	ScrapeInterval int `json:"ScrapeInterval"`
+	// low, normal or high.
+	Priority string `json:"Priority"`
+	Adaptive bool   `json:"Adaptive"`
+}
+
+// Returned by /api/tickers/{id}/time/{interval}.
+type TickerHistory struct {
+	Ticker           Ticker      `json:"ticker"`
+	QuoteHistory     []Point     `json:"quote_history"`
+	SentimentHistory []Point     `json:"sentiment_history"`
+	StatementHistory []Statement `json:"statement_history"`
+}
+
+// A ticker as stored.
+type Ticker struct {
+	Name           string    `json:"Name"`
+	LastScrapeTime time.Time `json:"LastScrapeTime"`
+	Id             int       `json:"Id"`
+}
+
+// A price or a sentiment bucket at a unix time.
+type Point struct {
+	TimeStamp    int64   `json:"TimeStamp"`
+	CurrentPrice float64 `json:"CurrentPrice"`
+}
+
+// A scraped statement about a ticker.
+type Statement struct {
+	Expression   string  `json:"Expression"`
+	TimeStamp    int64   `json:"TimeStamp"`
+	Polarity     float64 `json:"Polarity"`
+	PermanentURL string  `json:"PermanentURL"`
+	ID           uint64  `json:"ID"`
+	Likes        int     `json:"Likes"`
+	Replies      int     `json:"Replies"`
+	Retweets     int     `json:"Retweets"`
+}
+
+// Returned by /api/tickers/{id}/metadata.
+type TickerMetadataResponse struct {
+	Metadata TickerMetadata `json:"metadata"`
+	// The query the sources search for the ticker with.
+	SearchQuery string `json:"search_query"`
+}
+
+// What a ticker is searched for by.
+type TickerMetadata struct {
+	TickerId    int      `json:"ticker_id"`
+	CompanyName string   `json:"company_name"`
+	Aliases     []string `json:"aliases"`
+	Cashtag     string   `json:"cashtag"`
+	// Statements mentioning any of these are not about
+	// the ticker.
+	NegativeKeywords []string `json:"negative_keywords"`
+}
+
+// Returned by /api/tickers/{id}/related.
+type RelatedTickers struct {
+	Ticker      string     `json:"ticker"`
+	WindowHours int        `json:"window_hours"`
+	Neighbors   []Neighbor `json:"neighbors"`
+	Cluster     []Node     `json:"cluster"`
+}
+
+// A ticker mentioned together with another.
+type Neighbor struct {
+	Id       int     `json:"ticker_id"`
+	Name     string  `json:"name"`
+	Mentions int     `json:"mentions"`
+	Weight   float64 `json:"weight"`
+}
+
+// A ticker in the co-mention graph.
+type Node struct {
+	Id       int    `json:"id"`
+	Name     string `json:"name"`
+	Mentions int    `json:"mentions"`
+	// The id of the node that names the node's cluster.
+	Cluster int `json:"cluster"`
+}
+
+// Two tickers mentioned in the same statements.
+type Edge struct {
+	Source   int     `json:"source"`
+	Target   int     `json:"target"`
+	Mentions int     `json:"mentions"`
+	Weight   float64 `json:"weight"`
+}
+
+// Returned by /api/tickers/{id}/related?format=json.
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// Returned by /api/tickers/{id}/top-authors.
+type TopAuthors struct {
+	Ticker      string      `json:"ticker"`
+	WindowHours int         `json:"window_hours"`
+	Authors     []TopAuthor `json:"authors"`
+}
+
+// An author and their statements about a ticker in the window.
+type TopAuthor struct {
+	AuthorId  string `json:"author_id"`
+	Username  string `json:"username"`
+	Followers int    `json:"followers"`
+	// When the account was created, or 0 if unknown.
+	Joined         int64   `json:"joined"`
+	Verified       bool    `json:"verified"`
+	Statements     int     `json:"statements"`
+	SpamStatements int     `json:"spam_statements"`
+	Influence      float64 `json:"influence"`
+	// When the profile was last fetched, or 0 if it never
+	// has been.
+	ProfileUpdatedAt int64   `json:"profile_updated_at"`
+	TickerStatements int     `json:"ticker_statements"`
+	AveragePolarity  float64 `json:"average_polarity"`
+}
+
+// Returned by /api/trending.
+type Trending struct {
+	WindowHours int     `json:"window_hours"`
+	Trending    []Trend `json:"trending"`
+}
+
+// A symbol mentioned more than usual.
+type Trend struct {
+	Symbol     string  `json:"symbol"`
+	Name       string  `json:"name"`
+	AssetClass string  `json:"asset_class"`
+	Mentions   int     `json:"mentions"`
+	Baseline   float64 `json:"baseline"`
+	Velocity   float64 `json:"velocity"`
+}
+
+// Returned by /api/statements/search. NextCursor is empty on the
+// last page.
+type SearchResponse struct {
+	Results    []SearchResult `json:"results"`
+	NextCursor string         `json:"next_cursor"`
+}
+
+// A statement found by a search.
+type SearchResult struct {
+	TweetId    uint64   `json:"tweet_id,string"`
+	TimeStamp  int64    `json:"time_stamp"`
+	Expression string   `json:"expression"`
+	URL        string   `json:"url"`
+	Polarity   float64  `json:"polarity"`
+	Likes      int      `json:"likes"`
+	Replies    int      `json:"replies"`
+	Retweets   int      `json:"retweets"`
+	Spam       bool     `json:"spam"`
+	Source     string   `json:"source"`
+	Tickers    []string `json:"tickers"`
+	// How well the statement matches the text searched for,
+	// or 0 without one.
+	Relevance float64 `json:"relevance"`
+}
+
+// The body of POST /auth/tickers/.
+type NewTickerRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// The body of PUT /auth/tickers/{id}/schedule.
+type ScheduleRequest struct {
+	// Seconds, 0 or 300-86400.
+	ScrapeInterval int `json:"scrape_interval"`
+	// low, normal or high.
+	Priority string `json:"priority"`
+	Adaptive bool   `json:"adaptive"`
+}
+
+// The body of PUT /auth/tickers/{id}/metadata.
+type TickerMetadataRequest struct {
+	CompanyName      string   `json:"company_name"`
+	Aliases          []string `json:"aliases"`
+	Cashtag          string   `json:"cashtag"`
+	NegativeKeywords []string `json:"negative_keywords"`
+}
+
+// An alert rule as returned by GET /auth/alerts. Its webhook
+// secret is never returned.
+type AlertRule struct {
+	Id              int     `json:"Id"`
+	TickerId        int     `json:"TickerId"`
+	Kind            string  `json:"Kind"`
+	Threshold       float64 `json:"Threshold"`
+	WindowHours     int     `json:"WindowHours"`
+	CooldownSeconds int64   `json:"CooldownSeconds"`
+	WebhookURL      string  `json:"WebhookURL"`
+	Format          string  `json:"Format"`
+	// 1 if the rule is evaluated, 0 if not.
+	Active       int   `json:"Active"`
+	LastFired    int64 `json:"LastFired"`
+	LastObserved int64 `json:"LastObserved"`
+}
+
+// The body of POST /auth/alerts and PUT /auth/alerts/{id}. See the
+// alerts package for valid kinds and formats. An update without a
+// secret keeps the rule's secret, since rules are listed without it,
+// and an empty secret removes it.
+type AlertRuleRequest struct {
+	TickerId        int     `json:"ticker_id" binding:"required"`
+	Kind            string  `json:"kind" binding:"required"`
+	Threshold       float64 `json:"threshold"`
+	WindowHours     int     `json:"window_hours"`
+	CooldownSeconds int64   `json:"cooldown_seconds"`
+	WebhookURL      string  `json:"webhook_url" binding:"required"`
+	Format          string  `json:"format"`
+	Secret          *string `json:"secret"`
+	Active          *bool   `json:"active"`
+}
+
+// Returned by POST /auth/alerts.
+type Created struct {
+	Id int `json:"id"`
+}
+
+// The consumer workers of a Kafka topic.
+type TopicStatus struct {
+	Topic   string   `json:"topic"`
+	Workers []Worker `json:"workers"`
+}
+
+// A consumer worker.
+type Worker struct {
+	ID    int    `json:"id"`
+	State string `json:"state"`
+	// When the worker entered its current state.
+	Since     time.Time `json:"since"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// The body of PUT /auth/consumers/{topic}.
+type ResizeConsumersRequest struct {
+	// 0-64.
+	Workers *int `json:"workers" binding:"required"`
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The version of the API in the OpenAPI document. Bump it when a
+// body or route changes incompatibly.
+const VERSION = "1.0.0"
+
+const OPENAPI_VERSION = "3.0.3"
+
+// Prefixes references to the document's schemas.
+const SCHEMA_REF = "#/components/schemas/"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Returns the OpenAPI document of ROUTES. Every named body type
+// becomes a schema under components, referred to by its Go name.
+// Fields are required in responses unless they are omitempty, and
+// in requests only if they are bound as required.
+func Spec() map[string]interface{} {
+	s := schemas{components: make(map[string]interface{})}
+	paths := make(map[string]interface{})
+	for _, r := range ROUTES {
+		item, ok := paths[r.Path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[r.Path] = item
+		}
+		item[strings.ToLower(r.Method)] = s.operation(r)
+	}
+	return map[string]interface{}{
+		"openapi": OPENAPI_VERSION,
+		"info": map[string]interface{}{
+			"title":       "watch-dog-kafka",
+			"description": "Sentiment of scraped statements about stock and crypto tickers.",
+			"version":     VERSION,
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": s.components},
+	}
+}
+
+type schemas struct {
+	components map[string]interface{}
+}
+
+func (s schemas) operation(r Route) map[string]interface{} {
+	op := map[string]interface{}{
+		"operationId": r.OperationId,
+		"summary":     r.Summary,
+		"tags":        []string{r.Tag},
+	}
+	if len(r.Params) > 0 {
+		var params []interface{}
+		for _, p := range r.Params {
+			schema := map[string]interface{}{"type": p.Type}
+			if len(p.Enum) > 0 {
+				schema["enum"] = p.Enum
+			}
+			param := map[string]interface{}{"name": p.Name, "in": p.In, "required": p.In == "path", "schema": schema}
+			if p.Description != "" {
+				param["description"] = p.Description
+			}
+			params = append(params, param)
+		}
+		op["parameters"] = params
+	}
+	if r.Body != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": s.of(reflect.TypeOf(r.Body), true)}},
+		}
+	}
+
+	// Responses sharing a status are one response with several
+	// content types.
+	responses := make(map[string]interface{})
+	for _, resp := range r.Responses {
+		status := strconv.Itoa(resp.Status)
+		out, ok := responses[status].(map[string]interface{})
+		if !ok {
+			out = map[string]interface{}{"description": resp.Description, "content": map[string]interface{}{}}
+			responses[status] = out
+		}
+		content := out["content"].(map[string]interface{})
+		if resp.Body != nil {
+			content["application/json"] = map[string]interface{}{"schema": s.body(resp.Body)}
+		}
+		for _, contentType := range resp.Files {
+			content[contentType] = map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}}
+		}
+	}
+	op["responses"] = responses
+	return op
+}
+
+func (s schemas) body(body interface{}) map[string]interface{} {
+	if bodies, ok := body.(OneOf); ok {
+		var oneOf []interface{}
+		for _, b := range bodies {
+			oneOf = append(oneOf, s.of(reflect.TypeOf(b), false))
+		}
+		return map[string]interface{}{"oneOf": oneOf}
+	}
+	return s.of(reflect.TypeOf(body), false)
+}
+
+// Returns the schema of t, adding the named structs it refers to
+// to the components.
+func (s schemas) of(t reflect.Type, request bool) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		elem := s.of(t.Elem(), request)
+		if _, ok := elem["$ref"]; ok {
+			// Siblings of a $ref are ignored.
+			return map[string]interface{}{"allOf": []interface{}{elem}, "nullable": true}
+		}
+		elem["nullable"] = true
+		return elem
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t, request)
+		}
+		if _, ok := s.components[t.Name()]; !ok {
+			// Claimed before it is built, in case it refers
+			// to itself.
+			s.components[t.Name()] = nil
+			s.components[t.Name()] = s.object(t, request)
+		}
+		return map[string]interface{}{"$ref": SCHEMA_REF + t.Name()}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.of(t.Elem(), request)}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.Interface {
+			return map[string]interface{}{"type": "object"}
+		}
+		return map[string]interface{}{"type": "object", "additionalProperties": s.of(t.Elem(), request)}
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case reflect.Float32:
+		return map[string]interface{}{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]interface{}{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	}
+	panic("api: no schema for " + t.String())
+}
+
+func (s schemas) object(t reflect.Type, request bool) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	s.fields(t, request, properties, &required)
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// Adds the properties of t's fields, as encoding/json names them,
+// flattening embedded structs.
+func (s schemas) fields(t reflect.Type, request bool, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			s.fields(f.Type, request, properties, required)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		schema := s.of(f.Type, request)
+		if hasOption(options, "string") {
+			// Quoted, as a 64 bit id loses precision as a
+			// JavaScript number.
+			schema = map[string]interface{}{"type": "string", "pattern": "^[0-9]+$"}
+		}
+		properties[name] = schema
+		if request && hasOption(f.Tag.Get("binding"), "required") || !request && !hasOption(options, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func hasOption(options, option string) bool {
+	for _, o := range strings.Split(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
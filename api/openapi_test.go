@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSpecRoutes(t *testing.T) {
+	ids := make(map[string]bool)
+	pathParams := regexp.MustCompile(`\{([^}]+)\}`)
+	for _, r := range ROUTES {
+		if r.OperationId == "" || ids[r.OperationId] {
+			t.Errorf("%s %s: missing or duplicate operationId %q", r.Method, r.Path, r.OperationId)
+		}
+		ids[r.OperationId] = true
+
+		declared := make(map[string]bool)
+		for _, p := range r.Params {
+			if p.In == "path" {
+				declared[p.Name] = true
+			}
+		}
+		for _, m := range pathParams.FindAllStringSubmatch(r.Path, -1) {
+			if !declared[m[1]] {
+				t.Errorf("%s %s: path parameter %s is not declared", r.Method, r.Path, m[1])
+			}
+			delete(declared, m[1])
+		}
+		if len(declared) > 0 {
+			t.Errorf("%s %s: declares path parameters %v it does not have", r.Method, r.Path, declared)
+		}
+		if len(r.Responses) == 0 {
+			t.Errorf("%s %s: no responses", r.Method, r.Path)
+		}
+	}
+}
+
+func TestSpecSchemas(t *testing.T) {
+	b, err := json.Marshal(Spec())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec struct {
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]struct {
+				Type       string
+				Required   []string
+				Properties map[string]map[string]interface{}
+			}
+		}
+	}
+	if err := json.Unmarshal(b, &spec); err != nil {
+		t.Fatal(err)
+	}
+	schemas := spec.Components.Schemas
+	for name, s := range schemas {
+		if s.Type != "object" {
+			t.Errorf("%s has type %q", name, s.Type)
+		}
+	}
+
+	required := func(name string) string {
+		return strings.Join(schemas[name].Required, ",")
+	}
+	// Requests require only what is bound as required.
+	if got := required("AlertRuleRequest"); got != "ticker_id,kind,webhook_url" {
+		t.Errorf("AlertRuleRequest requires %s", got)
+	}
+	if got := required("ScheduleRequest"); got != "" {
+		t.Errorf("ScheduleRequest requires %s", got)
+	}
+	// Responses require all but omitempty fields.
+	if got := required("Check"); got != "name,ok,latency" {
+		t.Errorf("Check requires %s", got)
+	}
+	if got := schemas["SearchResult"].Properties["tweet_id"]["type"]; got != "string" {
+		t.Errorf("tweet_id is a %v, want a string", got)
+	}
+	if got := schemas["Status"].Properties["consumer_group"]; !reflect.DeepEqual(got, map[string]interface{}{
+		"allOf": []interface{}{map[string]interface{}{"$ref": SCHEMA_REF + "ConsumerGroup"}}, "nullable": true,
+	}) {
+		t.Errorf("consumer_group is %v", got)
+	}
+	if got := schemas["GroupMember"].Properties["partitions"]["additionalProperties"]; !reflect.DeepEqual(got, map[string]interface{}{
+		"type": "array", "items": map[string]interface{}{"type": "integer", "format": "int64"},
+	}) {
+		t.Errorf("partitions are %v", got)
+	}
+	if _, ok := schemas["Graph"]; !ok {
+		t.Error("Graph, only referred to from a oneOf, is missing")
+	}
+
+	var related struct {
+		Responses map[string]struct {
+			Content map[string]json.RawMessage
+		}
+	}
+	if err := json.Unmarshal(spec.Paths["/api/tickers/{id}/related"]["get"], &related); err != nil {
+		t.Fatal(err)
+	}
+	if content := related.Responses["200"].Content; len(content) != 2 {
+		t.Errorf("related's 200 has content types %v, want JSON and GraphML", content)
+	}
+}
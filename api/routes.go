@@ -0,0 +1,261 @@
+package api
+
+import "net/http"
+
+// An operation of the REST API, from which its entry in the OpenAPI
+// document is generated.
+type Route struct {
+	Method string
+	// The path with {name} for each path parameter.
+	Path string
+	// Names the operation, and the client method that calls it.
+	OperationId string
+	Summary     string
+	// public, admin or operations.
+	Tag    string
+	Params []Param
+	// A zero value of the JSON request body, or nil for none.
+	Body      interface{}
+	Responses []Response
+}
+
+// A path or query parameter. Path parameters are always required,
+// query parameters never.
+type Param struct {
+	Name string
+	// path or query.
+	In string
+	// integer, number, string or boolean.
+	Type        string
+	Enum        []string
+	Description string
+}
+
+// A response to an operation.
+type Response struct {
+	Status      int
+	Description string
+	// A zero value of the JSON body, or nil if the response is a file.
+	Body interface{}
+	// The content types of the file sent instead of a JSON body.
+	Files []string
+}
+
+// A JSON body that is one of several types, depending on the
+// request.
+type OneOf []interface{}
+
+func reply(status int, body interface{}) Response {
+	return Response{Status: status, Description: http.StatusText(status), Body: body}
+}
+
+func file(description string, contentTypes ...string) Response {
+	return Response{Status: http.StatusOK, Description: description, Files: contentTypes}
+}
+
+// Responses carrying an Error body.
+func failures(statuses ...int) []Response {
+	var responses []Response
+	for _, status := range statuses {
+		responses = append(responses, reply(status, Error{}))
+	}
+	return responses
+}
+
+func responses(ok Response, failed ...int) []Response {
+	return append([]Response{ok}, failures(failed...)...)
+}
+
+func pathParam(name, typ, description string) Param {
+	return Param{Name: name, In: "path", Type: typ, Description: description}
+}
+
+func queryParam(name, typ, description string, enum ...string) Param {
+	return Param{Name: name, In: "query", Type: typ, Description: description, Enum: enum}
+}
+
+var tickerId = pathParam("id", "integer", "The ticker's id.")
+
+// Every route the server registers.
+var ROUTES = []Route{
+	{
+		Method: http.MethodGet, Path: "/metrics", OperationId: "metrics", Tag: "operations",
+		Summary:   "Prometheus metrics in the text exposition format.",
+		Responses: []Response{file("Metrics.", "text/plain")},
+	},
+	{
+		Method: http.MethodGet, Path: "/healthz", OperationId: "healthz", Tag: "operations",
+		Summary:   "Reports that the process is up, without checking its dependencies.",
+		Responses: responses(reply(http.StatusOK, Health{})),
+	},
+	{
+		Method: http.MethodGet, Path: "/readyz", OperationId: "readyz", Tag: "operations",
+		Summary:   "Runs every dependency check. Responds 503 if a required check fails.",
+		Responses: []Response{reply(http.StatusOK, Readiness{}), reply(http.StatusServiceUnavailable, Readiness{})},
+	},
+	{
+		Method: http.MethodGet, Path: "/api/", OperationId: "ping", Tag: "public",
+		Summary:   "Responds pong.",
+		Responses: responses(reply(http.StatusOK, Ping{})),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/openapi.json", OperationId: "openAPI", Tag: "public",
+		Summary:   "This document.",
+		Responses: responses(reply(http.StatusOK, map[string]interface{}{})),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/status", OperationId: "status", Tag: "operations",
+		Summary:   "Reports when each active ticker was last scraped, the consumer group, the scheduler and the replicas.",
+		Responses: responses(reply(http.StatusOK, Status{}), http.StatusInternalServerError),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/tickers", OperationId: "tickers", Tag: "public",
+		Summary:   "Lists the active tickers with their current price.",
+		Responses: responses(reply(http.StatusOK, []TickerSummary{}), http.StatusInternalServerError),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/tickers/{id}/time/{interval}", OperationId: "tickerHistory", Tag: "public",
+		Summary: "Returns a ticker's quotes, sentiment and statements over an interval.",
+		Params: []Param{
+			tickerId,
+			{Name: "interval", In: "path", Type: "string", Enum: []string{"day", "week", "month", "2month"}},
+			queryParam("bucket", "string", "Quarter hour sentiment buckets instead of hourly ones.", "15m"),
+			queryParam("weighting", "string", "Weight each statement by its author's influence.", "influence"),
+		},
+		Responses: responses(reply(http.StatusOK, TickerHistory{}), http.StatusBadRequest),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/tickers/{id}/metadata", OperationId: "tickerMetadata", Tag: "public",
+		Summary:   "Returns a ticker's metadata and the search query built from it.",
+		Params:    []Param{tickerId},
+		Responses: responses(reply(http.StatusOK, TickerMetadataResponse{}), http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/tickers/{id}/related", OperationId: "relatedTickers", Tag: "public",
+		Summary: "Returns the tickers mentioned together with a ticker and its cluster, or with a format, the graph around it as a file.",
+		Params: []Param{
+			tickerId,
+			queryParam("window", "integer", "Hours, default 24, at most 720."),
+			queryParam("limit", "integer", "Most neighbours returned, default 10, at most 100."),
+			queryParam("min_weight", "number", "Lightest edge considered, 0 to 1, default 0.05."),
+			queryParam("format", "string", "Return the graph as a file.", "graphml", "json"),
+		},
+		Responses: append([]Response{
+			reply(http.StatusOK, OneOf{RelatedTickers{}, Graph{}}),
+			file("The graph with format=graphml.", "application/graphml+xml"),
+		}, failures(http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError)...),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/tickers/{id}/top-authors", OperationId: "topAuthors", Tag: "public",
+		Summary: "Returns the authors who weighed most on a ticker's sentiment.",
+		Params: []Param{
+			tickerId,
+			queryParam("window", "integer", "Hours, default 168, at most 1440."),
+			queryParam("limit", "integer", "Default 10, at most 100."),
+		},
+		Responses: responses(reply(http.StatusOK, TopAuthors{}), http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/trending", OperationId: "trending", Tag: "public",
+		Summary: "Lists untracked symbols mentioned more than usual, fastest rising first.",
+		Params: []Param{
+			queryParam("window", "integer", "Hours, default 1, at most 24."),
+			queryParam("limit", "integer", "Default 20, at most 100."),
+			queryParam("min_mentions", "integer", "Default 5."),
+		},
+		Responses: responses(reply(http.StatusOK, Trending{}), http.StatusBadRequest, http.StatusInternalServerError),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/export/{dataset}", OperationId: "export", Tag: "public",
+		Summary: "Streams the statements, sentiment buckets or quotes of tickers as a file.",
+		Params: []Param{
+			{Name: "dataset", In: "path", Type: "string", Enum: []string{"statements", "sentiments", "quotes"}},
+			queryParam("tickers", "string", "Comma separated ticker names, default every active ticker."),
+			queryParam("from", "string", "RFC 3339, YYYY-MM-DD or unix seconds, default a week before to."),
+			queryParam("to", "string", "RFC 3339, YYYY-MM-DD or unix seconds, default now."),
+			queryParam("format", "string", "Default csv.", "csv", "ndjson", "parquet"),
+		},
+		Responses: append([]Response{file("A row per statement, bucket or quote.", "text/csv", "application/x-ndjson", "application/vnd.apache.parquet")},
+			failures(http.StatusBadRequest, http.StatusNotFound)...),
+	},
+	{
+		Method: http.MethodGet, Path: "/api/statements/search", OperationId: "searchStatements", Tag: "public",
+		Summary: "Searches stored statements, most relevant first, or newest first without q.",
+		Params: []Param{
+			queryParam("q", "string", `Words and "quoted phrases" that must all appear. A leading - excludes one, a trailing * matches a prefix. Only excluding returns every statement without them.`),
+			queryParam("tickers", "string", "Comma separated ticker names."),
+			queryParam("source", "string", "Such as Twitter."),
+			queryParam("from", "string", "RFC 3339, YYYY-MM-DD or unix seconds."),
+			queryParam("to", "string", "RFC 3339, YYYY-MM-DD or unix seconds."),
+			queryParam("min_polarity", "number", "-1 to 1."),
+			queryParam("max_polarity", "number", "-1 to 1."),
+			queryParam("spam", "boolean", ""),
+			queryParam("min_engagement", "integer", "Least likes, replies and retweets combined."),
+			queryParam("limit", "integer", "Default 20, at most 100."),
+			queryParam("cursor", "string", "The previous page's next_cursor."),
+		},
+		Responses: responses(reply(http.StatusOK, SearchResponse{}), http.StatusBadRequest, http.StatusInternalServerError),
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/tickers/", OperationId: "addTicker", Tag: "admin",
+		Summary:   "Resolves a name to its canonical symbol and queues it to be added and scraped.",
+		Body:      NewTickerRequest{},
+		Responses: responses(reply(http.StatusOK, Success{}), http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError),
+	},
+	{
+		Method: http.MethodDelete, Path: "/auth/tickers/{id}", OperationId: "deactivateTicker", Tag: "admin",
+		Summary:   "Queues a ticker to be deactivated.",
+		Params:    []Param{tickerId},
+		Responses: responses(reply(http.StatusOK, Success{}), http.StatusBadRequest, http.StatusInternalServerError),
+	},
+	{
+		Method: http.MethodPut, Path: "/auth/tickers/{id}/schedule", OperationId: "updateSchedule", Tag: "admin",
+		Summary:   "Changes how often and how urgently a ticker is scraped.",
+		Params:    []Param{tickerId},
+		Body:      ScheduleRequest{},
+		Responses: responses(reply(http.StatusOK, Success{}), http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError),
+	},
+	{
+		Method: http.MethodPut, Path: "/auth/tickers/{id}/metadata", OperationId: "updateTickerMetadata", Tag: "admin",
+		Summary:   "Replaces a ticker's metadata, used from its next scrape on.",
+		Params:    []Param{tickerId},
+		Body:      TickerMetadataRequest{},
+		Responses: responses(reply(http.StatusOK, Success{}), http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError),
+	},
+	{
+		Method: http.MethodGet, Path: "/auth/alerts", OperationId: "alertRules", Tag: "admin",
+		Summary:   "Lists every alert rule.",
+		Responses: responses(reply(http.StatusOK, []AlertRule{}), http.StatusInternalServerError),
+	},
+	{
+		Method: http.MethodPost, Path: "/auth/alerts", OperationId: "addAlertRule", Tag: "admin",
+		Summary:   "Creates an alert rule for a tracked ticker.",
+		Body:      AlertRuleRequest{},
+		Responses: responses(reply(http.StatusCreated, Created{}), http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError),
+	},
+	{
+		Method: http.MethodPut, Path: "/auth/alerts/{id}", OperationId: "updateAlertRule", Tag: "admin",
+		Summary:   "Replaces an alert rule.",
+		Params:    []Param{pathParam("id", "integer", "The rule's id.")},
+		Body:      AlertRuleRequest{},
+		Responses: responses(reply(http.StatusOK, Success{}), http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError),
+	},
+	{
+		Method: http.MethodDelete, Path: "/auth/alerts/{id}", OperationId: "deleteAlertRule", Tag: "admin",
+		Summary:   "Deletes an alert rule.",
+		Params:    []Param{pathParam("id", "integer", "The rule's id.")},
+		Responses: responses(reply(http.StatusOK, Success{}), http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError),
+	},
+	{
+		Method: http.MethodGet, Path: "/auth/consumers", OperationId: "consumers", Tag: "admin",
+		Summary:   "Returns the consumer workers of every topic.",
+		Responses: responses(reply(http.StatusOK, []TopicStatus{})),
+	},
+	{
+		Method: http.MethodPut, Path: "/auth/consumers/{topic}", OperationId: "resizeConsumers", Tag: "admin",
+		Summary:   "Changes how many consumers run on a topic until the process restarts.",
+		Params:    []Param{pathParam("topic", "string", "")},
+		Body:      ResizeConsumersRequest{},
+		Responses: responses(reply(http.StatusOK, Success{}), http.StatusBadRequest, http.StatusNotFound),
+	},
+}
@@ -0,0 +1,176 @@
+package authors
+
+import (
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/twitter"
+	twitterscraper "github.com/n0madic/twitter-scraper"
+)
+
+const (
+	// How long a fetched profile is trusted before it is
+	// fetched again.
+	PROFILE_TTL = 7 * 24 * time.Hour
+	// Most profiles fetched per batch of statements. Authors
+	// beyond it are stored without a profile and fetched the
+	// next time they post.
+	MAX_FETCHES_PER_RECORD = 20
+	// Authors kept in memory before the cache starts over.
+	MAX_CACHED_AUTHORS = 10000
+	// Accounts younger than this count for less.
+	MATURE_ACCOUNT_AGE = 365 * 24 * time.Hour
+	// Influence of verified accounts is multiplied by this.
+	VERIFIED_BOOST = 1.5
+)
+
+// Returns how much weight an author's statements carry. It grows
+// with the logarithm of their followers, is scaled down for
+// accounts under a year old (to a tenth at most) and up for
+// verified ones, and is multiplied by the share of their stored
+// statements that were not spam. An author nothing is known about
+// scores 1, as does a year old account without followers.
+func Influence(a db.Author, now time.Time) float64 {
+	score := 1 + math.Log10(1+float64(a.Followers))
+	if a.Joined > 0 {
+		age := now.Sub(time.Unix(a.Joined, 0))
+		score *= math.Max(0.1, math.Min(1, float64(age)/float64(MATURE_ACCOUNT_AGE)))
+	}
+	if a.Verified {
+		score *= VERIFIED_BOOST
+	}
+	if a.Statements > 0 {
+		score *= 1 - float64(a.SpamStatements)/float64(a.Statements)
+	}
+	return score
+}
+
+// Defines the database operations the cache depends on.
+// Satisfied by db.DBManager.
+type Store interface {
+	ReturnAuthors(ids []string) (map[string]db.Author, error)
+	ReturnAuthorStatementCounts(ids []string) (map[string][2]int, error)
+	UpsertAuthors(authors []db.Author) error
+}
+
+// Keeps the authors table up to date as statements are stored,
+// fetching each author's profile at most once per PROFILE_TTL.
+// Profiles are looked up in memory, then in the table, and only
+// fetched from the source if neither has a fresh one.
+type Cache struct {
+	store Store
+	fetch func(username string) (twitterscraper.Profile, error)
+
+	mu      sync.Mutex
+	authors map[string]db.Author
+}
+
+// Creates a Cache that fetches profiles with fetch, such as
+// twitter.FetchProfile.
+func NewCache(store Store, fetch func(username string) (twitterscraper.Profile, error)) *Cache {
+	return &Cache{store: store, fetch: fetch, authors: make(map[string]db.Author)}
+}
+
+// Updates the authors of statements that have just been stored:
+// their profiles if stale, their statement and spam counts, and
+// their influence.
+func (c *Cache) Record(logger *slog.Logger, statements []twitter.Statement) error {
+	now := time.Now()
+	usernames := make(map[string]string)
+	var ids []string
+	for _, s := range statements {
+		id := s.User.UserID
+		if id == "" {
+			continue
+		}
+		if _, ok := usernames[id]; !ok {
+			ids = append(ids, id)
+		}
+		usernames[id] = s.User.Username
+		// Profiles scraped along with the statement are
+		// as fresh as they come.
+		if s.User.Joined != nil {
+			a, _ := c.get(id)
+			a.AuthorId = id
+			c.put(fromProfile(a, s.User, now))
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var missing []string
+	for _, id := range ids {
+		if _, ok := c.get(id); !ok {
+			missing = append(missing, id)
+		}
+	}
+	stored, err := c.store.ReturnAuthors(missing)
+	if err != nil {
+		return err
+	}
+	for _, a := range stored {
+		c.put(a)
+	}
+	counts, err := c.store.ReturnAuthorStatementCounts(ids)
+	if err != nil {
+		return err
+	}
+
+	var fetches int
+	authors := make([]db.Author, 0, len(ids))
+	for _, id := range ids {
+		a, _ := c.get(id)
+		a.AuthorId = id
+		if usernames[id] != "" {
+			a.Username = usernames[id]
+		}
+		if now.Sub(time.Unix(a.ProfileUpdatedAt, 0)) > PROFILE_TTL && fetches < MAX_FETCHES_PER_RECORD && a.Username != "" {
+			fetches++
+			profile, err := c.fetch(a.Username)
+			if err != nil {
+				logger.Warn("failed to fetch profile", "user", a.Username, "err", err)
+			} else {
+				a = fromProfile(a, profile, now)
+			}
+		}
+		a.Statements, a.SpamStatements = counts[id][0], counts[id][1]
+		a.Influence = Influence(a, now)
+		c.put(a)
+		authors = append(authors, a)
+	}
+	return c.store.UpsertAuthors(authors)
+}
+
+// Returns a with the details of profile.
+func fromProfile(a db.Author, profile twitterscraper.Profile, now time.Time) db.Author {
+	if profile.Username != "" {
+		a.Username = profile.Username
+	}
+	a.Followers = profile.FollowersCount
+	a.Verified = profile.IsVerified
+	if profile.Joined != nil {
+		a.Joined = profile.Joined.Unix()
+	}
+	a.ProfileUpdatedAt = now.Unix()
+	return a
+}
+
+func (c *Cache) get(id string) (db.Author, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	a, ok := c.authors[id]
+	return a, ok
+}
+
+func (c *Cache) put(a db.Author) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.authors[a.AuthorId]; !ok && len(c.authors) >= MAX_CACHED_AUTHORS {
+		c.authors = make(map[string]db.Author)
+	}
+	c.authors[a.AuthorId] = a
+}
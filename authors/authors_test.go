@@ -0,0 +1,120 @@
+package authors
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/logging"
+	"github.com/jonreesman/watch-dog-kafka/twitter"
+	twitterscraper "github.com/n0madic/twitter-scraper"
+)
+
+func TestInfluence(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	old := now.Add(-2 * MATURE_ACCOUNT_AGE).Unix()
+	cases := []struct {
+		name   string
+		author db.Author
+		want   float64
+	}{
+		{"unknown", db.Author{}, 1},
+		{"popular", db.Author{Followers: 9999, Joined: old}, 5},
+		{"verified", db.Author{Followers: 9, Joined: old, Verified: true}, 3},
+		{"half year old", db.Author{Followers: 9, Joined: now.Add(-MATURE_ACCOUNT_AGE / 2).Unix()}, 1},
+		{"brand new", db.Author{Followers: 9, Joined: now.Unix()}, 0.2},
+		{"spammer", db.Author{Followers: 9999, Joined: old, Statements: 10, SpamStatements: 8}, 1},
+		{"only spam", db.Author{Followers: 9999, Statements: 3, SpamStatements: 3}, 0},
+	}
+	for _, c := range cases {
+		if got := Influence(c.author, now); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("%s: Influence() = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+type fakeStore struct {
+	authors map[string]db.Author
+	counts  map[string][2]int
+	reads   int
+}
+
+func (f *fakeStore) ReturnAuthors(ids []string) (map[string]db.Author, error) {
+	f.reads += len(ids)
+	found := make(map[string]db.Author)
+	for _, id := range ids {
+		if a, ok := f.authors[id]; ok {
+			found[id] = a
+		}
+	}
+	return found, nil
+}
+
+func (f *fakeStore) ReturnAuthorStatementCounts(ids []string) (map[string][2]int, error) {
+	return f.counts, nil
+}
+
+func (f *fakeStore) UpsertAuthors(authors []db.Author) error {
+	for _, a := range authors {
+		f.authors[a.AuthorId] = a
+	}
+	return nil
+}
+
+func TestCacheRecord(t *testing.T) {
+	joined := time.Now().Add(-2 * MATURE_ACCOUNT_AGE)
+	store := &fakeStore{
+		authors: map[string]db.Author{
+			// Fetched recently, so not fetched again.
+			"2": {AuthorId: "2", Username: "fresh", Followers: 99, ProfileUpdatedAt: time.Now().Unix()},
+		},
+		counts: map[string][2]int{"1": {4, 1}, "2": {1, 0}},
+	}
+	var fetched []string
+	cache := NewCache(store, func(username string) (twitterscraper.Profile, error) {
+		fetched = append(fetched, username)
+		if username == "gone" {
+			return twitterscraper.Profile{}, errors.New("not found")
+		}
+		return twitterscraper.Profile{UserID: "1", Username: username, FollowersCount: 9999, Joined: &joined}, nil
+	})
+	statements := []twitter.Statement{
+		{ID: 1, User: twitterscraper.Profile{UserID: "1", Username: "trader"}},
+		{ID: 2, User: twitterscraper.Profile{UserID: "1", Username: "trader"}},
+		{ID: 3, User: twitterscraper.Profile{UserID: "2", Username: "fresh"}},
+		{ID: 4, User: twitterscraper.Profile{UserID: "3", Username: "gone"}},
+		{ID: 5},
+	}
+	if err := cache.Record(logging.Discard(), statements); err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != 2 || fetched[0] != "trader" || fetched[1] != "gone" {
+		t.Errorf("fetched %v, want trader and gone", fetched)
+	}
+	trader := store.authors["1"]
+	if trader.Followers != 9999 || trader.Statements != 4 || trader.SpamStatements != 1 {
+		t.Errorf("got %+v", trader)
+	}
+	if math.Abs(trader.Influence-3.75) > 1e-9 {
+		t.Errorf("trader influence %v, want 3.75", trader.Influence)
+	}
+	if a := store.authors["2"]; a.Followers != 99 || a.Statements != 1 {
+		t.Errorf("got %+v", a)
+	}
+	// An author whose profile could not be fetched is still
+	// stored, and retried next time.
+	if a, ok := store.authors["3"]; !ok || a.Username != "gone" || a.ProfileUpdatedAt != 0 {
+		t.Errorf("got %+v", a)
+	}
+
+	// The next batch is served from memory.
+	fetched, store.reads = nil, 0
+	if err := cache.Record(logging.Discard(), statements[:3]); err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != 0 || store.reads != 0 {
+		t.Errorf("fetched %v and read %d authors, want neither", fetched, store.reads)
+	}
+}
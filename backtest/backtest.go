@@ -0,0 +1,288 @@
+package backtest
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+)
+
+// Positions a rule can ask for.
+const (
+	SHORT = -1
+	FLAT  = 0
+	LONG  = 1
+)
+
+// Used to annualise the Sharpe ratio.
+const YEAR = 365 * 24 * time.Hour
+
+// Decides which position to hold given the sentiment known so
+// far, oldest first, and the position currently held.
+type Rule interface {
+	Position(sentiments []float64, current int) int
+}
+
+// Goes long once sentiment reaches Long and leaves once it falls
+// to Short, going short instead if AllowShort is set. In between,
+// the current position is kept.
+type Threshold struct {
+	Long       float64
+	Short      float64
+	AllowShort bool
+}
+
+func (r Threshold) Position(sentiments []float64, current int) int {
+	s := sentiments[len(sentiments)-1]
+	switch {
+	case s >= r.Long:
+		return LONG
+	case s <= r.Short && r.AllowShort:
+		return SHORT
+	case s <= r.Short:
+		return FLAT
+	}
+	return current
+}
+
+// Goes long while the moving average of the last Fast buckets of
+// sentiment is above that of the last Slow buckets, and leaves, or
+// goes short if AllowShort is set, while it is below. Nothing is
+// done until Slow buckets are known.
+type Crossover struct {
+	Fast       int
+	Slow       int
+	AllowShort bool
+}
+
+func (r Crossover) Position(sentiments []float64, current int) int {
+	if len(sentiments) < r.Slow {
+		return current
+	}
+	fast, slow := mean(sentiments[len(sentiments)-r.Fast:]), mean(sentiments[len(sentiments)-r.Slow:])
+	switch {
+	case fast > slow:
+		return LONG
+	case fast < slow && r.AllowShort:
+		return SHORT
+	case fast < slow:
+		return FLAT
+	}
+	return current
+}
+
+// Returns an error if the moving averages are not usable.
+func (r Crossover) Validate() error {
+	if r.Fast < 1 || r.Slow <= r.Fast {
+		return errors.New("crossover needs 0 < fast < slow")
+	}
+	return nil
+}
+
+// Describes a simulation.
+type Config struct {
+	Rule Rule
+	// Charged on the value traded at every change of
+	// position, as a fraction: 0.001 is 10 basis points.
+	// Reversing a position trades twice its value.
+	Fee float64
+	// The size of the sentiment buckets, in seconds. A
+	// bucket's sentiment is only known once it has ended.
+	BucketSeconds int
+}
+
+// The state of a simulation at one quote.
+type EquityPoint struct {
+	TimeStamp int64   `json:"time_stamp"`
+	Price     float64 `json:"price"`
+	// The latest sentiment known at the time, or 0 if none.
+	Sentiment float64 `json:"sentiment"`
+	// The position held from this quote to the next.
+	Position int `json:"position"`
+	// The value of the account, starting at 1, after fees.
+	Equity float64 `json:"equity"`
+}
+
+// The outcome of a simulation.
+type Result struct {
+	Ticker string `json:"ticker"`
+	// Total return, as a fraction, after fees.
+	Return float64 `json:"return"`
+	// Return of holding the ticker throughout.
+	BuyAndHold float64 `json:"buy_and_hold"`
+	// Annualised, from the returns between quotes with a
+	// risk free rate of 0.
+	Sharpe float64 `json:"sharpe"`
+	// Largest fall from a peak of equity, as a fraction.
+	MaxDrawdown float64 `json:"max_drawdown"`
+	// Closed positions, and the share of them that made money
+	// after fees.
+	Trades  int           `json:"trades"`
+	HitRate float64       `json:"hit_rate"`
+	Equity  []EquityPoint `json:"equity"`
+}
+
+// Simulates trading a ticker on its quotes by following cfg.Rule
+// over its sentiments. At every quote, the rule is given the
+// sentiment of every bucket that ended by then, and the position
+// it asks for is taken at that quote's price. Whatever is held is
+// closed at the last quote.
+func Run(ticker string, sentiments, quotes []db.IntervalQuote, cfg Config) Result {
+	quotes, sentiments = sorted(quotes), sorted(sentiments)
+	result := Result{Ticker: ticker, Equity: make([]EquityPoint, 0, len(quotes))}
+	var (
+		known    []float64
+		next     int
+		position = FLAT
+		equity   = 1.0
+		trade    float64
+		wins     int
+	)
+	for i, q := range quotes {
+		for next < len(sentiments) && sentiments[next].TimeStamp+int64(cfg.BucketSeconds) <= q.TimeStamp {
+			known = append(known, sentiments[next].CurrentPrice)
+			next++
+		}
+		if i > 0 && quotes[i-1].CurrentPrice > 0 {
+			growth := 1 + float64(position)*(q.CurrentPrice/quotes[i-1].CurrentPrice-1)
+			equity *= growth
+			trade *= growth
+		}
+
+		target := position
+		if i == len(quotes)-1 {
+			target = FLAT
+		} else if len(known) > 0 {
+			target = cfg.Rule.Position(known, position)
+		}
+		if target != position {
+			if position != FLAT {
+				equity *= 1 - cfg.Fee
+				trade *= 1 - cfg.Fee
+				result.Trades++
+				if trade > 1 {
+					wins++
+				}
+			}
+			if target != FLAT {
+				equity *= 1 - cfg.Fee
+				trade = 1 - cfg.Fee
+			}
+			position = target
+		}
+
+		p := EquityPoint{TimeStamp: q.TimeStamp, Price: q.CurrentPrice, Position: position, Equity: equity}
+		if len(known) > 0 {
+			p.Sentiment = known[len(known)-1]
+		}
+		result.Equity = append(result.Equity, p)
+	}
+
+	if len(quotes) > 1 && quotes[0].CurrentPrice > 0 {
+		result.BuyAndHold = quotes[len(quotes)-1].CurrentPrice/quotes[0].CurrentPrice - 1
+	}
+	if result.Trades > 0 {
+		result.HitRate = float64(wins) / float64(result.Trades)
+	}
+	result.Return, result.Sharpe, result.MaxDrawdown = summarize(result.Equity)
+	return result
+}
+
+// Combines the results of several tickers into that of a portfolio
+// splitting its equity evenly between those quoted at each time,
+// rebalanced at every quote. Its points carry no price, sentiment
+// or position.
+func Combine(ticker string, results []Result) Result {
+	combined := Result{Ticker: ticker}
+	returns := make(map[int64][]float64)
+	var wins float64
+	for _, r := range results {
+		for i := 1; i < len(r.Equity); i++ {
+			ts := r.Equity[i].TimeStamp
+			returns[ts] = append(returns[ts], r.Equity[i].Equity/r.Equity[i-1].Equity-1)
+		}
+		combined.BuyAndHold += r.BuyAndHold / float64(len(results))
+		combined.Trades += r.Trades
+		wins += r.HitRate * float64(r.Trades)
+	}
+	if combined.Trades > 0 {
+		combined.HitRate = wins / float64(combined.Trades)
+	}
+
+	var stamps []int64
+	for ts := range returns {
+		stamps = append(stamps, ts)
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i] < stamps[j] })
+	// The curve starts at 1 with the first quote of any ticker.
+	start := int64(math.MaxInt64)
+	for _, r := range results {
+		if len(r.Equity) > 0 {
+			start = min(start, r.Equity[0].TimeStamp)
+		}
+	}
+	if len(stamps) > 0 {
+		combined.Equity = append(combined.Equity, EquityPoint{TimeStamp: start, Equity: 1})
+	}
+	equity := 1.0
+	for _, ts := range stamps {
+		equity *= 1 + mean(returns[ts])
+		combined.Equity = append(combined.Equity, EquityPoint{TimeStamp: ts, Equity: equity})
+	}
+	combined.Return, combined.Sharpe, combined.MaxDrawdown = summarize(combined.Equity)
+	return combined
+}
+
+// Returns the total return, annualised Sharpe ratio and maximum
+// drawdown of an equity curve starting at 1.
+func summarize(points []EquityPoint) (total, sharpe, drawdown float64) {
+	if len(points) == 0 {
+		return 0, 0, 0
+	}
+	total = points[len(points)-1].Equity - 1
+
+	peak, previous := 1.0, 1.0
+	returns := make([]float64, 0, len(points))
+	for i, p := range points {
+		if i > 0 {
+			returns = append(returns, p.Equity/previous-1)
+		}
+		previous = p.Equity
+		peak = math.Max(peak, p.Equity)
+		drawdown = math.Max(drawdown, 1-p.Equity/peak)
+	}
+
+	// Quotes are hourly while a market is open, so the number
+	// per year is taken from the data rather than assumed.
+	span := time.Duration(points[len(points)-1].TimeStamp-points[0].TimeStamp) * time.Second
+	if len(returns) < 2 || span <= 0 {
+		return total, 0, drawdown
+	}
+	m := mean(returns)
+	var variance float64
+	for _, r := range returns {
+		variance += (r - m) * (r - m)
+	}
+	std := math.Sqrt(variance / float64(len(returns)-1))
+	if std == 0 {
+		return total, 0, drawdown
+	}
+	perYear := float64(len(returns)) / (float64(span) / float64(YEAR))
+	return total, m / std * math.Sqrt(perYear), drawdown
+}
+
+func sorted(quotes []db.IntervalQuote) []db.IntervalQuote {
+	s := append([]db.IntervalQuote(nil), quotes...)
+	sort.Slice(s, func(i, j int) bool { return s[i].TimeStamp < s[j].TimeStamp })
+	return s
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
@@ -0,0 +1,133 @@
+package backtest
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math"
+	"testing"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+)
+
+// Hourly quotes that rise 21% and fall back.
+var quotes = []db.IntervalQuote{
+	{TimeStamp: 5 * 3600, CurrentPrice: 100},
+	{TimeStamp: 1 * 3600, CurrentPrice: 100},
+	{TimeStamp: 2 * 3600, CurrentPrice: 110},
+	{TimeStamp: 3 * 3600, CurrentPrice: 121},
+	{TimeStamp: 4 * 3600, CurrentPrice: 110},
+}
+
+func buckets(values ...float64) []db.IntervalQuote {
+	var s []db.IntervalQuote
+	for i, v := range values {
+		s = append(s, db.IntervalQuote{TimeStamp: int64(i) * 3600, CurrentPrice: v})
+	}
+	return s
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestRunThreshold(t *testing.T) {
+	// Bullish in the first hour, bearish in the third, each
+	// known once its hour has ended.
+	sentiments := buckets(0.8, 0.1, -0.8, 0)
+	rule := Threshold{Long: 0.5, Short: -0.5}
+
+	r := Run("AMD", sentiments, quotes, Config{Rule: rule, BucketSeconds: 3600})
+	if !near(r.Return, 0.21) || r.Trades != 1 || r.HitRate != 1 || r.MaxDrawdown != 0 || r.BuyAndHold != 0 {
+		t.Errorf("got %+v", r)
+	}
+	var positions []int
+	for _, p := range r.Equity {
+		positions = append(positions, p.Position)
+	}
+	if want := []int{LONG, LONG, FLAT, FLAT, FLAT}; !equal(positions, want) {
+		t.Errorf("positions %v, want %v", positions, want)
+	}
+	if r.Equity[2].Sentiment != -0.8 {
+		t.Errorf("sentiment at the third quote %v, want -0.8", r.Equity[2].Sentiment)
+	}
+
+	r = Run("AMD", sentiments, quotes, Config{Rule: rule, Fee: 0.01, BucketSeconds: 3600})
+	if !near(r.Return, 0.99*1.21*0.99-1) {
+		t.Errorf("return with fees %v", r.Return)
+	}
+
+	rule.AllowShort = true
+	r = Run("AMD", sentiments, quotes, Config{Rule: rule, BucketSeconds: 3600})
+	if !near(r.Return, 1.21*(1+11.0/121)*(1+10.0/110)-1) || r.Trades != 2 || r.HitRate != 1 {
+		t.Errorf("got %+v", r)
+	}
+}
+
+func TestRunDrawdown(t *testing.T) {
+	r := Run("AMD", buckets(0.8, 0.8, 0.8, 0.8), quotes, Config{Rule: Threshold{Long: 0.5, Short: -0.5}, BucketSeconds: 3600})
+	if !near(r.Return, 0) || !near(r.MaxDrawdown, 1-1/1.21) || r.Trades != 1 || r.HitRate != 0 {
+		t.Errorf("got %+v", r)
+	}
+	if r.Sharpe == 0 {
+		t.Error("expected a Sharpe ratio")
+	}
+}
+
+func TestCrossover(t *testing.T) {
+	rule := Crossover{Fast: 1, Slow: 2, AllowShort: true}
+	if err := rule.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got := rule.Position([]float64{0.5}, FLAT); got != FLAT {
+		t.Errorf("before slow buckets: %d", got)
+	}
+	if got := rule.Position([]float64{0, 0.5}, FLAT); got != LONG {
+		t.Errorf("rising: %d", got)
+	}
+	if got := rule.Position([]float64{0.5, 0}, LONG); got != SHORT {
+		t.Errorf("falling: %d", got)
+	}
+	if got := rule.Position([]float64{0.5, 0.5}, LONG); got != LONG {
+		t.Errorf("flat: %d", got)
+	}
+	if (Crossover{Fast: 3, Slow: 3}).Validate() == nil {
+		t.Error("expected equal averages to be rejected")
+	}
+}
+
+func TestCombine(t *testing.T) {
+	cfg := Config{Rule: Threshold{Long: 0.5, Short: -0.5}, BucketSeconds: 3600}
+	a := Run("AMD", buckets(0.8, 0.1, -0.8, 0), quotes, cfg)
+	flat := Run("GME", buckets(0, 0, 0, 0), quotes, cfg)
+	r := Combine("portfolio", []Result{a, flat})
+	if !near(r.Return, 1.05*1.05-1) || r.Trades != 1 || r.HitRate != 1 || len(r.Equity) != 5 {
+		t.Errorf("got %+v", r)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	r := Run("AMD", buckets(0.8), quotes, Config{Rule: Threshold{Long: 0.5, Short: -0.5}, BucketSeconds: 3600})
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, []Result{r}); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 6 || rows[1][0] != "AMD" || rows[1][1] != "3600" || rows[2][5] != "1.1" {
+		t.Errorf("got %v", rows)
+	}
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
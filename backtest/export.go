@@ -0,0 +1,36 @@
+package backtest
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// Writes the equity curves of results as CSV, one row per ticker
+// and quote.
+func WriteCSV(w io.Writer, results []Result) error {
+	out := csv.NewWriter(w)
+	out.Write([]string{"ticker", "time_stamp", "price", "sentiment", "position", "equity"})
+	for _, r := range results {
+		for _, p := range r.Equity {
+			out.Write([]string{
+				r.Ticker,
+				strconv.FormatInt(p.TimeStamp, 10),
+				strconv.FormatFloat(p.Price, 'f', -1, 64),
+				strconv.FormatFloat(p.Sentiment, 'f', -1, 64),
+				strconv.Itoa(p.Position),
+				strconv.FormatFloat(p.Equity, 'f', -1, 64),
+			})
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// Writes results, with their equity curves, as a JSON array.
+func WriteJSON(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
@@ -0,0 +1,375 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/jonreesman/watch-dog-kafka/api"
+)
+
+// Calls the REST API, with a method for every operation in
+// api.ROUTES but /metrics, named after its operationId.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// Returned when the server responds with a status other than
+// the operation's success.
+type Error struct {
+	StatusCode int
+	// The body's error, or the status text without one.
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.StatusCode, e.Message)
+}
+
+// Creates a client for the API served at baseURL, such as
+// http://localhost:8080. A nil httpClient uses http.DefaultClient.
+func New(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), http: httpClient}
+}
+
+// Sends a request and returns the response if its status is one of
+// ok, or an *Error otherwise. The caller closes the body.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, in interface{}, ok ...int) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	defer resp.Body.Close()
+	var e api.Error
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+		e.Error = http.StatusText(resp.StatusCode)
+	}
+	return nil, &Error{StatusCode: resp.StatusCode, Message: e.Error}
+}
+
+// Sends a request expecting 200 OK and decodes its body into out.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	resp, err := c.send(ctx, method, path, query, in, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, out interface{}) error {
+	return c.do(ctx, http.MethodGet, path, query, nil, out)
+}
+
+// Adds name=n to query unless n is 0, which leaves the server's
+// default.
+func setInt(query url.Values, name string, n int) {
+	if n != 0 {
+		query.Set(name, strconv.Itoa(n))
+	}
+}
+
+func setFloat(query url.Values, name string, f *float64) {
+	if f != nil {
+		query.Set(name, strconv.FormatFloat(*f, 'g', -1, 64))
+	}
+}
+
+func tickerPath(id int, rest string) string {
+	return "/api/tickers/" + strconv.Itoa(id) + rest
+}
+
+func (c *Client) Healthz(ctx context.Context) (api.Health, error) {
+	var out api.Health
+	err := c.get(ctx, "/healthz", nil, &out)
+	return out, err
+}
+
+// Returns the readiness report, which is also returned along with
+// an *Error when the server is not ready.
+func (c *Client) Readyz(ctx context.Context) (api.Readiness, error) {
+	var out api.Readiness
+	resp, err := c.send(ctx, http.MethodGet, "/readyz", nil, nil, http.StatusOK, http.StatusServiceUnavailable)
+	if err != nil {
+		return out, err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return out, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return out, &Error{StatusCode: resp.StatusCode, Message: "not ready"}
+	}
+	return out, nil
+}
+
+func (c *Client) Ping(ctx context.Context) (api.Ping, error) {
+	var out api.Ping
+	err := c.get(ctx, "/api/", nil, &out)
+	return out, err
+}
+
+// Returns the server's OpenAPI document.
+func (c *Client) OpenAPI(ctx context.Context) (map[string]interface{}, error) {
+	var out map[string]interface{}
+	err := c.get(ctx, "/api/openapi.json", nil, &out)
+	return out, err
+}
+
+func (c *Client) Status(ctx context.Context) (api.Status, error) {
+	var out api.Status
+	err := c.get(ctx, "/api/status", nil, &out)
+	return out, err
+}
+
+// Returns the active tickers with their current price.
+func (c *Client) Tickers(ctx context.Context) ([]api.TickerSummary, error) {
+	var out []api.TickerSummary
+	err := c.get(ctx, "/api/tickers", nil, &out)
+	return out, err
+}
+
+// Options of TickerHistory. Zero values leave the server's default.
+type TickerHistoryOptions struct {
+	// 15m for quarter hour sentiment buckets.
+	Bucket string
+	// influence to weight statements by their author's influence.
+	Weighting string
+}
+
+// Returns a ticker's quotes, sentiment and statements over interval:
+// day, week, month or 2month.
+func (c *Client) TickerHistory(ctx context.Context, id int, interval string, opts TickerHistoryOptions) (api.TickerHistory, error) {
+	query := url.Values{}
+	if opts.Bucket != "" {
+		query.Set("bucket", opts.Bucket)
+	}
+	if opts.Weighting != "" {
+		query.Set("weighting", opts.Weighting)
+	}
+	var out api.TickerHistory
+	err := c.get(ctx, tickerPath(id, "/time/"+url.PathEscape(interval)), query, &out)
+	return out, err
+}
+
+func (c *Client) TickerMetadata(ctx context.Context, id int) (api.TickerMetadataResponse, error) {
+	var out api.TickerMetadataResponse
+	err := c.get(ctx, tickerPath(id, "/metadata"), nil, &out)
+	return out, err
+}
+
+// Options of RelatedTickers. Zero values leave the server's default.
+type RelatedOptions struct {
+	WindowHours int
+	Limit       int
+	MinWeight   *float64
+}
+
+// Returns the tickers mentioned together with a ticker and its
+// cluster.
+func (c *Client) RelatedTickers(ctx context.Context, id int, opts RelatedOptions) (api.RelatedTickers, error) {
+	var out api.RelatedTickers
+	err := c.get(ctx, tickerPath(id, "/related"), opts.query(), &out)
+	return out, err
+}
+
+// Returns the graph around a ticker.
+func (c *Client) RelatedGraph(ctx context.Context, id int, opts RelatedOptions) (api.Graph, error) {
+	query := opts.query()
+	query.Set("format", "json")
+	var out api.Graph
+	err := c.get(ctx, tickerPath(id, "/related"), query, &out)
+	return out, err
+}
+
+func (opts RelatedOptions) query() url.Values {
+	query := url.Values{}
+	setInt(query, "window", opts.WindowHours)
+	setInt(query, "limit", opts.Limit)
+	setFloat(query, "min_weight", opts.MinWeight)
+	return query
+}
+
+// Returns the authors who weighed most on a ticker's sentiment over
+// the last windowHours. Zeros leave the server's defaults.
+func (c *Client) TopAuthors(ctx context.Context, id, windowHours, limit int) (api.TopAuthors, error) {
+	query := url.Values{}
+	setInt(query, "window", windowHours)
+	setInt(query, "limit", limit)
+	var out api.TopAuthors
+	err := c.get(ctx, tickerPath(id, "/top-authors"), query, &out)
+	return out, err
+}
+
+// Options of Trending. Zero values leave the server's default.
+type TrendingOptions struct {
+	WindowHours int
+	Limit       int
+	MinMentions int
+}
+
+func (c *Client) Trending(ctx context.Context, opts TrendingOptions) (api.Trending, error) {
+	query := url.Values{}
+	setInt(query, "window", opts.WindowHours)
+	setInt(query, "limit", opts.Limit)
+	setInt(query, "min_mentions", opts.MinMentions)
+	var out api.Trending
+	err := c.get(ctx, "/api/trending", query, &out)
+	return out, err
+}
+
+// Options of Export. Zero values leave the server's default.
+type ExportOptions struct {
+	Tickers []string
+	// RFC 3339, YYYY-MM-DD or unix seconds.
+	From, To string
+	// csv, ndjson or parquet.
+	Format string
+}
+
+// Streams a dataset, statements, sentiments or quotes, as a file.
+// The caller closes it.
+func (c *Client) Export(ctx context.Context, dataset string, opts ExportOptions) (io.ReadCloser, error) {
+	query := url.Values{}
+	if len(opts.Tickers) > 0 {
+		query.Set("tickers", strings.Join(opts.Tickers, ","))
+	}
+	for name, v := range map[string]string{"from": opts.From, "to": opts.To, "format": opts.Format} {
+		if v != "" {
+			query.Set(name, v)
+		}
+	}
+	resp, err := c.send(ctx, http.MethodGet, "/api/export/"+url.PathEscape(dataset), query, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// A statement search. Zero values leave a filter out.
+type SearchOptions struct {
+	Query   string
+	Tickers []string
+	Source  string
+	// RFC 3339, YYYY-MM-DD or unix seconds.
+	From, To      string
+	MinPolarity   *float64
+	MaxPolarity   *float64
+	Spam          *bool
+	MinEngagement int
+	Limit         int
+	// The previous page's NextCursor.
+	Cursor string
+}
+
+func (c *Client) SearchStatements(ctx context.Context, opts SearchOptions) (api.SearchResponse, error) {
+	query := url.Values{}
+	for name, v := range map[string]string{"q": opts.Query, "source": opts.Source, "from": opts.From, "to": opts.To, "cursor": opts.Cursor} {
+		if v != "" {
+			query.Set(name, v)
+		}
+	}
+	if len(opts.Tickers) > 0 {
+		query.Set("tickers", strings.Join(opts.Tickers, ","))
+	}
+	setFloat(query, "min_polarity", opts.MinPolarity)
+	setFloat(query, "max_polarity", opts.MaxPolarity)
+	if opts.Spam != nil {
+		query.Set("spam", strconv.FormatBool(*opts.Spam))
+	}
+	setInt(query, "min_engagement", opts.MinEngagement)
+	setInt(query, "limit", opts.Limit)
+	var out api.SearchResponse
+	err := c.get(ctx, "/api/statements/search", query, &out)
+	return out, err
+}
+
+// Queues a ticker to be added and scraped.
+func (c *Client) AddTicker(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodPost, "/auth/tickers/", nil, api.NewTickerRequest{Name: name}, &api.Success{})
+}
+
+// Queues a ticker to be deactivated.
+func (c *Client) DeactivateTicker(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, "/auth/tickers/"+strconv.Itoa(id), nil, nil, &api.Success{})
+}
+
+func (c *Client) UpdateSchedule(ctx context.Context, id int, schedule api.ScheduleRequest) error {
+	return c.do(ctx, http.MethodPut, "/auth/tickers/"+strconv.Itoa(id)+"/schedule", nil, schedule, &api.Success{})
+}
+
+func (c *Client) UpdateTickerMetadata(ctx context.Context, id int, metadata api.TickerMetadataRequest) error {
+	return c.do(ctx, http.MethodPut, "/auth/tickers/"+strconv.Itoa(id)+"/metadata", nil, metadata, &api.Success{})
+}
+
+func (c *Client) AlertRules(ctx context.Context) ([]api.AlertRule, error) {
+	var out []api.AlertRule
+	err := c.get(ctx, "/auth/alerts", nil, &out)
+	return out, err
+}
+
+// Creates an alert rule and returns its id.
+func (c *Client) AddAlertRule(ctx context.Context, rule api.AlertRuleRequest) (int, error) {
+	resp, err := c.send(ctx, http.MethodPost, "/auth/alerts", nil, rule, http.StatusCreated)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var out api.Created
+	err = json.NewDecoder(resp.Body).Decode(&out)
+	return out.Id, err
+}
+
+func (c *Client) UpdateAlertRule(ctx context.Context, id int, rule api.AlertRuleRequest) error {
+	return c.do(ctx, http.MethodPut, "/auth/alerts/"+strconv.Itoa(id), nil, rule, &api.Success{})
+}
+
+func (c *Client) DeleteAlertRule(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, "/auth/alerts/"+strconv.Itoa(id), nil, nil, &api.Success{})
+}
+
+// Returns the consumer workers of every topic.
+func (c *Client) Consumers(ctx context.Context) ([]api.TopicStatus, error) {
+	var out []api.TopicStatus
+	err := c.get(ctx, "/auth/consumers", nil, &out)
+	return out, err
+}
+
+// Changes how many consumers run on a topic.
+func (c *Client) ResizeConsumers(ctx context.Context, topic string, workers int) error {
+	return c.do(ctx, http.MethodPut, "/auth/consumers/"+url.PathEscape(topic), nil, api.ResizeConsumersRequest{Workers: &workers}, &api.Success{})
+}
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jonreesman/watch-dog-kafka/api"
+)
+
+func TestEveryOperationHasAMethod(t *testing.T) {
+	client := reflect.TypeOf(&Client{})
+	for _, r := range api.ROUTES {
+		if r.Path == "/metrics" {
+			continue
+		}
+		name := strings.ToUpper(r.OperationId[:1]) + r.OperationId[1:]
+		if _, ok := client.MethodByName(name); !ok {
+			t.Errorf("no method %s for %s %s", name, r.Method, r.Path)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	var (
+		method, uri string
+		body        map[string]interface{}
+	)
+	mux := http.NewServeMux()
+	handle := func(path string, status int, response string) {
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			method, uri, body = r.Method, r.URL.RequestURI(), nil
+			json.NewDecoder(r.Body).Decode(&body)
+			w.WriteHeader(status)
+			io.WriteString(w, response)
+		})
+	}
+	handle("/api/tickers/7/related", http.StatusOK, `{"ticker":"AMD","window_hours":48,"neighbors":[{"ticker_id":8,"name":"NVDA","mentions":3,"weight":0.5}],"cluster":[]}`)
+	handle("/api/statements/search", http.StatusOK, `{"results":[{"tweet_id":"1600000000000000001","tickers":["AMD"]}],"next_cursor":"abc"}`)
+	handle("/auth/alerts", http.StatusCreated, `{"id":12}`)
+	handle("/auth/consumers/add", http.StatusNotFound, `{"error":"unknown topic"}`)
+	handle("/readyz", http.StatusServiceUnavailable, `{"ready":false,"checks":[{"name":"db","ok":false,"error":"down","latency":"1ms"}]}`)
+	handle("/api/export/quotes", http.StatusOK, "ticker,ticker_id,time_stamp,price\n")
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := New(server.URL+"/", nil)
+	ctx := context.Background()
+
+	minWeight := 0.0
+	related, err := c.RelatedTickers(ctx, 7, RelatedOptions{WindowHours: 48, MinWeight: &minWeight})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri != "/api/tickers/7/related?min_weight=0&window=48" {
+		t.Errorf("requested %s", uri)
+	}
+	if related.Neighbors[0] != (api.Neighbor{Id: 8, Name: "NVDA", Mentions: 3, Weight: 0.5}) || related.Cluster == nil {
+		t.Errorf("got %+v", related)
+	}
+
+	spam := false
+	results, err := c.SearchStatements(ctx, SearchOptions{Query: `"beat estimates"`, Tickers: []string{"AMD", "GME"}, Spam: &spam, Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri != "/api/statements/search?limit=5&q=%22beat+estimates%22&spam=false&tickers=AMD%2CGME" {
+		t.Errorf("requested %s", uri)
+	}
+	if results.Results[0].TweetId != 1600000000000000001 || results.NextCursor != "abc" {
+		t.Errorf("got %+v", results)
+	}
+
+	id, err := c.AddAlertRule(ctx, api.AlertRuleRequest{TickerId: 7, Kind: "sentiment_above", WebhookURL: "https://example.com"})
+	if err != nil || id != 12 {
+		t.Errorf("got %d, %v", id, err)
+	}
+	if method != http.MethodPost || body["ticker_id"] != 7.0 || body["webhook_url"] != "https://example.com" {
+		t.Errorf("sent %s %v", method, body)
+	}
+
+	err = c.ResizeConsumers(ctx, "add", 3)
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusNotFound || e.Message != "unknown topic" {
+		t.Errorf("got %v", err)
+	}
+	if method != http.MethodPut || body["workers"] != 3.0 {
+		t.Errorf("sent %s %v", method, body)
+	}
+
+	ready, err := c.Readyz(ctx)
+	if !errors.As(err, &e) || e.StatusCode != http.StatusServiceUnavailable || len(ready.Checks) != 1 || ready.Checks[0].Error != "down" {
+		t.Errorf("got %+v, %v", ready, err)
+	}
+
+	file, err := c.Export(ctx, "quotes", ExportOptions{Tickers: []string{"AMD"}, From: "2024-01-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if b, _ := io.ReadAll(file); !strings.HasPrefix(string(b), "ticker,") || uri != "/api/export/quotes?from=2024-01-01&tickers=AMD" {
+		t.Errorf("got %q from %s", b, uri)
+	}
+
+	// Anything unrouted is a 404 with a plain text body.
+	if _, err := c.Tickers(ctx); !errors.As(err, &e) || e.StatusCode != http.StatusNotFound || e.Message != "Not Found" {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/api"
+	"github.com/jonreesman/watch-dog-kafka/backtest"
+	"github.com/jonreesman/watch-dog-kafka/config"
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/export"
+	"github.com/jonreesman/watch-dog-kafka/kafka"
+	"github.com/jonreesman/watch-dog-kafka/logging"
+	"github.com/jonreesman/watch-dog-kafka/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Dispatches `watchdog <command> [flags]` invocations.
+func runCommand(name string, args []string) error {
+	switch name {
+	case "backfill":
+		return backfillCommand(args)
+	case "backtest":
+		return backtestCommand(args)
+	case "config":
+		return configCommand(args)
+	case "export":
+		return exportCommand(args)
+	case "openapi":
+		return openapiCommand(args)
+	case "topics":
+		return topicsCommand(args)
+	}
+	return fmt.Errorf("unknown command %q", name)
+}
+
+// Parses a command's flags, which include the config flags,
+// and returns the validated config and a logger built from it.
+func loadConfig(fs *flag.FlagSet, args []string) (config.Config, *slog.Logger, error) {
+	loader := config.Bind(fs)
+	fs.Parse(args)
+	cfg, err := loader.Load()
+	if err != nil {
+		return config.Config{}, nil, err
+	}
+	logger, err := logging.New(os.Stderr, cfg.Logging.Level, cfg.Logging.Format)
+	return cfg, logger, err
+}
+
+// Prints the effective configuration, after the config file,
+// environment and flags are applied, with secrets masked.
+// Problems are reported after the config is printed.
+/*
+	Usage: watchdog config print [--config watchdog.yaml] [flags]
+*/
+func configCommand(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return errors.New("usage: watchdog config print [flags]")
+	}
+	fs := flag.NewFlagSet("config print", flag.ExitOnError)
+	loader := config.Bind(fs)
+	fs.Parse(args[1:])
+	cfg, err := loader.Resolve()
+	if err != nil {
+		return err
+	}
+	out, err := cfg.Redacted()
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(out)
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config:\n%w", err)
+	}
+	return nil
+}
+
+// Queues a backfill job for a ticker over a time range.
+// The job is processed by the consumers on the `backfill`
+// topic, so the service must be running.
+/*
+	Usage: watchdog backfill --ticker AMD [--from 2022-05-01] [--to 2022-05-03]
+	       watchdog backfill --resume
+*/
+func backfillCommand(args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	tickerName := fs.String("ticker", "", "ticker to backfill, must already be tracked")
+	from := fs.String("from", "", "start of the range (RFC3339, YYYY-MM-DD or unix seconds), defaults to a week before the oldest stored tweet")
+	to := fs.String("to", "", "end of the range, defaults to now")
+	resume := fs.Bool("resume", false, "republish unfinished jobs instead of creating one")
+	cfg, logger, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+
+	d, err := db.NewManager(logger, cfg.Database.User, cfg.Database.Password, cfg.Database.Name, cfg.Database.Primary)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	bus, err := newBus(cfg)
+	if err != nil {
+		return err
+	}
+	defer bus.Close()
+
+	if *resume {
+		kafka.ResumeBackfills(d, bus, logger)
+		return nil
+	}
+
+	if *tickerName == "" {
+		return errors.New("--ticker is required")
+	}
+	id, err := d.RetrieveTickerIDByName(*tickerName)
+	if err != nil {
+		return err
+	}
+	toTime := time.Now().Unix()
+	if *to != "" {
+		if toTime, err = kafka.ParseBackfillTime(*to); err != nil {
+			return fmt.Errorf("invalid --to: %w", err)
+		}
+	}
+	// Without --from, we extend the history backwards from
+	// the oldest tweet we already hold.
+	var fromTime int64
+	if *from != "" {
+		if fromTime, err = kafka.ParseBackfillTime(*from); err != nil {
+			return fmt.Errorf("invalid --from: %w", err)
+		}
+	} else {
+		oldest, err := d.RetrieveOldestTweetTimestamp(id)
+		if err != nil {
+			return fmt.Errorf("no --from given and no stored tweets to extend: %w", err)
+		}
+		if *to == "" {
+			toTime = oldest
+		}
+		fromTime = toTime - int64(kafka.NEW_TICKER_BACKFILL/time.Second)
+	}
+	jobId, err := kafka.RequestBackfill(context.Background(), d, bus, id, fromTime, toTime)
+	if err != nil {
+		return err
+	}
+	logger.Info("queued backfill job", "job_id", jobId, "ticker", *tickerName,
+		"from", time.Unix(fromTime, 0).UTC().Format(time.RFC3339), "to", time.Unix(toTime, 0).UTC().Format(time.RFC3339))
+	return nil
+}
+
+// Compares our Kafka topics with their configuration under
+// `kafka.topics`, or creates and updates them to match. describe
+// exits non-zero if any topic has drifted.
+/*
+	Usage: watchdog topics describe [flags]
+	       watchdog topics ensure [flags]
+*/
+func topicsCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "describe" && args[0] != "ensure") {
+		return errors.New("usage: watchdog topics describe|ensure [flags]")
+	}
+	fs := flag.NewFlagSet("topics "+args[0], flag.ExitOnError)
+	cfg, logger, err := loadConfig(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	specs := topicSpecs(cfg)
+
+	if args[0] == "ensure" {
+		return kafka.EnsureTopics(ctx, cfg.Kafka.Brokers, specs, logger)
+	}
+	states, err := kafka.DescribeTopics(ctx, cfg.Kafka.Brokers, specs)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TOPIC\tPARTITIONS\tREPLICATION\tRETENTION.MS\tCLEANUP\tDRIFT")
+	drifted := 0
+	for _, s := range states {
+		status := "ok"
+		if len(s.Drift) > 0 {
+			drifted++
+			status = strings.Join(s.Drift, "; ")
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\t%s\n", s.Spec.Name, s.Partitions, s.ReplicationFactor,
+			s.Configs["retention.ms"], s.Configs["cleanup.policy"], status)
+	}
+	w.Flush()
+	if drifted > 0 {
+		return fmt.Errorf("%d of %d topics differ from the config, run `watchdog topics ensure` to fix what can be fixed", drifted, len(states))
+	}
+	return nil
+}
+
+// The furthest back hourly quotes can be fetched.
+const MAX_QUOTE_HISTORY_DAYS = 730
+
+// Simulates trading tickers on their stored sentiment and quotes,
+// and prints the returns, Sharpe ratio, maximum drawdown and hit
+// rate of each and of an evenly split portfolio. With --fetch-quotes,
+// quotes are first fetched through the analyzer and stored.
+/*
+	Usage: watchdog backtest [--tickers AMD,GME] [--from 2022-05-01] [--to 2022-06-01]
+	       [--rule threshold --long 0.2 --short -0.2 | --rule crossover --fast 6 --slow 24]
+	       [--allow-short] [--fee 0.001] [--bucket 1h|15m] [--weighting influence]
+	       [--fetch-quotes] [--equity equity.csv|equity.json]
+*/
+func backtestCommand(args []string) error {
+	fs := flag.NewFlagSet("backtest", flag.ExitOnError)
+	tickerNames := fs.String("tickers", "", "comma separated tickers to test, defaults to every active ticker")
+	from := fs.String("from", "", "start of the range (RFC3339, YYYY-MM-DD or unix seconds), defaults to 30 days ago")
+	to := fs.String("to", "", "end of the range, defaults to now")
+	ruleName := fs.String("rule", "threshold", "threshold or crossover")
+	long := fs.Float64("long", 0.2, "threshold: go long once sentiment reaches this")
+	short := fs.Float64("short", -0.2, "threshold: leave, or go short, once sentiment falls to this")
+	fast := fs.Int("fast", 6, "crossover: buckets in the fast moving average")
+	slow := fs.Int("slow", 24, "crossover: buckets in the slow moving average")
+	allowShort := fs.Bool("allow-short", false, "go short on bearish signals instead of staying out")
+	fee := fs.Float64("fee", 0.001, "fee per trade, as a fraction of the value traded")
+	bucket := fs.String("bucket", "1h", "sentiment bucket size, 1h or 15m")
+	weighting := fs.String("weighting", "", "influence to use author-weighted sentiment")
+	fetchQuotes := fs.Bool("fetch-quotes", false, "fetch and store hourly quotes through the analyzer first")
+	equityPath := fs.String("equity", "", "write equity curves to this .csv or .json file")
+	cfg, logger, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var rule backtest.Rule
+	switch *ruleName {
+	case "threshold":
+		if *short > *long {
+			return errors.New("--short must not be above --long")
+		}
+		rule = backtest.Threshold{Long: *long, Short: *short, AllowShort: *allowShort}
+	case "crossover":
+		crossover := backtest.Crossover{Fast: *fast, Slow: *slow, AllowShort: *allowShort}
+		if err := crossover.Validate(); err != nil {
+			return err
+		}
+		rule = crossover
+	default:
+		return fmt.Errorf("unknown rule %q, expected threshold or crossover", *ruleName)
+	}
+	if *fee < 0 || *fee >= 1 {
+		return errors.New("--fee must be at least 0 and below 1")
+	}
+	bucketSeconds := db.HOURLY_BUCKET
+	switch *bucket {
+	case "1h":
+	case "15m":
+		bucketSeconds = db.QUARTER_HOUR_BUCKET
+	default:
+		return fmt.Errorf("unknown bucket %q, expected 1h or 15m", *bucket)
+	}
+	if *weighting != "" && *weighting != "influence" {
+		return fmt.Errorf("unknown weighting %q, expected influence", *weighting)
+	}
+	var writeEquity func(io.Writer, []backtest.Result) error
+	switch filepath.Ext(*equityPath) {
+	case "":
+	case ".csv":
+		writeEquity = backtest.WriteCSV
+	case ".json":
+		writeEquity = backtest.WriteJSON
+	default:
+		return errors.New("--equity must end in .csv or .json")
+	}
+
+	toTime := time.Now().Unix()
+	if *to != "" {
+		if toTime, err = kafka.ParseBackfillTime(*to); err != nil {
+			return fmt.Errorf("invalid --to: %w", err)
+		}
+	}
+	fromTime := toTime - 30*24*3600
+	if *from != "" {
+		if fromTime, err = kafka.ParseBackfillTime(*from); err != nil {
+			return fmt.Errorf("invalid --from: %w", err)
+		}
+	}
+	if fromTime >= toTime {
+		return errors.New("--from must be before --to")
+	}
+
+	d, err := db.NewManager(logger, cfg.Database.User, cfg.Database.Password, cfg.Database.Name, cfg.Database.Primary)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	ctx := context.Background()
+	tickers := make(map[string]int)
+	if *tickerNames == "" {
+		active, err := d.ReturnActiveTickers(ctx)
+		if err != nil {
+			return err
+		}
+		for _, t := range active {
+			tickers[t.Name] = t.Id
+		}
+	} else {
+		for _, name := range strings.Split(*tickerNames, ",") {
+			name = strings.TrimSpace(name)
+			if tickers[name], err = d.RetrieveTickerIDByName(name); err != nil {
+				return fmt.Errorf("unknown ticker %s: %w", name, err)
+			}
+		}
+	}
+	names := make([]string, 0, len(tickers))
+	for name := range tickers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if *fetchQuotes {
+		conn, err := grpc.Dial(cfg.GRPC.Host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		days := min((time.Now().Unix()-fromTime)/(24*3600)+1, MAX_QUOTE_HISTORY_DAYS)
+		client := pb.NewQuotesClient(conn)
+		for _, name := range names {
+			response, err := client.Detect(ctx, &pb.QuoteRequest{Name: name, Period: fmt.Sprintf("%dd", days)})
+			if err != nil {
+				return fmt.Errorf("fetching quotes for %s: %w", name, err)
+			}
+			quotes := make([]db.IntervalQuote, 0, len(response.Quotes))
+			for _, q := range response.Quotes {
+				quotes = append(quotes, db.IntervalQuote{TimeStamp: q.Time.Seconds, CurrentPrice: float64(q.Price)})
+			}
+			if err := d.UpsertQuotes(tickers[name], quotes); err != nil {
+				return err
+			}
+			logger.Info("stored quotes", "ticker", name, "quotes", len(quotes))
+		}
+	}
+
+	simulation := backtest.Config{Rule: rule, Fee: *fee, BucketSeconds: bucketSeconds}
+	var results []backtest.Result
+	for _, name := range names {
+		id := tickers[name]
+		quotes, err := d.ReturnQuotes(id, fromTime, toTime)
+		if err != nil {
+			return err
+		}
+		var sentiments []db.IntervalQuote
+		if *weighting == "influence" {
+			sentiments = d.ReturnWeightedSentimentBuckets(id, fromTime, bucketSeconds)
+		} else {
+			sentiments = d.ReturnSentimentBuckets(id, fromTime, bucketSeconds)
+		}
+		if len(quotes) < 2 || len(sentiments) == 0 {
+			logger.Warn("skipping ticker without enough quotes or sentiment", "ticker", name, "quotes", len(quotes), "sentiments", len(sentiments))
+			continue
+		}
+		results = append(results, backtest.Run(name, sentiments, quotes, simulation))
+	}
+	if len(results) == 0 {
+		return errors.New("no ticker had quotes and sentiment in the range, try --fetch-quotes")
+	}
+	if len(results) > 1 {
+		results = append(results, backtest.Combine("PORTFOLIO", results))
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TICKER\tRETURN\tBUY&HOLD\tSHARPE\tMAX DRAWDOWN\tTRADES\tHIT RATE")
+	for _, r := range results {
+		fmt.Fprintf(w, "%s\t%.2f%%\t%.2f%%\t%.2f\t%.2f%%\t%d\t%.0f%%\n", r.Ticker, 100*r.Return, 100*r.BuyAndHold,
+			r.Sharpe, 100*r.MaxDrawdown, r.Trades, 100*r.HitRate)
+	}
+	w.Flush()
+
+	if writeEquity == nil {
+		return nil
+	}
+	f, err := os.Create(*equityPath)
+	if err != nil {
+		return err
+	}
+	if err := writeEquity(f, results); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Writes the statements, sentiment buckets or quotes of tickers over
+// a time range to a file or stdout, streaming them from the
+// database as /api/export does. The format is taken from --output's
+// extension unless --format is given.
+/*
+	Usage: watchdog export --dataset statements|sentiments|quotes [--tickers AMD,GME]
+	       [--from 2022-05-01] [--to 2022-06-01] [--format csv|ndjson|parquet] [--output statements.parquet]
+*/
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	dataset := fs.String("dataset", "statements", "statements, sentiments or quotes")
+	tickerNames := fs.String("tickers", "", "comma separated tickers to export, defaults to every active ticker")
+	from := fs.String("from", "", "start of the range (RFC3339, YYYY-MM-DD or unix seconds), defaults to a week before --to")
+	to := fs.String("to", "", "end of the range, defaults to now")
+	format := fs.String("format", "", "csv, ndjson or parquet, defaults to --output's extension or csv")
+	output := fs.String("output", "", "file to write, defaults to stdout")
+	cfg, logger, err := loadConfig(fs, args)
+	if err != nil {
+		return err
+	}
+
+	columns, ok := export.DATASETS[*dataset]
+	if !ok {
+		return fmt.Errorf("unknown dataset %q, expected statements, sentiments or quotes", *dataset)
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(*output), ".")
+		if _, ok := export.FORMATS[*format]; !ok {
+			*format = "csv"
+		}
+	}
+	if _, ok := export.FORMATS[*format]; !ok {
+		return fmt.Errorf("unknown format %q, expected csv, ndjson or parquet", *format)
+	}
+	fromTime, toTime, err := exportRange(*from, *to)
+	if err != nil {
+		return err
+	}
+
+	d, err := db.NewManager(logger, cfg.Database.User, cfg.Database.Password, cfg.Database.Name, cfg.Database.Primary)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	ids, err := exportTickers(context.Background(), d, *tickerNames)
+	if err != nil {
+		return err
+	}
+
+	f := os.Stdout
+	if *output != "" {
+		if f, err = os.Create(*output); err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+	out, err := export.NewWriter(f, *format, columns)
+	if err != nil {
+		return err
+	}
+	if err := export.Export(d, *dataset, ids, fromTime, toTime, out); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if *output != "" {
+		return f.Close()
+	}
+	return nil
+}
+
+// Writes the OpenAPI document served at /api/openapi.json, so that
+// clients can be generated without a running server.
+/*
+	Usage: watchdog openapi [--output openapi.json]
+*/
+func openapiCommand(args []string) error {
+	fs := flag.NewFlagSet("openapi", flag.ExitOnError)
+	output := fs.String("output", "", "file to write, defaults to stdout")
+	fs.Parse(args)
+
+	b, err := json.MarshalIndent(api.Spec(), "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if *output == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(*output, b, 0o644)
+}
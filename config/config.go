@@ -0,0 +1,542 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/kafka"
+	"github.com/jonreesman/watch-dog-kafka/logging"
+	"gopkg.in/yaml.v2"
+)
+
+// Defines the full configuration of the service. Values are
+// resolved in order of increasing precedence: the defaults below,
+// the YAML config file, environment variables, then flags.
+type Config struct {
+	Database  DatabaseConfig  `yaml:"database"`
+	Kafka     KafkaConfig     `yaml:"kafka"`
+	GRPC      GRPCConfig      `yaml:"grpc"`
+	Scheduler SchedulerConfig `yaml:"scheduler"`
+	Sentiment SentimentConfig `yaml:"sentiment"`
+	Models    ModelsConfig    `yaml:"models"`
+	Symbology SymbologyConfig `yaml:"symbology"`
+	Trending  TrendingConfig  `yaml:"trending"`
+	Listen    ListenConfig    `yaml:"listen"`
+	Logging   LoggingConfig   `yaml:"logging"`
+}
+
+type DatabaseConfig struct {
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+	// host:port of the primary, which takes all writes.
+	Primary string `yaml:"primary"`
+	// host:port of each read replica. Without any, the
+	// primary serves reads as well.
+	Replicas []string `yaml:"replicas"`
+	// Replication lag beyond which reads fail over from a
+	// replica to the primary.
+	MaxReplicaLag time.Duration `yaml:"max_replica_lag"`
+}
+
+type KafkaConfig struct {
+	Brokers []string `yaml:"brokers"`
+	GroupID string   `yaml:"group_id"`
+	// Consumers to run per topic. A topic set to 0 is
+	// not consumed by this instance.
+	Consumers map[string]int `yaml:"consumers"`
+	Producer  ProducerConfig `yaml:"producer"`
+	// Topics created and kept in line at startup, by name. Our
+	// own topics are always included, and other names, such as
+	// "scrape.dlq", may be added.
+	Topics map[string]TopicConfig `yaml:"topics"`
+}
+
+// Settings left at zero take the value of DEFAULT_TOPIC.
+type TopicConfig struct {
+	Partitions        int           `yaml:"partitions"`
+	ReplicationFactor int           `yaml:"replication_factor"`
+	Retention         time.Duration `yaml:"retention"`
+	// delete, compact, or "compact,delete".
+	CleanupPolicy string `yaml:"cleanup_policy"`
+}
+
+type ProducerConfig struct {
+	// Messages are sent in batches of up to BatchSize, or
+	// after BatchTimeout, whichever comes first.
+	BatchSize    int           `yaml:"batch_size"`
+	BatchTimeout time.Duration `yaml:"batch_timeout"`
+	// One of none, gzip, snappy, lz4 or zstd.
+	Compression string `yaml:"compression"`
+	// Acknowledgements a write waits for: none, leader or all.
+	RequiredAcks string `yaml:"required_acks"`
+}
+
+var (
+	compressions = []string{"none", "gzip", "snappy", "lz4", "zstd"}
+	acks         = []string{"none", "leader", "all"}
+	cleanups     = []string{"delete", "compact", "compact,delete"}
+)
+
+type GRPCConfig struct {
+	// host:port of the Python sentiment and quote service.
+	Host string `yaml:"host"`
+}
+
+type SchedulerConfig struct {
+	// How often a normal priority ticker is scraped.
+	ScrapeInterval time.Duration `yaml:"scrape_interval"`
+}
+
+type SentimentConfig struct {
+	// Also aggregate sentiment into 15 minute buckets. Off by
+	// default, since it quadruples the sentiment rows written.
+	QuarterHourBuckets bool `yaml:"quarter_hour_buckets"`
+}
+
+type ModelsConfig struct {
+	// Path of the trained spam classifier.
+	Spam string `yaml:"spam"`
+}
+
+type SymbologyConfig struct {
+	// Path of a CSV reference list of the symbols that may be
+	// tracked. Empty uses the list built into the binary.
+	Reference string `yaml:"reference"`
+}
+
+type TrendingConfig struct {
+	// Add trending symbols as tickers without an admin.
+	AutoAdd bool `yaml:"auto_add"`
+	// Least mentions in the last hour, and least multiple of
+	// its usual mentions, for a symbol to be added.
+	MinMentions int     `yaml:"min_mentions"`
+	MinVelocity float64 `yaml:"min_velocity"`
+	// Most symbols added in any 24 hours.
+	MaxPerDay int `yaml:"max_per_day"`
+	// No symbol is added while this many tickers are active.
+	MaxTracked int `yaml:"max_tracked"`
+}
+
+type ListenConfig struct {
+	API   string `yaml:"api"`
+	Pprof string `yaml:"pprof"`
+}
+
+type LoggingConfig struct {
+	Level  string `yaml:"level"`
+	Format string `yaml:"format"`
+}
+
+// The topics a consumer count may be given for.
+var Topics = kafka.Topics
+
+// Default number of consumers per topic.
+const DEFAULT_CONSUMERS = 5
+
+// Most consumers per topic.
+const MAX_CONSUMERS = kafka.MAX_WORKERS
+
+// Settings of a topic that the config leaves unset.
+var DEFAULT_TOPIC = TopicConfig{
+	Partitions:        10,
+	ReplicationFactor: 1,
+	Retention:         7 * 24 * time.Hour,
+	CleanupPolicy:     "delete",
+}
+
+// Returns the configuration used when nothing overrides it.
+// Consumer counts are filled in by Resolve for any topic left
+// unset, since the config file may only name some topics.
+func Default() Config {
+	return Config{
+		Database: DatabaseConfig{MaxReplicaLag: 30 * time.Second},
+		Kafka: KafkaConfig{Producer: ProducerConfig{
+			BatchSize:    100,
+			BatchTimeout: 10 * time.Millisecond,
+			Compression:  "snappy",
+			RequiredAcks: "all",
+		}},
+		Scheduler: SchedulerConfig{ScrapeInterval: time.Hour},
+		Models:    ModelsConfig{Spam: "model.by"},
+		Trending: TrendingConfig{
+			MinMentions: 20,
+			MinVelocity: 5,
+			MaxPerDay:   3,
+			MaxTracked:  100,
+		},
+		Listen:  ListenConfig{API: ":3100", Pprof: "localhost:6060"},
+		Logging: LoggingConfig{Level: "info", Format: logging.FORMAT_TEXT},
+	}
+}
+
+// Returns the comma separated broker list the kafka
+// package expects.
+func (k KafkaConfig) URL() string {
+	return strings.Join(k.Brokers, ",")
+}
+
+// Checks the configuration, returning every problem found
+// rather than only the first.
+func (c Config) Validate() error {
+	var errs []error
+	require := func(name, value string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf("%s is required", name))
+		}
+	}
+	address := func(name, value string) {
+		if _, _, err := net.SplitHostPort(value); err != nil {
+			errs = append(errs, fmt.Errorf("%s %q is not a host:port address", name, value))
+		}
+	}
+
+	require("database.user", c.Database.User)
+	require("database.name", c.Database.Name)
+	address("database.primary", c.Database.Primary)
+	for _, r := range c.Database.Replicas {
+		address("database.replicas", r)
+	}
+	if c.Database.MaxReplicaLag <= 0 {
+		errs = append(errs, errors.New("database.max_replica_lag must be positive"))
+	}
+
+	if len(c.Kafka.Brokers) == 0 {
+		errs = append(errs, errors.New("kafka.brokers is required"))
+	}
+	for _, broker := range c.Kafka.Brokers {
+		address("kafka.brokers", broker)
+	}
+	require("kafka.group_id", c.Kafka.GroupID)
+	for topic, n := range c.Kafka.Consumers {
+		if !isTopic(topic) {
+			errs = append(errs, fmt.Errorf("kafka.consumers: unknown topic %q, expected one of %s", topic, strings.Join(Topics, ", ")))
+		}
+		if n < 0 || n > MAX_CONSUMERS {
+			errs = append(errs, fmt.Errorf("kafka.consumers.%s must be between 0 and %d", topic, MAX_CONSUMERS))
+		}
+	}
+	producer := c.Kafka.Producer
+	if producer.BatchSize <= 0 {
+		errs = append(errs, errors.New("kafka.producer.batch_size must be positive"))
+	}
+	if producer.BatchTimeout <= 0 {
+		errs = append(errs, errors.New("kafka.producer.batch_timeout must be positive"))
+	}
+	if !contains(compressions, producer.Compression) {
+		errs = append(errs, fmt.Errorf("kafka.producer.compression %q is not one of %s", producer.Compression, strings.Join(compressions, ", ")))
+	}
+	if !contains(acks, producer.RequiredAcks) {
+		errs = append(errs, fmt.Errorf("kafka.producer.required_acks %q is not one of %s", producer.RequiredAcks, strings.Join(acks, ", ")))
+	}
+	for name, topic := range c.Kafka.Topics {
+		if !validTopicName(name) {
+			errs = append(errs, fmt.Errorf("kafka.topics: %q is not a valid topic name", name))
+		}
+		if topic.Partitions < 1 {
+			errs = append(errs, fmt.Errorf("kafka.topics.%s.partitions must be positive", name))
+		}
+		if topic.ReplicationFactor < 1 {
+			errs = append(errs, fmt.Errorf("kafka.topics.%s.replication_factor must be positive", name))
+		}
+		if topic.Retention < time.Millisecond {
+			errs = append(errs, fmt.Errorf("kafka.topics.%s.retention must be at least 1ms", name))
+		}
+		if !contains(cleanups, topic.CleanupPolicy) {
+			errs = append(errs, fmt.Errorf("kafka.topics.%s.cleanup_policy %q is not one of %s", name, topic.CleanupPolicy, strings.Join(cleanups, ", ")))
+		}
+	}
+
+	address("grpc.host", c.GRPC.Host)
+	if c.Scheduler.ScrapeInterval < time.Minute {
+		errs = append(errs, fmt.Errorf("scheduler.scrape_interval %v is shorter than a minute", c.Scheduler.ScrapeInterval))
+	}
+	require("models.spam", c.Models.Spam)
+	if c.Trending.AutoAdd {
+		if c.Trending.MinMentions < 1 {
+			errs = append(errs, errors.New("trending.min_mentions must be positive"))
+		}
+		if c.Trending.MinVelocity < 1 {
+			errs = append(errs, errors.New("trending.min_velocity must be at least 1"))
+		}
+		if c.Trending.MaxPerDay < 1 {
+			errs = append(errs, errors.New("trending.max_per_day must be positive"))
+		}
+		if c.Trending.MaxTracked < 1 {
+			errs = append(errs, errors.New("trending.max_tracked must be positive"))
+		}
+	}
+	address("listen.api", c.Listen.API)
+	if c.Listen.Pprof != "" {
+		address("listen.pprof", c.Listen.Pprof)
+	}
+	if _, err := logging.New(io.Discard, c.Logging.Level, c.Logging.Format); err != nil {
+		errs = append(errs, fmt.Errorf("logging: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// Kafka allows up to 249 letters, digits, '.', '_' and '-'.
+func validTopicName(name string) bool {
+	if name == "" || len(name) > 249 || name == "." || name == ".." {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func isTopic(topic string) bool {
+	return contains(Topics, topic)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the configuration as YAML with the database
+// password masked, for `watchdog config print`.
+func (c Config) Redacted() ([]byte, error) {
+	if c.Database.Password != "" {
+		c.Database.Password = "********"
+	}
+	return yaml.Marshal(c)
+}
+
+// Reads a YAML config file over c. Keys absent from
+// the file keep their current values.
+func (c *Config) loadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Applies environment variable overrides. The names are
+// those the service has always read, so existing deployments
+// keep working without a config file.
+func (c *Config) loadEnv(lookup func(string) (string, bool)) error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if v, ok := lookup(name); ok {
+			*dst = v
+		}
+	}
+	str("DB_USER", &c.Database.User)
+	str("DB_PWD", &c.Database.Password)
+	str("DB_NAME", &c.Database.Name)
+	str("DB_MASTER", &c.Database.Primary)
+	str("GRPC_HOST", &c.GRPC.Host)
+	str("groupID", &c.Kafka.GroupID)
+	str("SPAM_MODEL", &c.Models.Spam)
+	str("SYMBOL_REFERENCE", &c.Symbology.Reference)
+	str("API_ADDR", &c.Listen.API)
+	str("PPROF_ADDR", &c.Listen.Pprof)
+	str("LOG_LEVEL", &c.Logging.Level)
+	str("LOG_FORMAT", &c.Logging.Format)
+	if v, ok := lookup("DB_SLAVE"); ok {
+		c.Database.Replicas = splitList(v)
+	}
+	if v, ok := lookup("kafkaURL"); ok {
+		c.Kafka.Brokers = splitList(v)
+	}
+	if v, ok := lookup("CONSUMERS_PER_TOPIC"); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("CONSUMERS_PER_TOPIC: %q is not a number", v))
+		}
+		c.Kafka.Consumers = make(map[string]int)
+		for _, topic := range Topics {
+			c.Kafka.Consumers[topic] = n
+		}
+	}
+	if v, ok := lookup("DB_MAX_REPLICA_LAG"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("DB_MAX_REPLICA_LAG: %w", err))
+		}
+		c.Database.MaxReplicaLag = d
+	}
+	if v, ok := lookup("SCRAPE_INTERVAL"); ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("SCRAPE_INTERVAL: %w", err))
+		}
+		c.Scheduler.ScrapeInterval = d
+	}
+	if v, ok := lookup("QUARTER_HOUR_BUCKETS"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("QUARTER_HOUR_BUCKETS: %q is not a boolean", v))
+		}
+		c.Sentiment.QuarterHourBuckets = b
+	}
+	if v, ok := lookup("TRENDING_AUTO_ADD"); ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("TRENDING_AUTO_ADD: %q is not a boolean", v))
+		}
+		c.Trending.AutoAdd = b
+	}
+	return errors.Join(errs...)
+}
+
+// Gives every topic without a consumer count the default.
+func (c *Config) defaultConsumers() {
+	if c.Kafka.Consumers == nil {
+		c.Kafka.Consumers = make(map[string]int)
+	}
+	for _, topic := range Topics {
+		if _, ok := c.Kafka.Consumers[topic]; !ok {
+			c.Kafka.Consumers[topic] = DEFAULT_CONSUMERS
+		}
+	}
+}
+
+// Adds any of our topics missing from the config, and fills
+// unset topic settings from DEFAULT_TOPIC.
+func (c *Config) defaultTopics() {
+	if c.Kafka.Topics == nil {
+		c.Kafka.Topics = make(map[string]TopicConfig)
+	}
+	for _, topic := range Topics {
+		if _, ok := c.Kafka.Topics[topic]; !ok {
+			c.Kafka.Topics[topic] = TopicConfig{}
+		}
+	}
+	for name, t := range c.Kafka.Topics {
+		if t.Partitions == 0 {
+			t.Partitions = DEFAULT_TOPIC.Partitions
+		}
+		if t.ReplicationFactor == 0 {
+			t.ReplicationFactor = DEFAULT_TOPIC.ReplicationFactor
+		}
+		if t.Retention == 0 {
+			t.Retention = DEFAULT_TOPIC.Retention
+		}
+		if t.CleanupPolicy == "" {
+			t.CleanupPolicy = DEFAULT_TOPIC.CleanupPolicy
+		}
+		c.Kafka.Topics[name] = t
+	}
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Holds the flags bound by Bind until they are parsed.
+type Loader struct {
+	fs             *flag.FlagSet
+	path           string
+	brokers        string
+	groupID        string
+	grpcHost       string
+	scrapeInterval time.Duration
+	spamModel      string
+	apiAddr        string
+	pprofAddr      string
+	logLevel       string
+	logFormat      string
+}
+
+// Registers the configuration flags on fs. Call Load
+// once fs has been parsed.
+func Bind(fs *flag.FlagSet) *Loader {
+	l := &Loader{fs: fs}
+	fs.StringVar(&l.path, "config", "", "path of the YAML config file, defaults to $WATCHDOG_CONFIG")
+	fs.StringVar(&l.brokers, "kafka", "", "comma separated Kafka brokers")
+	fs.StringVar(&l.groupID, "group-id", "", "Kafka consumer group")
+	fs.StringVar(&l.grpcHost, "grpc-host", "", "host:port of the sentiment service")
+	fs.DurationVar(&l.scrapeInterval, "scrape-interval", 0, "how often a normal priority ticker is scraped")
+	fs.StringVar(&l.spamModel, "spam-model", "", "path of the spam classifier")
+	fs.StringVar(&l.apiAddr, "api-addr", "", "address the API listens on")
+	fs.StringVar(&l.pprofAddr, "pprof-addr", "", "address pprof listens on, empty disables it")
+	fs.StringVar(&l.logLevel, "log-level", "", "debug, info, warn or error")
+	fs.StringVar(&l.logFormat, "log-format", "", "text or json")
+	return l
+}
+
+// Resolves and validates the configuration.
+func (l *Loader) Load() (Config, error) {
+	c, err := l.Resolve()
+	if err != nil {
+		return Config{}, err
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return c, nil
+}
+
+// Resolves the configuration without validating it.
+func (l *Loader) Resolve() (Config, error) {
+	c := Default()
+	path := l.path
+	if path == "" {
+		path = os.Getenv("WATCHDOG_CONFIG")
+	}
+	if path != "" {
+		if err := c.loadFile(path); err != nil {
+			return Config{}, fmt.Errorf("config file: %w", err)
+		}
+	}
+	if err := c.loadEnv(os.LookupEnv); err != nil {
+		return Config{}, fmt.Errorf("environment: %w", err)
+	}
+	l.apply(&c)
+	c.defaultConsumers()
+	c.defaultTopics()
+	return c, nil
+}
+
+// Applies the flags that were given on the command line.
+func (l *Loader) apply(c *Config) {
+	l.fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "kafka":
+			c.Kafka.Brokers = splitList(l.brokers)
+		case "group-id":
+			c.Kafka.GroupID = l.groupID
+		case "grpc-host":
+			c.GRPC.Host = l.grpcHost
+		case "scrape-interval":
+			c.Scheduler.ScrapeInterval = l.scrapeInterval
+		case "spam-model":
+			c.Models.Spam = l.spamModel
+		case "api-addr":
+			c.Listen.API = l.apiAddr
+		case "pprof-addr":
+			c.Listen.Pprof = l.pprofAddr
+		case "log-level":
+			c.Logging.Level = l.logLevel
+		case "log-format":
+			c.Logging.Format = l.logFormat
+		}
+	})
+}
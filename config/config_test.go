@@ -0,0 +1,158 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testFile = `
+database:
+  user: root
+  name: app
+  primary: mysql-master:3306
+kafka:
+  brokers: [kafka-1:9093, kafka-2:9093]
+  group_id: demo
+  consumers:
+    backfill: 1
+  topics:
+    scrape:
+      partitions: 20
+    scrape.dlq:
+      retention: 720h
+grpc:
+  host: wdk-server:9999
+scheduler:
+  scrape_interval: 30m
+`
+
+func writeFile(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "watchdog.yaml")
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrecedence(t *testing.T) {
+	c := Default()
+	if err := c.loadFile(writeFile(t, testFile)); err != nil {
+		t.Fatal(err)
+	}
+	if c.Kafka.URL() != "kafka-1:9093,kafka-2:9093" {
+		t.Errorf("got brokers %q", c.Kafka.URL())
+	}
+	if c.Scheduler.ScrapeInterval != 30*time.Minute {
+		t.Errorf("got interval %v, want 30m", c.Scheduler.ScrapeInterval)
+	}
+	// Keys absent from the file keep their defaults.
+	c.defaultConsumers()
+	if c.Kafka.Consumers["backfill"] != 1 || c.Kafka.Consumers["scrape"] != DEFAULT_CONSUMERS {
+		t.Errorf("got consumers %v", c.Kafka.Consumers)
+	}
+	c.defaultTopics()
+	if scrape := c.Kafka.Topics["scrape"]; scrape.Partitions != 20 || scrape.ReplicationFactor != DEFAULT_TOPIC.ReplicationFactor {
+		t.Errorf("got scrape topic %+v", scrape)
+	}
+	if dlq := c.Kafka.Topics["scrape.dlq"]; dlq.Retention != 720*time.Hour || dlq.Partitions != DEFAULT_TOPIC.Partitions {
+		t.Errorf("got dead letter topic %+v", dlq)
+	}
+	if c.Kafka.Topics["add"] != DEFAULT_TOPIC {
+		t.Errorf("got add topic %+v, want the default", c.Kafka.Topics["add"])
+	}
+	if c.Listen.API != ":3100" {
+		t.Errorf("got api address %q", c.Listen.API)
+	}
+
+	env := map[string]string{"GRPC_HOST": "localhost:9999", "SCRAPE_INTERVAL": "2h"}
+	err := c.loadEnv(func(k string) (string, bool) { v, ok := env[k]; return v, ok })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.GRPC.Host != "localhost:9999" || c.Scheduler.ScrapeInterval != 2*time.Hour {
+		t.Errorf("env not applied: %+v %+v", c.GRPC, c.Scheduler)
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	l := Bind(fs)
+	if err := fs.Parse([]string{"--scrape-interval", "15m", "--api-addr", ":8080"}); err != nil {
+		t.Fatal(err)
+	}
+	l.apply(&c)
+	if c.Scheduler.ScrapeInterval != 15*time.Minute || c.Listen.API != ":8080" {
+		t.Errorf("flags not applied: %+v %+v", c.Scheduler, c.Listen)
+	}
+	// Flags that were not given leave the value alone.
+	if c.GRPC.Host != "localhost:9999" {
+		t.Errorf("got grpc host %q", c.GRPC.Host)
+	}
+	if err := c.Validate(); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	c.defaultConsumers()
+	c.Kafka.Consumers["scrap"] = 2
+	c.Kafka.Consumers["add"] = -1
+	c.Scheduler.ScrapeInterval = time.Second
+	c.Logging.Format = "xml"
+	c.Trending = TrendingConfig{AutoAdd: true, MinMentions: 10, MinVelocity: 0.5, MaxTracked: 10}
+	c.Kafka.Topics = map[string]TopicConfig{
+		"scrape dlq": DEFAULT_TOPIC,
+		"add":        {Partitions: 1, ReplicationFactor: 1, Retention: time.Hour, CleanupPolicy: "archive"},
+	}
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		"database.user is required",
+		`database.primary "" is not a host:port address`,
+		"kafka.brokers is required",
+		`unknown topic "scrap"`,
+		"kafka.consumers.add must be between 0 and 64",
+		"grpc.host",
+		"shorter than a minute",
+		`invalid log format "xml"`,
+		`"scrape dlq" is not a valid topic name`,
+		`kafka.topics.add.cleanup_policy "archive"`,
+		"trending.min_velocity must be at least 1",
+		"trending.max_per_day must be positive",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	c := Default()
+	if err := c.loadFile(writeFile(t, "kafka:\n  broker: [a:1]\n")); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+	env := map[string]string{"CONSUMERS_PER_TOPIC": "ten"}
+	if err := c.loadEnv(func(k string) (string, bool) { v, ok := env[k]; return v, ok }); err == nil {
+		t.Error("expected an error for a malformed CONSUMERS_PER_TOPIC")
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := Default()
+	c.Database.Password = "hunter2"
+	out, err := c.Redacted()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "hunter2") {
+		t.Errorf("password not masked:\n%s", out)
+	}
+	if !strings.Contains(string(out), "scrape_interval: 1h0m0s") {
+		t.Errorf("interval not printed as a duration:\n%s", out)
+	}
+}
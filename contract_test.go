@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonreesman/watch-dog-kafka/api"
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/health"
+	"github.com/jonreesman/watch-dog-kafka/kafka"
+	"github.com/jonreesman/watch-dog-kafka/logging"
+	"github.com/jonreesman/watch-dog-kafka/symbology"
+)
+
+// The OpenAPI document as served, decoded into generic JSON values.
+type spec map[string]interface{}
+
+// Creates a server around d, which is only used by the requests
+// that pass validation.
+func newContractServer(t *testing.T, d db.DBManager) *Server {
+	gin.SetMode(gin.TestMode)
+	symbols, err := symbology.Parse(strings.NewReader("symbol,name,asset_class,exchange,aliases\nAMD,Advanced Micro Devices Inc.,equity,NASDAQ,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker := health.NewChecker()
+	checker.Add("database", func(ctx context.Context) error { return nil })
+	checker.AddOptional("quotes", func(ctx context.Context) error { return errors.New("unreachable") })
+	pool := kafka.NewPool(kafka.ConsumerConfig{Logger: logging.Discard()}, "contract")
+	server, err := NewServer(logging.Discard(), d, nil, "", kafka.NewMemoryBus(), pool, symbols, kafka.NewMentionCache(), time.Second, monitor{checker: checker})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server
+}
+
+func (server *Server) serve(method, url, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	return w
+}
+
+func (server *Server) spec(t *testing.T) spec {
+	w := server.serve(http.MethodGet, "/api/openapi.json", "")
+	var s spec
+	if err := json.Unmarshal(w.Body.Bytes(), &s); err != nil {
+		t.Fatalf("openapi.json: %v", err)
+	}
+	return s
+}
+
+func TestRoutesMatchSpec(t *testing.T) {
+	server := newContractServer(t, db.DBManager{})
+	documented := make(map[string]bool)
+	for path, item := range server.spec(t)["paths"].(map[string]interface{}) {
+		for method := range item.(map[string]interface{}) {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+	param := regexp.MustCompile(`:(\w+)`)
+	for _, r := range server.router.Routes() {
+		route := r.Method + " " + param.ReplaceAllString(r.Path, "{$1}")
+		if !documented[route] {
+			t.Errorf("%s is not in the OpenAPI document", route)
+		}
+		delete(documented, route)
+	}
+	for route := range documented {
+		t.Errorf("%s is documented but not registered", route)
+	}
+}
+
+// A request and the status it should get.
+type contractCase struct {
+	method, url, body string
+	status            int
+}
+
+func TestHandlersMatchSpec(t *testing.T) {
+	server := newContractServer(t, db.DBManager{})
+	server.checkContract(t, []contractCase{
+		{"GET", "/api/", "", 200},
+		{"GET", "/api/openapi.json", "", 200},
+		{"GET", "/healthz", "", 200},
+		{"GET", "/readyz", "", 200},
+		{"GET", "/metrics", "", 200},
+		{"GET", "/auth/consumers", "", 200},
+		{"PUT", "/auth/consumers/add", `{"workers": 1}`, 400},
+		{"PUT", "/auth/consumers/add", `{}`, 400},
+		{"PUT", "/auth/consumers/nope", `{"workers": 1}`, 404},
+		{"POST", "/auth/tickers/", `{"name": "$amd"}`, 200},
+		{"POST", "/auth/tickers/", `{"name": "ZZZZ"}`, 404},
+		{"POST", "/auth/tickers/", `{}`, 400},
+		{"DELETE", "/auth/tickers/3", "", 200},
+		{"DELETE", "/auth/tickers/x", "", 400},
+		{"PUT", "/auth/tickers/x/schedule", `{}`, 400},
+		{"PUT", "/auth/tickers/3/schedule", `{"scrape_interval": 5}`, 400},
+		{"PUT", "/auth/tickers/3/schedule", `{"priority": "urgent"}`, 400},
+		{"PUT", "/auth/tickers/x/metadata", `{}`, 400},
+		{"PUT", "/auth/tickers/3/metadata", `{"cashtag": "$$"}`, 400},
+		{"POST", "/auth/alerts", `{}`, 400},
+		{"POST", "/auth/alerts", `{"ticker_id": 3, "kind": "sentiment_sideways", "webhook_url": "https://example.com"}`, 400},
+		{"PUT", "/auth/alerts/x", `{}`, 400},
+		{"DELETE", "/auth/alerts/x", "", 400},
+		{"GET", "/api/tickers/x/time/day", "", 400},
+		{"GET", "/api/tickers/x/metadata", "", 400},
+		{"GET", "/api/tickers/x/related", "", 400},
+		{"GET", "/api/tickers/3/related?format=xml", "", 400},
+		{"GET", "/api/tickers/3/related?min_weight=2", "", 400},
+		{"GET", "/api/tickers/x/top-authors", "", 400},
+		{"GET", "/api/tickers/3/top-authors?limit=0", "", 400},
+		{"GET", "/api/trending?window=0", "", 400},
+		{"GET", "/api/statements/search?min_polarity=2", "", 400},
+		{"GET", "/api/statements/search?cursor=%21", "", 400},
+		{"GET", "/api/export/tweets", "", 404},
+		{"GET", "/api/export/quotes?format=xls", "", 400},
+		{"GET", "/api/export/quotes?from=yesterday", "", 400},
+	})
+}
+
+// Runs the read routes against a scratch database named by the
+// same DB_* variables as the service.
+func TestHandlersMatchSpecWithDatabase(t *testing.T) {
+	if os.Getenv("DB_MASTER") == "" {
+		t.Skip("DB_MASTER not set, no database to read from")
+	}
+	d, err := db.NewManager(slog.Default(), os.Getenv("DB_USER"), os.Getenv("DB_PWD"), os.Getenv("DB_NAME"), os.Getenv("DB_MASTER"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	server := newContractServer(t, d)
+	cases := []contractCase{
+		{"GET", "/api/status", "", 200},
+		{"GET", "/api/trending", "", 200},
+		{"GET", "/api/statements/search?q=bullish&limit=5", "", 200},
+		{"GET", "/api/statements/search", "", 200},
+		{"GET", "/api/export/quotes", "", 200},
+		{"GET", "/api/export/statements?format=ndjson", "", 200},
+		{"GET", "/auth/alerts", "", 200},
+		{"GET", "/api/tickers/0/metadata", "", 404},
+		{"GET", "/api/tickers/0/top-authors", "", 404},
+		{"GET", "/api/tickers/0/related", "", 404},
+	}
+	if tickers, err := d.ReturnActiveTickers(context.Background()); err == nil && len(tickers) > 0 {
+		id := tickers[0].Id
+		cases = append(cases,
+			contractCase{"GET", fmt.Sprintf("/api/tickers/%d/metadata", id), "", 200},
+			contractCase{"GET", fmt.Sprintf("/api/tickers/%d/related", id), "", 200},
+			contractCase{"GET", fmt.Sprintf("/api/tickers/%d/related?format=json", id), "", 200},
+			contractCase{"GET", fmt.Sprintf("/api/tickers/%d/related?format=graphml", id), "", 200},
+			contractCase{"GET", fmt.Sprintf("/api/tickers/%d/top-authors", id), "", 200},
+		)
+	}
+	server.checkContract(t, cases)
+}
+
+// Sends each request and checks that the response has the status
+// expected, and that the OpenAPI document lists that status with
+// the response's content type and a schema its body matches.
+func (server *Server) checkContract(t *testing.T, cases []contractCase) {
+	s := server.spec(t)
+	for _, tc := range cases {
+		name := tc.method + " " + tc.url
+		w := server.serve(tc.method, tc.url, tc.body)
+		if w.Code != tc.status {
+			t.Errorf("%s: status %d, want %d: %s", name, w.Code, tc.status, w.Body)
+			continue
+		}
+		op := s.operation(tc.method, tc.url)
+		if op == nil {
+			t.Errorf("%s: no operation in the OpenAPI document", name)
+			continue
+		}
+		response, ok := op["responses"].(map[string]interface{})[fmt.Sprint(w.Code)].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s: status %d is not documented", name, w.Code)
+			continue
+		}
+		contentType, _, _ := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		media, ok := response["content"].(map[string]interface{})[contentType].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s: content type %q is not documented for %d", name, contentType, w.Code)
+			continue
+		}
+		schema := media["schema"].(map[string]interface{})
+		if schema["format"] == "binary" {
+			continue
+		}
+		var body interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		for _, err := range s.validate(schema, body, "body") {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+}
+
+// Returns the operation serving a request, matching each {param}
+// in the documented paths to a path segment.
+func (s spec) operation(method, url string) map[string]interface{} {
+	path, _, _ := strings.Cut(url, "?")
+	param := regexp.MustCompile(`\\\{\w+\\\}`)
+	for p, item := range s["paths"].(map[string]interface{}) {
+		pattern := "^" + param.ReplaceAllString(regexp.QuoteMeta(p), "[^/]+") + "$"
+		if regexp.MustCompile(pattern).MatchString(path) {
+			op, _ := item.(map[string]interface{})[strings.ToLower(method)].(map[string]interface{})
+			return op
+		}
+	}
+	return nil
+}
+
+// Checks a JSON value against a schema, returning what does not
+// match. It handles only what the document uses, and is stricter
+// than OpenAPI in rejecting properties an object does not declare,
+// so that a field added to a body without its DTO is caught.
+func (s spec) validate(schema map[string]interface{}, v interface{}, at string) []string {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, api.SCHEMA_REF)
+		resolved, ok := s["components"].(map[string]interface{})["schemas"].(map[string]interface{})[name].(map[string]interface{})
+		if !ok {
+			return []string{at + ": unknown schema " + ref}
+		}
+		return s.validate(resolved, v, at)
+	}
+	if v == nil {
+		if schema["nullable"] == true || len(schema) == 0 {
+			return nil
+		}
+		return []string{at + " is null"}
+	}
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		var errs []string
+		for _, sub := range all {
+			errs = append(errs, s.validate(sub.(map[string]interface{}), v, at)...)
+		}
+		return errs
+	}
+	if one, ok := schema["oneOf"].([]interface{}); ok {
+		var matches int
+		for _, sub := range one {
+			if len(s.validate(sub.(map[string]interface{}), v, at)) == 0 {
+				matches++
+			}
+		}
+		if matches == 0 {
+			return []string{at + " matches none of oneOf"}
+		}
+		return nil
+	}
+
+	wrongType := []string{fmt.Sprintf("%s is %T, want %v", at, v, schema["type"])}
+	switch schema["type"] {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return wrongType
+		}
+		var errs []string
+		properties, _ := schema["properties"].(map[string]interface{})
+		for _, name := range stringList(schema["required"]) {
+			if _, ok := obj[name]; !ok {
+				errs = append(errs, at+" is missing "+name)
+			}
+		}
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			switch prop, ok := properties[k].(map[string]interface{}); {
+			case ok:
+				errs = append(errs, s.validate(prop, obj[k], at+"."+k)...)
+			case additional != nil:
+				errs = append(errs, s.validate(additional, obj[k], at+"."+k)...)
+			case properties != nil:
+				errs = append(errs, at+" has undocumented "+k)
+			}
+		}
+		return errs
+	case "array":
+		list, ok := v.([]interface{})
+		if !ok {
+			return wrongType
+		}
+		var errs []string
+		for i, item := range list {
+			errs = append(errs, s.validate(schema["items"].(map[string]interface{}), item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+		return errs
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return wrongType
+		}
+		if enum := stringList(schema["enum"]); len(enum) > 0 && !contains(enum, str) {
+			return []string{fmt.Sprintf("%s is %q, want one of %v", at, str, enum)}
+		}
+		if pattern, ok := schema["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(str) {
+			return []string{fmt.Sprintf("%s is %q, want %s", at, str, pattern)}
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, str); err != nil {
+				return []string{fmt.Sprintf("%s is %q, want a date-time", at, str)}
+			}
+		}
+	case "integer":
+		if n, ok := v.(float64); !ok || n != float64(int64(n)) {
+			return wrongType
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return wrongType
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return wrongType
+		}
+	}
+	return nil
+}
+
+func stringList(v interface{}) []string {
+	var out []string
+	list, _ := v.([]interface{})
+	for _, item := range list {
+		out = append(out, item.(string))
+	}
+	return out
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidate(t *testing.T) {
+	s := spec{"components": map[string]interface{}{"schemas": map[string]interface{}{
+		"Item": map[string]interface{}{
+			"type":       "object",
+			"required":   []interface{}{"id"},
+			"properties": map[string]interface{}{"id": map[string]interface{}{"type": "integer"}},
+		},
+	}}}
+	schema := map[string]interface{}{"type": "array", "items": map[string]interface{}{"$ref": api.SCHEMA_REF + "Item"}}
+	for body, want := range map[string]int{
+		`[{"id": 1}, {"id": 2}]`:       0,
+		`[{"id": 1.5}]`:                1,
+		`[{}]`:                         1,
+		`[{"id": 1, "name": "extra"}]`: 1,
+		`null`:                         1,
+		`{"id": 1}`:                    1,
+	} {
+		var v interface{}
+		json.Unmarshal([]byte(body), &v)
+		if errs := s.validate(schema, v, "body"); len(errs) != want {
+			t.Errorf("%s: got %v, want %d errors", body, errs, want)
+		}
+	}
+}
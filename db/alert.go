@@ -0,0 +1,188 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Returned when no alert rule has the id asked for.
+var ErrNoAlertRule = errors.New("alert rule does not exist")
+
+// Defines a user configured alert rule. Rules are evaluated
+// against a ticker after every hourly push to the database.
+// Kind determines how Threshold and WindowHours are read,
+// see the alerts package for the supported kinds.
+type AlertRule struct {
+	Id              int
+	TickerId        int
+	Kind            string
+	Threshold       float64
+	WindowHours     int
+	CooldownSeconds int64
+	WebhookURL      string
+	Format          string
+	Secret          string `json:"-"`
+	Active          int
+	LastFired       int64
+	LastObserved    int64
+}
+
+const addAlertRuleQuery = `
+INSERT INTO alert_rules(ticker_id, kind, threshold, window_hours, cooldown_seconds, webhook_url, format, secret, active) ` +
+	`VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// Adds an alert rule to the database and returns the id
+// assigned to it.
+func (dbManager DBManager) AddAlertRule(r AlertRule) (int, error) {
+	defer dbManager.observe("AddAlertRule")()
+	res, err := dbManager.db.Exec(addAlertRuleQuery,
+		r.TickerId,
+		r.Kind,
+		r.Threshold,
+		r.WindowHours,
+		r.CooldownSeconds,
+		r.WebhookURL,
+		r.Format,
+		r.Secret,
+		r.Active,
+	)
+	if err != nil {
+		dbManager.logger.Error("AddAlertRule failed", "err", err)
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+const updateAlertRuleQuery = `
+UPDATE alert_rules SET ticker_id=?, kind=?, threshold=?, window_hours=?, ` +
+	`cooldown_seconds=?, webhook_url=?, format=?, secret=COALESCE(?, secret), active=? ` +
+	`WHERE rule_id=?`
+
+// Overwrites the editable fields of an existing alert rule. The
+// secret is replaced by secret, or kept if it is nil. Returns
+// ErrNoAlertRule if there is no rule with the id.
+func (dbManager DBManager) UpdateAlertRule(r AlertRule, secret *string) error {
+	defer dbManager.observe("UpdateAlertRule")()
+	res, err := dbManager.db.Exec(updateAlertRuleQuery,
+		r.TickerId,
+		r.Kind,
+		r.Threshold,
+		r.WindowHours,
+		r.CooldownSeconds,
+		r.WebhookURL,
+		r.Format,
+		secret,
+		r.Active,
+		r.Id,
+	)
+	if err != nil {
+		dbManager.logger.Error("UpdateAlertRule failed", "err", err)
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		if _, err := dbManager.ReadPrimary().RetrieveAlertRuleById(r.Id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const deleteAlertRuleQuery = `
+DELETE FROM alert_rules WHERE rule_id=?`
+
+// Removes an alert rule entirely. Returns ErrNoAlertRule if
+// there is no rule with the id.
+func (dbManager DBManager) DeleteAlertRule(id int) error {
+	defer dbManager.observe("DeleteAlertRule")()
+	res, err := dbManager.db.Exec(deleteAlertRuleQuery, id)
+	if err != nil {
+		dbManager.logger.Error("DeleteAlertRule failed", "err", err)
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNoAlertRule
+	}
+	return nil
+}
+
+const updateAlertRuleFiredQuery = `
+UPDATE alert_rules SET last_fired=?, last_observed=? WHERE rule_id=?`
+
+// Records when a rule last fired and which observation
+// triggered it, so that the same observation is not
+// reported twice and the cooldown survives restarts.
+func (dbManager DBManager) UpdateAlertRuleFired(id int, firedAt, observedAt int64) error {
+	defer dbManager.observe("UpdateAlertRuleFired")()
+	if _, err := dbManager.db.Exec(updateAlertRuleFiredQuery, firedAt, observedAt, id); err != nil {
+		return err
+	}
+	return nil
+}
+
+const alertRuleColumns = `
+SELECT rule_id, ticker_id, kind, threshold, window_hours, cooldown_seconds, ` +
+	`webhook_url, format, secret, active, last_fired, last_observed FROM alert_rules `
+
+const retrieveAlertRuleByIdQuery = alertRuleColumns + `WHERE rule_id=?`
+
+// Retrieves a single alert rule by its id. Returns
+// ErrNoAlertRule if there is none.
+func (dbManager DBManager) RetrieveAlertRuleById(id int) (AlertRule, error) {
+	defer dbManager.observe("RetrieveAlertRuleById")()
+	rules, err := dbManager.queryAlertRules(retrieveAlertRuleByIdQuery, id)
+	if err != nil {
+		return AlertRule{}, err
+	}
+	if len(rules) == 0 {
+		return AlertRule{}, ErrNoAlertRule
+	}
+	return rules[0], nil
+}
+
+const returnAlertRulesQuery = alertRuleColumns + `ORDER BY rule_id`
+
+// Returns every alert rule, active or not.
+func (dbManager DBManager) ReturnAlertRules() ([]AlertRule, error) {
+	defer dbManager.observe("ReturnAlertRules")()
+	return dbManager.queryAlertRules(returnAlertRulesQuery)
+}
+
+const returnActiveAlertRulesForTickerQuery = alertRuleColumns +
+	`WHERE ticker_id=? AND active=1 ORDER BY rule_id`
+
+// Returns the active alert rules that watch a given ticker.
+func (dbManager DBManager) ReturnActiveAlertRulesForTicker(tickerId int) ([]AlertRule, error) {
+	defer dbManager.observe("ReturnActiveAlertRulesForTicker")()
+	return dbManager.queryAlertRules(returnActiveAlertRulesForTickerQuery, tickerId)
+}
+
+func (dbManager DBManager) queryAlertRules(query string, args ...interface{}) ([]AlertRule, error) {
+	rows, err := dbManager.reader().Query(query, args...)
+	if err != nil {
+		dbManager.logger.Error("queryAlertRules failed", "err", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		rules        []AlertRule
+		lastFired    sql.NullInt64
+		lastObserved sql.NullInt64
+	)
+	for rows.Next() {
+		var r AlertRule
+		if err := rows.Scan(&r.Id, &r.TickerId, &r.Kind, &r.Threshold, &r.WindowHours, &r.CooldownSeconds,
+			&r.WebhookURL, &r.Format, &r.Secret, &r.Active, &lastFired, &lastObserved); err != nil {
+			dbManager.logger.Error("queryAlertRules scan failed", "err", err)
+			continue
+		}
+		r.LastFired = lastFired.Int64
+		r.LastObserved = lastObserved.Int64
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
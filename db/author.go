@@ -0,0 +1,169 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// Someone statements are posted by, with what is known of their
+// profile and how much weight their statements carry.
+type Author struct {
+	AuthorId  string `json:"author_id"`
+	Username  string `json:"username"`
+	Followers int    `json:"followers"`
+	// When the account was created, or 0 if unknown.
+	Joined   int64 `json:"joined"`
+	Verified bool  `json:"verified"`
+	// Stored statements by the author, and how many of
+	// them were spam.
+	Statements     int     `json:"statements"`
+	SpamStatements int     `json:"spam_statements"`
+	Influence      float64 `json:"influence"`
+	// When the profile was last fetched, or 0 if it never
+	// has been.
+	ProfileUpdatedAt int64 `json:"profile_updated_at"`
+}
+
+// Returns a `?` placeholder for each of n values, comma separated.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func stringArgs(s []string) []interface{} {
+	args := make([]interface{}, len(s))
+	for i, v := range s {
+		args[i] = v
+	}
+	return args
+}
+
+const returnAuthorsQuery = `
+SELECT author_id, username, followers, joined, verified, statements, spam_statements, influence, profile_updated_at ` +
+	`FROM authors WHERE author_id IN `
+
+// Returns the stored authors among ids, by id.
+func (dbManager DBManager) ReturnAuthors(ids []string) (map[string]Author, error) {
+	authors := make(map[string]Author)
+	if len(ids) == 0 {
+		return authors, nil
+	}
+	defer dbManager.observe("ReturnAuthors")()
+	rows, err := dbManager.reader().Query(returnAuthorsQuery+"("+placeholders(len(ids))+")", stringArgs(ids)...)
+	if err != nil {
+		dbManager.logger.Error("ReturnAuthors failed", "err", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a Author
+		if err := rows.Scan(&a.AuthorId, &a.Username, &a.Followers, &a.Joined, &a.Verified, &a.Statements, &a.SpamStatements, &a.Influence, &a.ProfileUpdatedAt); err != nil {
+			dbManager.logger.Error("ReturnAuthors scan failed", "err", err)
+			return nil, err
+		}
+		authors[a.AuthorId] = a
+	}
+	return authors, rows.Err()
+}
+
+const returnAuthorStatementCountsQuery = `
+SELECT author_id, COUNT(*), COALESCE(SUM(spam), 0) FROM statements ` +
+	`WHERE author_id IN `
+
+// Returns, by author id, how many statements each of ids has
+// stored and how many of those are spam.
+func (dbManager DBManager) ReturnAuthorStatementCounts(ids []string) (map[string][2]int, error) {
+	counts := make(map[string][2]int)
+	if len(ids) == 0 {
+		return counts, nil
+	}
+	defer dbManager.observe("ReturnAuthorStatementCounts")()
+	rows, err := dbManager.reader().Query(returnAuthorStatementCountsQuery+"("+placeholders(len(ids))+") GROUP BY author_id", stringArgs(ids)...)
+	if err != nil {
+		dbManager.logger.Error("ReturnAuthorStatementCounts failed", "err", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id          string
+			total, spam int
+		)
+		if err := rows.Scan(&id, &total, &spam); err != nil {
+			dbManager.logger.Error("ReturnAuthorStatementCounts scan failed", "err", err)
+			return nil, err
+		}
+		counts[id] = [2]int{total, spam}
+	}
+	return counts, rows.Err()
+}
+
+const upsertAuthorsQuery = `
+INSERT INTO authors(author_id, username, followers, joined, verified, statements, spam_statements, influence, profile_updated_at) VALUES `
+
+const upsertAuthorsUpdate = ` ON DUPLICATE KEY UPDATE username=VALUES(username), followers=VALUES(followers), ` +
+	`joined=VALUES(joined), verified=VALUES(verified), statements=VALUES(statements), ` +
+	`spam_statements=VALUES(spam_statements), influence=VALUES(influence), profile_updated_at=VALUES(profile_updated_at)`
+
+// Inserts or replaces authors in a single statement.
+func (dbManager DBManager) UpsertAuthors(authors []Author) error {
+	if len(authors) == 0 {
+		return nil
+	}
+	defer dbManager.observe("UpsertAuthors")()
+	values := make([]string, len(authors))
+	args := make([]interface{}, 0, 9*len(authors))
+	for i, a := range authors {
+		values[i] = "(" + placeholders(9) + ")"
+		args = append(args, a.AuthorId, a.Username, a.Followers, a.Joined, a.Verified, a.Statements, a.SpamStatements, a.Influence, a.ProfileUpdatedAt)
+	}
+	if _, err := dbManager.db.Exec(upsertAuthorsQuery+strings.Join(values, ", ")+upsertAuthorsUpdate, args...); err != nil {
+		dbManager.logger.Error("UpsertAuthors failed", "err", err)
+		return err
+	}
+	return nil
+}
+
+// An author of statements about a ticker.
+type TopAuthor struct {
+	Author
+	// The author's statements about the ticker in the window,
+	// and their average polarity.
+	TickerStatements int     `json:"ticker_statements"`
+	AveragePolarity  float64 `json:"average_polarity"`
+}
+
+const returnTopAuthorsQuery = `
+SELECT authors.author_id, username, followers, joined, verified, authors.statements, spam_statements, influence, ` +
+	`profile_updated_at, COUNT(*), AVG(polarity) FROM statements ` +
+	`JOIN statement_tickers ON statement_tickers.tweet_id = statements.tweet_id ` +
+	`JOIN authors ON authors.author_id = statements.author_id ` +
+	`WHERE statement_tickers.ticker_id=? AND time_stamp>=? ` +
+	`GROUP BY authors.author_id ` +
+	`ORDER BY influence * COUNT(*) DESC, authors.author_id LIMIT ?`
+
+// Returns the authors who weigh most on a ticker's sentiment since
+// fromTime: those whose influence times number of statements about
+// the ticker is highest.
+func (dbManager DBManager) ReturnTopAuthors(tickerId int, fromTime int64, limit int) ([]TopAuthor, error) {
+	defer dbManager.observe("ReturnTopAuthors")()
+	rows, err := dbManager.reader().Query(returnTopAuthorsQuery, tickerId, fromTime, limit)
+	if err != nil {
+		dbManager.logger.Error("ReturnTopAuthors failed", "ticker_id", tickerId, "err", err)
+		return nil, err
+	}
+	defer rows.Close()
+	authors := []TopAuthor{}
+	for rows.Next() {
+		var (
+			a        TopAuthor
+			polarity sql.NullFloat64
+		)
+		if err := rows.Scan(&a.AuthorId, &a.Username, &a.Followers, &a.Joined, &a.Verified, &a.Statements, &a.SpamStatements, &a.Influence, &a.ProfileUpdatedAt, &a.TickerStatements, &polarity); err != nil {
+			dbManager.logger.Error("ReturnTopAuthors scan failed", "ticker_id", tickerId, "err", err)
+			return nil, err
+		}
+		a.AveragePolarity = polarity.Float64
+		authors = append(authors, a)
+	}
+	return authors, rows.Err()
+}
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Defines the states a backfill job moves through.
+const (
+	BACKFILL_PENDING = "pending"
+	BACKFILL_RUNNING = "running"
+	BACKFILL_DONE    = "done"
+	// A chunk failed. The job keeps its cursor and is retried
+	// once it is stale.
+	BACKFILL_FAILED = "failed"
+)
+
+// Defines a request to fill the history of a ticker between
+// FromTime and ToTime. Cursor is the time up to which the
+// range has been processed, so an interrupted job resumes
+// from Cursor rather than from FromTime.
+type BackfillJob struct {
+	Id        int
+	TickerId  int
+	FromTime  int64
+	ToTime    int64
+	Cursor    int64
+	Status    string
+	UpdatedAt int64
+}
+
+const addBackfillJobQuery = `
+INSERT INTO backfill_jobs(ticker_id, from_time, to_time, cursor_time, status, updated_at) ` +
+	`VALUES (?, ?, ?, ?, ?, ?)`
+
+// Creates a pending backfill job and returns its id.
+func (dbManager DBManager) AddBackfillJob(tickerId int, fromTime, toTime int64) (int, error) {
+	defer dbManager.observe("AddBackfillJob")()
+	if fromTime >= toTime {
+		return 0, errors.New("backfill range is empty")
+	}
+	res, err := dbManager.db.Exec(addBackfillJobQuery, tickerId, fromTime, toTime, fromTime, BACKFILL_PENDING, time.Now().Unix())
+	if err != nil {
+		dbManager.logger.Error("AddBackfillJob failed", "ticker_id", tickerId, "err", err)
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+const updateBackfillJobQuery = `
+UPDATE backfill_jobs SET cursor_time=?, status=?, updated_at=? WHERE job_id=?`
+
+// Records the progress of a backfill job. Called after every
+// chunk is committed so that a restart does not repeat it, and
+// with BACKFILL_FAILED when a chunk fails.
+func (dbManager DBManager) UpdateBackfillJob(id int, cursor int64, status string) error {
+	defer dbManager.observe("UpdateBackfillJob")()
+	if _, err := dbManager.db.Exec(updateBackfillJobQuery, cursor, status, time.Now().Unix(), id); err != nil {
+		return err
+	}
+	return nil
+}
+
+const backfillJobColumns = `
+SELECT job_id, ticker_id, from_time, to_time, cursor_time, status, updated_at FROM backfill_jobs `
+
+const retrieveBackfillJobByIdQuery = backfillJobColumns + `WHERE job_id=?`
+
+// Retrieves a backfill job by its id.
+func (dbManager DBManager) RetrieveBackfillJobById(id int) (BackfillJob, error) {
+	defer dbManager.observe("RetrieveBackfillJobById")()
+	jobs, err := dbManager.queryBackfillJobs(retrieveBackfillJobByIdQuery, id)
+	if err != nil {
+		return BackfillJob{}, err
+	}
+	if len(jobs) == 0 {
+		return BackfillJob{}, errors.New("backfill job does not exist")
+	}
+	return jobs[0], nil
+}
+
+const returnStaleBackfillJobsQuery = backfillJobColumns +
+	`WHERE status<>? AND updated_at<? ORDER BY job_id`
+
+// Returns unfinished jobs that have not made progress since
+// olderThan. These are jobs whose consumer died mid-way, whose
+// message was never consumed, or that failed.
+func (dbManager DBManager) ReturnStaleBackfillJobs(olderThan int64) ([]BackfillJob, error) {
+	defer dbManager.observe("ReturnStaleBackfillJobs")()
+	return dbManager.queryBackfillJobs(returnStaleBackfillJobsQuery, BACKFILL_DONE, olderThan)
+}
+
+func (dbManager DBManager) queryBackfillJobs(query string, args ...interface{}) ([]BackfillJob, error) {
+	rows, err := dbManager.reader().Query(query, args...)
+	if err != nil {
+		dbManager.logger.Error("queryBackfillJobs failed", "err", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []BackfillJob
+	for rows.Next() {
+		var j BackfillJob
+		if err := rows.Scan(&j.Id, &j.TickerId, &j.FromTime, &j.ToTime, &j.Cursor, &j.Status, &j.UpdatedAt); err != nil {
+			dbManager.logger.Error("queryBackfillJobs scan failed", "err", err)
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+const addScrapedHoursQuery = `
+INSERT IGNORE INTO scraped_hours(ticker_id, time_stamp) VALUES `
+
+// Records that the hours starting at hourStarts have been scraped
+// for a ticker, so that hours in which nothing was found are not
+// scraped again.
+func (dbManager DBManager) AddScrapedHours(tickerId int, hourStarts ...int64) error {
+	if len(hourStarts) == 0 {
+		return nil
+	}
+	defer dbManager.observe("AddScrapedHours")()
+	values := make([]string, len(hourStarts))
+	args := make([]interface{}, 0, 2*len(hourStarts))
+	for i, h := range hourStarts {
+		values[i] = "(?, ?)"
+		args = append(args, tickerId, h)
+	}
+	if _, err := dbManager.db.Exec(addScrapedHoursQuery+strings.Join(values, ", "), args...); err != nil {
+		dbManager.logger.Error("AddScrapedHours failed", "ticker_id", tickerId, "err", err)
+		return err
+	}
+	return nil
+}
+
+const returnCoveredHoursQuery = `
+SELECT time_stamp FROM sentiments WHERE ticker_id=? AND bucket_seconds=? AND time_stamp>=? AND time_stamp<? ` +
+	`UNION SELECT time_stamp FROM scraped_hours WHERE ticker_id=? AND time_stamp>=? AND time_stamp<? ` +
+	`ORDER BY time_stamp ASC`
+
+// Returns the start of every hour in [fromTime, toTime) that has
+// an hourly sentiment stored for a ticker, or that has been
+// scraped without finding anything. Used to find holes in the
+// history.
+func (dbManager DBManager) ReturnCoveredHours(tickerId int, fromTime, toTime int64) ([]int64, error) {
+	defer dbManager.observe("ReturnCoveredHours")()
+	rows, err := dbManager.reader().Query(returnCoveredHoursQuery, tickerId, HOURLY_BUCKET, fromTime, toTime, tickerId, fromTime, toTime)
+	if err != nil {
+		dbManager.logger.Error("ReturnCoveredHours failed", "ticker_id", tickerId, "err", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		timestamps []int64
+		ts         sql.NullInt64
+	)
+	for rows.Next() {
+		if err := rows.Scan(&ts); err != nil {
+			dbManager.logger.Error("ReturnCoveredHours scan failed", "ticker_id", tickerId, "err", err)
+			continue
+		}
+		if ts.Valid {
+			timestamps = append(timestamps, ts.Int64)
+		}
+	}
+	return timestamps, rows.Err()
+}
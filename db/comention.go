@@ -0,0 +1,70 @@
+package db
+
+const upsertCoMentionsQuery = `
+INSERT INTO co_mentions(ticker_a, ticker_b, time_stamp, mentions) ` +
+	`SELECT a.ticker_id, b.ticker_id, ?, COUNT(*) FROM statements ` +
+	`JOIN statement_tickers a ON a.tweet_id = statements.tweet_id ` +
+	`JOIN statement_tickers b ON b.tweet_id = statements.tweet_id AND a.ticker_id <= b.ticker_id ` +
+	`WHERE (a.ticker_id=? OR b.ticker_id=?) AND time_stamp>=? AND time_stamp<? ` +
+	`GROUP BY a.ticker_id, b.ticker_id ` +
+	`ON DUPLICATE KEY UPDATE mentions=VALUES(mentions)`
+
+// Recomputes, for the hour starting at hourStart, how many
+// statements mention the ticker together with each other ticker,
+// and how many mention it at all (stored as a pair of the ticker
+// with itself). Like sentiment buckets, the counts are taken over
+// every stored statement, so re-scraped tweets are not counted
+// twice.
+func (dbManager DBManager) UpsertCoMentions(tickerId int, hourStart int64) error {
+	defer dbManager.observe("UpsertCoMentions")()
+	_, err := dbManager.db.Exec(upsertCoMentionsQuery,
+		hourStart,
+		tickerId,
+		tickerId,
+		hourStart,
+		hourStart+HOURLY_BUCKET,
+	)
+	if err != nil {
+		dbManager.logger.Error("UpsertCoMentions failed", "ticker_id", tickerId, "hour", hourStart, "err", err)
+	}
+	return err
+}
+
+// How often two active tickers were mentioned together. For a
+// pair of a ticker with itself, how often it was mentioned.
+type CoMention struct {
+	TickerA  int
+	NameA    string
+	TickerB  int
+	NameB    string
+	Mentions int
+}
+
+const returnCoMentionsQuery = `
+SELECT ticker_a, a.name, ticker_b, b.name, SUM(mentions) FROM co_mentions ` +
+	`JOIN tickers a ON a.ticker_id = co_mentions.ticker_a ` +
+	`JOIN tickers b ON b.ticker_id = co_mentions.ticker_b ` +
+	`WHERE a.active=1 AND b.active=1 AND time_stamp>=? ` +
+	`GROUP BY ticker_a, a.name, ticker_b, b.name`
+
+// Returns the co-mentions of active tickers in statements posted
+// since fromTime, by whole hours.
+func (dbManager DBManager) ReturnCoMentions(fromTime int64) ([]CoMention, error) {
+	defer dbManager.observe("ReturnCoMentions")()
+	rows, err := dbManager.reader().Query(returnCoMentionsQuery, fromTime-fromTime%HOURLY_BUCKET)
+	if err != nil {
+		dbManager.logger.Error("ReturnCoMentions failed", "err", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var pairs []CoMention
+	for rows.Next() {
+		var p CoMention
+		if err := rows.Scan(&p.TickerA, &p.NameA, &p.TickerB, &p.NameB, &p.Mentions); err != nil {
+			dbManager.logger.Error("ReturnCoMentions scan failed", "err", err)
+			return nil, err
+		}
+		pairs = append(pairs, p)
+	}
+	return pairs, rows.Err()
+}
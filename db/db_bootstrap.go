@@ -1,48 +1,156 @@
 package db
 
-import "log"
+import "os"
+
+// Bootstrap failures leave the schema unusable, so they end the process.
+func (dbManager DBManager) fatal(err error) {
+	dbManager.logger.Error("failed to bootstrap schema", "err", err)
+	os.Exit(1)
+}
 
 func (dbManager DBManager) dropTable(s string) {
 	//REMOVE ONCE DONE DEBUGGING
 	_, err := dbManager.db.Exec("SET FOREIGN_KEY_CHECKS = 0")
 	if err != nil {
-		log.Fatal(err)
+		dbManager.fatal(err)
 	}
 	_, err = dbManager.db.Exec("DROP TABLE IF EXISTS " + s)
 	if err != nil {
-		log.Fatal(err)
+		dbManager.fatal(err)
 	}
 	_, err = dbManager.db.Exec("SET FOREIGN_KEY_CHECKS = 1")
 	if err != nil {
-		log.Fatal(err)
+		dbManager.fatal(err)
 	}
 }
 
 func (dbManager DBManager) createTickerTable() {
-	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS tickers(ticker_id SERIAL PRIMARY KEY, name VARCHAR(255), active INT, last_scrape_time BIGINT)")
+	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS tickers(ticker_id SERIAL PRIMARY KEY, name VARCHAR(255), active INT, last_scrape_time BIGINT, next_scrape_time BIGINT, scrape_interval INT, priority INT NOT NULL DEFAULT 0, adaptive INT NOT NULL DEFAULT 0)")
 	if err != nil {
-		log.Fatal(err)
+		dbManager.fatal(err)
 	}
 	_, err = dbManager.db.Exec("ALTER TABLE tickers ADD CONSTRAINT ticker_Unique UNIQUE(name)")
 	if err != nil {
-		log.Print(err)
+		dbManager.logger.Warn("failed to add constraint", "err", err)
 	}
 }
 
 func (dbManager DBManager) createStatementTable() {
 	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS statements(tweet_id BIGINT UNSIGNED PRIMARY KEY, ticker_id BIGINT UNSIGNED, expression VARCHAR(500), url VARCHAR(255), time_stamp BIGINT, polarity FLOAT, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE)")
 	if err != nil {
-		log.Fatal(err)
+		dbManager.fatal(err)
 	}
 	_, err = dbManager.db.Exec("ALTER TABLE statements ADD CONSTRAINT url_Unique UNIQUE(url)")
 	if err != nil {
-		log.Print(err)
+		dbManager.logger.Warn("failed to add constraint", "err", err)
+	}
+	_, err = dbManager.db.Exec("ALTER TABLE statements ADD COLUMN likes INT, ADD COLUMN replies INT, ADD COLUMN retweets INT, ADD COLUMN spam BOOLEAN, ADD COLUMN author_id VARCHAR(32), ADD INDEX (author_id)")
+	if err != nil {
+		dbManager.logger.Warn("failed to add columns", "err", err)
+	}
+	// Statements stored before sources were recorded all came
+	// from Twitter.
+	_, err = dbManager.db.Exec("ALTER TABLE statements ADD COLUMN source VARCHAR(32) NOT NULL DEFAULT 'Twitter', ADD FULLTEXT INDEX statement_text (expression)")
+	if err != nil {
+		dbManager.logger.Warn("failed to add search index", "err", err)
+	}
+}
+
+// Statements stored before statement_tickers existed are
+// attributed to the ticker that stored them.
+func (dbManager DBManager) createStatementTickerTable() {
+	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS statement_tickers(tweet_id BIGINT UNSIGNED, ticker_id BIGINT UNSIGNED, PRIMARY KEY (ticker_id, tweet_id), FOREIGN KEY (tweet_id) REFERENCES statements(tweet_id) ON DELETE CASCADE, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE)")
+	if err != nil {
+		dbManager.fatal(err)
+	}
+	_, err = dbManager.db.Exec("INSERT IGNORE INTO statement_tickers(tweet_id, ticker_id) SELECT tweet_id, ticker_id FROM statements")
+	if err != nil {
+		dbManager.fatal(err)
 	}
 }
 
 func (dbManager DBManager) createSentimentTable() {
-	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS sentiments(sentiment_id SERIAL PRIMARY KEY, time_stamp BIGINT, ticker_id BIGINT UNSIGNED, hourly_sentiment FLOAT, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE)")
+	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS sentiments(sentiment_id SERIAL PRIMARY KEY, time_stamp BIGINT, ticker_id BIGINT UNSIGNED, bucket_seconds INT NOT NULL DEFAULT 3600, hourly_sentiment FLOAT, weighted_sentiment FLOAT, statement_count INT, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE)")
+	if err != nil {
+		dbManager.fatal(err)
+	}
+	_, err = dbManager.db.Exec("ALTER TABLE sentiments ADD CONSTRAINT sentiment_bucket_Unique UNIQUE(ticker_id, bucket_seconds, time_stamp)")
+	if err != nil {
+		dbManager.logger.Warn("failed to add constraint", "err", err)
+	}
+}
+
+func (dbManager DBManager) createAlertRuleTable() {
+	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS alert_rules(rule_id SERIAL PRIMARY KEY, ticker_id BIGINT UNSIGNED, kind VARCHAR(32), threshold FLOAT, window_hours INT, cooldown_seconds BIGINT, webhook_url VARCHAR(500), format VARCHAR(16), secret VARCHAR(255), active INT, last_fired BIGINT, last_observed BIGINT, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE)")
+	if err != nil {
+		dbManager.fatal(err)
+	}
+}
+
+func (dbManager DBManager) createBackfillJobTable() {
+	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS backfill_jobs(job_id SERIAL PRIMARY KEY, ticker_id BIGINT UNSIGNED, from_time BIGINT, to_time BIGINT, cursor_time BIGINT, status VARCHAR(16), updated_at BIGINT, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE)")
+	if err != nil {
+		dbManager.fatal(err)
+	}
+}
+
+func (dbManager DBManager) createSchedulerLeaseTable() {
+	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS scheduler_leases(name VARCHAR(64) PRIMARY KEY, holder VARCHAR(255), expires_at BIGINT)")
+	if err != nil {
+		dbManager.fatal(err)
+	}
+}
+
+func (dbManager DBManager) createTickerMetadataTable() {
+	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS ticker_metadata(ticker_id BIGINT UNSIGNED PRIMARY KEY, company_name VARCHAR(255), aliases TEXT, cashtag VARCHAR(32), negative_keywords TEXT, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE)")
+	if err != nil {
+		dbManager.fatal(err)
+	}
+}
+
+func (dbManager DBManager) createUntrackedMentionTable() {
+	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS untracked_mentions(symbol VARCHAR(32), tweet_id BIGINT UNSIGNED, time_stamp BIGINT, PRIMARY KEY (symbol, tweet_id), INDEX (time_stamp))")
+	if err != nil {
+		dbManager.fatal(err)
+	}
+}
+
+func (dbManager DBManager) createAutoAddedTickerTable() {
+	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS auto_added_tickers(symbol VARCHAR(32) PRIMARY KEY, added_at BIGINT)")
+	if err != nil {
+		dbManager.fatal(err)
+	}
+}
+
+// Counts statements stored before co_mentions existed.
+func (dbManager DBManager) createCoMentionTable() {
+	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS co_mentions(ticker_a BIGINT UNSIGNED, ticker_b BIGINT UNSIGNED, time_stamp BIGINT, mentions INT, PRIMARY KEY (ticker_a, ticker_b, time_stamp), INDEX (time_stamp), FOREIGN KEY (ticker_a) REFERENCES tickers(ticker_id) ON DELETE CASCADE, FOREIGN KEY (ticker_b) REFERENCES tickers(ticker_id) ON DELETE CASCADE)")
+	if err != nil {
+		dbManager.fatal(err)
+	}
+	_, err = dbManager.db.Exec("INSERT IGNORE INTO co_mentions(ticker_a, ticker_b, time_stamp, mentions) SELECT a.ticker_id, b.ticker_id, FLOOR(statements.time_stamp / 3600) * 3600 AS hour, COUNT(*) FROM statements JOIN statement_tickers a ON a.tweet_id = statements.tweet_id JOIN statement_tickers b ON b.tweet_id = statements.tweet_id AND a.ticker_id <= b.ticker_id GROUP BY a.ticker_id, b.ticker_id, hour")
+	if err != nil {
+		dbManager.fatal(err)
+	}
+}
+
+func (dbManager DBManager) createAuthorTable() {
+	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS authors(author_id VARCHAR(32) PRIMARY KEY, username VARCHAR(255), followers INT, joined BIGINT, verified BOOLEAN, statements INT, spam_statements INT, influence FLOAT, profile_updated_at BIGINT)")
+	if err != nil {
+		dbManager.fatal(err)
+	}
+}
+
+func (dbManager DBManager) createQuoteTable() {
+	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS quotes(ticker_id BIGINT UNSIGNED, time_stamp BIGINT, price DOUBLE, PRIMARY KEY (ticker_id, time_stamp), FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE)")
+	if err != nil {
+		dbManager.fatal(err)
+	}
+}
+
+func (dbManager DBManager) createScrapedHourTable() {
+	_, err := dbManager.db.Exec("CREATE TABLE IF NOT EXISTS scraped_hours(ticker_id BIGINT UNSIGNED, time_stamp BIGINT, PRIMARY KEY (ticker_id, time_stamp), FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE)")
 	if err != nil {
-		log.Fatal(err)
+		dbManager.fatal(err)
 	}
 }
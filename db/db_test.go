@@ -3,6 +3,7 @@ package db
 import (
 	"fmt"
 	"log"
+	"log/slog"
 	"math/rand"
 	"os"
 	"strconv"
@@ -40,7 +41,7 @@ func TestAddStatements(t *testing.T) {
 	dbName := os.Getenv("DB_NAME")
 	dbMasterURL := os.Getenv("DB_MASTER")
 
-	d, err := NewManager(dbUser, dbPwd, dbName, dbMasterURL)
+	d, err := NewManager(slog.Default(), dbUser, dbPwd, dbName, dbMasterURL)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -49,10 +50,13 @@ func TestAddStatements(t *testing.T) {
 	if err != nil {
 		log.Fatal(err)
 	}
-	tx := d.BeginTx()
+	tx, err := d.BeginTx()
+	if err != nil {
+		log.Fatal(err)
+	}
 	for i := 0; i < 500; i++ {
 		s := randomStatement()
-		d.AddStatements(tx, id, s.Expression, s.TimeStamp, s.Polarity, s.PermanentURL, s.ID, s.Likes, s.Replies, s.Retweets, false)
+		d.AddStatements(tx, id, s.Expression, s.TimeStamp, s.Polarity, s.PermanentURL, s.ID, s.Likes, s.Replies, s.Retweets, false, "", "Twitter")
 	}
 	if err := tx.Commit(); err != nil {
 		log.Fatal(err)
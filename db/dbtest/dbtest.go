@@ -0,0 +1,159 @@
+// Opens a db.DBManager on a temporary SQLite database, so that
+// tests can run the real queries without a MySQL server.
+//
+// The queries are written for MySQL. The driver registered here
+// translates the few constructs SQLite spells differently, and
+// tests that rely on anything else, such as full text search,
+// still need MySQL.
+package dbtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	_ "embed"
+	"io"
+	"math"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/logging"
+	"github.com/mattn/go-sqlite3"
+)
+
+// The name the translating driver is registered under.
+const DRIVER = "sqlite3_mysql"
+
+//go:embed schema.sql
+var schema string
+
+func init() {
+	sql.Register(DRIVER, translatingDriver{&sqlite3.SQLiteDriver{
+		ConnectHook: func(c *sqlite3.SQLiteConn) error {
+			return c.RegisterFunc("floor", math.Floor, true)
+		},
+	}})
+}
+
+// Opens a manager on a new database with the schema of
+// mysql/master/init.sql. The database is removed once the
+// test and its subtests are done.
+func Open(t testing.TB) db.DBManager {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "watchdog.db")
+	// Consumers write concurrently, so writers wait for the lock
+	// rather than fail.
+	sqlDB, err := sql.Open(DRIVER, "file:"+path+"?_busy_timeout=10000&_journal_mode=WAL&_foreign_keys=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { sqlDB.Close() })
+	if _, err := sqlDB.Exec(schema); err != nil {
+		t.Fatalf("creating schema: %v", err)
+	}
+	return db.NewManagerFromDB(logging.Discard(), sqlDB, "watchdog")
+}
+
+var (
+	insertIgnore     = regexp.MustCompile(`(?i)\bINSERT IGNORE\b`)
+	onDuplicateKey   = regexp.MustCompile(`(?i)\bON DUPLICATE KEY UPDATE\b`)
+	insertedValue    = regexp.MustCompile(`(?i)\bVALUES\((\w+)\)`)
+	startsWithSelect = regexp.MustCompile(`(?i)^\s*(SELECT|WITH)\b`)
+)
+
+// Rewrites a MySQL query in SQLite's dialect.
+func translate(query string) string {
+	query = insertIgnore.ReplaceAllString(query, "INSERT OR IGNORE")
+	if loc := onDuplicateKey.FindStringIndex(query); loc != nil {
+		update := insertedValue.ReplaceAllString(query[loc[1]:], "excluded.$1")
+		query = query[:loc[0]] + "ON CONFLICT DO UPDATE SET" + update
+	}
+	return query
+}
+
+type translatingDriver struct {
+	driver *sqlite3.SQLiteDriver
+}
+
+func (d translatingDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{c.(*sqlite3.SQLiteConn)}, nil
+}
+
+// Translates every query before SQLite sees it.
+type conn struct {
+	*sqlite3.SQLiteConn
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	s, err := c.SQLiteConn.PrepareContext(ctx, translate(query))
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{s.(*sqlite3.SQLiteStmt), startsWithSelect.MatchString(query)}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.SQLiteConn.ExecContext(ctx, translate(query), args)
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if !startsWithSelect.MatchString(query) {
+		return execRows(c.SQLiteConn.ExecContext(ctx, translate(query), args))
+	}
+	return c.SQLiteConn.QueryContext(ctx, translate(query), args)
+}
+
+// SQLite only runs a statement as its rows are read, whereas MySQL
+// runs it when it is queried. Statements other than a SELECT are
+// run to completion when queried, as MySQL would.
+type stmt struct {
+	*sqlite3.SQLiteStmt
+	selects bool
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if !s.selects {
+		return execRows(s.SQLiteStmt.ExecContext(ctx, args))
+	}
+	return s.SQLiteStmt.QueryContext(ctx, args)
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return s.QueryContext(context.Background(), named)
+}
+
+// Returns no rows once a statement has run.
+func execRows(_ driver.Result, err error) (driver.Rows, error) {
+	if err != nil {
+		return nil, err
+	}
+	return noRows{}, nil
+}
+
+type noRows struct{}
+
+func (noRows) Columns() []string {
+	return nil
+}
+
+func (noRows) Close() error {
+	return nil
+}
+
+func (noRows) Next(dest []driver.Value) error {
+	return io.EOF
+}
@@ -0,0 +1,50 @@
+package dbtest
+
+import (
+	"testing"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+)
+
+func TestTranslate(t *testing.T) {
+	cases := map[string]string{
+		"INSERT IGNORE INTO tickers(name) VALUES (?)":                           "INSERT OR IGNORE INTO tickers(name) VALUES (?)",
+		"INSERT INTO s(a, b) VALUES (?, ?) ON DUPLICATE KEY UPDATE b=VALUES(b)": "INSERT INTO s(a, b) VALUES (?, ?) ON CONFLICT DO UPDATE SET b=excluded.b",
+		"SELECT name FROM tickers WHERE ticker_id=?":                            "SELECT name FROM tickers WHERE ticker_id=?",
+	}
+	for query, want := range cases {
+		if got := translate(query); got != want {
+			t.Errorf("translate(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	d := Open(t)
+	tickerId, err := d.AddTicker("AMD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ticker, err := d.RetrieveTickerById(tickerId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticker.Name != "AMD" {
+		t.Fatalf("ticker = %+v, want AMD", ticker)
+	}
+
+	id, err := d.AddAlertRule(db.AlertRule{TickerId: tickerId, Kind: "sentiment_above", WebhookURL: "https://example.com", Secret: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.UpdateAlertRule(db.AlertRule{Id: id, TickerId: tickerId, Kind: "sentiment_above", Threshold: 0.7, WebhookURL: "https://example.com"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := d.RetrieveAlertRuleById(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Secret != "s3cret" || r.Threshold != 0.7 {
+		t.Errorf("update without a secret stored %+v, want the secret kept", r)
+	}
+}
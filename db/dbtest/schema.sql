@@ -0,0 +1,19 @@
+-- The schema of mysql/master/init.sql in SQLite's dialect, without
+-- the full text index that /api/statements/search depends on.
+CREATE TABLE tickers(ticker_id INTEGER PRIMARY KEY AUTOINCREMENT, name VARCHAR(255) NOT NULL UNIQUE, active INT, last_scrape_time BIGINT, next_scrape_time BIGINT, scrape_interval INT, priority INT NOT NULL DEFAULT 0, adaptive INT NOT NULL DEFAULT 0);
+CREATE TABLE statements(tweet_id INTEGER PRIMARY KEY, ticker_id INTEGER, expression VARCHAR(500), url VARCHAR(255) UNIQUE, time_stamp BIGINT, polarity FLOAT, likes INT, replies INT, retweets INT, spam BOOLEAN, author_id VARCHAR(32), source VARCHAR(32) NOT NULL DEFAULT 'Twitter', FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
+CREATE INDEX statements_author_id ON statements(author_id);
+CREATE TABLE statement_tickers(tweet_id INTEGER, ticker_id INTEGER, PRIMARY KEY (ticker_id, tweet_id), FOREIGN KEY (tweet_id) REFERENCES statements(tweet_id) ON DELETE CASCADE, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
+CREATE TABLE sentiments(sentiment_id INTEGER PRIMARY KEY AUTOINCREMENT, time_stamp BIGINT, ticker_id INTEGER, hourly_sentiment FLOAT, bucket_seconds INT NOT NULL DEFAULT 3600, statement_count INT, weighted_sentiment FLOAT, UNIQUE (ticker_id, bucket_seconds, time_stamp), FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
+CREATE TABLE alert_rules(rule_id INTEGER PRIMARY KEY AUTOINCREMENT, ticker_id INTEGER, kind VARCHAR(32), threshold FLOAT, window_hours INT, cooldown_seconds BIGINT, webhook_url VARCHAR(500), format VARCHAR(16), secret VARCHAR(255), active INT, last_fired BIGINT, last_observed BIGINT, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
+CREATE TABLE backfill_jobs(job_id INTEGER PRIMARY KEY AUTOINCREMENT, ticker_id INTEGER, from_time BIGINT, to_time BIGINT, cursor_time BIGINT, status VARCHAR(16), updated_at BIGINT, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
+CREATE TABLE scheduler_leases(name VARCHAR(64) PRIMARY KEY, holder VARCHAR(255), expires_at BIGINT);
+CREATE TABLE ticker_metadata(ticker_id INTEGER PRIMARY KEY, company_name VARCHAR(255), aliases TEXT, cashtag VARCHAR(32), negative_keywords TEXT, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
+CREATE TABLE untracked_mentions(symbol VARCHAR(32), tweet_id INTEGER, time_stamp BIGINT, PRIMARY KEY (symbol, tweet_id));
+CREATE INDEX untracked_mentions_time_stamp ON untracked_mentions(time_stamp);
+CREATE TABLE auto_added_tickers(symbol VARCHAR(32) PRIMARY KEY, added_at BIGINT);
+CREATE TABLE co_mentions(ticker_a INTEGER, ticker_b INTEGER, time_stamp BIGINT, mentions INT, PRIMARY KEY (ticker_a, ticker_b, time_stamp), FOREIGN KEY (ticker_a) REFERENCES tickers(ticker_id) ON DELETE CASCADE, FOREIGN KEY (ticker_b) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
+CREATE INDEX co_mentions_time_stamp ON co_mentions(time_stamp);
+CREATE TABLE authors(author_id VARCHAR(32) PRIMARY KEY, username VARCHAR(255), followers INT, joined BIGINT, verified BOOLEAN, statements INT, spam_statements INT, influence FLOAT, profile_updated_at BIGINT);
+CREATE TABLE quotes(ticker_id INTEGER, time_stamp BIGINT, price DOUBLE, PRIMARY KEY (ticker_id, time_stamp), FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
+CREATE TABLE scraped_hours(ticker_id INTEGER, time_stamp BIGINT, PRIMARY KEY (ticker_id, time_stamp), FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+)
+
+// A statement as exported, once per ticker it mentions.
+type ExportedStatement struct {
+	Ticker     string
+	TickerId   int
+	TweetId    uint64
+	TimeStamp  int64
+	Expression string
+	URL        string
+	Polarity   float64
+	Likes      int
+	Replies    int
+	Retweets   int
+	Spam       bool
+	AuthorId   string
+}
+
+// A sentiment bucket as exported.
+type ExportedSentiment struct {
+	Ticker            string
+	TickerId          int
+	TimeStamp         int64
+	BucketSeconds     int
+	Sentiment         float64
+	WeightedSentiment float64
+	Statements        int
+}
+
+// A quote as exported.
+type ExportedQuote struct {
+	Ticker    string
+	TickerId  int
+	TimeStamp int64
+	Price     float64
+}
+
+const streamStatementsQuery = `
+SELECT tickers.name, statement_tickers.ticker_id, statements.tweet_id, time_stamp, COALESCE(expression, ''), ` +
+	`COALESCE(url, ''), COALESCE(polarity, 0), COALESCE(likes, 0), COALESCE(replies, 0), COALESCE(retweets, 0), ` +
+	`COALESCE(spam, FALSE), COALESCE(author_id, '') FROM statements ` +
+	`JOIN statement_tickers ON statement_tickers.tweet_id = statements.tweet_id ` +
+	`JOIN tickers ON tickers.ticker_id = statement_tickers.ticker_id ` +
+	`WHERE statement_tickers.ticker_id IN `
+
+// Calls fn with each statement mentioning any of tickerIds from
+// fromTime up to toTime, by ticker then time, as it is read from
+// the database. Stops at the first error fn returns.
+func (dbManager DBManager) StreamStatements(tickerIds []int, fromTime, toTime int64, fn func(ExportedStatement) error) error {
+	defer dbManager.observe("StreamStatements")()
+	return dbManager.stream("StreamStatements", streamStatementsQuery, tickerIds, fromTime, toTime, func(rows *sql.Rows) error {
+		var s ExportedStatement
+		if err := rows.Scan(&s.Ticker, &s.TickerId, &s.TweetId, &s.TimeStamp, &s.Expression, &s.URL, &s.Polarity,
+			&s.Likes, &s.Replies, &s.Retweets, &s.Spam, &s.AuthorId); err != nil {
+			return err
+		}
+		return fn(s)
+	})
+}
+
+const streamSentimentsQuery = `
+SELECT tickers.name, sentiments.ticker_id, time_stamp, bucket_seconds, COALESCE(hourly_sentiment, 0), ` +
+	`COALESCE(weighted_sentiment, hourly_sentiment, 0), COALESCE(statement_count, 0) FROM sentiments ` +
+	`JOIN tickers ON tickers.ticker_id = sentiments.ticker_id ` +
+	`WHERE sentiments.ticker_id IN `
+
+// Calls fn with each sentiment bucket, of every size, of tickerIds
+// from fromTime up to toTime, as StreamStatements does.
+func (dbManager DBManager) StreamSentiments(tickerIds []int, fromTime, toTime int64, fn func(ExportedSentiment) error) error {
+	defer dbManager.observe("StreamSentiments")()
+	return dbManager.stream("StreamSentiments", streamSentimentsQuery, tickerIds, fromTime, toTime, func(rows *sql.Rows) error {
+		var s ExportedSentiment
+		if err := rows.Scan(&s.Ticker, &s.TickerId, &s.TimeStamp, &s.BucketSeconds, &s.Sentiment, &s.WeightedSentiment, &s.Statements); err != nil {
+			return err
+		}
+		return fn(s)
+	})
+}
+
+const streamQuotesQuery = `
+SELECT tickers.name, quotes.ticker_id, time_stamp, price FROM quotes ` +
+	`JOIN tickers ON tickers.ticker_id = quotes.ticker_id ` +
+	`WHERE quotes.ticker_id IN `
+
+// Calls fn with each stored quote of tickerIds from fromTime up to
+// toTime, as StreamStatements does.
+func (dbManager DBManager) StreamQuotes(tickerIds []int, fromTime, toTime int64, fn func(ExportedQuote) error) error {
+	defer dbManager.observe("StreamQuotes")()
+	return dbManager.stream("StreamQuotes", streamQuotesQuery, tickerIds, fromTime, toTime, func(rows *sql.Rows) error {
+		var q ExportedQuote
+		if err := rows.Scan(&q.Ticker, &q.TickerId, &q.TimeStamp, &q.Price); err != nil {
+			return err
+		}
+		return fn(q)
+	})
+}
+
+// Runs query, completed with the ticker ids and time range, and
+// hands each row to scan while the cursor is open, so only one row
+// is held at a time. The query is cancelled with the manager's
+// context, such as when an API client goes away.
+func (dbManager DBManager) stream(method, query string, tickerIds []int, fromTime, toTime int64, scan func(*sql.Rows) error) error {
+	if len(tickerIds) == 0 {
+		return nil
+	}
+	ctx := dbManager.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	args := make([]interface{}, 0, len(tickerIds)+2)
+	for _, id := range tickerIds {
+		args = append(args, id)
+	}
+	args = append(args, fromTime, toTime)
+	query += "(" + placeholders(len(tickerIds)) + ") AND time_stamp>=? AND time_stamp<? ORDER BY tickers.name, time_stamp"
+	rows, err := dbManager.reader().QueryContext(ctx, query, args...)
+	if err != nil {
+		dbManager.logger.Error(method+" failed", "err", err)
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
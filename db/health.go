@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Returned by ReplicationLag when the server is not a replica.
+var ErrNotReplica = errors.New("server is not a replica")
+
+// Checks that the database accepts connections.
+func (dbManager DBManager) Ping(ctx context.Context) error {
+	defer dbManager.observe("Ping")()
+	return dbManager.db.PingContext(ctx)
+}
+
+// Returns how far this server's replication lags behind its
+// source, as reported by Seconds_Behind_Source. Returns an error
+// if replication is stopped, and ErrNotReplica on a primary.
+func (dbManager DBManager) ReplicationLag(ctx context.Context) (time.Duration, error) {
+	defer dbManager.observe("ReplicationLag")()
+	return replicationLag(ctx, dbManager.db)
+}
+
+func replicationLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	// SHOW REPLICA STATUS needs MySQL 8.0.22, older
+	// servers only know the SLAVE spelling.
+	rows, err := db.QueryContext(ctx, "SHOW REPLICA STATUS")
+	if err != nil {
+		rows, err = db.QueryContext(ctx, "SHOW SLAVE STATUS")
+		if err != nil {
+			return 0, err
+		}
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, ErrNotReplica
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	for i, column := range columns {
+		if column != "Seconds_Behind_Source" && column != "Seconds_Behind_Master" {
+			continue
+		}
+		// NULL means the replication threads are not running.
+		if values[i] == nil {
+			return 0, errors.New("replication is not running")
+		}
+		seconds, err := strconv.ParseInt(string(values[i]), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, errors.New("replica status has no Seconds_Behind_Source column")
+}
@@ -1,12 +1,15 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/jonreesman/watch-dog-kafka/metrics"
+	"github.com/jonreesman/watch-dog-kafka/tracing"
 	"github.com/jonreesman/watch-dog-kafka/twitter"
 )
 
@@ -21,6 +24,12 @@ type DBManager struct {
 	dbPwd  string
 	dbURL  string
 	URI    string
+	// Only used to parent the spans of queries, see WithContext().
+	ctx    context.Context
+	logger *slog.Logger
+	// Routes reads to replicas, nil if there are none. See NewRouter().
+	router      *router
+	readPrimary bool
 }
 
 type TickerSlice []Ticker
@@ -34,20 +43,71 @@ type Ticker struct {
 	HourlySentiment float64
 	Id              int
 	Active          int
+	NextScrapeTime  int64
+	// Seconds between scrapes, 0 means the priority's default.
+	ScrapeInterval int
+	Priority       int
+	// Scale ScrapeInterval with recent mention volume.
+	Adaptive bool
 }
 
 func (dbManager DBManager) Close() {
 	dbManager.db.Close()
+	if dbManager.router != nil {
+		for _, rep := range dbManager.router.replicas {
+			rep.db.Close()
+		}
+	}
+}
+
+// Returns a copy of the manager whose queries are traced as
+// children of the span in ctx. The copy shares the connection
+// pool, so it is cheap to make one per request or message.
+func (dbManager DBManager) WithContext(ctx context.Context) DBManager {
+	dbManager.ctx = ctx
+	return dbManager
+}
+
+// Returns a copy of the manager that logs to logger, so that
+// callers can attach their own fields to database errors.
+func (dbManager DBManager) WithLogger(logger *slog.Logger) DBManager {
+	dbManager.logger = logger
+	return dbManager
+}
+
+// Called on entry to every DBManager method. Starts a span if
+// the manager carries a traced context, and returns a function
+// that ends it and records the method's latency.
+func (dbManager DBManager) observe(method string) func() {
+	start := time.Now()
+	var span *tracing.Span
+	if tracing.SpanFromContext(dbManager.ctx) != nil {
+		_, span = tracing.Start(dbManager.ctx, "db."+method, tracing.KIND_CLIENT)
+		span.SetAttribute("db.system", "mysql")
+		span.SetAttribute("db.name", dbManager.dbName)
+	}
+	return func() {
+		span.End()
+		metrics.DBQueryDuration.Since(start, method)
+	}
+}
+
+// Creates a DB Manager around a connection pool that is already
+// open, such as the SQLite database of dbtest.Open(). The schema
+// must already exist.
+func NewManagerFromDB(logger *slog.Logger, sqlDB *sql.DB, dbName string) DBManager {
+	return DBManager{db: sqlDB, dbName: dbName, logger: logger.With("db", dbName)}
 }
 
 // Creates and returns a DB Manager based off the type
 // of connection the implementer needs. Here, it is either
 // a master or slave connection.
-func NewManager(dbUser, dbPwd, dbName, dbURL string) (DBManager, error) {
+func NewManager(logger *slog.Logger, dbUser, dbPwd, dbName, dbURL string) (DBManager, error) {
 	var (
 		d   DBManager
 		err error
 	)
+	d.logger = logger.With("db", dbURL)
 	d.dbUser = dbUser
 	d.dbPwd = dbPwd
 	d.dbName = dbName
@@ -56,17 +116,17 @@ func NewManager(dbUser, dbPwd, dbName, dbURL string) (DBManager, error) {
 	d.URI = fmt.Sprintf("%s:%s@tcp(%s)/%s", d.dbUser, d.dbPwd, d.dbURL, d.dbName)
 	d.db, err = sql.Open("mysql", d.URI)
 	if err != nil {
-		log.Printf("Failed to open connection in DB NewManager(): %v", err)
+		d.logger.Error("failed to open connection", "err", err)
 		return DBManager{}, err
 	}
 
 	if err := d.db.Ping(); err != nil {
-		log.Printf("Failed to Ping DB in NewManager(): %v", err)
+		d.logger.Error("failed to ping", "err", err)
 		return DBManager{}, err
 	}
 
 	if _, err := d.db.Exec(fmt.Sprintf("USE %s", d.dbName)); err != nil {
-		log.Printf("Failed to `USE %s` in NewManager(): %v", d.dbName, err)
+		d.logger.Error("failed to select database", "database", d.dbName, "err", err)
 		return DBManager{}, err
 	}
 
@@ -79,7 +139,18 @@ func NewManager(dbUser, dbPwd, dbName, dbURL string) (DBManager, error) {
 	/*if _, err := d.ReturnActiveTickers(); err != nil {
 		d.createTickerTable()
 		d.createStatementTable()
+		d.createStatementTickerTable()
 		d.createSentimentTable()
+		d.createAlertRuleTable()
+		d.createBackfillJobTable()
+		d.createSchedulerLeaseTable()
+		d.createTickerMetadataTable()
+		d.createUntrackedMentionTable()
+		d.createAutoAddedTickerTable()
+		d.createCoMentionTable()
+		d.createAuthorTable()
+		d.createQuoteTable()
+		d.createScrapedHourTable()
 	}*/
 	return d, nil
 }
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+)
+
+// Returned by RetrieveTickerMetadata() for a ticker that has
+// none stored.
+var ErrNoMetadata = errors.New("ticker has no metadata")
+
+// Describes how a ticker is talked about, so that sources can
+// search for it and discard statements that are not about it.
+type TickerMetadata struct {
+	TickerId    int    `json:"ticker_id"`
+	CompanyName string `json:"company_name"`
+	// Other names for the ticker, such as a product or a
+	// former name.
+	Aliases []string `json:"aliases"`
+	Cashtag string   `json:"cashtag"`
+	// Statements mentioning any of these are not about
+	// the ticker.
+	NegativeKeywords []string `json:"negative_keywords"`
+}
+
+// Lists are stored as JSON arrays.
+func (m TickerMetadata) lists() (aliases, negative []byte, err error) {
+	if aliases, err = json.Marshal(nonNil(m.Aliases)); err != nil {
+		return nil, nil, err
+	}
+	negative, err = json.Marshal(nonNil(m.NegativeKeywords))
+	return aliases, negative, err
+}
+
+func (m *TickerMetadata) setLists(aliases, negative []byte) error {
+	if err := json.Unmarshal(aliases, &m.Aliases); err != nil {
+		return err
+	}
+	return json.Unmarshal(negative, &m.NegativeKeywords)
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+const addTickerMetadataQuery = `
+INSERT IGNORE INTO ticker_metadata(ticker_id, company_name, aliases, cashtag, negative_keywords) ` +
+	`VALUES (?, ?, ?, ?, ?)`
+
+// Stores metadata for a ticker that has none. Metadata that
+// already exists, perhaps edited by an admin, is kept.
+func (dbManager DBManager) AddTickerMetadata(m TickerMetadata) error {
+	defer dbManager.observe("AddTickerMetadata")()
+	aliases, negative, err := m.lists()
+	if err != nil {
+		return err
+	}
+	if _, err := dbManager.db.Exec(addTickerMetadataQuery, m.TickerId, m.CompanyName, aliases, m.Cashtag, negative); err != nil {
+		dbManager.logger.Error("AddTickerMetadata failed", "ticker_id", m.TickerId, "err", err)
+		return err
+	}
+	return nil
+}
+
+const upsertTickerMetadataQuery = `
+INSERT INTO ticker_metadata(ticker_id, company_name, aliases, cashtag, negative_keywords) ` +
+	`VALUES (?, ?, ?, ?, ?) ` +
+	`ON DUPLICATE KEY UPDATE company_name=VALUES(company_name), aliases=VALUES(aliases), ` +
+	`cashtag=VALUES(cashtag), negative_keywords=VALUES(negative_keywords)`
+
+// Replaces the metadata of a ticker.
+func (dbManager DBManager) UpsertTickerMetadata(m TickerMetadata) error {
+	defer dbManager.observe("UpsertTickerMetadata")()
+	aliases, negative, err := m.lists()
+	if err != nil {
+		return err
+	}
+	if _, err := dbManager.db.Exec(upsertTickerMetadataQuery, m.TickerId, m.CompanyName, aliases, m.Cashtag, negative); err != nil {
+		dbManager.logger.Error("UpsertTickerMetadata failed", "ticker_id", m.TickerId, "err", err)
+		return err
+	}
+	return nil
+}
+
+const retrieveTickerMetadataQuery = `
+SELECT company_name, aliases, cashtag, negative_keywords FROM ticker_metadata WHERE ticker_id=?`
+
+// Returns the metadata of a ticker, or ErrNoMetadata if it
+// has none.
+func (dbManager DBManager) RetrieveTickerMetadata(tickerId int) (TickerMetadata, error) {
+	defer dbManager.observe("RetrieveTickerMetadata")()
+	m := TickerMetadata{TickerId: tickerId}
+	var aliases, negative []byte
+	err := dbManager.reader().QueryRow(retrieveTickerMetadataQuery, tickerId).Scan(&m.CompanyName, &aliases, &m.Cashtag, &negative)
+	if errors.Is(err, sql.ErrNoRows) {
+		return m, ErrNoMetadata
+	}
+	if err != nil {
+		dbManager.logger.Error("RetrieveTickerMetadata failed", "ticker_id", tickerId, "err", err)
+		return m, err
+	}
+	return m, m.setLists(aliases, negative)
+}
+
+const returnAllTickerMetadataQuery = `
+SELECT ticker_id, company_name, aliases, cashtag, negative_keywords FROM ticker_metadata`
+
+// Returns the metadata of every ticker that has any, by ticker id.
+func (dbManager DBManager) ReturnAllTickerMetadata() (map[int]TickerMetadata, error) {
+	defer dbManager.observe("ReturnAllTickerMetadata")()
+	rows, err := dbManager.reader().Query(returnAllTickerMetadataQuery)
+	if err != nil {
+		dbManager.logger.Error("ReturnAllTickerMetadata failed", "err", err)
+		return nil, err
+	}
+	defer rows.Close()
+	metadata := make(map[int]TickerMetadata)
+	for rows.Next() {
+		var (
+			m                 TickerMetadata
+			aliases, negative []byte
+		)
+		if err := rows.Scan(&m.TickerId, &m.CompanyName, &aliases, &m.Cashtag, &negative); err != nil {
+			dbManager.logger.Error("ReturnAllTickerMetadata scan failed", "err", err)
+			return nil, err
+		}
+		if err := m.setLists(aliases, negative); err != nil {
+			return nil, err
+		}
+		metadata[m.TickerId] = m
+	}
+	return metadata, rows.Err()
+}
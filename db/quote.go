@@ -0,0 +1,53 @@
+package db
+
+import "strings"
+
+const upsertQuotesQuery = `
+INSERT INTO quotes(ticker_id, time_stamp, price) VALUES `
+
+// Stores hourly prices of a ticker, overwriting any already
+// stored for the same hours.
+func (dbManager DBManager) UpsertQuotes(tickerId int, quotes []IntervalQuote) error {
+	if len(quotes) == 0 {
+		return nil
+	}
+	defer dbManager.observe("UpsertQuotes")()
+	values := make([]string, len(quotes))
+	args := make([]interface{}, 0, 3*len(quotes))
+	for i, q := range quotes {
+		values[i] = "(?, ?, ?)"
+		args = append(args, tickerId, q.TimeStamp, q.CurrentPrice)
+	}
+	query := upsertQuotesQuery + strings.Join(values, ", ") + " ON DUPLICATE KEY UPDATE price=VALUES(price)"
+	if _, err := dbManager.db.Exec(query, args...); err != nil {
+		dbManager.logger.Error("UpsertQuotes failed", "ticker_id", tickerId, "err", err)
+		return err
+	}
+	return nil
+}
+
+const returnQuotesQuery = `
+SELECT time_stamp, price FROM quotes ` +
+	`WHERE ticker_id=? AND time_stamp>=? AND time_stamp<? ORDER BY time_stamp`
+
+// Returns the stored prices of a ticker from fromTime up to
+// toTime, oldest first.
+func (dbManager DBManager) ReturnQuotes(tickerId int, fromTime, toTime int64) ([]IntervalQuote, error) {
+	defer dbManager.observe("ReturnQuotes")()
+	rows, err := dbManager.reader().Query(returnQuotesQuery, tickerId, fromTime, toTime)
+	if err != nil {
+		dbManager.logger.Error("ReturnQuotes failed", "ticker_id", tickerId, "err", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var quotes []IntervalQuote
+	for rows.Next() {
+		var q IntervalQuote
+		if err := rows.Scan(&q.TimeStamp, &q.CurrentPrice); err != nil {
+			dbManager.logger.Error("ReturnQuotes scan failed", "ticker_id", tickerId, "err", err)
+			return nil, err
+		}
+		quotes = append(quotes, q)
+	}
+	return quotes, rows.Err()
+}
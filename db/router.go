@@ -0,0 +1,235 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/metrics"
+)
+
+// How often MonitorReplicas measures replication lag.
+const REPLICA_CHECK_INTERVAL = 5 * time.Second
+
+type readPrimaryKey struct{}
+
+// Returns a context whose reads are served by the primary, so that
+// a request sees its own writes while the replicas catch up. It
+// takes effect once passed to DBManager.WithContext().
+func ReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readPrimaryKey{}, true)
+}
+
+func readsPrimary(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	v, _ := ctx.Value(readPrimaryKey{}).(bool)
+	return v
+}
+
+// Reports whether a read replica is serving reads.
+type ReplicaStatus struct {
+	URL     string  `json:"url"`
+	Serving bool    `json:"serving"`
+	Lag     float64 `json:"lag_seconds"`
+	Error   string  `json:"error,omitempty"`
+	// When the lag was last measured.
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// A read replica and the outcome of its last lag measurement.
+type replica struct {
+	url string
+	db  *sql.DB
+	lag func(ctx context.Context) (time.Duration, error)
+
+	mu      sync.Mutex
+	last    time.Duration
+	err     error
+	checked time.Time
+}
+
+// Returns the replica's state. The lag grows with the age of the
+// measurement, so a replica that is no longer being measured stops
+// serving reads once the measurement is older than maxLag.
+func (r *replica) status(maxLag time.Duration) ReplicaStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := ReplicaStatus{URL: r.url, CheckedAt: r.checked, Lag: r.last.Seconds()}
+	switch {
+	case r.checked.IsZero():
+		s.Error = "lag not measured yet"
+	case r.err != nil:
+		s.Error = r.err.Error()
+	default:
+		lag := r.last + time.Since(r.checked)
+		if lag > maxLag {
+			s.Error = fmt.Sprintf("lag of %v exceeds %v", lag.Round(time.Second), maxLag)
+		}
+	}
+	s.Serving = s.Error == ""
+	return s
+}
+
+// Spreads reads over the replicas that are keeping up with
+// the primary. It is shared by every copy of a DBManager.
+type router struct {
+	replicas []*replica
+	maxLag   time.Duration
+	next     uint32
+	logger   *slog.Logger
+}
+
+// Measures the lag of every replica, logging when one
+// stops or starts serving reads.
+func (r *router) measure(ctx context.Context) {
+	for _, rep := range r.replicas {
+		before := rep.status(r.maxLag)
+		lag, err := rep.lag(ctx)
+		rep.mu.Lock()
+		rep.last, rep.err, rep.checked = lag, err, time.Now()
+		rep.mu.Unlock()
+		after := rep.status(r.maxLag)
+
+		if err != nil {
+			metrics.DBReplicaLag.WithLabelValues(rep.url).Set(-1)
+		} else {
+			metrics.DBReplicaLag.WithLabelValues(rep.url).Set(lag.Seconds())
+		}
+		if before.Serving && !after.Serving {
+			r.logger.Warn("replica stopped serving reads", "replica", rep.url, "err", after.Error)
+		} else if !before.Serving && after.Serving {
+			r.logger.Info("replica serving reads", "replica", rep.url, "lag", lag)
+		}
+	}
+}
+
+// Returns the next replica that is serving reads, or nil if
+// none are.
+func (r *router) pick() *replica {
+	n := len(r.replicas)
+	start := int(atomic.AddUint32(&r.next, 1))
+	for i := 0; i < n; i++ {
+		rep := r.replicas[(start+i)%n]
+		if rep.status(r.maxLag).Serving {
+			return rep
+		}
+	}
+	return nil
+}
+
+// Creates a DB Manager that sends writes to the primary and
+// reads to the replicas whose replication lag is within maxLag.
+// Reads fail over to the primary when no replica is keeping up.
+// Replicas that are down at startup are retried by
+// MonitorReplicas(), and a replica at the primary's address
+// is ignored.
+func NewRouter(logger *slog.Logger, dbUser, dbPwd, dbName, primary string, replicas []string, maxLag time.Duration) (DBManager, error) {
+	d, err := NewManager(logger, dbUser, dbPwd, dbName, primary)
+	if err != nil {
+		return DBManager{}, err
+	}
+	r := &router{maxLag: maxLag, logger: logger.With("component", "db_router")}
+	for _, url := range replicas {
+		if url == primary {
+			continue
+		}
+		conn, err := sql.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s)/%s", dbUser, dbPwd, url, dbName))
+		if err != nil {
+			d.Close()
+			return DBManager{}, err
+		}
+		conn.SetMaxOpenConns(55)
+		conn.SetMaxIdleConns(55)
+		r.replicas = append(r.replicas, &replica{
+			url: url,
+			db:  conn,
+			lag: func(ctx context.Context) (time.Duration, error) { return replicationLag(ctx, conn) },
+		})
+	}
+	if len(r.replicas) == 0 {
+		return d, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), REPLICA_CHECK_INTERVAL)
+	defer cancel()
+	r.measure(ctx)
+	d.router = r
+	return d, nil
+}
+
+// Measures replication lag every interval until ctx is done,
+// so that reads move off a replica as soon as it falls behind
+// and back once it catches up.
+func (dbManager DBManager) MonitorReplicas(ctx context.Context, interval time.Duration) {
+	if dbManager.router == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		measureCtx, cancel := context.WithTimeout(ctx, interval)
+		dbManager.router.measure(measureCtx)
+		cancel()
+	}
+}
+
+// Returns the state of every replica.
+func (dbManager DBManager) Replicas() []ReplicaStatus {
+	statuses := make([]ReplicaStatus, 0)
+	if dbManager.router == nil {
+		return statuses
+	}
+	for _, rep := range dbManager.router.replicas {
+		statuses = append(statuses, rep.status(dbManager.router.maxLag))
+	}
+	return statuses
+}
+
+// Fails if any replica is not serving reads. Reads fail over
+// to the primary, so this is not fatal to readiness.
+func (dbManager DBManager) CheckReplicas(ctx context.Context) error {
+	var failing []string
+	for _, s := range dbManager.Replicas() {
+		if !s.Serving {
+			failing = append(failing, fmt.Sprintf("%s: %s", s.URL, s.Error))
+		}
+	}
+	if len(failing) > 0 {
+		return fmt.Errorf("replicas not serving reads: %s", strings.Join(failing, "; "))
+	}
+	return nil
+}
+
+// Returns a copy of the manager whose reads always go to the
+// primary. Used by writers that read back what they wrote,
+// such as the consumers and the scheduler.
+func (dbManager DBManager) ReadPrimary() DBManager {
+	dbManager.readPrimary = true
+	return dbManager
+}
+
+// Returns the connection pool a read should use: a replica
+// that is keeping up, or else the primary.
+func (dbManager DBManager) reader() *sql.DB {
+	if dbManager.router == nil || dbManager.readPrimary || readsPrimary(dbManager.ctx) {
+		metrics.DBReads.WithLabelValues("primary").Inc()
+		return dbManager.db
+	}
+	if rep := dbManager.router.pick(); rep != nil {
+		metrics.DBReads.WithLabelValues("replica").Inc()
+		return rep.db
+	}
+	metrics.DBReads.WithLabelValues("primary_failover").Inc()
+	return dbManager.db
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+// Returns a router over replicas reporting the given lags. The
+// connections are never used, so nothing needs to be listening.
+func testRouter(t *testing.T, lags map[string]func() (time.Duration, error)) DBManager {
+	t.Helper()
+	open := func(url string) *sql.DB {
+		conn, err := sql.Open("mysql", "user:pwd@tcp("+url+")/app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	r := &router{maxLag: 30 * time.Second, logger: slog.Default()}
+	for url, lag := range lags {
+		lag := lag
+		r.replicas = append(r.replicas, &replica{
+			url: url,
+			db:  open(url),
+			lag: func(context.Context) (time.Duration, error) { return lag() },
+		})
+	}
+	r.measure(context.Background())
+	return DBManager{db: open("primary:3306"), router: r}
+}
+
+func (dbManager DBManager) readsFrom() string {
+	conn := dbManager.reader()
+	for _, rep := range dbManager.router.replicas {
+		if rep.db == conn {
+			return rep.url
+		}
+	}
+	return "primary"
+}
+
+func TestRouterFailover(t *testing.T) {
+	lag := 5 * time.Second
+	d := testRouter(t, map[string]func() (time.Duration, error){
+		"replica:3306": func() (time.Duration, error) { return lag, nil },
+	})
+	if got := d.readsFrom(); got != "replica:3306" {
+		t.Fatalf("read from %s, want the replica", got)
+	}
+
+	lag = time.Minute
+	d.router.measure(context.Background())
+	if got := d.readsFrom(); got != "primary" {
+		t.Fatalf("read from %s while the replica lags, want the primary", got)
+	}
+	if err := d.CheckReplicas(context.Background()); err == nil {
+		t.Error("expected a lagging replica to fail the check")
+	}
+
+	lag = 0
+	d.router.measure(context.Background())
+	if got := d.readsFrom(); got != "replica:3306" {
+		t.Fatalf("read from %s after the replica caught up", got)
+	}
+
+	// A measurement older than the maximum lag no longer
+	// vouches for the replica.
+	d.router.replicas[0].checked = time.Now().Add(-time.Minute)
+	if got := d.readsFrom(); got != "primary" {
+		t.Fatalf("read from %s with a stale measurement", got)
+	}
+}
+
+func TestRouterSkipsBrokenReplicas(t *testing.T) {
+	d := testRouter(t, map[string]func() (time.Duration, error){
+		"broken:3306":  func() (time.Duration, error) { return 0, errors.New("replication is not running") },
+		"healthy:3306": func() (time.Duration, error) { return time.Second, nil },
+	})
+	for i := 0; i < 4; i++ {
+		if got := d.readsFrom(); got != "healthy:3306" {
+			t.Fatalf("read from %s, want the healthy replica", got)
+		}
+	}
+	statuses := d.Replicas()
+	if len(statuses) != 2 {
+		t.Fatalf("got %d statuses", len(statuses))
+	}
+	for _, s := range statuses {
+		if s.Serving != (s.URL == "healthy:3306") {
+			t.Errorf("unexpected status %+v", s)
+		}
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	d := testRouter(t, map[string]func() (time.Duration, error){
+		"replica:3306": func() (time.Duration, error) { return 0, nil },
+	})
+	if got := d.ReadPrimary().readsFrom(); got != "primary" {
+		t.Errorf("ReadPrimary() read from %s", got)
+	}
+	ctx := ReadYourWrites(context.Background())
+	if got := d.WithContext(ctx).readsFrom(); got != "primary" {
+		t.Errorf("read-your-writes context read from %s", got)
+	}
+	if got := d.WithContext(context.Background()).readsFrom(); got != "replica:3306" {
+		t.Errorf("plain context read from %s", got)
+	}
+}
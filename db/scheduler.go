@@ -0,0 +1,142 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Defines the priority tiers a ticker can be scraped at. Higher
+// tiers are published first and default to shorter intervals.
+// The zero value is the normal tier.
+const (
+	PRIORITY_LOW    = -1
+	PRIORITY_NORMAL = 0
+	PRIORITY_HIGH   = 1
+)
+
+const acquireLeaseQuery = `
+INSERT INTO scheduler_leases(name, holder, expires_at) VALUES (?, ?, ?) ` +
+	`ON DUPLICATE KEY UPDATE ` +
+	`holder=IF(expires_at<? OR holder=?, VALUES(holder), holder), ` +
+	`expires_at=IF(holder=?, VALUES(expires_at), expires_at)`
+
+const retrieveLeaseHolderQuery = `
+SELECT holder FROM scheduler_leases WHERE name=?`
+
+// Attempts to take or renew the named lease for holder. The lease
+// is granted if nobody holds it, it has expired, or holder already
+// has it. Returns whether holder owns the lease afterwards. Since
+// the row is only ever changed in a single statement, at most one
+// instance can hold a lease at a time.
+func (dbManager DBManager) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	defer dbManager.observe("AcquireLease")()
+	now := time.Now()
+	if _, err := dbManager.db.Exec(acquireLeaseQuery,
+		name,
+		holder,
+		now.Add(ttl).Unix(),
+		now.Unix(),
+		holder,
+		holder,
+	); err != nil {
+		return false, err
+	}
+	var current string
+	if err := dbManager.db.QueryRow(retrieveLeaseHolderQuery, name).Scan(&current); err != nil {
+		return false, err
+	}
+	return current == holder, nil
+}
+
+const releaseLeaseQuery = `
+UPDATE scheduler_leases SET expires_at=0 WHERE name=? AND holder=?`
+
+// Gives up a lease early so another instance can take over
+// without waiting for it to expire.
+func (dbManager DBManager) ReleaseLease(name, holder string) error {
+	defer dbManager.observe("ReleaseLease")()
+	_, err := dbManager.db.Exec(releaseLeaseQuery, name, holder)
+	return err
+}
+
+const returnDueTickersQuery = `
+SELECT ticker_id, name, next_scrape_time, scrape_interval, priority, adaptive FROM tickers ` +
+	`WHERE active=1 AND (next_scrape_time IS NULL OR next_scrape_time<=?) ` +
+	`ORDER BY priority DESC, next_scrape_time ASC`
+
+// Returns the active tickers whose next scrape is due at now,
+// highest priority first. Tickers that have never been
+// scheduled are always due.
+func (dbManager DBManager) ReturnDueTickers(now int64) (TickerSlice, error) {
+	defer dbManager.observe("ReturnDueTickers")()
+	rows, err := dbManager.reader().Query(returnDueTickersQuery, now)
+	if err != nil {
+		dbManager.logger.Error("ReturnDueTickers failed", "err", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		tickers        TickerSlice
+		id             int
+		name           string
+		nextScrapeTime sql.NullInt64
+		scrapeInterval sql.NullInt64
+		priority       sql.NullInt64
+		adaptive       sql.NullInt64
+	)
+	for rows.Next() {
+		if err := rows.Scan(&id, &name, &nextScrapeTime, &scrapeInterval, &priority, &adaptive); err != nil {
+			dbManager.logger.Error("ReturnDueTickers scan failed", "err", err)
+			continue
+		}
+		tickers.appendTicker(Ticker{
+			Id:             id,
+			Name:           name,
+			NextScrapeTime: nextScrapeTime.Int64,
+			ScrapeInterval: int(scrapeInterval.Int64),
+			Priority:       int(priority.Int64),
+			Adaptive:       adaptive.Int64 == 1,
+		})
+	}
+	return tickers, rows.Err()
+}
+
+const setNextScrapeTimeQuery = `
+UPDATE tickers SET next_scrape_time=? WHERE ticker_id=?`
+
+// Persists when a ticker should next be scraped.
+func (dbManager DBManager) SetNextScrapeTime(id int, next int64) error {
+	defer dbManager.observe("SetNextScrapeTime")()
+	_, err := dbManager.db.Exec(setNextScrapeTimeQuery, next, id)
+	return err
+}
+
+const updateTickerScheduleQuery = `
+UPDATE tickers SET scrape_interval=?, priority=?, adaptive=?, next_scrape_time=NULL ` +
+	`WHERE ticker_id=?`
+
+// Changes how often and how urgently a ticker is scraped. The
+// ticker's next run is cleared so the new cadence applies from
+// the scheduler's next tick rather than after the old interval.
+// Returns ErrNoTicker if there is no ticker with the id.
+func (dbManager DBManager) UpdateTickerSchedule(id int, scrapeInterval int, priority int, adaptive bool) error {
+	defer dbManager.observe("UpdateTickerSchedule")()
+	adaptiveInt := 0
+	if adaptive {
+		adaptiveInt = 1
+	}
+	res, err := dbManager.db.Exec(updateTickerScheduleQuery, scrapeInterval, priority, adaptiveInt, id)
+	if err != nil {
+		dbManager.logger.Error("UpdateTickerSchedule failed", "ticker_id", id, "err", err)
+		return err
+	}
+	// No rows change either when the ticker is missing or when
+	// its schedule already had these values.
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		if _, err := dbManager.ReadPrimary().RetrieveTickerById(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"unicode"
+)
+
+// Filters and orders a search of stored statements. Zero values
+// leave a filter out.
+type StatementSearch struct {
+	// Words and "quoted phrases" that must all appear, see
+	// BooleanQuery(). Without any, or with only excluded ones,
+	// statements are returned newest first rather than by
+	// relevance.
+	Text      string
+	TickerIds []int
+	Source    string
+	FromTime  int64
+	ToTime    int64
+	// Bounds on polarity, inclusive.
+	MinPolarity *float64
+	MaxPolarity *float64
+	Spam        *bool
+	// Least likes, replies and retweets combined.
+	MinEngagement int
+	Limit         int
+	// Where the previous page ended, if any.
+	After *SearchCursor
+}
+
+// The position of a search result, from which the next page
+// carries on.
+type SearchCursor struct {
+	Relevance float64 `json:"r,omitempty"`
+	TimeStamp int64   `json:"t,omitempty"`
+	TweetId   uint64  `json:"id,string"`
+}
+
+// A statement found by a search.
+type SearchResult struct {
+	TweetId    uint64  `json:"tweet_id,string"`
+	TimeStamp  int64   `json:"time_stamp"`
+	Expression string  `json:"expression"`
+	URL        string  `json:"url"`
+	Polarity   float64 `json:"polarity"`
+	Likes      int     `json:"likes"`
+	Replies    int     `json:"replies"`
+	Retweets   int     `json:"retweets"`
+	Spam       bool    `json:"spam"`
+	Source     string  `json:"source"`
+	// Names of the tickers the statement is attributed to.
+	Tickers []string `json:"tickers"`
+	// How well the statement matches the text searched for,
+	// or 0 without one.
+	Relevance float64 `json:"relevance"`
+}
+
+// Returns where the next page after r begins.
+func (r SearchResult) Cursor() SearchCursor {
+	return SearchCursor{Relevance: r.Relevance, TimeStamp: r.TimeStamp, TweetId: r.TweetId}
+}
+
+// Relevance is a float computed afresh for every page, so cursors
+// treat values this close as equal.
+const RELEVANCE_EPSILON = 1e-9
+
+// Turns a search into a MySQL boolean mode full-text query in which
+// every word and "quoted phrase" is required, a leading - excludes
+// a word or phrase instead and a trailing * matches a prefix. Other
+// operators are stripped. Returns "" if nothing is left to match.
+func BooleanQuery(text string) string {
+	return strings.Join(booleanTerms(text), " ")
+}
+
+// Returns the terms of a search that only excludes, such as
+// "-puts -calls", as a query matching statements with any of
+// them, or "" if the search requires a term. MySQL matches nothing
+// for a boolean query of exclusions alone, so such a search keeps
+// the statements this does not match instead.
+func exclusionQuery(text string) string {
+	terms := booleanTerms(text)
+	for i, term := range terms {
+		if !strings.HasPrefix(term, "-") {
+			return ""
+		}
+		terms[i] = term[1:]
+	}
+	return strings.Join(terms, " ")
+}
+
+// Returns each term of BooleanQuery(text).
+func booleanTerms(text string) []string {
+	var terms []string
+	for len(text) > 0 {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if text == "" {
+			break
+		}
+		op := "+"
+		if text[0] == '-' {
+			op = "-"
+			text = text[1:]
+		}
+		if strings.HasPrefix(text, `"`) {
+			end := strings.Index(text[1:], `"`)
+			var phrase string
+			if end < 0 {
+				phrase, text = text[1:], ""
+			} else {
+				phrase, text = text[1:end+1], text[end+2:]
+			}
+			if words := strings.Fields(searchWords(phrase)); len(words) > 0 {
+				terms = append(terms, op+`"`+strings.Join(words, " ")+`"`)
+			}
+			continue
+		}
+		end := strings.IndexFunc(text, unicode.IsSpace)
+		if end < 0 {
+			end = len(text)
+		}
+		word := text[:end]
+		text = text[end:]
+		prefix := strings.HasSuffix(word, "*")
+		for _, w := range strings.Fields(searchWords(word)) {
+			terms = append(terms, op+w)
+		}
+		if prefix && len(terms) > 0 {
+			terms[len(terms)-1] += "*"
+		}
+	}
+	return terms
+}
+
+// Replaces everything but letters, digits and underscores with
+// spaces, as the full-text index splits words on them anyway. A
+// cashtag such as $AMD is searched for as AMD.
+func searchWords(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return ' '
+	}, s)
+}
+
+const searchStatementsSelect = `
+SELECT statements.tweet_id, time_stamp, COALESCE(expression, ''), COALESCE(url, ''), COALESCE(polarity, 0), ` +
+	`COALESCE(likes, 0), COALESCE(replies, 0), COALESCE(retweets, 0), COALESCE(spam, FALSE), source, ` +
+	`(SELECT GROUP_CONCAT(tickers.name ORDER BY tickers.name SEPARATOR ',') FROM statement_tickers ` +
+	`JOIN tickers ON tickers.ticker_id = statement_tickers.ticker_id ` +
+	`WHERE statement_tickers.tweet_id = statements.tweet_id), `
+
+const searchMatch = `MATCH(expression) AGAINST(? IN BOOLEAN MODE)`
+
+// Returns a page of the statements matching search, most relevant
+// first if it has text to match and newest first otherwise.
+func (dbManager DBManager) SearchStatements(search StatementSearch) ([]SearchResult, error) {
+	defer dbManager.observe("SearchStatements")()
+	var (
+		query    strings.Builder
+		where    []string
+		args     []interface{}
+		boolean  = BooleanQuery(search.Text)
+		excluded = exclusionQuery(search.Text)
+	)
+	if excluded != "" {
+		boolean = ""
+		where = append(where, "NOT "+searchMatch)
+		args = append(args, excluded)
+	}
+	query.WriteString(searchStatementsSelect)
+	if boolean != "" {
+		query.WriteString(searchMatch)
+		args = append(args, boolean)
+		where = append(where, searchMatch)
+		args = append(args, boolean)
+	} else {
+		query.WriteString("0")
+	}
+	query.WriteString(" FROM statements")
+
+	if len(search.TickerIds) > 0 {
+		where = append(where, "EXISTS (SELECT 1 FROM statement_tickers WHERE statement_tickers.tweet_id = statements.tweet_id "+
+			"AND statement_tickers.ticker_id IN ("+placeholders(len(search.TickerIds))+"))")
+		for _, id := range search.TickerIds {
+			args = append(args, id)
+		}
+	}
+	if search.Source != "" {
+		where = append(where, "source=?")
+		args = append(args, search.Source)
+	}
+	if search.FromTime != 0 {
+		where = append(where, "time_stamp>=?")
+		args = append(args, search.FromTime)
+	}
+	if search.ToTime != 0 {
+		where = append(where, "time_stamp<?")
+		args = append(args, search.ToTime)
+	}
+	if search.MinPolarity != nil {
+		where = append(where, "polarity>=?")
+		args = append(args, *search.MinPolarity)
+	}
+	if search.MaxPolarity != nil {
+		where = append(where, "polarity<=?")
+		args = append(args, *search.MaxPolarity)
+	}
+	if search.Spam != nil {
+		where = append(where, "COALESCE(spam, FALSE)=?")
+		args = append(args, *search.Spam)
+	}
+	if search.MinEngagement > 0 {
+		where = append(where, "COALESCE(likes, 0) + COALESCE(replies, 0) + COALESCE(retweets, 0)>=?")
+		args = append(args, search.MinEngagement)
+	}
+	if c := search.After; c != nil {
+		if boolean != "" {
+			where = append(where, "("+searchMatch+"<? OR (ABS("+searchMatch+"-?)<? AND statements.tweet_id<?))")
+			args = append(args, boolean, c.Relevance-RELEVANCE_EPSILON, boolean, c.Relevance, RELEVANCE_EPSILON, c.TweetId)
+		} else {
+			where = append(where, "(time_stamp<? OR (time_stamp=? AND statements.tweet_id<?))")
+			args = append(args, c.TimeStamp, c.TimeStamp, c.TweetId)
+		}
+	}
+
+	if len(where) > 0 {
+		query.WriteString(" WHERE " + strings.Join(where, " AND "))
+	}
+	if boolean != "" {
+		query.WriteString(" ORDER BY " + searchMatch + " DESC, statements.tweet_id DESC LIMIT ?")
+		args = append(args, boolean, search.Limit)
+	} else {
+		query.WriteString(" ORDER BY time_stamp DESC, statements.tweet_id DESC LIMIT ?")
+		args = append(args, search.Limit)
+	}
+
+	rows, err := dbManager.reader().Query(query.String(), args...)
+	if err != nil {
+		dbManager.logger.Error("SearchStatements failed", "err", err)
+		return nil, err
+	}
+	defer rows.Close()
+	results := []SearchResult{}
+	for rows.Next() {
+		var (
+			r       SearchResult
+			tickers sql.NullString
+		)
+		if err := rows.Scan(&r.TweetId, &r.TimeStamp, &r.Expression, &r.URL, &r.Polarity, &r.Likes, &r.Replies,
+			&r.Retweets, &r.Spam, &r.Source, &tickers, &r.Relevance); err != nil {
+			dbManager.logger.Error("SearchStatements scan failed", "err", err)
+			return nil, err
+		}
+		r.Tickers = []string{}
+		if tickers.String != "" {
+			r.Tickers = strings.Split(tickers.String, ",")
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
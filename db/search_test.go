@@ -0,0 +1,41 @@
+package db
+
+import "testing"
+
+func TestBooleanQuery(t *testing.T) {
+	cases := map[string]string{
+		"earnings":              "+earnings",
+		"  earnings   beat ":    "+earnings +beat",
+		`"earnings call" $AMD`:  `+"earnings call" +AMD`,
+		`earn* -puts`:           "+earn* -puts",
+		`-"short squeeze" moon`: `-"short squeeze" +moon`,
+		`"unterminated phrase`:  `+"unterminated phrase"`,
+		`+(>weird <ops~) @3`:    "+weird +ops +3",
+		`a-b`:                   "+a +b",
+		`"" - * ()`:             "",
+		`"  to   the moon!! "`:  `+"to the moon"`,
+		"":                      "",
+	}
+	for text, want := range cases {
+		if got := BooleanQuery(text); got != want {
+			t.Errorf("BooleanQuery(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestExclusionQuery(t *testing.T) {
+	cases := map[string]string{
+		"-puts":                  "puts",
+		`-puts -"short squeeze"`: `puts "short squeeze"`,
+		"-earn*":                 "earn*",
+		"-puts calls":            "",
+		"earnings":               "",
+		`"" - * ()`:              "",
+		"":                       "",
+	}
+	for text, want := range cases {
+		if got := exclusionQuery(text); got != want {
+			t.Errorf("exclusionQuery(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
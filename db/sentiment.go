@@ -1,7 +1,6 @@
 package db
 
 import (
-	"log"
 	"sync"
 )
 
@@ -19,26 +18,94 @@ INSERT INTO sentiments(time_stamp, ticker_id, hourly_sentiment) ` +
 // but does generate an error message for diagnosing issues.
 func (dbManager DBManager) AddSentiment(wg *sync.WaitGroup, timeStamp int64, tickerId int, hourlySentiment float64) {
 	defer wg.Done()
+	defer dbManager.observe("AddSentiment")()
 	_, err := dbManager.db.Exec(addSentimentQuery,
 		timeStamp,
 		tickerId,
 		float32(hourlySentiment),
 	)
 	if err != nil {
-		log.Print("Error in addSentiment()", err, hourlySentiment)
-		log.Print("id is ", tickerId)
+		dbManager.logger.Error("AddSentiment failed", "ticker_id", tickerId, "sentiment", hourlySentiment, "err", err)
 	}
 }
 
+// Defines the sizes, in seconds, of the buckets sentiments are
+// aggregated into. Hourly buckets are always kept, quarter hour
+// buckets only when enabled.
+const (
+	HOURLY_BUCKET       = 3600
+	QUARTER_HOUR_BUCKET = 900
+)
+
+const upsertSentimentBucketQuery = `
+INSERT INTO sentiments(time_stamp, ticker_id, bucket_seconds, hourly_sentiment, weighted_sentiment, statement_count) ` +
+	`SELECT ?, ?, ?, COALESCE(AVG(polarity), 0), ` +
+	`COALESCE(SUM(polarity * COALESCE(authors.influence, 1)) / NULLIF(SUM(COALESCE(authors.influence, 1)), 0), 0), ` +
+	`COUNT(*) FROM statements ` +
+	`JOIN statement_tickers ON statement_tickers.tweet_id = statements.tweet_id ` +
+	`LEFT JOIN authors ON authors.author_id = statements.author_id ` +
+	`WHERE statement_tickers.ticker_id=? AND time_stamp>=? AND time_stamp<? ` +
+	`ON DUPLICATE KEY UPDATE hourly_sentiment=VALUES(hourly_sentiment), ` +
+	`weighted_sentiment=VALUES(weighted_sentiment), statement_count=VALUES(statement_count)`
+
+// Recomputes the average sentiment of the bucket starting at
+// bucketStart from the statements mentioning the ticker, inserting
+// the bucket or overwriting it if it already exists. Because the
+// average is taken over every stored statement, tweets that
+// arrive late correct their own bucket and re-scraped tweets
+// are never counted twice. Alongside the plain average, an average
+// weighted by each author's influence is kept, with statements by
+// unknown authors weighted 1.
+func (dbManager DBManager) UpsertSentimentBucket(tickerId int, bucketStart int64, bucketSeconds int) error {
+	defer dbManager.observe("UpsertSentimentBucket")()
+	_, err := dbManager.db.Exec(upsertSentimentBucketQuery,
+		bucketStart,
+		tickerId,
+		bucketSeconds,
+		tickerId,
+		bucketStart,
+		bucketStart+int64(bucketSeconds),
+	)
+	if err != nil {
+		dbManager.logger.Error("UpsertSentimentBucket failed", "ticker_id", tickerId, "bucket", bucketStart, "err", err)
+	}
+	return err
+}
+
 const returnSentimentHistoryQuery = `
 SELECT time_stamp, hourly_sentiment FROM sentiments ` +
-	`WHERE ticker_id=? ORDER BY time_stamp DESC`
+	`WHERE ticker_id=? AND bucket_seconds=? ORDER BY time_stamp DESC`
 
 // Retrieves the average hourly sentiment over a given time range.
 func (dbManager DBManager) ReturnSentimentHistory(id int, fromTime int64) []IntervalQuote {
-	rows, err := dbManager.db.Query(returnSentimentHistoryQuery, id)
+	defer dbManager.observe("ReturnSentimentHistory")()
+	return dbManager.ReturnSentimentBuckets(id, fromTime, HOURLY_BUCKET)
+}
+
+const returnWeightedSentimentHistoryQuery = `
+SELECT time_stamp, COALESCE(weighted_sentiment, hourly_sentiment) FROM sentiments ` +
+	`WHERE ticker_id=? AND bucket_seconds=? ORDER BY time_stamp DESC`
+
+// Retrieves the average sentiment per bucket of the given size
+// over a given time range.
+func (dbManager DBManager) ReturnSentimentBuckets(id int, fromTime int64, bucketSeconds int) []IntervalQuote {
+	defer dbManager.observe("ReturnSentimentBuckets")()
+	return dbManager.returnSentimentBuckets("ReturnSentimentBuckets", returnSentimentHistoryQuery, id, fromTime, bucketSeconds)
+}
+
+// Retrieves the average sentiment per bucket weighted by the
+// influence of each statement's author. Buckets aggregated before
+// authors were tracked fall back to the plain average.
+func (dbManager DBManager) ReturnWeightedSentimentBuckets(id int, fromTime int64, bucketSeconds int) []IntervalQuote {
+	defer dbManager.observe("ReturnWeightedSentimentBuckets")()
+	return dbManager.returnSentimentBuckets("ReturnWeightedSentimentBuckets", returnWeightedSentimentHistoryQuery, id, fromTime, bucketSeconds)
+}
+
+func (dbManager DBManager) returnSentimentBuckets(method, query string, id int, fromTime int64, bucketSeconds int) []IntervalQuote {
+	rows, err := dbManager.reader().Query(query, id, bucketSeconds)
 	if err != nil {
-		log.Print("Error returning senitment history: ", err)
+		dbManager.logger.Error(method+" failed", "ticker_id", id, "err", err)
+		return nil
 	}
 	defer rows.Close()
 
@@ -47,10 +114,10 @@ func (dbManager DBManager) ReturnSentimentHistory(id int, fromTime int64) []Inte
 
 	for rows.Next() {
 		if rows.Err() != nil {
-			log.Print("Found no rows.")
+			dbManager.logger.Warn(method+" found no rows", "ticker_id", id)
 		}
 		if err := rows.Scan(&s.TimeStamp, &s.CurrentPrice); err != nil {
-			log.Printf("ReturnSentimentHistory(): Error in rows.Scan() for ticker %d: %v", id, err)
+			dbManager.logger.Error(method+" scan failed", "ticker_id", id, "err", err)
 		}
 		if s.TimeStamp < fromTime {
 			break
@@ -3,7 +3,7 @@ package db
 import (
 	"context"
 	"database/sql"
-	"log"
+	"strings"
 
 	"github.com/jonreesman/watch-dog-kafka/twitter"
 )
@@ -14,6 +14,7 @@ INSERT INTO statements(ticker_id, expression, time_stamp, polarity, url, tweet_i
 
 // Adds a single tweet to the statement table of the database.
 func (dbManager DBManager) AddStatement(tickerId int, expression string, timeStamp int64, polarity float64, url string, tweet_id uint64, likes, replies, retweets int) {
+	defer dbManager.observe("AddStatement")()
 	_, err := dbManager.db.Exec(addStatementQuery,
 		tickerId,
 		expression,
@@ -26,13 +27,29 @@ func (dbManager DBManager) AddStatement(tickerId int, expression string, timeSta
 		retweets,
 	)
 	if err != nil {
-		log.Print("Error in addStatement", err)
+		dbManager.logger.Error("AddStatement failed", "ticker_id", tickerId, "err", err)
 	}
 }
 
-// Adds a single tweet to the statement table of the database.
-func (dbManager DBManager) AddStatements(t *sql.Tx, tickerId int, expression string, timeStamp int64, polarity float64, url string, tweet_id uint64, likes, replies, retweets int, spam bool) {
-	_, err := t.Exec(addStatementQuery,
+// A transaction statements are added in. Satisfied by *sql.Tx.
+type Tx interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Commit() error
+	Rollback() error
+}
+
+const addStatementIgnoreQuery = `
+INSERT IGNORE INTO statements(ticker_id, expression, time_stamp, polarity, url, tweet_id, likes, replies, retweets, spam, author_id, source) ` +
+	`VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// Adds a single tweet to the statement table of the database and
+// attributes it to tickerId. A tweet already stored by another
+// ticker is kept as it is and only gains the attribution.
+// authorId may be empty if the author is unknown. source names
+// where the tweet was scraped from, such as "Twitter".
+func (dbManager DBManager) AddStatements(t Tx, tickerId int, expression string, timeStamp int64, polarity float64, url string, tweet_id uint64, likes, replies, retweets int, spam bool, authorId, source string) {
+	defer dbManager.observe("AddStatements")()
+	_, err := t.Exec(addStatementIgnoreQuery,
 		tickerId,
 		expression,
 		timeStamp,
@@ -43,30 +60,64 @@ func (dbManager DBManager) AddStatements(t *sql.Tx, tickerId int, expression str
 		replies,
 		retweets,
 		spam,
+		sql.NullString{String: authorId, Valid: authorId != ""},
+		source,
 	)
 	if err != nil {
-		log.Print("Error in addStatements(): ", err)
+		dbManager.logger.Error("AddStatements failed", "ticker_id", tickerId, "err", err)
+		return
+	}
+	dbManager.AddStatementTickers(t, tweet_id, tickerId)
+}
+
+const addStatementTickersQuery = `
+INSERT IGNORE INTO statement_tickers(tweet_id, ticker_id) VALUES `
+
+// Attributes a stored tweet to every ticker it mentions, so that
+// it counts towards the sentiment of each. Attributions that
+// already exist are left alone.
+func (dbManager DBManager) AddStatementTickers(t Tx, tweetId uint64, tickerIds ...int) error {
+	if len(tickerIds) == 0 {
+		return nil
 	}
+	defer dbManager.observe("AddStatementTickers")()
+	values := make([]string, len(tickerIds))
+	args := make([]interface{}, 0, 2*len(tickerIds))
+	for i, id := range tickerIds {
+		values[i] = "(?, ?)"
+		args = append(args, tweetId, id)
+	}
+	if _, err := t.Exec(addStatementTickersQuery+strings.Join(values, ", "), args...); err != nil {
+		dbManager.logger.Error("AddStatementTickers failed", "tweet_id", tweetId, "err", err)
+		return err
+	}
+	return nil
 }
 
-func (dbManager DBManager) BeginTx() *sql.Tx {
+// Begins a transaction for AddStatements() and the calls that
+// go with it.
+func (dbManager DBManager) BeginTx() (Tx, error) {
 	t, err := dbManager.db.BeginTx(context.Background(), nil)
 	if err != nil {
-		log.Printf("Error beginning transaction: %v", err)
+		dbManager.logger.Error("BeginTx failed", "err", err)
+		return nil, err
 	}
-	return t
+	return t, nil
 }
 
 const returnAllStatementsQuery = `
-SELECT time_stamp, expression, url, polarity, tweet_id, likes, replies, retweets ` +
-	`FROM statements WHERE ticker_id=? ` +
+SELECT time_stamp, expression, url, polarity, statements.tweet_id, likes, replies, retweets ` +
+	`FROM statements JOIN statement_tickers ON statement_tickers.tweet_id = statements.tweet_id ` +
+	`WHERE statement_tickers.ticker_id=? ` +
 	`ORDER BY time_stamp DESC`
 
-// Returns all tweets over a given timerange for a ticker specified by ID.
+// Returns all tweets over a given timerange that mention the ticker
+// specified by ID, including those stored by another ticker.
 func (dbManager DBManager) ReturnAllStatements(id int, fromTime int64) []twitter.Statement {
-	rows, err := dbManager.db.Query(returnAllStatementsQuery, id)
+	defer dbManager.observe("ReturnAllStatements")()
+	rows, err := dbManager.reader().Query(returnAllStatementsQuery, id)
 	if err != nil {
-		log.Print("Error returning sentiment history: ", err)
+		dbManager.logger.Error("ReturnAllStatements failed", "ticker_id", id, "err", err)
 		return nil
 	}
 
@@ -81,10 +132,10 @@ func (dbManager DBManager) ReturnAllStatements(id int, fromTime int64) []twitter
 
 	for rows.Next() {
 		if rows.Err() != nil {
-			log.Printf("ReturnAllStatements(): %v", rows.Err())
+			dbManager.logger.Error("ReturnAllStatements failed", "ticker_id", id, "err", rows.Err())
 		}
 		if err := rows.Scan(&statement.TimeStamp, &statement.Expression, &statement.PermanentURL, &statement.Polarity, &statement.ID, &likes, &replies, &retweets); err != nil {
-			log.Printf("ReturnAllStatements(): Error in rows.Scan() for ticker %d: %v", id, err)
+			dbManager.logger.Error("ReturnAllStatements scan failed", "ticker_id", id, "err", err)
 		}
 		if statement.TimeStamp < fromTime {
 			break
@@ -102,3 +153,36 @@ func (dbManager DBManager) ReturnAllStatements(id int, fromTime int64) []twitter
 	}
 	return returnPackage
 }
+
+const returnMentionHistoryQuery = `
+SELECT FLOOR(time_stamp / 3600) * 3600 AS hour, COUNT(*) FROM statements ` +
+	`JOIN statement_tickers ON statement_tickers.tweet_id = statements.tweet_id ` +
+	`WHERE statement_tickers.ticker_id=? AND time_stamp>=? ` +
+	`GROUP BY hour ORDER BY hour ASC`
+
+// Returns the number of statements stored for a ticker in each
+// calendar hour since fromTime. Hours without any statements are
+// omitted. CurrentPrice holds the count, mirroring how sentiment
+// history reuses IntervalQuote.
+func (dbManager DBManager) ReturnMentionHistory(id int, fromTime int64) []IntervalQuote {
+	defer dbManager.observe("ReturnMentionHistory")()
+	rows, err := dbManager.reader().Query(returnMentionHistoryQuery, id, fromTime)
+	if err != nil {
+		dbManager.logger.Error("ReturnMentionHistory failed", "ticker_id", id, "err", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var (
+		payload []IntervalQuote
+		q       IntervalQuote
+	)
+	for rows.Next() {
+		if err := rows.Scan(&q.TimeStamp, &q.CurrentPrice); err != nil {
+			dbManager.logger.Error("ReturnMentionHistory scan failed", "ticker_id", id, "err", err)
+			continue
+		}
+		payload = append(payload, q)
+	}
+	return payload
+}
@@ -4,12 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"log"
 	"strconv"
-	"sync"
 	"time"
 )
 
+// Returned when no ticker has the id asked for.
+var ErrNoTicker = errors.New("ticker does not exist")
+
 const activateTickerQuery = `
 UPDATE tickers SET active=1 WHERE ticker_id=?`
 const addTickerQuery = `
@@ -21,9 +22,12 @@ INSERT INTO tickers(name, active, last_scrape_time) ` +
 // to the ticker if successful, else returns 0 and an error.
 // Id 0 is reserved by the program for error purposes.
 func (dbManager DBManager) AddTicker(name string) (int, error) {
+	defer dbManager.observe("AddTicker")()
 	if name == "" {
 		return 0, errors.New("ticker name is blank")
 	}
+	// Reads back the row it inserts, which a replica may not have yet.
+	dbManager = dbManager.ReadPrimary()
 	if t, err := dbManager.RetrieveTickerByName(name); err == nil {
 		if t.Active == 1 {
 			return t.Id, errors.New("ticker active")
@@ -37,7 +41,7 @@ func (dbManager DBManager) AddTicker(name string) (int, error) {
 	dbQuery, err := dbManager.db.Prepare(addTickerQuery)
 	defer dbQuery.Close()
 	if err != nil {
-		log.Print("Error in AddTicker()", err)
+		dbManager.logger.Error("AddTicker failed", "ticker", name, "err", err)
 		return 0, err
 	}
 	if row, err := dbQuery.Query(name, 1, nil); err != nil {
@@ -59,9 +63,10 @@ UPDATE tickers SET last_scrape_time=? ` +
 
 // Updates the last_scrape_time for a ticker
 // upon completion of an hourly scrape.
-func (dbManager DBManager) UpdateTicker(wg *sync.WaitGroup, id int, timeStamp time.Time) error {
-	defer wg.Done()
+func (dbManager DBManager) UpdateTicker(id int, timeStamp time.Time) error {
+	defer dbManager.observe("UpdateTicker")()
 	if _, err := dbManager.db.Exec(updateTickerQuery, timeStamp.Unix(), id); err != nil {
+		dbManager.logger.Error("UpdateTicker failed", "ticker_id", id, "err", err)
 		return err
 	}
 	return nil
@@ -75,9 +80,10 @@ SELECT ticker_id, name, last_scrape_time, active FROM tickers ` +
 // with only the ticker name. Ticker name is assumed to be
 // unique, as that is true for the NASDAQ.
 func (dbManager DBManager) RetrieveTickerByName(tickerName string) (Ticker, error) {
-	rows, err := dbManager.db.Query(retrieveTickerByNameQuery, tickerName)
+	defer dbManager.observe("RetrieveTickerByName")()
+	rows, err := dbManager.reader().Query(retrieveTickerByNameQuery, tickerName)
 	if err != nil {
-		log.Print(err)
+		dbManager.logger.Error("RetrieveTickerByName failed", "ticker", tickerName, "err", err)
 	}
 	defer rows.Close()
 	var (
@@ -89,7 +95,7 @@ func (dbManager DBManager) RetrieveTickerByName(tickerName string) (Ticker, erro
 	for rows.Next() {
 		err := rows.Scan(&id, &name, &lastScrapeTime, &active)
 		if err != nil {
-			log.Print(err)
+			dbManager.logger.Error("RetrieveTickerByName scan failed", "ticker", tickerName, "err", err)
 		}
 		if name != tickerName {
 			continue
@@ -110,9 +116,10 @@ func (dbManager DBManager) RetrieveTickerByName(tickerName string) (Ticker, erro
 // by the database. This is mostly heavily used internally,
 // as the user doesnt necessarily know tickers by their DB IDs.
 func (dbManager DBManager) RetrieveTickerIDByName(tickerName string) (int, error) {
-	rows, err := dbManager.db.Query(retrieveTickerByNameQuery, tickerName)
+	defer dbManager.observe("RetrieveTickerIDByName")()
+	rows, err := dbManager.reader().Query(retrieveTickerByNameQuery, tickerName)
 	if err != nil {
-		log.Print(err)
+		dbManager.logger.Error("RetrieveTickerIDByName failed", "ticker", tickerName, "err", err)
 	}
 	defer rows.Close()
 	var (
@@ -126,7 +133,7 @@ func (dbManager DBManager) RetrieveTickerIDByName(tickerName string) (int, error
 		// to prevent us from finding the ticker in rows.Scan if it
 		// fails on a completely unrelated ticker/line.
 		if err := rows.Scan(&id, &name, &lastScrapeTime, &active); err != nil {
-			log.Print(err)
+			dbManager.logger.Error("RetrieveTickerIDByName scan failed", "ticker", tickerName, "err", err)
 		}
 		if name == tickerName {
 			return id, nil
@@ -137,9 +144,10 @@ func (dbManager DBManager) RetrieveTickerIDByName(tickerName string) (int, error
 
 // Retrieves the last scrape time for a ticker.
 func (dbManager DBManager) RetrieveTickerLastScrapeTime(tickerName string) (int64, error) {
-	rows, err := dbManager.db.Query(retrieveTickerByNameQuery, tickerName)
+	defer dbManager.observe("RetrieveTickerLastScrapeTime")()
+	rows, err := dbManager.reader().Query(retrieveTickerByNameQuery, tickerName)
 	if err != nil {
-		log.Print(err)
+		dbManager.logger.Error("RetrieveTickerLastScrapeTime failed", "ticker", tickerName, "err", err)
 	}
 	defer rows.Close()
 	var (
@@ -153,7 +161,7 @@ func (dbManager DBManager) RetrieveTickerLastScrapeTime(tickerName string) (int6
 		// to prevent us from finding the ticker in rows.Scan if it
 		// fails on a completely unrelated ticker/line.
 		if err := rows.Scan(&id, &name, &lastScrapeTime, &active); err != nil {
-			log.Print(err)
+			dbManager.logger.Error("RetrieveTickerLastScrapeTime scan failed", "ticker", tickerName, "err", err)
 		}
 		if name == tickerName {
 			return lastScrapeTime.Int64, nil
@@ -164,22 +172,26 @@ func (dbManager DBManager) RetrieveTickerLastScrapeTime(tickerName string) (int6
 
 const activeTickerQuery = `
 SELECT tickers.ticker_id, tickers.name, tickers.last_scrape_time, ` +
+	`tickers.scrape_interval, tickers.priority, tickers.adaptive, ` +
 	`sentiments.hourly_sentiment FROM tickers LEFT JOIN sentiments ` +
 	`ON tickers.ticker_id = sentiments.ticker_id ` +
-	`AND tickers.last_scrape_time = sentiments.time_stamp ` +
-	`WHERE active=1 ORDER BY ticker_id`
+	`AND sentiments.bucket_seconds = 3600 ` +
+	`AND sentiments.time_stamp = (SELECT MAX(latest.time_stamp) FROM sentiments latest ` +
+	`WHERE latest.ticker_id = tickers.ticker_id AND latest.bucket_seconds = 3600) ` +
+	`WHERE active=1 ORDER BY tickers.ticker_id`
 
 // Searches for and returns only tickers presently listed as active.
 func (dbManager DBManager) ReturnActiveTickers(ctx context.Context) (tickers TickerSlice, err error) {
+	defer dbManager.observe("ReturnActiveTickers")()
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	rows, err := dbManager.db.QueryContext(ctx, activeTickerQuery)
+	rows, err := dbManager.reader().QueryContext(ctx, activeTickerQuery)
 	if err != nil {
-		log.Printf("Database Error in ReturnActiveTickers(): %v", err)
+		dbManager.logger.Error("ReturnActiveTickers failed", "err", err)
 		return nil, err
 	}
-	log.Printf("ReturnActiveTickers(): Query complete.")
+	dbManager.logger.Debug("ReturnActiveTickers query complete")
 	defer rows.Close()
 
 	var (
@@ -189,11 +201,14 @@ func (dbManager DBManager) ReturnActiveTickers(ctx context.Context) (tickers Tic
 		lastScrapeTime        int64
 		hourlySentimentHolder sql.NullFloat64
 		hourlySentiment       float64
+		scrapeInterval        sql.NullInt64
+		priority              sql.NullInt64
+		adaptive              sql.NullInt64
 	)
 
 	for rows.Next() {
-		if err := rows.Scan(&id, &name, &lastScrapeTimeHolder, &hourlySentimentHolder); err != nil {
-			log.Print(err)
+		if err := rows.Scan(&id, &name, &lastScrapeTimeHolder, &scrapeInterval, &priority, &adaptive, &hourlySentimentHolder); err != nil {
+			dbManager.logger.Error("ReturnActiveTickers scan failed", "err", err)
 		}
 
 		// MySQL's implementation of Int64 and Float64 make it
@@ -217,6 +232,9 @@ func (dbManager DBManager) ReturnActiveTickers(ctx context.Context) (tickers Tic
 			Id:              id,
 			LastScrapeTime:  time.Unix(lastScrapeTime, 0),
 			HourlySentiment: hourlySentiment,
+			ScrapeInterval:  int(scrapeInterval.Int64),
+			Priority:        int(priority.Int64),
+			Adaptive:        adaptive.Int64 == 1,
 		})
 	}
 	return tickers, nil
@@ -228,9 +246,11 @@ SELECT ticker_id, name, last_scrape_time FROM tickers ` +
 
 // Retrieves a ticker by ID. Mostly used internally.
 func (dbManager DBManager) RetrieveTickerById(tickerId int) (Ticker, error) {
-	rows, err := dbManager.db.Query(retrieveTickerByIdQuery, tickerId)
+	defer dbManager.observe("RetrieveTickerById")()
+	rows, err := dbManager.reader().Query(retrieveTickerByIdQuery, tickerId)
 	if err != nil {
-		log.Printf("RetrieveTickerById(): Error querying the DB: %v", err)
+		dbManager.logger.Error("RetrieveTickerById failed", "ticker_id", tickerId, "err", err)
+		return Ticker{Name: "none"}, err
 	}
 	defer rows.Close()
 	var (
@@ -241,32 +261,36 @@ func (dbManager DBManager) RetrieveTickerById(tickerId int) (Ticker, error) {
 	strId := strconv.Itoa(tickerId)
 	for rows.Next() {
 		if err := rows.Scan(&id, &name, &lastScrapeTime); err != nil {
-			log.Print(err)
+			dbManager.logger.Error("RetrieveTickerById scan failed", "ticker_id", tickerId, "err", err)
 		}
 		if strId == id {
 			return Ticker{Name: name, Id: tickerId, LastScrapeTime: time.Unix(lastScrapeTime.Int64, 0)}, nil
 		}
 	}
-	return Ticker{Name: "none"}, errors.New("ticker does not exist")
+	if err := rows.Err(); err != nil {
+		return Ticker{Name: "none"}, err
+	}
+	return Ticker{Name: "none"}, ErrNoTicker
 }
 
 const checkTickerExistsQuery = `
 SELECT ticker_id FROM tickers where name=?`
 
 func (dbManager DBManager) CheckTickerExists(ticker string) bool {
-	rows, err := dbManager.db.Query(checkTickerExistsQuery, ticker)
+	defer dbManager.observe("CheckTickerExists")()
+	rows, err := dbManager.reader().Query(checkTickerExistsQuery, ticker)
 	if err != nil {
-		log.Printf("Error checking if ticker %s exists: %v", ticker, err)
+		dbManager.logger.Error("CheckTickerExists failed", "ticker", ticker, "err", err)
 		return false
 	}
 	defer rows.Close()
 	var id int
 	for rows.Next() {
 		if rows.Err() != nil {
-			log.Printf("Error checking if ticker %s exists: %v", ticker, rows.Err())
+			dbManager.logger.Error("CheckTickerExists failed", "ticker", ticker, "err", rows.Err())
 		}
 		if err := rows.Scan(&id); err != nil {
-			log.Printf("Error checking if ticker %s exists: %v", ticker, err)
+			dbManager.logger.Error("CheckTickerExists scan failed", "ticker", ticker, "err", err)
 		}
 	}
 	if id > 0 {
@@ -276,14 +300,16 @@ func (dbManager DBManager) CheckTickerExists(ticker string) bool {
 }
 
 const retrieveOldestTweetTimestampQuery = `
-SELECT time_stamp FROM statements WHERE ticker_id=? ORDER BY time_stamp ASC LIMIT 1
-`
+SELECT time_stamp FROM statements ` +
+	`JOIN statement_tickers ON statement_tickers.tweet_id = statements.tweet_id ` +
+	`WHERE statement_tickers.ticker_id=? ORDER BY time_stamp ASC LIMIT 1`
 
-// Retrieves the last scrape time for a ticker.
-func (dbManager DBManager) RetrieveOldestTweetTimestamp(tickerName string) (int64, error) {
-	rows, err := dbManager.db.Query(retrieveOldestTweetTimestampQuery, tickerName)
+// Retrieves the timestamp of the oldest tweet stored for a ticker.
+func (dbManager DBManager) RetrieveOldestTweetTimestamp(tickerId int) (int64, error) {
+	defer dbManager.observe("RetrieveOldestTweetTimestamp")()
+	rows, err := dbManager.reader().Query(retrieveOldestTweetTimestampQuery, tickerId)
 	if err != nil {
-		log.Print(err)
+		dbManager.logger.Error("RetrieveOldestTweetTimestamp failed", "ticker_id", tickerId, "err", err)
 	}
 	defer rows.Close()
 	var (
@@ -291,7 +317,7 @@ func (dbManager DBManager) RetrieveOldestTweetTimestamp(tickerName string) (int6
 	)
 	for rows.Next() {
 		if err := rows.Scan(&oldestTweetTimestamp); err != nil {
-			log.Print(err)
+			dbManager.logger.Error("RetrieveOldestTweetTimestamp scan failed", "ticker_id", tickerId, "err", err)
 			return 0, errors.New("Error in retrieveOldestTweetTimestamp():" + err.Error())
 		}
 	}
@@ -308,6 +334,7 @@ UPDATE tickers SET active=0 WHERE ticker_id=?`
 // Sets the ticker active status to 0.
 // Prevents the hourly scraping of the ticker.
 func (dbManager DBManager) DeactivateTicker(id int) error {
+	defer dbManager.observe("DeactivateTicker")()
 	if _, err := dbManager.db.Exec(deactivateTickerQuery, id); err != nil {
 		return err
 	}
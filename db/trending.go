@@ -0,0 +1,116 @@
+package db
+
+import (
+	"strings"
+)
+
+const addUntrackedMentionsQuery = `
+INSERT IGNORE INTO untracked_mentions(symbol, tweet_id, time_stamp) VALUES `
+
+// Records that a stored tweet mentions symbols no ticker tracks.
+// Each tweet counts once per symbol, however often it is scraped.
+func (dbManager DBManager) AddUntrackedMentions(t Tx, tweetId uint64, timeStamp int64, symbols ...string) error {
+	if len(symbols) == 0 {
+		return nil
+	}
+	defer dbManager.observe("AddUntrackedMentions")()
+	values := make([]string, len(symbols))
+	args := make([]interface{}, 0, 3*len(symbols))
+	for i, s := range symbols {
+		values[i] = "(?, ?, ?)"
+		args = append(args, s, tweetId, timeStamp)
+	}
+	if _, err := t.Exec(addUntrackedMentionsQuery+strings.Join(values, ", "), args...); err != nil {
+		dbManager.logger.Error("AddUntrackedMentions failed", "tweet_id", tweetId, "err", err)
+		return err
+	}
+	return nil
+}
+
+const returnUntrackedMentionCountsQuery = `
+SELECT symbol, COUNT(*) FROM untracked_mentions ` +
+	`WHERE time_stamp>=? AND time_stamp<? GROUP BY symbol`
+
+// Returns how many stored tweets in [fromTime, toTime) mention
+// each untracked symbol.
+func (dbManager DBManager) ReturnUntrackedMentionCounts(fromTime, toTime int64) (map[string]int, error) {
+	defer dbManager.observe("ReturnUntrackedMentionCounts")()
+	rows, err := dbManager.reader().Query(returnUntrackedMentionCountsQuery, fromTime, toTime)
+	if err != nil {
+		dbManager.logger.Error("ReturnUntrackedMentionCounts failed", "err", err)
+		return nil, err
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var (
+			symbol string
+			count  int
+		)
+		if err := rows.Scan(&symbol, &count); err != nil {
+			dbManager.logger.Error("ReturnUntrackedMentionCounts scan failed", "err", err)
+			return nil, err
+		}
+		counts[symbol] = count
+	}
+	return counts, rows.Err()
+}
+
+const pruneUntrackedMentionsQuery = `
+DELETE FROM untracked_mentions WHERE time_stamp<?`
+
+// Deletes the mentions of tweets posted before the given time.
+func (dbManager DBManager) PruneUntrackedMentions(before int64) error {
+	defer dbManager.observe("PruneUntrackedMentions")()
+	if _, err := dbManager.db.Exec(pruneUntrackedMentionsQuery, before); err != nil {
+		dbManager.logger.Error("PruneUntrackedMentions failed", "err", err)
+		return err
+	}
+	return nil
+}
+
+const recordAutoAdditionQuery = `
+INSERT IGNORE INTO auto_added_tickers(symbol, added_at) VALUES (?, ?)`
+
+// Records that symbol was added automatically at the given time.
+// Returns false if it had already been, so that a ticker an admin
+// has since removed is not added back.
+func (dbManager DBManager) RecordAutoAddition(symbol string, at int64) (bool, error) {
+	defer dbManager.observe("RecordAutoAddition")()
+	result, err := dbManager.db.Exec(recordAutoAdditionQuery, symbol, at)
+	if err != nil {
+		dbManager.logger.Error("RecordAutoAddition failed", "symbol", symbol, "err", err)
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+const deleteAutoAdditionQuery = `
+DELETE FROM auto_added_tickers WHERE symbol=?`
+
+// Forgets that symbol was added automatically, for when adding it
+// failed after it was recorded.
+func (dbManager DBManager) DeleteAutoAddition(symbol string) error {
+	defer dbManager.observe("DeleteAutoAddition")()
+	if _, err := dbManager.db.Exec(deleteAutoAdditionQuery, symbol); err != nil {
+		dbManager.logger.Error("DeleteAutoAddition failed", "symbol", symbol, "err", err)
+		return err
+	}
+	return nil
+}
+
+const countAutoAdditionsQuery = `
+SELECT COUNT(*) FROM auto_added_tickers WHERE added_at>=?`
+
+// Returns how many symbols were added automatically since the
+// given time.
+func (dbManager DBManager) CountAutoAdditions(since int64) (int, error) {
+	defer dbManager.observe("CountAutoAdditions")()
+	var n int
+	if err := dbManager.db.QueryRow(countAutoAdditionsQuery, since).Scan(&n); err != nil {
+		dbManager.logger.Error("CountAutoAdditions failed", "err", err)
+		return 0, err
+	}
+	return n, nil
+}
@@ -0,0 +1,187 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+)
+
+// The types a column's values can have, held in a row as int64,
+// float64, string and bool respectively.
+const (
+	INT64 = iota
+	DOUBLE
+	STRING
+	BOOLEAN
+)
+
+type Column struct {
+	Name string
+	Type int
+}
+
+// The datasets that can be exported, and their columns.
+var DATASETS = map[string][]Column{
+	"statements": {
+		{"ticker", STRING}, {"ticker_id", INT64}, {"tweet_id", INT64}, {"time_stamp", INT64},
+		{"expression", STRING}, {"url", STRING}, {"polarity", DOUBLE}, {"likes", INT64},
+		{"replies", INT64}, {"retweets", INT64}, {"spam", BOOLEAN}, {"author_id", STRING},
+	},
+	"sentiments": {
+		{"ticker", STRING}, {"ticker_id", INT64}, {"time_stamp", INT64}, {"bucket_seconds", INT64},
+		{"sentiment", DOUBLE}, {"weighted_sentiment", DOUBLE}, {"statements", INT64},
+	},
+	"quotes": {
+		{"ticker", STRING}, {"ticker_id", INT64}, {"time_stamp", INT64}, {"price", DOUBLE},
+	},
+}
+
+// The formats rows can be written in, by name, and their content
+// types.
+var FORMATS = map[string]string{
+	"csv":     "text/csv",
+	"ndjson":  "application/x-ndjson",
+	"parquet": "application/vnd.apache.parquet",
+}
+
+// Writes rows, each holding a value of the matching type for every
+// column, as they come.
+type Writer interface {
+	Write(row []interface{}) error
+	// Writes whatever is buffered, and any trailer the format
+	// needs. The underlying writer is left open.
+	Close() error
+}
+
+// Returns a Writer of rows of columns to w in the named format.
+func NewWriter(w io.Writer, format string, columns []Column) (Writer, error) {
+	switch format {
+	case "csv":
+		return newCSVWriter(w, columns), nil
+	case "ndjson":
+		return newNDJSONWriter(w, columns), nil
+	case "parquet":
+		return newParquetWriter(w, columns, ROW_GROUP_BYTES)
+	}
+	return nil, fmt.Errorf("unknown format %q, expected csv, ndjson or parquet", format)
+}
+
+// Defines the database operations an export depends on.
+// Satisfied by db.DBManager.
+type Store interface {
+	StreamStatements(tickerIds []int, fromTime, toTime int64, fn func(db.ExportedStatement) error) error
+	StreamSentiments(tickerIds []int, fromTime, toTime int64, fn func(db.ExportedSentiment) error) error
+	StreamQuotes(tickerIds []int, fromTime, toTime int64, fn func(db.ExportedQuote) error) error
+}
+
+// Writes the rows of dataset for tickerIds from fromTime up to
+// toTime to out as they are read from store. out is not closed.
+func Export(store Store, dataset string, tickerIds []int, fromTime, toTime int64, out Writer) error {
+	switch dataset {
+	case "statements":
+		return store.StreamStatements(tickerIds, fromTime, toTime, func(s db.ExportedStatement) error {
+			return out.Write([]interface{}{s.Ticker, int64(s.TickerId), int64(s.TweetId), s.TimeStamp, s.Expression, s.URL,
+				s.Polarity, int64(s.Likes), int64(s.Replies), int64(s.Retweets), s.Spam, s.AuthorId})
+		})
+	case "sentiments":
+		return store.StreamSentiments(tickerIds, fromTime, toTime, func(s db.ExportedSentiment) error {
+			return out.Write([]interface{}{s.Ticker, int64(s.TickerId), s.TimeStamp, int64(s.BucketSeconds),
+				s.Sentiment, s.WeightedSentiment, int64(s.Statements)})
+		})
+	case "quotes":
+		return store.StreamQuotes(tickerIds, fromTime, toTime, func(q db.ExportedQuote) error {
+			return out.Write([]interface{}{q.Ticker, int64(q.TickerId), q.TimeStamp, q.Price})
+		})
+	}
+	return fmt.Errorf("unknown dataset %q, expected statements, sentiments or quotes", dataset)
+}
+
+// Formats a value as text, for CSV and JSON.
+func format(v interface{}) string {
+	switch v := v.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case string:
+		return v
+	}
+	return fmt.Sprint(v)
+}
+
+type csvWriter struct {
+	out    *csv.Writer
+	record []string
+}
+
+// Writes a header of the column names, then a record per row.
+func newCSVWriter(w io.Writer, columns []Column) *csvWriter {
+	c := &csvWriter{out: csv.NewWriter(w), record: make([]string, len(columns))}
+	for i, col := range columns {
+		c.record[i] = col.Name
+	}
+	c.out.Write(c.record)
+	return c
+}
+
+func (c *csvWriter) Write(row []interface{}) error {
+	for i, v := range row {
+		c.record[i] = format(v)
+	}
+	return c.out.Write(c.record)
+}
+
+func (c *csvWriter) Close() error {
+	c.out.Flush()
+	return c.out.Error()
+}
+
+type ndjsonWriter struct {
+	out *bufio.Writer
+	// The quoted column names, ready to be written as keys.
+	keys []string
+	line []byte
+}
+
+// Writes an object per row, keyed by column name in column order.
+func newNDJSONWriter(w io.Writer, columns []Column) *ndjsonWriter {
+	n := &ndjsonWriter{out: bufio.NewWriter(w), keys: make([]string, len(columns))}
+	for i, col := range columns {
+		n.keys[i] = strconv.Quote(col.Name)
+	}
+	return n
+}
+
+func (n *ndjsonWriter) Write(row []interface{}) error {
+	n.line = append(n.line[:0], '{')
+	for i, v := range row {
+		if i > 0 {
+			n.line = append(n.line, ',')
+		}
+		n.line = append(n.line, n.keys[i]...)
+		n.line = append(n.line, ':')
+		if s, ok := v.(string); ok {
+			b, err := json.Marshal(s)
+			if err != nil {
+				return err
+			}
+			n.line = append(n.line, b...)
+		} else {
+			n.line = append(n.line, format(v)...)
+		}
+	}
+	n.line = append(n.line, '}', '\n')
+	_, err := n.out.Write(n.line)
+	return err
+}
+
+func (n *ndjsonWriter) Close() error {
+	return n.out.Flush()
+}
@@ -0,0 +1,113 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+)
+
+type fakeStore struct {
+	statements []db.ExportedStatement
+}
+
+func (f fakeStore) StreamStatements(tickerIds []int, fromTime, toTime int64, fn func(db.ExportedStatement) error) error {
+	for _, s := range f.statements {
+		if s.TimeStamp >= fromTime && s.TimeStamp < toTime {
+			if err := fn(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (f fakeStore) StreamSentiments(tickerIds []int, fromTime, toTime int64, fn func(db.ExportedSentiment) error) error {
+	return fn(db.ExportedSentiment{Ticker: "AMD", TickerId: 1, TimeStamp: 3600, BucketSeconds: 3600, Sentiment: 0.5, WeightedSentiment: 0.25, Statements: 4})
+}
+
+func (f fakeStore) StreamQuotes(tickerIds []int, fromTime, toTime int64, fn func(db.ExportedQuote) error) error {
+	return nil
+}
+
+var store = fakeStore{statements: []db.ExportedStatement{
+	{Ticker: "AMD", TickerId: 1, TweetId: 10, TimeStamp: 100, Expression: `AMD, "to the moon"`, URL: "https://twitter.com/a/10", Polarity: 0.5, Likes: 3, AuthorId: "7"},
+	{Ticker: "AMD", TickerId: 1, TweetId: 11, TimeStamp: 200, Expression: "buy $AMD\nnow", Polarity: -0.25, Spam: true},
+	{Ticker: "AMD", TickerId: 1, TweetId: 12, TimeStamp: 300},
+}}
+
+func TestExportCSV(t *testing.T) {
+	var buf bytes.Buffer
+	out, _ := NewWriter(&buf, "csv", DATASETS["statements"])
+	if err := Export(store, "statements", []int{1}, 0, 300, out); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want a header and 2 rows", len(records))
+	}
+	if strings.Join(records[0][:4], ",") != "ticker,ticker_id,tweet_id,time_stamp" {
+		t.Errorf("header %v", records[0])
+	}
+	if got := records[1]; got[4] != `AMD, "to the moon"` || got[6] != "0.5" || got[7] != "3" || got[10] != "false" || got[11] != "7" {
+		t.Errorf("first row %v", got)
+	}
+	if got := records[2]; got[4] != "buy $AMD\nnow" || got[10] != "true" {
+		t.Errorf("second row %v", got)
+	}
+}
+
+func TestExportNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	out, _ := NewWriter(&buf, "ndjson", DATASETS["sentiments"])
+	if err := Export(store, "sentiments", []int{1}, 0, 7200, out); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+	if want := `{"ticker":"AMD","ticker_id":1,"time_stamp":3600,"bucket_seconds":3600,"sentiment":0.5,"weighted_sentiment":0.25,"statements":4}` + "\n"; buf.String() != want {
+		t.Errorf("got %s", buf.String())
+	}
+
+	buf.Reset()
+	out, _ = NewWriter(&buf, "ndjson", DATASETS["statements"])
+	Export(store, "statements", []int{1}, 0, 300, out)
+	out.Close()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines", len(lines))
+	}
+	var row map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &row); err != nil {
+		t.Fatal(err)
+	}
+	if row["expression"] != "buy $AMD\nnow" || row["spam"] != true || row["polarity"] != -0.25 {
+		t.Errorf("got %v", row)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(row []interface{}) error { return errors.New("client went away") }
+func (failingWriter) Close() error                  { return nil }
+
+func TestExportStopsOnError(t *testing.T) {
+	if err := Export(store, "statements", []int{1}, 0, 300, failingWriter{}); err == nil {
+		t.Error("expected the writer's error")
+	}
+	if err := Export(store, "tweets", []int{1}, 0, 300, failingWriter{}); err == nil {
+		t.Error("expected an unknown dataset to fail")
+	}
+	if _, err := NewWriter(&bytes.Buffer{}, "xlsx", nil); err == nil {
+		t.Error("expected an unknown format to fail")
+	}
+}
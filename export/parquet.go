@@ -0,0 +1,300 @@
+package export
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Rows are buffered, already encoded, until about this many bytes,
+// then written as a row group. It bounds the memory an export
+// takes whatever its size.
+const ROW_GROUP_BYTES = 8 << 20
+
+const PARQUET_MAGIC = "PAR1"
+
+// Values from the Parquet format's Thrift definitions.
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetRequired = 0
+	parquetUTF8     = 0
+	parquetPlain    = 0
+	parquetRLE      = 3
+	parquetDataPage = 0
+)
+
+var parquetTypes = map[int]int32{
+	INT64:   parquetInt64,
+	DOUBLE:  parquetDouble,
+	STRING:  parquetByteArray,
+	BOOLEAN: parquetBoolean,
+}
+
+type chunk struct {
+	offset int64
+	size   int64
+}
+
+type rowGroup struct {
+	rows   int64
+	chunks []chunk
+}
+
+// Writes a Parquet file with every column required, PLAIN encoded
+// and uncompressed, in row groups of a single page per column. Only
+// the metadata of written row groups is kept until Close writes the
+// footer.
+type parquetWriter struct {
+	out        io.Writer
+	columns    []Column
+	groupBytes int
+
+	// The values of the row group being built, PLAIN encoded.
+	pages    [][]byte
+	buffered int
+	rows     int64
+
+	offset int64
+	groups []rowGroup
+}
+
+func newParquetWriter(w io.Writer, columns []Column, groupBytes int) (*parquetWriter, error) {
+	p := &parquetWriter{out: w, columns: columns, groupBytes: groupBytes, pages: make([][]byte, len(columns))}
+	if err := p.write([]byte(PARQUET_MAGIC)); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *parquetWriter) write(b []byte) error {
+	n, err := p.out.Write(b)
+	p.offset += int64(n)
+	return err
+}
+
+func (p *parquetWriter) Write(row []interface{}) error {
+	for i, v := range row {
+		page := p.pages[i]
+		before := len(page)
+		switch p.columns[i].Type {
+		case INT64:
+			page = binary.LittleEndian.AppendUint64(page, uint64(v.(int64)))
+		case DOUBLE:
+			page = binary.LittleEndian.AppendUint64(page, math.Float64bits(v.(float64)))
+		case STRING:
+			s := v.(string)
+			page = binary.LittleEndian.AppendUint32(page, uint32(len(s)))
+			page = append(page, s...)
+		case BOOLEAN:
+			// Bit packed, least significant bit first.
+			if p.rows%8 == 0 {
+				page = append(page, 0)
+			}
+			if v.(bool) {
+				page[len(page)-1] |= 1 << (p.rows % 8)
+			}
+		default:
+			return fmt.Errorf("column %s has unknown type %d", p.columns[i].Name, p.columns[i].Type)
+		}
+		p.pages[i] = page
+		p.buffered += len(page) - before
+	}
+	p.rows++
+	if p.buffered >= p.groupBytes {
+		return p.flush()
+	}
+	return nil
+}
+
+// Writes the buffered rows as a row group.
+func (p *parquetWriter) flush() error {
+	if p.rows == 0 {
+		return nil
+	}
+	group := rowGroup{rows: p.rows, chunks: make([]chunk, len(p.columns))}
+	for i, page := range p.pages {
+		header := pageHeader(len(page), p.rows)
+		group.chunks[i] = chunk{offset: p.offset, size: int64(len(header) + len(page))}
+		if err := p.write(header); err != nil {
+			return err
+		}
+		if err := p.write(page); err != nil {
+			return err
+		}
+		p.pages[i] = page[:0]
+	}
+	p.groups = append(p.groups, group)
+	p.buffered, p.rows = 0, 0
+	return nil
+}
+
+func (p *parquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	footer := p.metadata()
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(len(footer)))
+	return p.write(append(footer, PARQUET_MAGIC...))
+}
+
+func pageHeader(size int, rows int64) []byte {
+	var t thrift
+	t.begin()
+	t.i32(1, parquetDataPage)
+	t.i32(2, int32(size))
+	t.i32(3, int32(size))
+	t.structField(5)
+	t.i32(1, int32(rows))
+	t.i32(2, parquetPlain)
+	t.i32(3, parquetRLE)
+	t.i32(4, parquetRLE)
+	t.end()
+	t.end()
+	return t.buf
+}
+
+// Returns the FileMetaData of the written row groups.
+func (p *parquetWriter) metadata() []byte {
+	var t thrift
+	t.begin()
+	t.i32(1, 1)
+
+	t.list(2, thriftStruct, len(p.columns)+1)
+	t.begin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(p.columns)))
+	t.end()
+	for _, col := range p.columns {
+		t.begin()
+		t.i32(1, parquetTypes[col.Type])
+		t.i32(3, parquetRequired)
+		t.binary(4, col.Name)
+		if col.Type == STRING {
+			t.i32(6, parquetUTF8)
+		}
+		t.end()
+	}
+
+	var rows int64
+	for _, g := range p.groups {
+		rows += g.rows
+	}
+	t.i64(3, rows)
+
+	t.list(4, thriftStruct, len(p.groups))
+	for _, g := range p.groups {
+		var size int64
+		t.begin()
+		t.list(1, thriftStruct, len(g.chunks))
+		for i, c := range g.chunks {
+			size += c.size
+			t.begin()
+			t.i64(2, c.offset)
+			t.structField(3)
+			t.i32(1, parquetTypes[p.columns[i].Type])
+			t.list(2, thriftI32, 1)
+			t.elemI32(parquetPlain)
+			t.list(3, thriftBinary, 1)
+			t.elemBinary(p.columns[i].Name)
+			t.i32(4, 0)
+			t.i64(5, g.rows)
+			t.i64(6, c.size)
+			t.i64(7, c.size)
+			t.i64(9, c.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, size)
+		t.i64(3, g.rows)
+		t.end()
+	}
+	t.binary(6, "watch-dog-kafka")
+	t.end()
+	return t.buf
+}
+
+// Thrift's compact protocol types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// Encodes structs in Thrift's compact protocol, which Parquet's
+// metadata is written in. Fields must be written in increasing
+// order of id within each struct.
+type thrift struct {
+	buf []byte
+	// The last field id written in each open struct.
+	last []int16
+}
+
+// Opens a struct, at the top level or as an element of a list.
+func (t *thrift) begin() {
+	t.last = append(t.last, 0)
+}
+
+// Closes the innermost open struct.
+func (t *thrift) end() {
+	t.buf = append(t.buf, 0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thrift) field(id int16, typ byte) {
+	top := len(t.last) - 1
+	if delta := id - t.last[top]; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.buf = binary.AppendVarint(t.buf, int64(id))
+	}
+	t.last[top] = id
+}
+
+func (t *thrift) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.elemI32(v)
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.buf = binary.AppendVarint(t.buf, v)
+}
+
+func (t *thrift) binary(id int16, s string) {
+	t.field(id, thriftBinary)
+	t.elemBinary(s)
+}
+
+// Opens a struct field, closed with end().
+func (t *thrift) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+// Starts a list field of n elements of type elem, which follow.
+func (t *thrift) list(id int16, elem byte, n int) {
+	t.field(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elem)
+	} else {
+		t.buf = append(t.buf, 0xf0|elem)
+		t.buf = binary.AppendUvarint(t.buf, uint64(n))
+	}
+}
+
+func (t *thrift) elemI32(v int32) {
+	t.buf = binary.AppendVarint(t.buf, int64(v))
+}
+
+func (t *thrift) elemBinary(s string) {
+	t.buf = binary.AppendUvarint(t.buf, uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
@@ -0,0 +1,157 @@
+package export
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// Decodes Thrift compact structs into maps of field id to value:
+// int64 for integers, []byte for binary, []interface{} for lists
+// and map[int16]interface{} for structs.
+type decoder struct {
+	buf []byte
+	pos int
+}
+
+func (d *decoder) varint() int64 {
+	v, n := binary.Varint(d.buf[d.pos:])
+	d.pos += n
+	return v
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf[d.pos:])
+	d.pos += n
+	return v
+}
+
+func (d *decoder) value(typ byte) interface{} {
+	switch typ {
+	case thriftI32, thriftI64:
+		return d.varint()
+	case thriftBinary:
+		n := int(d.uvarint())
+		b := d.buf[d.pos : d.pos+n]
+		d.pos += n
+		return b
+	case thriftList:
+		header := d.buf[d.pos]
+		d.pos++
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(d.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = d.value(header & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return d.structure()
+	}
+	panic("unexpected type")
+}
+
+func (d *decoder) structure() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var last int16
+	for {
+		header := d.buf[d.pos]
+		d.pos++
+		if header == 0 {
+			return fields
+		}
+		id := last + int16(header>>4)
+		if header>>4 == 0 {
+			id = int16(d.varint())
+		}
+		fields[id] = d.value(header & 0x0f)
+		last = id
+	}
+}
+
+func TestParquet(t *testing.T) {
+	columns := []Column{{"ticker", STRING}, {"time_stamp", INT64}, {"polarity", DOUBLE}, {"spam", BOOLEAN}}
+	var buf bytes.Buffer
+	// Small row groups, so the ten rows span several.
+	p, err := newParquetWriter(&buf, columns, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := p.Write([]interface{}{"AMD", int64(1000 + i), float64(i) / 4, i%3 == 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := buf.Bytes()
+	if string(file[:4]) != PARQUET_MAGIC || string(file[len(file)-4:]) != PARQUET_MAGIC {
+		t.Fatal("missing magic")
+	}
+	length := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	footer := &decoder{buf: file[len(file)-8-length : len(file)-8]}
+	meta := footer.structure()
+	if footer.pos != length {
+		t.Errorf("footer decoded to %d bytes of %d", footer.pos, length)
+	}
+	if meta[3].(int64) != 10 {
+		t.Errorf("num_rows %v", meta[3])
+	}
+	schema := meta[2].([]interface{})
+	if len(schema) != 5 || string(schema[1].(map[int16]interface{})[4].([]byte)) != "ticker" {
+		t.Errorf("schema %v", schema)
+	}
+
+	var (
+		stamps []int64
+		spam   []bool
+	)
+	groups := meta[4].([]interface{})
+	if len(groups) < 2 {
+		t.Fatalf("got %d row groups, want several", len(groups))
+	}
+	for _, g := range groups {
+		group := g.(map[int16]interface{})
+		rows := int(group[3].(int64))
+		chunks := group[1].([]interface{})
+		read := func(column int) []byte {
+			meta := chunks[column].(map[int16]interface{})[3].(map[int16]interface{})
+			if meta[5].(int64) != int64(rows) {
+				t.Errorf("chunk has %v values, want %d", meta[5], rows)
+			}
+			page := &decoder{buf: file, pos: int(meta[9].(int64))}
+			header := page.structure()
+			if header[5].(map[int16]interface{})[1].(int64) != int64(rows) {
+				t.Errorf("page header %v", header)
+			}
+			return file[page.pos : page.pos+int(header[2].(int64))]
+		}
+		data := read(1)
+		for i := 0; i < rows; i++ {
+			stamps = append(stamps, int64(binary.LittleEndian.Uint64(data[8*i:])))
+		}
+		data = read(3)
+		for i := 0; i < rows; i++ {
+			spam = append(spam, data[i/8]&(1<<(i%8)) != 0)
+		}
+		if data := read(0); string(data[4:7]) != "AMD" || binary.LittleEndian.Uint32(data) != 3 {
+			t.Errorf("ticker column %q", data)
+		}
+		if data := read(2); math.Float64frombits(binary.LittleEndian.Uint64(data)) != float64(stamps[len(stamps)-rows]-1000)/4 {
+			t.Errorf("polarity column %v", data)
+		}
+	}
+	for i := range stamps {
+		if stamps[i] != int64(1000+i) || spam[i] != (i%3 == 0) {
+			t.Fatalf("row %d read back as %d, %v", i, stamps[i], spam[i])
+		}
+	}
+	if len(stamps) != 10 {
+		t.Errorf("read back %d rows", len(stamps))
+	}
+}
@@ -1,11 +1,12 @@
 module github.com/jonreesman/watch-dog-kafka
 
-go 1.18
+go 1.21
 
 require (
 	github.com/forPelevin/gomoji v1.1.3
 	github.com/gin-gonic/gin v1.7.7
 	github.com/go-sql-driver/mysql v1.6.0
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/n0madic/twitter-scraper v0.0.0-20220428111857-6626e52adeb9
 	google.golang.org/grpc v1.46.0
 )
@@ -39,5 +40,5 @@ require (
 	golang.org/x/sys v0.0.0-20220429233432-b5fbb4746d32 // indirect
 	golang.org/x/text v0.3.7 // indirect
 	google.golang.org/protobuf v1.28.0
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,245 @@
+package graph
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// Rounds of label propagation after which clustering stops even
+// if labels are still changing.
+const MAX_CLUSTER_ROUNDS = 20
+
+// A ticker in the co-mention graph.
+type Node struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+	// Statements mentioning the ticker.
+	Mentions int `json:"mentions"`
+	// The id of the node that names the node's cluster.
+	Cluster int `json:"cluster"`
+}
+
+// Two tickers mentioned in the same statements.
+type Edge struct {
+	Source int `json:"source"`
+	Target int `json:"target"`
+	// Statements mentioning both tickers.
+	Mentions int `json:"mentions"`
+	// The share of the statements mentioning either ticker that
+	// mention both, from 0 to 1, so that two tickers talked about
+	// a lot are not related just for being popular.
+	Weight float64 `json:"weight"`
+}
+
+// An undirected graph of tickers weighted by how often they are
+// mentioned together.
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+
+	index map[int]int
+	// Maps each pair of ids, lower first, to its edge.
+	pairs map[[2]int]int
+}
+
+// Creates an empty graph.
+func New() *Graph {
+	return &Graph{index: make(map[int]int), pairs: make(map[[2]int]int)}
+}
+
+func (g *Graph) node(id int, name string) *Node {
+	i, ok := g.index[id]
+	if !ok {
+		i = len(g.Nodes)
+		g.index[id] = i
+		g.Nodes = append(g.Nodes, Node{Id: id, Name: name, Cluster: id})
+	}
+	return &g.Nodes[i]
+}
+
+// Counts statements mentioning both a and b. With a equal to b,
+// counts statements mentioning a at all. Counts for the same pair
+// add up, so a graph can be built from one count per hour.
+func (g *Graph) Add(a int, nameA string, b int, nameB string, mentions int) {
+	if a == b {
+		g.node(a, nameA).Mentions += mentions
+		return
+	}
+	g.node(a, nameA)
+	g.node(b, nameB)
+	if a > b {
+		a, b = b, a
+	}
+	if i, ok := g.pairs[[2]int{a, b}]; ok {
+		g.Edges[i].Mentions += mentions
+		return
+	}
+	g.pairs[[2]int{a, b}] = len(g.Edges)
+	g.Edges = append(g.Edges, Edge{Source: a, Target: b, Mentions: mentions})
+}
+
+// Computes the weight of every edge, drops those lighter than
+// minWeight along with nodes left without edges, and clusters
+// what remains. Call it once every count has been added.
+func (g *Graph) Finish(minWeight float64) {
+	var edges []Edge
+	for _, e := range g.Edges {
+		a, b := g.Nodes[g.index[e.Source]], g.Nodes[g.index[e.Target]]
+		// A ticker is mentioned at least as often as with another.
+		union := max(a.Mentions, e.Mentions) + max(b.Mentions, e.Mentions) - e.Mentions
+		e.Weight = float64(e.Mentions) / float64(union)
+		if e.Weight >= minWeight {
+			edges = append(edges, e)
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].Source != edges[j].Source {
+			return edges[i].Source < edges[j].Source
+		}
+		return edges[i].Target < edges[j].Target
+	})
+	connected := make(map[int]bool)
+	for _, e := range edges {
+		connected[e.Source] = true
+		connected[e.Target] = true
+	}
+	var nodes []Node
+	for _, n := range g.Nodes {
+		if connected[n.Id] {
+			nodes = append(nodes, n)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].Id < nodes[j].Id })
+	g.Nodes, g.Edges = nodes, edges
+	g.reindex()
+	g.cluster()
+}
+
+func (g *Graph) reindex() {
+	g.index = make(map[int]int, len(g.Nodes))
+	for i, n := range g.Nodes {
+		g.index[n.Id] = i
+	}
+	g.pairs = make(map[[2]int]int, len(g.Edges))
+	for i, e := range g.Edges {
+		g.pairs[[2]int{e.Source, e.Target}] = i
+	}
+}
+
+// Groups nodes by weighted label propagation: every node takes
+// the label that carries the most edge weight among its
+// neighbours, until no label changes. Nodes are visited in id
+// order and ties go to the lowest label, so the result does not
+// depend on the order counts were added in.
+func (g *Graph) cluster() {
+	adjacent := make(map[int][]Edge)
+	for _, e := range g.Edges {
+		adjacent[e.Source] = append(adjacent[e.Source], e)
+		adjacent[e.Target] = append(adjacent[e.Target], e)
+	}
+	for round := 0; round < MAX_CLUSTER_ROUNDS; round++ {
+		changed := false
+		for i, n := range g.Nodes {
+			weights := map[int]float64{n.Cluster: 0}
+			for _, e := range adjacent[n.Id] {
+				other := e.Target
+				if other == n.Id {
+					other = e.Source
+				}
+				weights[g.Nodes[g.index[other]].Cluster] += e.Weight
+			}
+			best := n.Cluster
+			for label, w := range weights {
+				if w > weights[best] || w == weights[best] && label < best {
+					best = label
+				}
+			}
+			if best != n.Cluster {
+				g.Nodes[i].Cluster = best
+				changed = true
+			}
+		}
+		if !changed {
+			return
+		}
+	}
+}
+
+// A ticker related to another, with the edge between them.
+type Neighbor struct {
+	Id       int     `json:"ticker_id"`
+	Name     string  `json:"name"`
+	Mentions int     `json:"mentions"`
+	Weight   float64 `json:"weight"`
+}
+
+// Returns the tickers connected to id, heaviest edge first.
+func (g *Graph) Neighbors(id int) []Neighbor {
+	var neighbors []Neighbor
+	for _, e := range g.Edges {
+		other := e.Target
+		if e.Target == id {
+			other = e.Source
+		} else if e.Source != id {
+			continue
+		}
+		n := g.Nodes[g.index[other]]
+		neighbors = append(neighbors, Neighbor{Id: n.Id, Name: n.Name, Mentions: e.Mentions, Weight: e.Weight})
+	}
+	sort.SliceStable(neighbors, func(i, j int) bool { return neighbors[i].Weight > neighbors[j].Weight })
+	return neighbors
+}
+
+// Returns the nodes in the same cluster as id, including it, or
+// nil if id is not in the graph.
+func (g *Graph) Cluster(id int) []Node {
+	i, ok := g.index[id]
+	if !ok {
+		return nil
+	}
+	var members []Node
+	for _, n := range g.Nodes {
+		if n.Cluster == g.Nodes[i].Cluster {
+			members = append(members, n)
+		}
+	}
+	return members
+}
+
+// Returns the graph of id, its neighbours and the rest of its
+// cluster, with every edge between them.
+func (g *Graph) Around(id int) *Graph {
+	keep := make(map[int]bool)
+	for _, n := range g.Cluster(id) {
+		keep[n.Id] = true
+	}
+	for _, n := range g.Neighbors(id) {
+		keep[n.Id] = true
+	}
+	sub := New()
+	for _, n := range g.Nodes {
+		if keep[n.Id] {
+			sub.Nodes = append(sub.Nodes, n)
+		}
+	}
+	for _, e := range g.Edges {
+		if keep[e.Source] && keep[e.Target] {
+			sub.Edges = append(sub.Edges, e)
+		}
+	}
+	sub.reindex()
+	return sub
+}
+
+// Writes the graph as node-link JSON.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	out := *g
+	if out.Nodes == nil {
+		out.Nodes = []Node{}
+	}
+	if out.Edges == nil {
+		out.Edges = []Edge{}
+	}
+	return json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,98 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/xml"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// Two baskets, AMD/NVDA/INTC and GME/AMC, joined by a single
+// stray statement, and SPY mentioned with nothing.
+func sample() *Graph {
+	g := New()
+	names := map[int]string{1: "AMD", 2: "NVDA", 3: "INTC", 4: "GME", 5: "AMC", 6: "SPY"}
+	add := func(a, b, n int) { g.Add(a, names[a], b, names[b], n) }
+	for id, n := range map[int]int{1: 20, 2: 20, 3: 10, 4: 30, 5: 20, 6: 50} {
+		add(id, id, n)
+	}
+	// Counts arrive per hour and in either order.
+	add(1, 2, 6)
+	add(2, 1, 4)
+	add(1, 3, 5)
+	add(2, 3, 5)
+	add(4, 5, 15)
+	add(3, 4, 1)
+	g.Finish(0.05)
+	return g
+}
+
+func TestGraph(t *testing.T) {
+	g := sample()
+	var ids []int
+	for _, n := range g.Nodes {
+		ids = append(ids, n.Id)
+	}
+	// SPY has no edges, and INTC-GME is below the weight.
+	if want := []int{1, 2, 3, 4, 5}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("nodes %v, want %v", ids, want)
+	}
+	if len(g.Edges) != 4 {
+		t.Errorf("got edges %+v", g.Edges)
+	}
+
+	neighbors := g.Neighbors(1)
+	if len(neighbors) != 2 || neighbors[0].Name != "NVDA" || neighbors[0].Mentions != 10 {
+		t.Fatalf("got neighbors %+v", neighbors)
+	}
+	// 10 of the 30 statements mentioning AMD or NVDA.
+	if math.Abs(neighbors[0].Weight-1.0/3) > 1e-9 {
+		t.Errorf("AMD-NVDA weight %v, want 1/3", neighbors[0].Weight)
+	}
+
+	cluster := func(id int) []string {
+		var names []string
+		for _, n := range g.Cluster(id) {
+			names = append(names, n.Name)
+		}
+		return names
+	}
+	if got := cluster(3); !reflect.DeepEqual(got, []string{"AMD", "NVDA", "INTC"}) {
+		t.Errorf("INTC clustered with %v", got)
+	}
+	if got := cluster(5); !reflect.DeepEqual(got, []string{"GME", "AMC"}) {
+		t.Errorf("AMC clustered with %v", got)
+	}
+	if g.Cluster(6) != nil {
+		t.Error("SPY should not be in the graph")
+	}
+
+	around := g.Around(4)
+	if len(around.Nodes) != 2 || len(around.Edges) != 1 {
+		t.Errorf("around GME: %+v", around)
+	}
+}
+
+func TestWriteGraphML(t *testing.T) {
+	var buf bytes.Buffer
+	if err := sample().WriteGraphML(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var doc graphML
+	if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("%v\n%s", err, buf.String())
+	}
+	if doc.Xmlns != GRAPHML_NAMESPACE || doc.Graph.EdgeDefault != "undirected" {
+		t.Errorf("got %+v", doc)
+	}
+	if len(doc.Graph.Nodes) != 5 || len(doc.Graph.Edges) != 4 {
+		t.Fatalf("got %d nodes and %d edges", len(doc.Graph.Nodes), len(doc.Graph.Edges))
+	}
+	if n := doc.Graph.Nodes[0]; n.Id != "t1" || n.Data[0] != (graphMLData{Key: "name", Value: "AMD"}) {
+		t.Errorf("first node %+v", n)
+	}
+	if e := doc.Graph.Edges[0]; e.Source != "t1" || e.Target != "t2" || e.Data[0].Value != "10" {
+		t.Errorf("first edge %+v", e)
+	}
+}
@@ -0,0 +1,100 @@
+package graph
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+)
+
+const GRAPHML_NAMESPACE = "http://graphml.graphdrawing.org/xmlns"
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	Id   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	Id          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	Id   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Attributes written for nodes and edges. Edge mentions have a
+// key of their own, since GraphML keys are shared by both.
+var graphMLKeys = []graphMLKey{
+	{Id: "name", For: "node", Name: "name", Type: "string"},
+	{Id: "mentions", For: "node", Name: "mentions", Type: "int"},
+	{Id: "cluster", For: "node", Name: "cluster", Type: "int"},
+	{Id: "co_mentions", For: "edge", Name: "mentions", Type: "int"},
+	{Id: "weight", For: "edge", Name: "weight", Type: "double"},
+}
+
+func nodeId(id int) string {
+	return "t" + strconv.Itoa(id)
+}
+
+// Writes the graph as GraphML, which Gephi, Cytoscape and
+// networkx read. Nodes are named t<ticker id>.
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	doc := graphML{
+		Xmlns: GRAPHML_NAMESPACE,
+		Keys:  graphMLKeys,
+		Graph: graphMLGraph{Id: "co-mentions", EdgeDefault: "undirected"},
+	}
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			Id: nodeId(n.Id),
+			Data: []graphMLData{
+				{Key: "name", Value: n.Name},
+				{Key: "mentions", Value: strconv.Itoa(n.Mentions)},
+				{Key: "cluster", Value: strconv.Itoa(n.Cluster)},
+			},
+		})
+	}
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: nodeId(e.Source),
+			Target: nodeId(e.Target),
+			Data: []graphMLData{
+				{Key: "co_mentions", Value: strconv.Itoa(e.Mentions)},
+				{Key: "weight", Value: strconv.FormatFloat(e.Weight, 'f', -1, 64)},
+			},
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,167 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Reports whether a dependency is usable, returning nil if so.
+type Check func(ctx context.Context) error
+
+// The outcome of a single check.
+type Result struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+	Latency string `json:"latency"`
+	// Optional checks are reported but do not affect readiness.
+	Optional bool `json:"optional,omitempty"`
+}
+
+// The outcome of every check. Ready is false if any
+// required check failed.
+type Report struct {
+	Ready  bool     `json:"ready"`
+	Checks []Result `json:"checks"`
+}
+
+type namedCheck struct {
+	name     string
+	check    Check
+	optional bool
+}
+
+// Runs a set of named checks concurrently. It is safe to
+// add checks and run them from several goroutines.
+type Checker struct {
+	// How long each check may take before it counts as failed.
+	Timeout time.Duration
+
+	mu     sync.Mutex
+	checks []namedCheck
+}
+
+// Creates a Checker with a 2 second timeout per check.
+func NewChecker() *Checker {
+	return &Checker{Timeout: 2 * time.Second}
+}
+
+// Adds a check that must pass for the service to be ready.
+func (c *Checker) Add(name string, check Check) {
+	c.add(namedCheck{name: name, check: check})
+}
+
+// Adds a check that is reported but does not affect readiness.
+func (c *Checker) AddOptional(name string, check Check) {
+	c.add(namedCheck{name: name, check: check, optional: true})
+}
+
+func (c *Checker) add(nc namedCheck) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, nc)
+}
+
+// Runs every check and returns their results sorted by name.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := append([]namedCheck(nil), c.checks...)
+	c.mu.Unlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, nc := range checks {
+		wg.Add(1)
+		go func(i int, nc namedCheck) {
+			defer wg.Done()
+			results[i] = c.run(ctx, nc)
+		}(i, nc)
+	}
+	wg.Wait()
+
+	report := Report{Ready: true, Checks: results}
+	for _, r := range results {
+		if !r.OK && !r.Optional {
+			report.Ready = false
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, nc namedCheck) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err <- fmt.Errorf("check panicked: %v", r)
+			}
+		}()
+		err <- nc.check(ctx)
+	}()
+
+	r := Result{Name: nc.name, Optional: nc.optional}
+	select {
+	case e := <-err:
+		if e != nil {
+			r.Error = e.Error()
+		}
+	case <-ctx.Done():
+		r.Error = ctx.Err().Error()
+	}
+	r.OK = r.Error == ""
+	r.Latency = time.Since(start).Round(time.Millisecond).String()
+	return r
+}
+
+// Returns a check that asks a gRPC server for its status with
+// the standard health checking protocol. An empty service
+// checks the server as a whole.
+// See https://github.com/grpc/grpc/blob/master/doc/health-checking.md
+func GRPC(conn *grpc.ClientConn, service string) Check {
+	client := healthpb.NewHealthClient(conn)
+	return func(ctx context.Context) error {
+		resp, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			return err
+		}
+		if resp.Status != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("status %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// Returns a check that fails while lag reports more than max.
+func MaxLag(lag func(ctx context.Context) (time.Duration, error), max time.Duration) Check {
+	return func(ctx context.Context) error {
+		d, err := lag(ctx)
+		if err != nil {
+			return err
+		}
+		if d > max {
+			return fmt.Errorf("lag of %v exceeds %v", d, max)
+		}
+		return nil
+	}
+}
+
+// Returns a check that fails with msg until loaded reports true.
+func Loaded(msg string, loaded func() bool) Check {
+	return func(ctx context.Context) error {
+		if !loaded() {
+			return errors.New(msg)
+		}
+		return nil
+	}
+}
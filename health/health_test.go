@@ -0,0 +1,87 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	grpchealth "google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestChecker(t *testing.T) {
+	c := NewChecker()
+	c.Timeout = 50 * time.Millisecond
+	c.Add("ok", func(ctx context.Context) error { return nil })
+	c.AddOptional("lag", func(ctx context.Context) error { return errors.New("too far behind") })
+
+	report := c.Run(context.Background())
+	if !report.Ready {
+		t.Errorf("optional failure made the report not ready: %+v", report)
+	}
+	if report.Checks[0].Name != "lag" || report.Checks[0].OK || report.Checks[0].Error != "too far behind" {
+		t.Errorf("unexpected result %+v", report.Checks[0])
+	}
+
+	c.Add("slow", func(ctx context.Context) error { time.Sleep(time.Second); return nil })
+	c.Add("panics", func(ctx context.Context) error { panic("boom") })
+	report = c.Run(context.Background())
+	if report.Ready {
+		t.Error("expected not ready")
+	}
+	for _, r := range report.Checks {
+		switch r.Name {
+		case "slow":
+			if r.OK || r.Error != context.DeadlineExceeded.Error() {
+				t.Errorf("slow check: %+v", r)
+			}
+		case "panics":
+			if r.OK {
+				t.Errorf("panicking check passed: %+v", r)
+			}
+		}
+	}
+}
+
+func TestMaxLag(t *testing.T) {
+	lag := func(d time.Duration) func(context.Context) (time.Duration, error) {
+		return func(context.Context) (time.Duration, error) { return d, nil }
+	}
+	if err := MaxLag(lag(5*time.Second), 30*time.Second)(context.Background()); err != nil {
+		t.Error(err)
+	}
+	if err := MaxLag(lag(time.Minute), 30*time.Second)(context.Background()); err == nil {
+		t.Error("expected lag above the maximum to fail")
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	hs := grpchealth.NewServer()
+	healthpb.RegisterHealthServer(server, hs)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	check := GRPC(conn, "")
+	if err := check(context.Background()); err != nil {
+		t.Errorf("serving server failed the check: %v", err)
+	}
+	hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	if err := check(context.Background()); err == nil {
+		t.Error("expected a NOT_SERVING server to fail the check")
+	}
+}
@@ -0,0 +1,255 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/metrics"
+	"github.com/jonreesman/watch-dog-kafka/twitter"
+)
+
+const (
+	// Largest range, in hours, handed to a single
+	// Source.ScrapeRange() call while backfilling.
+	BACKFILL_CHUNK_HOURS = 6
+	// How far back a newly added ticker is backfilled.
+	NEW_TICKER_BACKFILL = 7 * 24 * time.Hour
+	// How long a job may go without progress before it is
+	// considered abandoned and republished. Failed jobs are
+	// retried after the same wait.
+	BACKFILL_STALE_AFTER = 15 * time.Minute
+	// How often stale jobs are looked for while running.
+	BACKFILL_RESUME_INTERVAL = 5 * time.Minute
+)
+
+const hour = int64(time.Hour / time.Second)
+
+// Defines the message published on the `backfill` topic.
+// The range itself lives in the database so that progress
+// survives restarts.
+type BackfillRequest struct {
+	JobId int `json:"job_id"`
+}
+
+// Creates a backfill job for a ticker and publishes it on the
+// `backfill` topic. Returns the id of the new job. If only the
+// publish fails, the id is returned with the error and the job
+// is picked up later by ResumeBackfills().
+func RequestBackfill(ctx context.Context, d Store, bus Bus, tickerId int, fromTime, toTime int64) (int, error) {
+	id, err := d.AddBackfillJob(tickerId, fromTime, toTime)
+	if err != nil {
+		return 0, err
+	}
+	return id, publishBackfill(ctx, bus, id, tickerId)
+}
+
+// Republishes every unfinished backfill job that has stopped
+// making progress, so that jobs interrupted by a restart or
+// failed by a chunk pick up from their cursor. A republished job
+// counts as having made progress, so it is not republished again
+// until it is stale once more.
+func ResumeBackfills(d Store, bus Bus, logger *slog.Logger) {
+	jobs, err := d.ReturnStaleBackfillJobs(time.Now().Add(-BACKFILL_STALE_AFTER).Unix())
+	if err != nil {
+		logger.Error("failed to retrieve stale backfill jobs", "err", err)
+		return
+	}
+	for _, job := range jobs {
+		l := logger.With("job_id", job.Id, "ticker_id", job.TickerId)
+		l.Info("resuming backfill", "cursor", job.Cursor, "status", job.Status)
+		if err := publishBackfill(context.Background(), bus, job.Id, job.TickerId); err != nil {
+			l.Error("failed to resume backfill", "err", err)
+			continue
+		}
+		if err := d.UpdateBackfillJob(job.Id, job.Cursor, job.Status); err != nil {
+			l.Error("failed to record resumed backfill", "err", err)
+		}
+	}
+}
+
+// Calls ResumeBackfills() at once and then every interval until
+// ctx is done.
+func RunBackfillResumer(ctx context.Context, d Store, bus Bus, logger *slog.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		ResumeBackfills(d, bus, logger)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Jobs are keyed by ticker id, so that one ticker's jobs are
+// handled in order on a single partition.
+func publishBackfill(ctx context.Context, bus Bus, jobId, tickerId int) error {
+	payload, err := json.Marshal(BackfillRequest{JobId: jobId})
+	if err != nil {
+		return err
+	}
+	if err := Produce(ctx, bus, BACKFILL_TOPIC, strconv.Itoa(tickerId), string(payload)); err != nil {
+		return fmt.Errorf("failed to publish backfill job %d: %w", jobId, err)
+	}
+	return nil
+}
+
+// Processes a backfill job. Only hours with no stored sentiment
+// that have not been scraped before are scraped, in chunks of at
+// most BACKFILL_CHUNK_HOURS, and the job cursor is advanced after
+// each chunk is committed. If a chunk fails, the job is marked
+// BACKFILL_FAILED with its cursor where it was, to be retried by
+// ResumeBackfills().
+func runBackfill(ctx context.Context, config *ConsumerConfig, logger *slog.Logger, jobId int) error {
+	logger = logger.With("job_id", jobId)
+	d := scope(config.Store, ctx, logger)
+	job, err := d.RetrieveBackfillJobById(jobId)
+	if err != nil {
+		return err
+	}
+	if job.Status == db.BACKFILL_DONE {
+		return nil
+	}
+	tick, err := d.RetrieveTickerById(job.TickerId)
+	if err != nil {
+		return err
+	}
+
+	start := job.Cursor
+	if start < job.FromTime {
+		start = job.FromTime
+	}
+	present, err := d.ReturnCoveredHours(job.TickerId, start-start%hour, job.ToTime)
+	if err != nil {
+		return err
+	}
+	chunks := chunkHours(missingHours(present, start, job.ToTime), BACKFILL_CHUNK_HOURS)
+	logger = logger.With("ticker", tick.Name)
+	d = scope(d, ctx, logger)
+	logger.Info("backfilling", "chunks", len(chunks))
+
+	source := config.source()
+	query := config.query(d, logger, tick.Id, tick.Name)
+	cursor := job.Cursor
+	for _, chunk := range chunks {
+		t := ticker{
+			Name:           tick.Name,
+			Id:             tick.Id,
+			db:             d,
+			grpcServerConn: config.GrpcServerConn,
+			logger:         logger,
+		}
+		start := time.Now()
+		t.Tweets, err = source.ScrapeRange(logger, query, chunk[0], chunk[1])
+		if err != nil {
+			return failBackfill(d, logger, job.Id, cursor, fmt.Errorf("scraping %d to %d: %w", chunk[0], chunk[1], err))
+		}
+		t.numTweets = len(t.Tweets)
+		metrics.ScrapeDuration.Since(start, t.Name, source.Name())
+		metrics.ScrapedStatements.WithLabelValues(t.Name, source.Name()).Add(float64(t.numTweets))
+		t.spamProcessor(ctx, config)
+		if err := t.computeHourlySentiment(ctx); err != nil {
+			return failBackfill(d, logger, job.Id, cursor, fmt.Errorf("analyzing %d to %d: %w", chunk[0], chunk[1], err))
+		}
+		if err := t.pushStatements(ctx, config); err != nil {
+			return failBackfill(d, logger, job.Id, cursor, fmt.Errorf("storing %d to %d: %w", chunk[0], chunk[1], err))
+		}
+		if config.Alerter != nil {
+			config.Alerter.Check(logger, t.Id, t.Name)
+		}
+		// Hours with statements now have a sentiment, but those
+		// without would otherwise be scraped again by every job.
+		if err := d.AddScrapedHours(job.TickerId, hoursIn(chunk, start.Unix())...); err != nil {
+			logger.Warn("failed to record scraped hours", "err", err)
+		}
+		cursor = chunk[1]
+		if err := d.UpdateBackfillJob(job.Id, cursor, db.BACKFILL_RUNNING); err != nil {
+			logger.Error("failed to record backfill progress", "err", err)
+		}
+	}
+	return d.UpdateBackfillJob(job.Id, job.ToTime, db.BACKFILL_DONE)
+}
+
+// Marks a job failed, keeping its cursor, and returns err.
+func failBackfill(d Store, logger *slog.Logger, jobId int, cursor int64, err error) error {
+	if err := d.UpdateBackfillJob(jobId, cursor, db.BACKFILL_FAILED); err != nil {
+		logger.Error("failed to record backfill failure", "err", err)
+	}
+	return err
+}
+
+// Returns the start of every hour in [fromTime, toTime) that
+// has no timestamp in present.
+func missingHours(present []int64, fromTime, toTime int64) []int64 {
+	have := make(map[int64]bool, len(present))
+	for _, ts := range present {
+		have[ts-ts%hour] = true
+	}
+	var missing []int64
+	for h := fromTime - fromTime%hour; h < toTime; h += hour {
+		if !have[h] {
+			missing = append(missing, h)
+		}
+	}
+	return missing
+}
+
+// Returns the start of every hour in a [from, to) chunk that had
+// ended by before. Later hours may yet gain statements.
+func hoursIn(chunk [2]int64, before int64) []int64 {
+	var hours []int64
+	for h := chunk[0]; h < chunk[1] && h+hour <= before; h += hour {
+		hours = append(hours, h)
+	}
+	return hours
+}
+
+// Merges sorted hour starts into contiguous [from, to) ranges
+// that span at most maxHours each.
+func chunkHours(hours []int64, maxHours int) [][2]int64 {
+	var chunks [][2]int64
+	for _, h := range hours {
+		n := len(chunks)
+		if n > 0 && chunks[n-1][1] == h && chunks[n-1][1]-chunks[n-1][0] < int64(maxHours)*hour {
+			chunks[n-1][1] = h + hour
+			continue
+		}
+		chunks = append(chunks, [2]int64{h, h + hour})
+	}
+	return chunks
+}
+
+// Returns the start of every bucket of the given size that
+// contains at least one statement, in ascending order.
+func bucketStarts(statements []twitter.Statement, size int64) []int64 {
+	seen := make(map[int64]bool)
+	var starts []int64
+	for _, s := range statements {
+		start := s.TimeStamp - s.TimeStamp%size
+		if !seen[start] {
+			seen[start] = true
+			starts = append(starts, start)
+		}
+	}
+	sort.Slice(starts, func(i, j int) bool { return starts[i] < starts[j] })
+	return starts
+}
+
+// Parses the time formats accepted on the command line:
+// RFC3339, a bare YYYY-MM-DD date (UTC), or unix seconds.
+func ParseBackfillTime(s string) (int64, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.Unix(), nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t.Unix(), nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
@@ -0,0 +1,170 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/logging"
+	"github.com/jonreesman/watch-dog-kafka/twitter"
+)
+
+func TestMissingHours(t *testing.T) {
+	present := []int64{hour + 120, 3*hour + 5}
+	got := missingHours(present, 30, 5*hour)
+	want := []int64{0, 2 * hour, 4 * hour}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("missingHours() = %v, want %v", got, want)
+	}
+}
+
+// Finds nothing, and fails from the chunk starting at failFrom on
+// if it is set.
+type rangeSource struct {
+	failFrom int64
+	scraped  [][2]int64
+}
+
+func (*rangeSource) Name() string {
+	return "range"
+}
+
+func (*rangeSource) Scrape(logger *slog.Logger, query twitter.Query, lastScrapeTime int64) []twitter.Statement {
+	return nil
+}
+
+func (s *rangeSource) ScrapeRange(logger *slog.Logger, query twitter.Query, fromTime, toTime int64) ([]twitter.Statement, error) {
+	if s.failFrom != 0 && fromTime >= s.failFrom {
+		return nil, errors.New("rate limited")
+	}
+	s.scraped = append(s.scraped, [2]int64{fromTime, toTime})
+	return nil, nil
+}
+
+func TestRunBackfill(t *testing.T) {
+	d := newMemoryStore()
+	id, _ := d.AddTicker("AMD")
+	to := time.Now().Unix()
+	to -= to%hour + 2*hour
+	from := to - 2*BACKFILL_CHUNK_HOURS*hour
+	middle := from + BACKFILL_CHUNK_HOURS*hour
+	jobId, _ := d.AddBackfillJob(id, from, to)
+	source := &rangeSource{failFrom: middle}
+	config := &ConsumerConfig{Store: d, Source: source, Logger: logging.Discard()}
+	ctx := context.Background()
+
+	// A failed chunk leaves the cursor after the last one that
+	// succeeded.
+	if err := runBackfill(ctx, config, config.Logger, jobId); err == nil {
+		t.Fatal("expected the second chunk to fail")
+	}
+	job, _ := d.RetrieveBackfillJobById(jobId)
+	if job.Status != db.BACKFILL_FAILED || job.Cursor != middle {
+		t.Errorf("got job %+v, want it failed at %d", job, middle)
+	}
+	if covered, _ := d.ReturnCoveredHours(id, from, to); len(covered) != BACKFILL_CHUNK_HOURS {
+		t.Errorf("got %d hours covered, want %d", len(covered), BACKFILL_CHUNK_HOURS)
+	}
+
+	// A retry only scrapes what is left, as the hours in which
+	// nothing was found count as covered.
+	source.failFrom = 0
+	source.scraped = nil
+	if err := runBackfill(ctx, config, config.Logger, jobId); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][2]int64{{middle, to}}; !reflect.DeepEqual(source.scraped, want) {
+		t.Errorf("scraped %v, want %v", source.scraped, want)
+	}
+	if job, _ := d.RetrieveBackfillJobById(jobId); job.Status != db.BACKFILL_DONE || job.Cursor != to {
+		t.Errorf("got job %+v, want it done", job)
+	}
+
+	// So does a new job over the same range.
+	source.scraped = nil
+	jobId, _ = d.AddBackfillJob(id, from, to)
+	if err := runBackfill(ctx, config, config.Logger, jobId); err != nil || len(source.scraped) != 0 {
+		t.Errorf("scraped %v, %v", source.scraped, err)
+	}
+
+	// The current hour is scraped, but may still gain statements.
+	source.scraped = nil
+	current := time.Now().Unix()
+	current -= current % hour
+	jobId, _ = d.AddBackfillJob(id, current, current+hour)
+	if err := runBackfill(ctx, config, config.Logger, jobId); err != nil || len(source.scraped) != 1 {
+		t.Errorf("scraped %v, %v", source.scraped, err)
+	}
+	if covered, _ := d.ReturnCoveredHours(id, current, current+hour); len(covered) != 0 {
+		t.Errorf("current hour recorded as scraped")
+	}
+}
+
+func TestResumeBackfills(t *testing.T) {
+	d := newMemoryStore()
+	bus := NewMemoryBus()
+	defer bus.Close()
+	for i := 0; i < 3; i++ {
+		d.AddBackfillJob(7, 0, hour)
+	}
+	stale := time.Now().Add(-2 * BACKFILL_STALE_AFTER).Unix()
+	d.jobs[0].Status, d.jobs[0].UpdatedAt = db.BACKFILL_FAILED, stale
+	d.jobs[1].Status, d.jobs[1].UpdatedAt = db.BACKFILL_DONE, stale
+
+	// Only the stale unfinished job is republished, and it is not
+	// republished again until it is stale once more.
+	ResumeBackfills(d, bus, logging.Discard())
+	ResumeBackfills(d, bus, logging.Discard())
+	messages := bus.Messages(BACKFILL_TOPIC)
+	if len(messages) != 1 || string(messages[0].Value) != `{"job_id":1}` {
+		t.Fatalf("published %v", messages)
+	}
+	if job := d.jobs[0]; job.Status != db.BACKFILL_FAILED || job.UpdatedAt <= stale {
+		t.Errorf("got job %+v", job)
+	}
+}
+
+func TestChunkHours(t *testing.T) {
+	hours := []int64{0, hour, 2 * hour, 3 * hour, 7 * hour}
+	got := chunkHours(hours, 3)
+	want := [][2]int64{{0, 3 * hour}, {3 * hour, 4 * hour}, {7 * hour, 8 * hour}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("chunkHours() = %v, want %v", got, want)
+	}
+}
+
+func TestBucketStarts(t *testing.T) {
+	statements := []twitter.Statement{
+		{TimeStamp: 2*hour + 10},
+		{TimeStamp: 10},
+		{TimeStamp: 2*hour + 3000},
+		{TimeStamp: 100},
+	}
+	if got, want := bucketStarts(statements, hour), []int64{0, 2 * hour}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hourly bucketStarts() = %v, want %v", got, want)
+	}
+	want := []int64{0, 2 * hour, 2*hour + 2700}
+	if got := bucketStarts(statements, 900); !reflect.DeepEqual(got, want) {
+		t.Errorf("quarter hour bucketStarts() = %v, want %v", got, want)
+	}
+}
+
+func TestParseBackfillTime(t *testing.T) {
+	for in, want := range map[string]int64{
+		"2022-05-04":           1651622400,
+		"2022-05-04T01:00:00Z": 1651626000,
+		"1651691408":           1651691408,
+	} {
+		got, err := ParseBackfillTime(in)
+		if err != nil || got != want {
+			t.Errorf("ParseBackfillTime(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	if _, err := ParseBackfillTime("yesterday"); err == nil {
+		t.Errorf("expected an error for an unparseable time")
+	}
+}
@@ -0,0 +1,51 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// Checks that at least one of brokers accepts connections
+// and returns cluster metadata.
+func PingBrokers(ctx context.Context, brokers []string) error {
+	var err error
+	for _, broker := range brokers {
+		var conn *kafka.Conn
+		conn, err = kafka.DialContext(ctx, "tcp", broker)
+		if err != nil {
+			continue
+		}
+		_, err = conn.Brokers()
+		conn.Close()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Blocks until the bus is reachable, backing off between
+// attempts, or until ctx is cancelled.
+func WaitForBus(ctx context.Context, bus Bus, logger *slog.Logger) error {
+	backoff := time.Second
+	for {
+		pingCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		err := bus.Ping(pingCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		logger.Warn("kafka not ready", "retry_in", backoff, "err", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
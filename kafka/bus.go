@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonreesman/watch-dog-kafka/logging"
+	"github.com/jonreesman/watch-dog-kafka/tracing"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// Returned by a Bus, and its subscriptions, once it is closed.
+var ErrBusClosed = errors.New("bus is closed")
+
+// Carries messages between the API, the scheduler and the
+// consumers. KafkaBus is used in production, MemoryBus lets the
+// whole pipeline run inside a test.
+type Bus interface {
+	// Writes msgs to their topics and waits for them to be
+	// stored. Messages with the same key keep their order.
+	Publish(ctx context.Context, msgs ...kafka.Message) error
+	// Joins groupID as a consumer of topic. The members of a
+	// group share the topic's messages between them.
+	Subscribe(topic, groupID string) Subscription
+	// Fails if the bus cannot currently carry messages.
+	Ping(ctx context.Context) error
+	// Creates or updates topics to match specs.
+	EnsureTopics(ctx context.Context, specs []TopicSpec, logger *slog.Logger) error
+	// Flushes pending messages and releases the bus.
+	Close() error
+}
+
+// A group member's view of a topic.
+type Subscription interface {
+	// Blocks until the next message is available or ctx is done.
+	Fetch(ctx context.Context) (kafka.Message, error)
+	// Marks m, and every message before it on its partition, as
+	// processed. Messages that are fetched but never committed are
+	// delivered to the group again once this member leaves.
+	Commit(ctx context.Context, m kafka.Message) error
+	// Leaves the group.
+	Close() error
+}
+
+// Publishes value to topic, keyed by key. The trace and correlation
+// id in ctx, if any, are carried to the consumer in the headers.
+func Produce(ctx context.Context, bus Bus, topic, key, value string) error {
+	return produce(ctx, bus, topic, key, value)
+}
+
+func produce(ctx context.Context, bus Bus, topic, key, value string, headers ...kafka.Header) error {
+	ctx, span := tracing.Start(ctx, "kafka.produce "+topic, tracing.KIND_PRODUCER)
+	defer span.End()
+	span.SetAttribute("messaging.destination", topic)
+	span.SetAttribute("messaging.kafka.message_key", key)
+
+	msg := kafka.Message{
+		Topic: topic,
+		Key:   []byte(key),
+		Value: []byte(value),
+		Headers: append([]kafka.Header{
+			{Key: tracing.TRACEPARENT, Value: []byte(tracing.Inject(ctx))},
+			{Key: logging.CORRELATION_HEADER, Value: []byte(logging.CorrelationID(ctx))},
+		}, headers...),
+	}
+	if err := bus.Publish(ctx, msg); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// Headers added to messages forwarded to a dead letter topic.
+const (
+	DEAD_LETTER_ERROR_HEADER  = "x-dead-letter-error"
+	DEAD_LETTER_OFFSET_HEADER = "x-dead-letter-offset"
+)
+
+// Forwards a message that could not be processed to the dead
+// letter topic of its topic, recording why and where it came from.
+func DeadLetter(ctx context.Context, bus Bus, m kafka.Message, cause error) error {
+	return produce(ctx, bus, DeadLetterTopic(m.Topic), string(m.Key), string(m.Value),
+		kafka.Header{Key: DEAD_LETTER_ERROR_HEADER, Value: []byte(cause.Error())},
+		kafka.Header{Key: DEAD_LETTER_OFFSET_HEADER, Value: []byte(fmt.Sprintf("%d/%d", m.Partition, m.Offset))},
+	)
+}
+
+// Middleware that writes the given message (a stock/crypto ticker
+// here) to the given topic, keyed by the ticker.
+// Has no return, but given the context, will return an HTTP response.
+// This method also doubles as a non-middleware Kafka producer, so it will
+// accept a `nil` context and write the given message to the topic anyways.
+func ProducerHandler(c *gin.Context, bus Bus, topic, ticker string) {
+	if ticker == "" {
+		return
+	}
+	if c == nil {
+		// There is no request to report a failure to,
+		// so it goes to the process-wide logger.
+		if err := Produce(context.Background(), bus, topic, ticker, ticker); err != nil {
+			slog.Error("failed to write message", "topic", topic, "ticker", ticker, "err", err)
+		}
+		return
+	}
+
+	if err := Produce(c.Request.Context(), bus, topic, ticker, ticker); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -2,15 +2,23 @@ package kafka
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"runtime/debug"
 	"strconv"
-	"strings"
 	"time"
 
+	"github.com/jonreesman/watch-dog-kafka/alerts"
+	"github.com/jonreesman/watch-dog-kafka/authors"
 	"github.com/jonreesman/watch-dog-kafka/by"
 	"github.com/jonreesman/watch-dog-kafka/cleaner"
 	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/logging"
+	"github.com/jonreesman/watch-dog-kafka/metrics"
+	"github.com/jonreesman/watch-dog-kafka/symbology"
+	"github.com/jonreesman/watch-dog-kafka/tracing"
 	kafka "github.com/segmentio/kafka-go"
 	"google.golang.org/grpc"
 )
@@ -18,113 +26,231 @@ import (
 // Defines the Kafka topics for the project
 // across the package.
 const (
-	ADD_TOPIC    = "add"
-	DELETE_TOPIC = "delete"
-	SCRAPE_TOPIC = "scrape"
+	ADD_TOPIC      = "add"
+	DELETE_TOPIC   = "delete"
+	SCRAPE_TOPIC   = "scrape"
+	BACKFILL_TOPIC = "backfill"
 )
 
 type ConsumerConfig struct {
-	DbManager      db.DBManager
+	Store          Store
 	GrpcServerConn *grpc.ClientConn
 	SpamDetector   *by.SpamDetector
 	Cleaner        *cleaner.Cleaner
+	Alerter        *alerts.Alerter
+	Logger         *slog.Logger
+	// Carries the messages consumed, and publishes backfills
+	// and dead letters.
+	Bus Bus
+	// Where statements are scraped from. Defaults to Twitter.
+	Source Source
+	// Gives new tickers their default metadata. Optional.
+	Symbols *symbology.Reference
+	// Topics whose failed messages are forwarded to their
+	// DeadLetterTopic().
+	DeadLetter map[string]bool
+	// Also aggregate sentiment into 15 minute buckets,
+	// alongside the hourly buckets that are always kept.
+	QuarterHourBuckets bool
+	// Keeps the authors of stored statements and their
+	// influence up to date. Optional.
+	Authors *authors.Cache
+	// Caches the index statements are attributed to tickers
+	// with. Optional; without it the index is rebuilt for every
+	// push.
+	Mentions *MentionCache
 }
 
-// Returns a Kafka reader for a specific topic and group
-func getKafkaReader(kafkaURL, topic, groupID string) *kafka.Reader {
-	brokers := strings.Split(kafkaURL, ",")
-	return kafka.NewReader(kafka.ReaderConfig{
-		Brokers:  brokers,
-		GroupID:  groupID,
-		Topic:    topic,
-		MinBytes: 10e3, // 10KB
-		MaxBytes: 10e6, // 10MB
-	})
+// Returns the bucket sizes, in seconds, that scraped
+// statements are aggregated into.
+func (config *ConsumerConfig) bucketSizes() []int {
+	if config.QuarterHourBuckets {
+		return []int{db.HOURLY_BUCKET, db.QUARTER_HOUR_BUCKET}
+	}
+	return []int{db.HOURLY_BUCKET}
 }
 
-// Defines our consumer goroutine. Retrieves a Kafka Reader for its topic,
-// grabs a connection to the master database, and listes to the topic
-// for events. It can handle the logic for deletions, additions, and scrapes.
-func SpawnConsumer(ch chan int, config ConsumerConfig, kafkaURL string, topic string, groupID string) {
-	fmt.Printf("Spawning consumer on topic %s\n", topic)
-	reader := getKafkaReader(kafkaURL, topic, groupID)
-	d := config.DbManager
-	defer reader.Close()
+// Returns where statements are scraped from.
+func (config *ConsumerConfig) source() Source {
+	if config.Source == nil {
+		return TwitterSource{}
+	}
+	return config.Source
+}
+
+// Defines our consumer. Subscribes to its topic on the bus and
+// handles its messages until ctx is done, when it returns nil. It
+// can handle the logic for deletions, additions, and scrapes. A
+// message is committed once handled, so that one interrupted by a
+// restart is handled again. A failed read or commit is returned,
+// so that the Pool can restart the consumer after a backoff.
+func SpawnConsumer(ctx context.Context, config ConsumerConfig, topic string, groupID string) error {
+	logger := config.Logger.With("topic", topic, "group", groupID)
+	logger.Info("spawning consumer")
+	sub := config.Bus.Subscribe(topic, groupID)
+	defer sub.Close()
 	for {
-		m, err := reader.ReadMessage(context.Background())
+		m, err := sub.Fetch(ctx)
 		if err != nil {
-			log.Printf("SpawnConsumer(): %v", err)
-			sleepTime := 30
-			if err.Error() == kafka.BrokerNotAvailable.Error() {
-				sleepTime = 120
+			if ctx.Err() != nil {
+				return nil
 			}
-			if err.Error() == kafka.RebalanceInProgress.Error() {
-				sleepTime = 60
+			metrics.MessagesFailed.WithLabelValues(topic).Inc()
+			return fmt.Errorf("failed to read message: %w", err)
+		}
+		metrics.MessagesConsumed.WithLabelValues(m.Topic).Inc()
+		metrics.ConsumerLag.WithLabelValues(m.Topic, strconv.Itoa(m.Partition)).Set(float64(m.HighWaterMark - m.Offset - 1))
+
+		// Continues the trace started by whoever produced the message.
+		ctx := tracing.Extract(context.Background(), headerValue(m, tracing.TRACEPARENT))
+		// Messages from older producers carry no correlation id.
+		id := headerValue(m, logging.CORRELATION_HEADER)
+		if id == "" {
+			id = logging.NewCorrelationID()
+		}
+		ctx = logging.WithCorrelationID(ctx, id)
+		msgLogger := logger.With("partition", m.Partition, "offset", m.Offset, "correlation_id", id)
+		msgLogger.Info("message received", "value", string(m.Value))
+
+		ctx, span := tracing.Start(ctx, "kafka.consume "+m.Topic, tracing.KIND_CONSUMER)
+		span.SetAttribute("messaging.destination", m.Topic)
+		span.SetAttribute("messaging.kafka.partition", m.Partition)
+		span.SetAttribute("messaging.kafka.offset", m.Offset)
+		if err := processMessage(ctx, &config, msgLogger, m); err != nil {
+			msgLogger.Error("failed to process message", "err", err)
+			metrics.MessagesFailed.WithLabelValues(m.Topic).Inc()
+			span.RecordError(err)
+			if config.DeadLetter[m.Topic] {
+				if err := DeadLetter(ctx, config.Bus, m, err); err != nil {
+					msgLogger.Error("failed to forward message to dead letter topic", "err", err)
+				}
 			}
-			time.Sleep(time.Duration(sleepTime) * time.Second)
-			fmt.Printf("Consumer resuming...")
-			reader = getKafkaReader(kafkaURL, topic, groupID)
-			continue
 		}
-		fmt.Printf("message at topic:%v partition:%v offset:%v	%s = %s\n", m.Topic, m.Partition, m.Offset, string(m.Key), string(m.Value))
-		if m.Value == nil {
-			log.Printf("message value nil. continuing")
-			continue
+		span.End()
+		// A message that failed has been logged, and forwarded
+		// if its topic has a dead letter topic, so it is
+		// committed too rather than retried forever.
+		if err := sub.Commit(ctx, m); err != nil {
+			return fmt.Errorf("failed to commit message: %w", err)
 		}
-		t := ticker{
-			Name: string(m.Value),
-			db:   d,
+	}
+}
+
+// Calls handleMessage, turning a panic into an error so that a
+// message that panics is forwarded and committed like any that
+// fails, rather than handed to every restarted consumer in turn.
+func processMessage(ctx context.Context, config *ConsumerConfig, logger *slog.Logger, m kafka.Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("message handler panicked", "panic", r, "stack", string(debug.Stack()))
+			err = fmt.Errorf("message handler panicked: %v", r)
 		}
+	}()
+	return handleMessage(ctx, config, logger, m)
+}
 
-		// If the consumer is a `delete` consumer, it'll exclusively
-		// execute this logic. It simply issues a MySQL query to
-		// set active to 0 so that no scraping occurs for that ticker.
-		if m.Topic == DELETE_TOPIC {
-			id, err := strconv.Atoi(t.Name)
-			if err != nil {
-				log.Printf("Consumer: Failed to convert id from string to int: %v", err)
-				continue
-			}
-			if err := d.DeactivateTicker(id); err != nil {
-				log.Printf("Consumer: Failed to DeactivateTicker %s with id %d: %v", t.Name, id, err)
-			}
-			continue
+// Processes a single message according to its topic. Returns
+// an error if the message could not be processed.
+func handleMessage(ctx context.Context, config *ConsumerConfig, logger *slog.Logger, m kafka.Message) error {
+	var err error
+	if m.Value == nil {
+		return errors.New("message value nil")
+	}
+
+	// Backfill messages carry a job id rather than a ticker
+	// name. The job itself tracks the range and progress.
+	if m.Topic == BACKFILL_TOPIC {
+		var req BackfillRequest
+		if err := json.Unmarshal(m.Value, &req); err != nil {
+			return fmt.Errorf("invalid backfill request %s: %w", string(m.Value), err)
 		}
+		if err := runBackfill(ctx, config, logger, req.JobId); err != nil {
+			return fmt.Errorf("backfill job %d failed: %w", req.JobId, err)
+		}
+		return nil
+	}
 
-		if m.Topic == ADD_TOPIC {
-			t.Id, err = d.AddTicker(t.Name)
-			if err != nil {
-				if err.Error() == "ticker active" {
-					log.Printf("SpawnWorker(): Ticker already active. Skipping.")
-					continue
-				}
-				log.Printf("SpawnWorker(); Could not add ticker with name %s: %v", t.Name, err)
-				continue
-			}
+	logger = logger.With("ticker", string(m.Value))
+	d := scope(config.Store, ctx, logger)
+	t := ticker{
+		Name:   string(m.Value),
+		db:     d,
+		logger: logger,
+	}
+	tracing.SpanFromContext(ctx).SetAttribute("ticker", t.Name)
+
+	// If the consumer is a `delete` consumer, it'll exclusively
+	// execute this logic. It simply issues a MySQL query to
+	// set active to 0 so that no scraping occurs for that ticker.
+	if m.Topic == DELETE_TOPIC {
+		id, err := strconv.Atoi(t.Name)
+		if err != nil {
+			return fmt.Errorf("failed to convert id from string to int: %w", err)
 		}
+		if err := d.DeactivateTicker(id); err != nil {
+			return fmt.Errorf("failed to DeactivateTicker %s with id %d: %w", t.Name, id, err)
+		}
+		config.Mentions.Refresh()
+		return nil
+	}
 
-		if m.Topic == SCRAPE_TOPIC {
-			t.Id, err = d.RetrieveTickerIDByName(t.Name)
-			if err != nil {
-				log.Printf("SpawnWorker(); Could not find ticker with name %s: %v", t.Name, err)
-				continue
+	if m.Topic == ADD_TOPIC {
+		t.Id, err = d.AddTicker(t.Name)
+		if err != nil {
+			if err.Error() == "ticker active" {
+				logger.Info("ticker already active, skipping")
+				return nil
 			}
+			return fmt.Errorf("could not add ticker with name %s: %w", t.Name, err)
+		}
+		if err := d.AddTickerMetadata(DefaultMetadata(config.Symbols, t.Id, t.Name)); err != nil {
+			logger.Error("could not add ticker metadata", "err", err)
+		}
+		config.Mentions.Refresh()
+		// A new ticker has no history, so we queue a backfill
+		// covering as far back as the scraper can reach.
+		now := time.Now()
+		if _, err := RequestBackfill(ctx, d, config.Bus, t.Id, now.Add(-NEW_TICKER_BACKFILL).Unix(), now.Unix()); err != nil {
+			logger.Error("could not request backfill", "err", err)
 		}
+	}
 
-		t.grpcServerConn = config.GrpcServerConn
-		// Grabs the last time the stock was scraped so that we know
-		// how far back we must scrape twitter. If none is found (eg. its
-		// NULL in the database), we set it to 0 to do an initial scrape.
-		lastScrapeTime, err := d.RetrieveTickerLastScrapeTime(t.Name)
+	if m.Topic == SCRAPE_TOPIC {
+		t.Id, err = d.RetrieveTickerIDByName(t.Name)
 		if err != nil {
-			log.Printf("Error retrieiving lastScrapeTime for %s: %v", t.Name, err)
-			lastScrapeTime = 0
+			return fmt.Errorf("could not find ticker with name %s: %w", t.Name, err)
 		}
-		t.scrape(lastScrapeTime)
-		t.spamProcessor(&config)
-		t.computeHourlySentiment()
-		t.pushToDb()
-		t = ticker{}
 	}
 
+	t.grpcServerConn = config.GrpcServerConn
+	// Grabs the last time the stock was scraped so that we know
+	// how far back we must scrape twitter. If none is found (eg. its
+	// NULL in the database), we set it to 0 to do an initial scrape.
+	lastScrapeTime, err := d.RetrieveTickerLastScrapeTime(t.Name)
+	if err != nil {
+		logger.Warn("could not retrieve last scrape time", "err", err)
+		lastScrapeTime = 0
+	}
+	t.scrape(ctx, config.source(), config.query(d, logger, t.Id, t.Name), lastScrapeTime)
+	t.spamProcessor(ctx, config)
+	if err := t.computeHourlySentiment(ctx); err != nil {
+		return err
+	}
+	if err := t.pushToDb(ctx, config); err != nil {
+		return err
+	}
+	if config.Alerter != nil {
+		config.Alerter.Check(logger, t.Id, t.Name)
+	}
+	return nil
+}
+
+// Returns the value of a message header, or "" if it is absent.
+func headerValue(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
 }
@@ -1,58 +1,94 @@
 package kafka
 
 import (
-	"log"
-	"os"
+	"context"
+	"log/slog"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/jonreesman/watch-dog-kafka/by"
-	"github.com/jonreesman/watch-dog-kafka/cleaner"
-	"github.com/jonreesman/watch-dog-kafka/db"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	kafka "github.com/segmentio/kafka-go"
 )
 
-func TestSpawnConsumer(t *testing.T) {
-	dbUser := os.Getenv("DB_USER")
-	dbPwd := os.Getenv("DB_PWD")
-	dbName := os.Getenv("DB_NAME")
-	dbMasterURL := os.Getenv("DB_MASTER")
-
-	// GRPC environment variable
-	grpcHost := os.Getenv("GRPC_HOST")
-
-	// Kafka environment variables.
-	kafkaURL := os.Getenv("kafkaURL")
-	groupID := os.Getenv("groupID")
-	main, err := db.NewManager(dbUser, dbPwd, dbName, dbMasterURL)
-	if err != nil {
-		log.Fatalf("Error Opening DB connection in NewServer(): %v", err)
+func TestSpawnConsumerDeadLetter(t *testing.T) {
+	bus := NewMemoryBus()
+	config := ConsumerConfig{
+		Bus:        bus,
+		Logger:     slog.Default(),
+		DeadLetter: map[string]bool{SCRAPE_TOPIC: true},
 	}
-	grpcServerConn, err := grpc.Dial(grpcHost, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
-	if err != nil {
-		log.Fatalf("main(): Failed to dial GRPC.")
-		return
+	// A message without a value fails before anything
+	// else is touched.
+	if err := bus.Publish(context.Background(), kafka.Message{Topic: SCRAPE_TOPIC, Key: []byte("AMD")}); err != nil {
+		t.Fatal(err)
 	}
 
-	spamDetector, err := by.LoadModelFromFile("../model.by")
-	if err != nil {
-		log.Fatalf("main(): Failed to load spam detection model %v", err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- SpawnConsumer(ctx, config, SCRAPE_TOPIC, "group") }()
+	deadline := time.Now().Add(time.Second)
+	for len(bus.Messages(DeadLetterTopic(SCRAPE_TOPIC))) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("message was not forwarded to the dead letter topic")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("SpawnConsumer() returned %v once cancelled", err)
 	}
 
-	cleaner := cleaner.NewCleaner()
-
-	consumerConfig := ConsumerConfig{
-		DbManager:      main,
-		GrpcServerConn: grpcServerConn,
-		SpamDetector:   &spamDetector,
-		Cleaner:        cleaner,
+	m := bus.Messages(DeadLetterTopic(SCRAPE_TOPIC))[0]
+	if string(m.Key) != "AMD" {
+		t.Errorf("dead letter keyed by %q", m.Key)
 	}
+	if got := headerValue(m, DEAD_LETTER_ERROR_HEADER); got != "message value nil" {
+		t.Errorf("dead letter error %q", got)
+	}
+	if got := headerValue(m, DEAD_LETTER_OFFSET_HEADER); got != "0/0" {
+		t.Errorf("dead letter offset %q", got)
+	}
+	// The failed message was committed, so it is not
+	// handled again.
+	fetchNothing(t, bus.Subscribe(SCRAPE_TOPIC, "group"))
+}
 
-	ProducerHandler(nil, kafkaURL, SCRAPE_TOPIC, "AMD")
-	ProducerHandler(nil, kafkaURL, SCRAPE_TOPIC, "AAPL")
-	ProducerHandler(nil, kafkaURL, SCRAPE_TOPIC, "AMC")
+func TestSpawnConsumerRecoversPanics(t *testing.T) {
+	bus := NewMemoryBus()
+	// Without a store, handling a scrape panics.
+	config := ConsumerConfig{
+		Bus:        bus,
+		Logger:     slog.Default(),
+		DeadLetter: map[string]bool{SCRAPE_TOPIC: true},
+	}
+	if err := bus.Publish(context.Background(), kafka.Message{Topic: SCRAPE_TOPIC, Key: []byte("AMD"), Value: []byte("AMD")}); err != nil {
+		t.Fatal(err)
+	}
 
-	addChannel := make(chan int, 5)
-	SpawnConsumer(addChannel, consumerConfig, kafkaURL, SCRAPE_TOPIC, groupID)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- SpawnConsumer(ctx, config, SCRAPE_TOPIC, "group") }()
+	deadline := time.Now().Add(time.Second)
+	for len(bus.Messages(DeadLetterTopic(SCRAPE_TOPIC))) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("message was not forwarded to the dead letter topic")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// The consumer carries on with the next message.
+	select {
+	case err := <-done:
+		t.Fatalf("SpawnConsumer() returned %v after a panic", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("SpawnConsumer() returned %v once cancelled", err)
+	}
 
+	m := bus.Messages(DeadLetterTopic(SCRAPE_TOPIC))[0]
+	if got := headerValue(m, DEAD_LETTER_ERROR_HEADER); !strings.HasPrefix(got, "message handler panicked") {
+		t.Errorf("dead letter error %q", got)
+	}
+	fetchNothing(t, bus.Subscribe(SCRAPE_TOPIC, "group"))
 }
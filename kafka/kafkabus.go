@@ -0,0 +1,199 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Defines how a KafkaBus writes to the brokers.
+type ProducerConfig struct {
+	Brokers []string
+	// A batch is sent once it holds BatchSize messages or
+	// BatchTimeout has passed since its first message.
+	BatchSize    int
+	BatchTimeout time.Duration
+	// One of none, gzip, snappy, lz4 or zstd.
+	Compression string
+	// One of none, leader or all.
+	RequiredAcks string
+}
+
+var compressionCodecs = map[string]kafka.Compression{
+	"none":   0,
+	"gzip":   kafka.Gzip,
+	"snappy": kafka.Snappy,
+	"lz4":    kafka.Lz4,
+	"zstd":   kafka.Zstd,
+}
+
+var requiredAcks = map[string]kafka.RequiredAcks{
+	"none":   kafka.RequireNone,
+	"leader": kafka.RequireOne,
+	"all":    kafka.RequireAll,
+}
+
+// The Bus backed by our Kafka brokers. It keeps one long-lived
+// writer per topic, so that concurrent messages are batched
+// together, and is safe to share between goroutines.
+type KafkaBus struct {
+	brokers []string
+
+	mu      sync.Mutex
+	writers map[string]*kafka.Writer
+	closed  bool
+	// Copied to create the writer of each topic.
+	template kafka.Writer
+}
+
+// Creates a KafkaBus with a writer for each of Topics. Writers
+// for other topics, such as dead letter topics, are created on
+// first use.
+func NewKafkaBus(config ProducerConfig) (*KafkaBus, error) {
+	if len(config.Brokers) == 0 {
+		return nil, errors.New("no brokers given")
+	}
+	codec, ok := compressionCodecs[config.Compression]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression %q", config.Compression)
+	}
+	acks, ok := requiredAcks[config.RequiredAcks]
+	if !ok {
+		return nil, fmt.Errorf("unknown required acks %q", config.RequiredAcks)
+	}
+	b := &KafkaBus{
+		brokers: config.Brokers,
+		writers: make(map[string]*kafka.Writer),
+		template: kafka.Writer{
+			Addr: kafka.TCP(config.Brokers...),
+			// Messages with the same key, the ticker, always
+			// land on the same partition.
+			Balancer:     &kafka.Hash{},
+			BatchSize:    config.BatchSize,
+			BatchTimeout: config.BatchTimeout,
+			Compression:  codec,
+			RequiredAcks: acks,
+			// Topics are normally created by EnsureTopics, this
+			// covers brokers we could not administer.
+			AllowAutoTopicCreation: true,
+		},
+	}
+	for _, topic := range Topics {
+		b.writer(topic)
+	}
+	return b, nil
+}
+
+// Returns the writer for topic, creating it if needed. Must
+// be called with b.mu held.
+func (b *KafkaBus) writer(topic string) *kafka.Writer {
+	w, ok := b.writers[topic]
+	if !ok {
+		w = &kafka.Writer{
+			Addr:                   b.template.Addr,
+			Topic:                  topic,
+			Balancer:               b.template.Balancer,
+			BatchSize:              b.template.BatchSize,
+			BatchTimeout:           b.template.BatchTimeout,
+			Compression:            b.template.Compression,
+			RequiredAcks:           b.template.RequiredAcks,
+			AllowAutoTopicCreation: b.template.AllowAutoTopicCreation,
+		}
+		b.writers[topic] = w
+	}
+	return w
+}
+
+// Writes msgs through the writer of their topic and waits for
+// the brokers to acknowledge them.
+func (b *KafkaBus) Publish(ctx context.Context, msgs ...kafka.Message) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBusClosed
+	}
+	var topics []string
+	byTopic := make(map[string][]kafka.Message)
+	for _, m := range msgs {
+		if _, ok := byTopic[m.Topic]; !ok {
+			topics = append(topics, m.Topic)
+			b.writer(m.Topic)
+		}
+		// The writer sets the topic, and refuses
+		// messages that carry their own.
+		topic := m.Topic
+		m.Topic = ""
+		byTopic[topic] = append(byTopic[topic], m)
+	}
+	writers := make(map[string]*kafka.Writer, len(topics))
+	for _, topic := range topics {
+		writers[topic] = b.writers[topic]
+	}
+	b.mu.Unlock()
+
+	for _, topic := range topics {
+		if err := writers[topic].WriteMessages(ctx, byTopic[topic]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Joins groupID on topic with a reader that commits offsets
+// only when asked to, so that a message is not lost if the
+// consumer dies while processing it.
+func (b *KafkaBus) Subscribe(topic, groupID string) Subscription {
+	return kafkaSubscription{kafka.NewReader(kafka.ReaderConfig{
+		Brokers:  b.brokers,
+		GroupID:  groupID,
+		Topic:    topic,
+		MinBytes: 10e3, // 10KB
+		MaxBytes: 10e6, // 10MB
+	})}
+}
+
+type kafkaSubscription struct {
+	reader *kafka.Reader
+}
+
+func (s kafkaSubscription) Fetch(ctx context.Context) (kafka.Message, error) {
+	return s.reader.FetchMessage(ctx)
+}
+
+func (s kafkaSubscription) Commit(ctx context.Context, m kafka.Message) error {
+	return s.reader.CommitMessages(ctx, m)
+}
+
+func (s kafkaSubscription) Close() error {
+	return s.reader.Close()
+}
+
+func (b *KafkaBus) Ping(ctx context.Context) error {
+	return PingBrokers(ctx, b.brokers)
+}
+
+func (b *KafkaBus) EnsureTopics(ctx context.Context, specs []TopicSpec, logger *slog.Logger) error {
+	return EnsureTopics(ctx, b.brokers, specs, logger)
+}
+
+// Flushes any pending batches and closes every writer.
+func (b *KafkaBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	var errs []error
+	for _, w := range b.writers {
+		if err := w.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
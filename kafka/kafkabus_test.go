@@ -0,0 +1,42 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewKafkaBus(t *testing.T) {
+	config := ProducerConfig{
+		Brokers:      []string{"localhost:9092", "localhost:9093"},
+		BatchSize:    100,
+		BatchTimeout: 10 * time.Millisecond,
+		Compression:  "snappy",
+		RequiredAcks: "all",
+	}
+	b, err := NewKafkaBus(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.writers[SCRAPE_TOPIC].Addr.String(); got != "localhost:9092,localhost:9093" {
+		t.Errorf("writer addresses %q, want every broker", got)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := Produce(context.Background(), b, SCRAPE_TOPIC, "AMD", "AMD"); !errors.Is(err, ErrBusClosed) {
+		t.Errorf("Produce() after Close() returned %v", err)
+	}
+
+	bad := config
+	bad.Compression = "brotli"
+	if _, err := NewKafkaBus(bad); err == nil {
+		t.Error("expected an unknown compression to fail")
+	}
+	bad = config
+	bad.RequiredAcks = "some"
+	if _, err := NewKafkaBus(bad); err == nil {
+		t.Error("expected unknown acks to fail")
+	}
+}
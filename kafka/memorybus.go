@@ -0,0 +1,183 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// A Bus that keeps every topic in memory as a single partition.
+// Like Kafka, each group has its own position in a topic and
+// messages that are fetched but not committed are delivered
+// again once their subscriber leaves. It lets the pipeline be
+// tested without brokers.
+type MemoryBus struct {
+	mu     sync.Mutex
+	logs   map[string][]kafka.Message
+	groups map[memoryGroupKey]*memoryGroup
+	closed bool
+	// Closed, and replaced, whenever there may be something new
+	// to fetch, to wake the subscribers waiting in Fetch().
+	wake chan struct{}
+}
+
+type memoryGroupKey struct {
+	topic, group string
+}
+
+type memoryGroup struct {
+	// The offset of the next message to hand out, and of the
+	// first message that has not been committed.
+	next      int64
+	committed int64
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		logs:   make(map[string][]kafka.Message),
+		groups: make(map[memoryGroupKey]*memoryGroup),
+		wake:   make(chan struct{}),
+	}
+}
+
+// Must be called with b.mu held.
+func (b *MemoryBus) notify() {
+	close(b.wake)
+	b.wake = make(chan struct{})
+}
+
+// Appends msgs to their topics, creating the topics as needed.
+func (b *MemoryBus) Publish(ctx context.Context, msgs ...kafka.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBusClosed
+	}
+	for _, m := range msgs {
+		m.Partition = 0
+		m.Offset = int64(len(b.logs[m.Topic]))
+		m.Time = time.Now()
+		m.Headers = append([]kafka.Header(nil), m.Headers...)
+		b.logs[m.Topic] = append(b.logs[m.Topic], m)
+	}
+	b.notify()
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(topic, groupID string) Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := memoryGroupKey{topic, groupID}
+	if _, ok := b.groups[key]; !ok {
+		b.groups[key] = &memoryGroup{}
+	}
+	return &memorySubscription{bus: b, key: key}
+}
+
+func (b *MemoryBus) Ping(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrBusClosed
+	}
+	return nil
+}
+
+// Creates the topics in specs. Partitions and retention
+// have no meaning in memory, so they are ignored.
+func (b *MemoryBus) EnsureTopics(ctx context.Context, specs []TopicSpec, logger *slog.Logger) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, spec := range specs {
+		if _, ok := b.logs[spec.Name]; !ok {
+			b.logs[spec.Name] = nil
+		}
+	}
+	return nil
+}
+
+// Closes the bus. Subscribers waiting in Fetch() return ErrBusClosed.
+func (b *MemoryBus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		b.notify()
+	}
+	return nil
+}
+
+// Returns every message published to topic, in order.
+func (b *MemoryBus) Messages(topic string) []kafka.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]kafka.Message(nil), b.logs[topic]...)
+}
+
+type memorySubscription struct {
+	bus    *MemoryBus
+	key    memoryGroupKey
+	closed bool
+}
+
+func (s *memorySubscription) Fetch(ctx context.Context) (kafka.Message, error) {
+	b := s.bus
+	for {
+		b.mu.Lock()
+		if b.closed || s.closed {
+			b.mu.Unlock()
+			return kafka.Message{}, ErrBusClosed
+		}
+		log := b.logs[s.key.topic]
+		g := b.groups[s.key]
+		if g.next < int64(len(log)) {
+			m := log[g.next]
+			m.HighWaterMark = int64(len(log))
+			g.next++
+			b.mu.Unlock()
+			return m, nil
+		}
+		wake := b.wake
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		case <-wake:
+		}
+	}
+}
+
+func (s *memorySubscription) Commit(ctx context.Context, m kafka.Message) error {
+	b := s.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed || s.closed {
+		return ErrBusClosed
+	}
+	if g := b.groups[s.key]; m.Offset+1 > g.committed {
+		g.committed = m.Offset + 1
+	}
+	return nil
+}
+
+// Leaves the group. As in a Kafka rebalance, the group resumes
+// from its last commit, so anything in flight is delivered again.
+func (s *memorySubscription) Close() error {
+	b := s.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	g := b.groups[s.key]
+	if g.next > g.committed {
+		g.next = g.committed
+		b.notify()
+	}
+	return nil
+}
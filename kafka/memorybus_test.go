@@ -0,0 +1,121 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// Fetches the next message, failing if none arrives in time.
+func fetch(t *testing.T, sub Subscription) kafka.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	m, err := sub.Fetch(ctx)
+	if err != nil {
+		t.Fatalf("Fetch() returned %v", err)
+	}
+	return m
+}
+
+// Fails if a message is available.
+func fetchNothing(t *testing.T, sub Subscription) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if m, err := sub.Fetch(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Fetch() returned %q, %v, want nothing", m.Value, err)
+	}
+}
+
+func TestMemoryBusGroups(t *testing.T) {
+	bus := NewMemoryBus()
+	ctx := context.Background()
+	for _, v := range []string{"AMD", "AAPL", "AMC"} {
+		if err := Produce(ctx, bus, SCRAPE_TOPIC, v, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Members of a group share the topic.
+	a1, a2 := bus.Subscribe(SCRAPE_TOPIC, "a"), bus.Subscribe(SCRAPE_TOPIC, "a")
+	if m := fetch(t, a1); string(m.Value) != "AMD" || m.Offset != 0 || m.HighWaterMark != 3 {
+		t.Fatalf("got %q at offset %d of %d", m.Value, m.Offset, m.HighWaterMark)
+	}
+	if m := fetch(t, a2); string(m.Value) != "AAPL" {
+		t.Fatalf("got %q, want AAPL", m.Value)
+	}
+	// Other groups read the topic from the start.
+	b := bus.Subscribe(SCRAPE_TOPIC, "b")
+	if m := fetch(t, b); string(m.Value) != "AMD" {
+		t.Fatalf("got %q, want AMD", m.Value)
+	}
+
+	// A message published while a member waits wakes it.
+	m := fetch(t, a1)
+	if err := a1.Commit(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Headers) == 0 {
+		t.Error("expected trace and correlation headers")
+	}
+	done := make(chan kafka.Message)
+	go func() {
+		m, _ := a1.Fetch(ctx)
+		done <- m
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := Produce(ctx, bus, SCRAPE_TOPIC, "TSLA", "TSLA"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-done:
+		if string(m.Value) != "TSLA" {
+			t.Fatalf("got %q, want TSLA", m.Value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting member was not woken")
+	}
+}
+
+func TestMemoryBusRedelivery(t *testing.T) {
+	bus := NewMemoryBus()
+	ctx := context.Background()
+	for _, v := range []string{"AMD", "AAPL"} {
+		if err := Produce(ctx, bus, ADD_TOPIC, v, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sub := bus.Subscribe(ADD_TOPIC, "group")
+	if err := sub.Commit(ctx, fetch(t, sub)); err != nil {
+		t.Fatal(err)
+	}
+	fetch(t, sub)
+	sub.Close()
+	if _, err := sub.Fetch(ctx); !errors.Is(err, ErrBusClosed) {
+		t.Errorf("Fetch() after Close() returned %v", err)
+	}
+
+	// The uncommitted message goes to the next member.
+	sub = bus.Subscribe(ADD_TOPIC, "group")
+	m := fetch(t, sub)
+	if string(m.Value) != "AAPL" {
+		t.Fatalf("got %q, want the uncommitted AAPL", m.Value)
+	}
+	if err := sub.Commit(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	sub.Close()
+	fetchNothing(t, bus.Subscribe(ADD_TOPIC, "group"))
+
+	bus.Close()
+	if err := bus.Ping(ctx); !errors.Is(err, ErrBusClosed) {
+		t.Errorf("Ping() after Close() returned %v", err)
+	}
+	if err := Produce(ctx, bus, ADD_TOPIC, "AMD", "AMD"); !errors.Is(err, ErrBusClosed) {
+		t.Errorf("Produce() after Close() returned %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package kafka
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/symbology"
+	"github.com/jonreesman/watch-dog-kafka/twitter"
+)
+
+// Finds the tracked tickers a statement mentions, by cashtag or
+// by any of the terms their search query matches.
+type mentionIndex struct {
+	symbols *symbology.Reference
+	// Maps the name of each tracked ticker to its id.
+	ids     map[string]int
+	queries map[int]twitter.Query
+}
+
+func newMentionIndex(symbols *symbology.Reference, tickers db.TickerSlice, metadata map[int]db.TickerMetadata) mentionIndex {
+	index := mentionIndex{
+		symbols: symbols,
+		ids:     make(map[string]int, len(tickers)),
+		queries: make(map[int]twitter.Query, len(tickers)),
+	}
+	for _, tick := range tickers {
+		m, ok := metadata[tick.Id]
+		if !ok {
+			m = DefaultMetadata(symbols, tick.Id, tick.Name)
+		}
+		index.ids[tick.Name] = tick.Id
+		index.queries[tick.Id] = SearchQuery(tick.Name, m)
+	}
+	return index
+}
+
+// How long a cached mention index is used before it is rebuilt,
+// which picks up tickers and aliases changed by other instances.
+const MENTION_INDEX_MAX_AGE = 5 * time.Minute
+
+// Holds the mention index shared by the consumers, so that it is
+// built once rather than for every message. It is rebuilt once
+// invalidated, as when a ticker is added or removed or its
+// aliases change, or once it is MENTION_INDEX_MAX_AGE old.
+type MentionCache struct {
+	mu      sync.Mutex
+	index   mentionIndex
+	builtAt time.Time
+	valid   bool
+	now     func() time.Time
+}
+
+func NewMentionCache() *MentionCache {
+	return &MentionCache{now: time.Now}
+}
+
+// Has the index rebuilt before it is next used. Safe to call on
+// a nil cache.
+func (c *MentionCache) Refresh() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.valid = false
+	c.mu.Unlock()
+}
+
+// Returns the cached index, calling build if there is none or it
+// is stale. A failed build is not cached.
+func (c *MentionCache) get(build func() (mentionIndex, error)) (mentionIndex, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.valid && c.now().Sub(c.builtAt) < MENTION_INDEX_MAX_AGE {
+		return c.index, nil
+	}
+	index, err := build()
+	if err != nil {
+		return mentionIndex{}, err
+	}
+	c.index, c.builtAt, c.valid = index, c.now(), true
+	return index, nil
+}
+
+// Returns the index of the active tickers, from config.Mentions
+// if it is set.
+func (config *ConsumerConfig) mentions(ctx context.Context, d Store) (mentionIndex, error) {
+	build := func() (mentionIndex, error) {
+		tickers, err := d.ReturnActiveTickers(ctx)
+		if err != nil {
+			return mentionIndex{}, err
+		}
+		metadata, err := d.ReturnAllTickerMetadata()
+		if err != nil {
+			return mentionIndex{}, err
+		}
+		return newMentionIndex(config.Symbols, tickers, metadata), nil
+	}
+	if config.Mentions == nil {
+		return build()
+	}
+	return config.Mentions.get(build)
+}
+
+// Returns the ids of the tracked tickers text mentions, in
+// ascending order. A cashtag counts even if it is written as
+// an alias, such as $FB for META, or as a crypto base, such as
+// $BTC for BTC-USD.
+func (index mentionIndex) tickers(text string) []int {
+	found := make(map[int]bool)
+	for _, tag := range twitter.Cashtags(text) {
+		if id, ok := index.ids[tag]; ok {
+			found[id] = true
+		} else if s, ok := index.resolve(tag); ok {
+			if id, ok := index.ids[s]; ok {
+				found[id] = true
+			}
+		}
+	}
+	for id, q := range index.queries {
+		if !found[id] && q.Matches(text) {
+			found[id] = true
+		}
+	}
+	ids := make([]int, 0, len(found))
+	for id := range found {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Returns the listed symbols whose cashtags appear in text but
+// that no ticker tracks, such as NVDA for "$nvda" when only AMD
+// is tracked. Cashtags missing from the reference list are left
+// out, so nothing is counted without one.
+func (index mentionIndex) untracked(text string) []string {
+	var symbols []string
+	seen := make(map[string]bool)
+	for _, tag := range twitter.Cashtags(text) {
+		if _, ok := index.ids[tag]; ok {
+			continue
+		}
+		s, ok := index.resolve(tag)
+		if !ok || seen[s] {
+			continue
+		}
+		if _, ok := index.ids[s]; !ok {
+			seen[s] = true
+			symbols = append(symbols, s)
+		}
+	}
+	return symbols
+}
+
+// Returns the canonical symbol a cashtag stands for.
+func (index mentionIndex) resolve(tag string) (string, bool) {
+	if index.symbols == nil {
+		return "", false
+	}
+	s, err := index.symbols.Resolve(tag)
+	return s.Symbol, err == nil
+}
@@ -0,0 +1,115 @@
+package kafka
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/symbology"
+)
+
+func TestMentionIndex(t *testing.T) {
+	symbols, err := symbology.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tickers := db.TickerSlice{
+		{Id: 1, Name: "AMD"},
+		{Id: 2, Name: "NVDA"},
+		{Id: 3, Name: "META"},
+		{Id: 4, Name: "BTC-USD"},
+		{Id: 5, Name: "TSLA"},
+	}
+	metadata := map[int]db.TickerMetadata{
+		2: {TickerId: 2, Cashtag: "$NVDA", Aliases: []string{"GeForce"}},
+		5: {TickerId: 5, Cashtag: "$TSLA", NegativeKeywords: []string{"coil"}},
+	}
+	index := newMentionIndex(symbols, tickers, metadata)
+	cases := map[string][]int{
+		"$AMD and $NVDA both up":           {1, 2},
+		"new GeForce cards from AMD?":      {1, 2},
+		"$FB is now $META":                 {3},
+		"Advanced Micro Devices and $btc":  {1, 4},
+		"a TSLA coil, not the car":         {},
+		"$SPY is untracked, $ZZZZ unknown": {},
+	}
+	for text, want := range cases {
+		if got := index.tickers(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("tickers(%q) = %v, want %v", text, got, want)
+		}
+	}
+
+	untracked := map[string][]string{
+		"$AMD, $SPY and $spy again": {"SPY"},
+		"$FB and $BTC are tracked":  nil,
+		"$ZZZZ is not listed":       nil,
+	}
+	for text, want := range untracked {
+		if got := index.untracked(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("untracked(%q) = %v, want %v", text, got, want)
+		}
+	}
+
+	// Without an index, such as when loading it failed, nothing
+	// else is attributed.
+	if got := (mentionIndex{}).tickers("$AMD"); len(got) != 0 {
+		t.Errorf("empty index found %v", got)
+	}
+	if got := (mentionIndex{}).untracked("$AMD"); len(got) != 0 {
+		t.Errorf("empty index found untracked %v", got)
+	}
+}
+
+func TestMentionCache(t *testing.T) {
+	now := time.Unix(1650000000, 0)
+	cache := NewMentionCache()
+	cache.now = func() time.Time { return now }
+	builds := 0
+	tickers := db.TickerSlice{{Id: 1, Name: "AMD"}}
+	build := func() (mentionIndex, error) {
+		builds++
+		return newMentionIndex(nil, tickers, nil), nil
+	}
+	get := func() []int {
+		index, err := cache.get(build)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return index.tickers("$AMD and $NVDA")
+	}
+
+	if got := get(); !reflect.DeepEqual(got, []int{1}) || builds != 1 {
+		t.Fatalf("got %v after %d builds", got, builds)
+	}
+	// A new ticker is only seen once the cache is invalidated.
+	tickers = append(tickers, db.Ticker{Id: 2, Name: "NVDA"})
+	if got := get(); !reflect.DeepEqual(got, []int{1}) || builds != 1 {
+		t.Errorf("got %v after %d builds, want the cached index", got, builds)
+	}
+	cache.Refresh()
+	if got := get(); !reflect.DeepEqual(got, []int{1, 2}) || builds != 2 {
+		t.Errorf("got %v after %d builds, want a rebuilt index", got, builds)
+	}
+
+	// Or once it is stale.
+	now = now.Add(MENTION_INDEX_MAX_AGE)
+	get()
+	if builds != 3 {
+		t.Errorf("stale index not rebuilt, %d builds", builds)
+	}
+
+	// A failed build is retried on the next use.
+	cache.Refresh()
+	if _, err := cache.get(func() (mentionIndex, error) { return mentionIndex{}, errors.New("down") }); err == nil {
+		t.Error("expected the build error")
+	}
+	get()
+	if builds != 4 {
+		t.Errorf("failed build was cached, %d builds", builds)
+	}
+
+	// Invalidating no cache is a no-op.
+	(*MentionCache)(nil).Refresh()
+}
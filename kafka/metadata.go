@@ -0,0 +1,48 @@
+package kafka
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/symbology"
+	"github.com/jonreesman/watch-dog-kafka/twitter"
+)
+
+// Returns the metadata a ticker starts with: its cashtag and
+// company name from the reference list, if it is listed there.
+func DefaultMetadata(symbols *symbology.Reference, tickerId int, name string) db.TickerMetadata {
+	m := db.TickerMetadata{TickerId: tickerId, Aliases: []string{}, NegativeKeywords: []string{}}
+	if symbols == nil {
+		return m
+	}
+	if s, ok := symbols.Lookup(name); ok {
+		m.CompanyName = s.CommonName()
+		m.Cashtag = s.Cashtag()
+	}
+	return m
+}
+
+// Returns the query sources search for a ticker with.
+func SearchQuery(name string, m db.TickerMetadata) twitter.Query {
+	q := twitter.Query{Ticker: name, Exclude: m.NegativeKeywords}
+	for _, term := range append([]string{m.Cashtag, m.CompanyName}, m.Aliases...) {
+		if term != "" {
+			q.Terms = append(q.Terms, term)
+		}
+	}
+	return q
+}
+
+// Returns the query for a ticker from its stored metadata, or
+// from its defaults if it has none.
+func (config *ConsumerConfig) query(d Store, logger *slog.Logger, tickerId int, name string) twitter.Query {
+	m, err := d.RetrieveTickerMetadata(tickerId)
+	if errors.Is(err, db.ErrNoMetadata) {
+		m = DefaultMetadata(config.Symbols, tickerId, name)
+	} else if err != nil {
+		logger.Warn("could not retrieve ticker metadata, searching by name only", "err", err)
+		m = db.TickerMetadata{TickerId: tickerId}
+	}
+	return SearchQuery(name, m)
+}
@@ -0,0 +1,40 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/jonreesman/watch-dog-kafka/symbology"
+)
+
+func TestDefaultMetadata(t *testing.T) {
+	symbols, err := symbology.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := DefaultMetadata(symbols, 7, "AMD")
+	if m.TickerId != 7 || m.CompanyName != "Advanced Micro Devices" || m.Cashtag != "$AMD" {
+		t.Errorf("got %+v", m)
+	}
+	q := SearchQuery("AMD", m)
+	if want := `(AMD OR $AMD OR "Advanced Micro Devices")`; q.Search() != want {
+		t.Errorf("Search() = %s, want %s", q.Search(), want)
+	}
+	if !q.Matches("Advanced Micro Devices raised guidance") {
+		t.Error("expected the company name to match")
+	}
+
+	// Tickers missing from the list, or without a list, are
+	// searched for by name alone.
+	for _, m := range []struct {
+		symbols *symbology.Reference
+		name    string
+	}{{symbols, "ZZZZ"}, {nil, "AMD"}} {
+		got := DefaultMetadata(m.symbols, 1, m.name)
+		if got.CompanyName != "" || got.Cashtag != "" {
+			t.Errorf("%s: got %+v", m.name, got)
+		}
+		if q := SearchQuery(m.name, got); q.Search() != m.name {
+			t.Errorf("%s: Search() = %s", m.name, q.Search())
+		}
+	}
+}
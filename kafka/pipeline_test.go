@@ -0,0 +1,200 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/db/dbtest"
+	"github.com/jonreesman/watch-dog-kafka/logging"
+	"github.com/jonreesman/watch-dog-kafka/pb"
+	"github.com/jonreesman/watch-dog-kafka/twitter"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Returns canned statements for every ticker.
+type fakeSource struct {
+	expressions []string
+}
+
+func (fakeSource) Name() string {
+	return "fake"
+}
+
+func (s fakeSource) Scrape(logger *slog.Logger, query twitter.Query, lastScrapeTime int64) []twitter.Statement {
+	var statements []twitter.Statement
+	for _, e := range s.expressions {
+		// Tweet ids fit in 63 bits.
+		id := uint64(rand.Int63())
+		statements = append(statements, twitter.Statement{
+			Expression:   query.Ticker + " " + e,
+			TimeStamp:    time.Now().Unix(),
+			PermanentURL: "https://example.com/" + strconv.FormatUint(id, 10),
+			ID:           id,
+		})
+	}
+	return statements
+}
+
+// Backfills find nothing.
+func (fakeSource) ScrapeRange(logger *slog.Logger, query twitter.Query, fromTime, toTime int64) ([]twitter.Statement, error) {
+	return nil, nil
+}
+
+// Scores statements mentioning "bullish" 0.5 and the rest -0.5.
+type fakeAnalyzer struct {
+	pb.UnimplementedSentimentServer
+}
+
+func (fakeAnalyzer) Detect(ctx context.Context, req *pb.SentimentRequest) (*pb.SentimentResponse, error) {
+	if strings.Contains(req.Tweet, "bullish") {
+		return &pb.SentimentResponse{Polarity: 0.5}, nil
+	}
+	return &pb.SentimentResponse{Polarity: -0.5}, nil
+}
+
+// Serves fakeAnalyzer in memory and returns a connection to it.
+func dialFakeAnalyzer(t *testing.T) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterSentimentServer(server, fakeAnalyzer{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// Polls check until it succeeds or time runs out.
+func eventually(t *testing.T, what string, check func() error) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		err := check()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: %v", what, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Drives a ticker through add, scrape, sentiment and storage
+// with the bus, the source and the analyzer in memory and the
+// database in SQLite, then reads back what the API would serve.
+func TestPipeline(t *testing.T) {
+	d := dbtest.Open(t)
+	bus := NewMemoryBus()
+	defer bus.Close()
+	config := ConsumerConfig{
+		Store:          d,
+		GrpcServerConn: dialFakeAnalyzer(t),
+		Logger:         logging.Discard(),
+		Bus:            bus,
+		Source:         fakeSource{expressions: []string{"looks bullish", "is bullish", "looks bearish"}},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pool := NewPool(config, "pipeline")
+	if err := pool.Start(ctx, map[string]int{ADD_TOPIC: 1, DELETE_TOPIC: 1, SCRAPE_TOPIC: 1, BACKFILL_TOPIC: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	name := fmt.Sprintf("E2E%d", rand.Intn(1e6))
+	start := time.Now().Unix() - 1
+	ProducerHandler(nil, bus, ADD_TOPIC, name)
+
+	var (
+		id  int
+		err error
+	)
+	eventually(t, "statements not stored", func() error {
+		if id, err = d.RetrieveTickerIDByName(name); err != nil {
+			return err
+		}
+		if n := len(d.ReturnAllStatements(id, start)); n != 3 {
+			return fmt.Errorf("%d statements stored, want 3", n)
+		}
+		return nil
+	})
+	for _, s := range d.ReturnAllStatements(id, start) {
+		want := -0.5
+		if strings.Contains(s.Expression, "bullish") {
+			want = 0.5
+		}
+		if s.Polarity != want {
+			t.Errorf("%q stored with polarity %v, want %v", s.Expression, s.Polarity, want)
+		}
+	}
+	// Buckets are upserted once the statements are committed.
+	eventually(t, "sentiment not stored", func() error {
+		sentiments := d.ReturnSentimentHistory(id, start-hour)
+		if len(sentiments) != 1 || math.Abs(sentiments[0].CurrentPrice-1.0/6) > 1e-3 {
+			return fmt.Errorf("got hourly sentiment %+v, want one bucket of %.3f", sentiments, 1.0/6)
+		}
+		return nil
+	})
+
+	eventually(t, "scrape time not advanced", func() error {
+		if last, _ := d.RetrieveTickerLastScrapeTime(name); last < start {
+			return fmt.Errorf("last scrape time %d, want at least %d", last, start)
+		}
+		return nil
+	})
+
+	// The new ticker's backfill goes through the bus too, and
+	// finds nothing to add.
+	eventually(t, "backfill not run", func() error {
+		published := false
+		for _, m := range bus.Messages(BACKFILL_TOPIC) {
+			published = published || string(m.Key) == strconv.Itoa(id)
+		}
+		if !published {
+			return fmt.Errorf("no backfill published for ticker %d", id)
+		}
+		job, err := d.RetrieveBackfillJobById(1)
+		if err != nil {
+			return err
+		}
+		if job.TickerId != id || job.Status != db.BACKFILL_DONE {
+			return fmt.Errorf("got backfill job %+v", job)
+		}
+		return nil
+	})
+	if n := len(d.ReturnAllStatements(id, 0)); n != 3 {
+		t.Errorf("%d statements stored after the backfill, want 3", n)
+	}
+
+	ProducerHandler(nil, bus, DELETE_TOPIC, strconv.Itoa(id))
+	eventually(t, "ticker not deactivated", func() error {
+		active, err := d.ReturnActiveTickers(ctx)
+		if err != nil {
+			return err
+		}
+		for _, tick := range active {
+			if tick.Id == id {
+				return fmt.Errorf("ticker %d still active", id)
+			}
+		}
+		return nil
+	})
+}
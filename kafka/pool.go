@@ -0,0 +1,243 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/metrics"
+)
+
+// Every topic the pool can consume.
+var Topics = []string{ADD_TOPIC, DELETE_TOPIC, SCRAPE_TOPIC, BACKFILL_TOPIC}
+
+// The most workers a topic may be resized to.
+const MAX_WORKERS = 64
+
+// Worker states reported by Pool.Status().
+const (
+	WORKER_RUNNING = "running"
+	WORKER_BACKOFF = "backoff"
+)
+
+// Returned by Pool.Resize for a topic the pool does not consume.
+var ErrUnknownTopic = errors.New("unknown topic")
+
+// Keeps a set number of consumers running on each topic,
+// restarting any that exit or panic after an exponential
+// backoff. The number of consumers can be changed while it runs.
+type Pool struct {
+	// The first and the longest wait before a worker is
+	// restarted. The wait doubles on each consecutive failure,
+	// and resets once a worker has run for MaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	logger *slog.Logger
+	// Runs one consumer until ctx is done.
+	consume func(ctx context.Context, topic string) error
+
+	mu     sync.Mutex
+	ctx    context.Context
+	topics map[string][]*worker
+	nextID int
+}
+
+type worker struct {
+	id     int
+	topic  string
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	state    string
+	since    time.Time
+	restarts int
+	lastErr  string
+}
+
+// Reports what a worker is doing and how often it has failed.
+type WorkerStatus struct {
+	ID    int    `json:"id"`
+	State string `json:"state"`
+	// When the worker entered its current state.
+	Since     time.Time `json:"since"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Reports the workers consuming a topic.
+type TopicStatus struct {
+	Topic   string         `json:"topic"`
+	Workers []WorkerStatus `json:"workers"`
+}
+
+// Creates a pool of consumers in groupID. It runs nothing
+// until Start() is called.
+func NewPool(config ConsumerConfig, groupID string) *Pool {
+	return newPool(config.Logger, func(ctx context.Context, topic string) error {
+		return SpawnConsumer(ctx, config, topic, groupID)
+	})
+}
+
+func newPool(logger *slog.Logger, consume func(ctx context.Context, topic string) error) *Pool {
+	return &Pool{
+		MinBackoff: time.Second,
+		MaxBackoff: 2 * time.Minute,
+		logger:     logger.With("component", "consumer_pool"),
+		consume:    consume,
+		topics:     make(map[string][]*worker),
+	}
+}
+
+// Starts counts[topic] workers on each topic. Workers run
+// until ctx is done.
+func (p *Pool) Start(ctx context.Context, counts map[string]int) error {
+	p.mu.Lock()
+	p.ctx = ctx
+	p.mu.Unlock()
+	for _, topic := range Topics {
+		if counts[topic] == 0 {
+			p.logger.Info("not consuming topic", "topic", topic)
+		}
+		if err := p.Resize(topic, counts[topic]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Changes the number of workers on topic to n. Workers that are
+// removed finish the message they are processing, then stop.
+func (p *Pool) Resize(topic string, n int) error {
+	if !knownTopic(topic) {
+		return fmt.Errorf("%w %q", ErrUnknownTopic, topic)
+	}
+	if n < 0 || n > MAX_WORKERS {
+		return fmt.Errorf("workers must be between 0 and %d", MAX_WORKERS)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.ctx == nil {
+		return errors.New("pool is not started")
+	}
+	workers := p.topics[topic]
+	before := len(workers)
+	for len(workers) < n {
+		workers = append(workers, p.spawn(topic))
+	}
+	for len(workers) > n {
+		workers[len(workers)-1].cancel()
+		workers = workers[:len(workers)-1]
+	}
+	p.topics[topic] = workers
+	metrics.ConsumerWorkers.WithLabelValues(topic).Set(float64(n))
+	if before != n {
+		p.logger.Info("resized consumers", "topic", topic, "from", before, "to", n)
+	}
+	return nil
+}
+
+// Returns the workers of every topic.
+func (p *Pool) Status() []TopicStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	statuses := make([]TopicStatus, 0, len(Topics))
+	for _, topic := range Topics {
+		s := TopicStatus{Topic: topic, Workers: make([]WorkerStatus, 0)}
+		for _, w := range p.topics[topic] {
+			s.Workers = append(s.Workers, w.status())
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses
+}
+
+// Must be called with p.mu held.
+func (p *Pool) spawn(topic string) *worker {
+	p.nextID++
+	ctx, cancel := context.WithCancel(p.ctx)
+	w := &worker{id: p.nextID, topic: topic, cancel: cancel}
+	w.set(WORKER_RUNNING, nil)
+	go p.supervise(ctx, w)
+	return w
+}
+
+// Runs a worker's consumer until ctx is done, restarting it
+// with a backoff whenever it fails.
+func (p *Pool) supervise(ctx context.Context, w *worker) {
+	logger := p.logger.With("topic", w.topic, "worker", w.id)
+	backoff := p.MinBackoff
+	for {
+		w.set(WORKER_RUNNING, nil)
+		start := time.Now()
+		err := p.run(ctx, logger, w.topic)
+		if ctx.Err() != nil {
+			logger.Info("consumer stopped")
+			return
+		}
+		if err == nil {
+			err = errors.New("consumer exited")
+		}
+		if time.Since(start) >= p.MaxBackoff {
+			backoff = p.MinBackoff
+		}
+		w.set(WORKER_BACKOFF, err)
+		metrics.ConsumerRestarts.WithLabelValues(w.topic).Inc()
+		logger.Error("consumer failed, restarting", "err", err, "backoff", backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logger.Info("consumer stopped")
+			return
+		case <-timer.C:
+		}
+		if backoff *= 2; backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+// Runs a consumer, turning a panic into an error. Panics while
+// handling a message are recovered by the consumer itself, so
+// this only catches those outside of any message.
+func (p *Pool) run(ctx context.Context, logger *slog.Logger, topic string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("consumer panicked", "panic", r, "stack", string(debug.Stack()))
+			err = fmt.Errorf("consumer panicked: %v", r)
+		}
+	}()
+	return p.consume(ctx, topic)
+}
+
+func (w *worker) set(state string, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state = state
+	w.since = time.Now()
+	if err != nil {
+		w.restarts++
+		w.lastErr = err.Error()
+	}
+}
+
+func (w *worker) status() WorkerStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return WorkerStatus{ID: w.id, State: w.state, Since: w.since, Restarts: w.restarts, LastError: w.lastErr}
+}
+
+func knownTopic(topic string) bool {
+	for _, t := range Topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/logging"
+)
+
+// Counts the consumers running on each topic.
+type fakeConsumers struct {
+	mu      sync.Mutex
+	running map[string]int
+	started map[string]int
+}
+
+func (f *fakeConsumers) count(m map[string]int, topic string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return m[topic]
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolResize(t *testing.T) {
+	f := &fakeConsumers{running: map[string]int{}, started: map[string]int{}}
+	p := newPool(logging.Discard(), func(ctx context.Context, topic string) error {
+		f.mu.Lock()
+		f.running[topic]++
+		f.started[topic]++
+		f.mu.Unlock()
+		<-ctx.Done()
+		f.mu.Lock()
+		f.running[topic]--
+		f.mu.Unlock()
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := p.Start(ctx, map[string]int{SCRAPE_TOPIC: 3, ADD_TOPIC: 1}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "3 scrape consumers", func() bool { return f.count(f.running, SCRAPE_TOPIC) == 3 })
+	if n := f.count(f.running, DELETE_TOPIC); n != 0 {
+		t.Errorf("%d delete consumers running, want 0", n)
+	}
+
+	if err := p.Resize(SCRAPE_TOPIC, 1); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "1 scrape consumer", func() bool { return f.count(f.running, SCRAPE_TOPIC) == 1 })
+	if err := p.Resize(DELETE_TOPIC, 2); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "2 delete consumers", func() bool { return f.count(f.running, DELETE_TOPIC) == 2 })
+
+	for _, s := range p.Status() {
+		want := map[string]int{ADD_TOPIC: 1, DELETE_TOPIC: 2, SCRAPE_TOPIC: 1}[s.Topic]
+		if len(s.Workers) != want {
+			t.Errorf("%s has %d workers, want %d", s.Topic, len(s.Workers), want)
+		}
+	}
+
+	if err := p.Resize("nope", 1); !errors.Is(err, ErrUnknownTopic) {
+		t.Errorf("Resize() of an unknown topic returned %v", err)
+	}
+	if err := p.Resize(ADD_TOPIC, MAX_WORKERS+1); err == nil {
+		t.Error("expected an error resizing above MAX_WORKERS")
+	}
+
+	cancel()
+	waitFor(t, "every consumer to stop", func() bool {
+		return f.count(f.running, ADD_TOPIC)+f.count(f.running, DELETE_TOPIC)+f.count(f.running, SCRAPE_TOPIC) == 0
+	})
+}
+
+func TestPoolRestartsFailedWorkers(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	p := newPool(slog.Default(), func(ctx context.Context, topic string) error {
+		mu.Lock()
+		calls++
+		n := calls
+		mu.Unlock()
+		switch n {
+		case 1:
+			panic("boom")
+		case 2:
+			return errors.New("broker not available")
+		}
+		<-ctx.Done()
+		return nil
+	})
+	p.MinBackoff = time.Millisecond
+	p.MaxBackoff = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := p.Start(ctx, map[string]int{ADD_TOPIC: 1}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "a third start", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls == 3
+	})
+	var w WorkerStatus
+	waitFor(t, "the worker to run", func() bool {
+		w = p.Status()[0].Workers[0]
+		return w.State == WORKER_RUNNING
+	})
+	if w.Restarts != 2 || w.LastError != "broker not available" {
+		t.Errorf("unexpected status %+v", w)
+	}
+}
@@ -0,0 +1,35 @@
+package kafka
+
+import (
+	"log/slog"
+
+	"github.com/jonreesman/watch-dog-kafka/twitter"
+)
+
+// Where the statements about a ticker are scraped from.
+type Source interface {
+	// Labels the source in metrics and traces.
+	Name() string
+	// Returns the statements matching query posted since
+	// lastScrapeTime.
+	Scrape(logger *slog.Logger, query twitter.Query, lastScrapeTime int64) []twitter.Statement
+	// Returns the statements matching query posted in
+	// [fromTime, toTime), or an error if they could not all be
+	// scraped.
+	ScrapeRange(logger *slog.Logger, query twitter.Query, fromTime, toTime int64) ([]twitter.Statement, error)
+}
+
+// Scrapes Twitter. The default Source.
+type TwitterSource struct{}
+
+func (TwitterSource) Name() string {
+	return "twitter"
+}
+
+func (TwitterSource) Scrape(logger *slog.Logger, query twitter.Query, lastScrapeTime int64) []twitter.Statement {
+	return twitter.TwitterScrape(logger, query, lastScrapeTime)
+}
+
+func (TwitterSource) ScrapeRange(logger *slog.Logger, query twitter.Query, fromTime, toTime int64) ([]twitter.Statement, error) {
+	return twitter.TwitterScrapeRange(logger, fromTime, toTime, query)
+}
@@ -0,0 +1,51 @@
+package kafka
+
+import (
+	"context"
+	"strings"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// Describes a consumer group as reported by the brokers.
+type GroupStatus struct {
+	GroupID string        `json:"group_id"`
+	State   string        `json:"state"`
+	Members []GroupMember `json:"members"`
+}
+
+// A member of a consumer group and the partitions it owns.
+type GroupMember struct {
+	ClientID   string           `json:"client_id"`
+	ClientHost string           `json:"client_host"`
+	Partitions map[string][]int `json:"partitions"`
+}
+
+// Returns the state of a consumer group, such as Stable
+// or PreparingRebalance, along with its members.
+func DescribeGroup(ctx context.Context, kafkaURL, groupID string) (GroupStatus, error) {
+	client := &kafka.Client{Addr: kafka.TCP(strings.Split(kafkaURL, ",")...)}
+	resp, err := client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: []string{groupID}})
+	if err != nil {
+		return GroupStatus{}, err
+	}
+	status := GroupStatus{GroupID: groupID, Members: make([]GroupMember, 0)}
+	for _, g := range resp.Groups {
+		if g.Error != nil {
+			return GroupStatus{}, g.Error
+		}
+		status.State = g.GroupState
+		for _, m := range g.Members {
+			member := GroupMember{
+				ClientID:   m.ClientID,
+				ClientHost: m.ClientHost,
+				Partitions: make(map[string][]int),
+			}
+			for _, t := range m.MemberAssignments.Topics {
+				member.Partitions[t.Topic] = t.Partitions
+			}
+			status.Members = append(status.Members, member)
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,50 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+)
+
+// Defines the database operations the consumers depend on.
+// Satisfied by db.DBManager, which should be the primary.
+type Store interface {
+	AddTicker(name string) (int, error)
+	DeactivateTicker(id int) error
+	RetrieveTickerById(tickerId int) (db.Ticker, error)
+	RetrieveTickerIDByName(tickerName string) (int, error)
+	RetrieveTickerLastScrapeTime(tickerName string) (int64, error)
+	ReturnActiveTickers(ctx context.Context) (db.TickerSlice, error)
+	UpdateTicker(id int, timeStamp time.Time) error
+
+	AddTickerMetadata(m db.TickerMetadata) error
+	RetrieveTickerMetadata(tickerId int) (db.TickerMetadata, error)
+	ReturnAllTickerMetadata() (map[int]db.TickerMetadata, error)
+
+	BeginTx() (db.Tx, error)
+	AddStatements(t db.Tx, tickerId int, expression string, timeStamp int64, polarity float64, url string, tweet_id uint64, likes, replies, retweets int, spam bool, authorId, source string)
+	AddStatementTickers(t db.Tx, tweetId uint64, tickerIds ...int) error
+	AddUntrackedMentions(t db.Tx, tweetId uint64, timeStamp int64, symbols ...string) error
+	UpsertSentimentBucket(tickerId int, bucketStart int64, bucketSeconds int) error
+	UpsertCoMentions(tickerId int, hourStart int64) error
+
+	AddBackfillJob(tickerId int, fromTime, toTime int64) (int, error)
+	UpdateBackfillJob(id int, cursor int64, status string) error
+	RetrieveBackfillJobById(id int) (db.BackfillJob, error)
+	ReturnStaleBackfillJobs(olderThan int64) ([]db.BackfillJob, error)
+	AddScrapedHours(tickerId int, hourStarts ...int64) error
+	ReturnCoveredHours(tickerId int, fromTime, toTime int64) ([]int64, error)
+}
+
+// Returns store with its queries traced under ctx and logged to
+// logger. Only a db.DBManager carries either, so any other store
+// is returned as it is.
+func scope(store Store, ctx context.Context, logger *slog.Logger) Store {
+	d, ok := store.(db.DBManager)
+	if !ok {
+		return store
+	}
+	return d.WithContext(ctx).WithLogger(logger)
+}
@@ -0,0 +1,357 @@
+package kafka
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/twitter"
+)
+
+// Keeps everything the consumers store in memory, for tests that
+// run the pipeline without a database. Statements added in a
+// transaction are only stored once it commits.
+type memoryStore struct {
+	mu         sync.Mutex
+	tickers    []db.Ticker
+	metadata   map[int]db.TickerMetadata
+	statements map[uint64]twitter.Statement
+	// The tickers each statement is attributed to.
+	attributed map[uint64]map[int]bool
+	// Average polarity by ticker, bucket size and bucket start.
+	sentiments map[[3]int64]float64
+	jobs       []db.BackfillJob
+	// Hours scraped by backfills, by ticker.
+	scraped map[int]map[int64]bool
+	// Returned by every commit if set.
+	commitErr error
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		metadata:   make(map[int]db.TickerMetadata),
+		statements: make(map[uint64]twitter.Statement),
+		attributed: make(map[uint64]map[int]bool),
+		sentiments: make(map[[3]int64]float64),
+		scraped:    make(map[int]map[int64]bool),
+	}
+}
+
+func (s *memoryStore) ticker(match func(db.Ticker) bool) (*db.Ticker, error) {
+	for i := range s.tickers {
+		if match(s.tickers[i]) {
+			return &s.tickers[i], nil
+		}
+	}
+	return nil, db.ErrNoTicker
+}
+
+func (s *memoryStore) byName(name string) (*db.Ticker, error) {
+	return s.ticker(func(t db.Ticker) bool { return t.Name == name })
+}
+
+func (s *memoryStore) byId(id int) (*db.Ticker, error) {
+	return s.ticker(func(t db.Ticker) bool { return t.Id == id })
+}
+
+func (s *memoryStore) AddTicker(name string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, err := s.byName(name); err == nil {
+		if t.Active == 1 {
+			return t.Id, errors.New("ticker active")
+		}
+		t.Active = 1
+		return t.Id, nil
+	}
+	id := len(s.tickers) + 1
+	s.tickers = append(s.tickers, db.Ticker{Id: id, Name: name, Active: 1})
+	return id, nil
+}
+
+func (s *memoryStore) DeactivateTicker(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.byId(id)
+	if err != nil {
+		return err
+	}
+	t.Active = 0
+	return nil
+}
+
+func (s *memoryStore) RetrieveTickerById(tickerId int) (db.Ticker, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.byId(tickerId)
+	if err != nil {
+		return db.Ticker{}, err
+	}
+	return *t, nil
+}
+
+func (s *memoryStore) RetrieveTickerIDByName(tickerName string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.byName(tickerName)
+	if err != nil {
+		return 0, err
+	}
+	return t.Id, nil
+}
+
+func (s *memoryStore) RetrieveTickerLastScrapeTime(tickerName string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.byName(tickerName)
+	if err != nil || t.LastScrapeTime.IsZero() {
+		return 0, err
+	}
+	return t.LastScrapeTime.Unix(), nil
+}
+
+func (s *memoryStore) ReturnActiveTickers(ctx context.Context) (db.TickerSlice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tickers db.TickerSlice
+	for _, t := range s.tickers {
+		if t.Active == 1 {
+			tickers = append(tickers, t)
+		}
+	}
+	return tickers, nil
+}
+
+func (s *memoryStore) UpdateTicker(id int, timeStamp time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, err := s.byId(id)
+	if err != nil {
+		return err
+	}
+	t.LastScrapeTime = timeStamp
+	return nil
+}
+
+func (s *memoryStore) AddTickerMetadata(m db.TickerMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.metadata[m.TickerId]; !ok {
+		s.metadata[m.TickerId] = m
+	}
+	return nil
+}
+
+func (s *memoryStore) RetrieveTickerMetadata(tickerId int) (db.TickerMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.metadata[tickerId]
+	if !ok {
+		return db.TickerMetadata{}, sql.ErrNoRows
+	}
+	return m, nil
+}
+
+func (s *memoryStore) ReturnAllTickerMetadata() (map[int]db.TickerMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	metadata := make(map[int]db.TickerMetadata, len(s.metadata))
+	for id, m := range s.metadata {
+		metadata[id] = m
+	}
+	return metadata, nil
+}
+
+// Holds the writes of a transaction until it commits.
+type memoryTx struct {
+	store  *memoryStore
+	writes []func()
+}
+
+func (tx *memoryTx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return nil, errors.New("memoryTx does not run SQL")
+}
+
+func (tx *memoryTx) Commit() error {
+	tx.store.mu.Lock()
+	defer tx.store.mu.Unlock()
+	if tx.store.commitErr != nil {
+		return tx.store.commitErr
+	}
+	for _, write := range tx.writes {
+		write()
+	}
+	return nil
+}
+
+func (tx *memoryTx) Rollback() error {
+	tx.writes = nil
+	return nil
+}
+
+func (s *memoryStore) BeginTx() (db.Tx, error) {
+	return &memoryTx{store: s}, nil
+}
+
+func (s *memoryStore) AddStatements(t db.Tx, tickerId int, expression string, timeStamp int64, polarity float64, url string, tweet_id uint64, likes, replies, retweets int, spam bool, authorId, source string) {
+	tx := t.(*memoryTx)
+	tx.writes = append(tx.writes, func() {
+		if _, ok := s.statements[tweet_id]; !ok {
+			s.statements[tweet_id] = twitter.Statement{Expression: expression, TimeStamp: timeStamp, Polarity: polarity,
+				PermanentURL: url, ID: tweet_id, Likes: likes, Replies: replies, Retweets: retweets, Spam: spam, Source: source}
+		}
+	})
+	s.AddStatementTickers(t, tweet_id, tickerId)
+}
+
+func (s *memoryStore) AddStatementTickers(t db.Tx, tweetId uint64, tickerIds ...int) error {
+	tx := t.(*memoryTx)
+	tx.writes = append(tx.writes, func() {
+		if s.attributed[tweetId] == nil {
+			s.attributed[tweetId] = make(map[int]bool)
+		}
+		for _, id := range tickerIds {
+			s.attributed[tweetId][id] = true
+		}
+	})
+	return nil
+}
+
+func (s *memoryStore) AddUntrackedMentions(t db.Tx, tweetId uint64, timeStamp int64, symbols ...string) error {
+	return nil
+}
+
+func (s *memoryStore) UpsertSentimentBucket(tickerId int, bucketStart int64, bucketSeconds int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sum float64
+	var n int
+	for id, st := range s.statements {
+		if s.attributed[id][tickerId] && st.TimeStamp >= bucketStart && st.TimeStamp < bucketStart+int64(bucketSeconds) {
+			sum += st.Polarity
+			n++
+		}
+	}
+	average := 0.0
+	if n > 0 {
+		average = sum / float64(n)
+	}
+	s.sentiments[[3]int64{int64(tickerId), int64(bucketSeconds), bucketStart}] = average
+	return nil
+}
+
+func (s *memoryStore) UpsertCoMentions(tickerId int, hourStart int64) error {
+	return nil
+}
+
+func (s *memoryStore) AddBackfillJob(tickerId int, fromTime, toTime int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fromTime >= toTime {
+		return 0, errors.New("backfill range is empty")
+	}
+	id := len(s.jobs) + 1
+	s.jobs = append(s.jobs, db.BackfillJob{Id: id, TickerId: tickerId, FromTime: fromTime, ToTime: toTime,
+		Cursor: fromTime, Status: db.BACKFILL_PENDING, UpdatedAt: time.Now().Unix()})
+	return id, nil
+}
+
+func (s *memoryStore) UpdateBackfillJob(id int, cursor int64, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > len(s.jobs) {
+		return errors.New("backfill job does not exist")
+	}
+	job := &s.jobs[id-1]
+	job.Cursor, job.Status, job.UpdatedAt = cursor, status, time.Now().Unix()
+	return nil
+}
+
+func (s *memoryStore) RetrieveBackfillJobById(id int) (db.BackfillJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id < 1 || id > len(s.jobs) {
+		return db.BackfillJob{}, errors.New("backfill job does not exist")
+	}
+	return s.jobs[id-1], nil
+}
+
+func (s *memoryStore) ReturnStaleBackfillJobs(olderThan int64) ([]db.BackfillJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []db.BackfillJob
+	for _, job := range s.jobs {
+		if job.Status != db.BACKFILL_DONE && job.UpdatedAt < olderThan {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (s *memoryStore) AddScrapedHours(tickerId int, hourStarts ...int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scraped[tickerId] == nil {
+		s.scraped[tickerId] = make(map[int64]bool)
+	}
+	for _, h := range hourStarts {
+		s.scraped[tickerId][h] = true
+	}
+	return nil
+}
+
+func (s *memoryStore) ReturnCoveredHours(tickerId int, fromTime, toTime int64) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	covered := make(map[int64]bool)
+	for key := range s.sentiments {
+		if key[0] == int64(tickerId) && key[1] == db.HOURLY_BUCKET {
+			covered[key[2]] = true
+		}
+	}
+	for h := range s.scraped[tickerId] {
+		covered[h] = true
+	}
+	var timestamps []int64
+	for h := range covered {
+		if h >= fromTime && h < toTime {
+			timestamps = append(timestamps, h)
+		}
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps, nil
+}
+
+// Returns the statements attributed to a ticker since fromTime, as
+// the API lists them: newest first.
+func (s *memoryStore) ReturnAllStatements(id int, fromTime int64) []twitter.Statement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var statements []twitter.Statement
+	for tweetId, st := range s.statements {
+		if s.attributed[tweetId][id] && st.TimeStamp >= fromTime {
+			statements = append(statements, st)
+		}
+	}
+	sort.Slice(statements, func(i, j int) bool { return statements[i].TimeStamp > statements[j].TimeStamp })
+	return statements
+}
+
+// Returns the hourly sentiment of a ticker since fromTime, as the
+// API charts it: newest first.
+func (s *memoryStore) ReturnSentimentHistory(id int, fromTime int64) []db.IntervalQuote {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var history []db.IntervalQuote
+	for key, sentiment := range s.sentiments {
+		if key[0] == int64(id) && key[1] == db.HOURLY_BUCKET && key[2] >= fromTime {
+			history = append(history, db.IntervalQuote{TimeStamp: key[2], CurrentPrice: sentiment})
+		}
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].TimeStamp > history[j].TimeStamp })
+	return history
+}
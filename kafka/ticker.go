@@ -2,14 +2,13 @@ package kafka
 
 import (
 	"context"
-
 	"fmt"
-	"log"
-	"sync"
+	"log/slog"
 	"time"
 
-	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/metrics"
 	"github.com/jonreesman/watch-dog-kafka/pb"
+	"github.com/jonreesman/watch-dog-kafka/tracing"
 	"github.com/jonreesman/watch-dog-kafka/twitter"
 	"google.golang.org/grpc"
 )
@@ -26,7 +25,8 @@ type ticker struct {
 	Id              int
 	Active          int
 	grpcServerConn  *grpc.ClientConn
-	db              db.DBManager
+	db              Store
+	logger          *slog.Logger
 }
 
 // Defines a statement object. Primarily refers to a tweet,
@@ -40,59 +40,144 @@ type intervalQuote struct {
 	CurrentPrice float64
 }
 
-// Handles pushing all relevant ticker information to the database concurrently.
-// It will push all tweets and hourly sentiments to the DB and update the lastScrapeTime.
-func (t ticker) pushToDb() {
-	var wg sync.WaitGroup
-	db := t.db
-	wg.Add(1)
-	go db.AddSentiment(&wg, t.LastScrapeTime.Unix(), t.Id, t.HourlySentiment)
-	wg.Add(1)
-	go db.UpdateTicker(&wg, t.Id, t.LastScrapeTime)
-	tx := db.BeginTx()
+// Handles pushing all relevant ticker information to the database.
+// It will push all tweets, recompute the sentiment of every bucket
+// the tweets fall into, and update the lastScrapeTime once the
+// tweets are committed, so a failed push is scraped again.
+func (t ticker) pushToDb(ctx context.Context, config *ConsumerConfig) error {
+	ctx, span := tracing.Start(ctx, "pushToDb", tracing.KIND_INTERNAL)
+	defer span.End()
+	defer func() { t.Tweets = nil }()
+	if err := t.pushStatements(ctx, config); err != nil {
+		return err
+	}
+	if err := scope(t.db, ctx, t.logger).UpdateTicker(t.Id, t.LastScrapeTime); err != nil {
+		span.RecordError(err)
+		return err
+	}
+	return nil
+}
+
+// Commits all tweets in a single transaction, attributing each to
+// this ticker and every other tracked ticker it mentions and
+// recording the untracked symbols it mentions for discovery. Once
+// committed, it updates their authors, then upserts the sentiment
+// and co-mentions of each bucket the tweets touched for each of
+// those tickers. Buckets are keyed by the tweets' own timestamps
+// rather than the scrape time, so a scrape spanning many hours
+// (after downtime, or during a backfill) produces one sentiment
+// per hour rather than a single point. Returns the error if the
+// transaction cannot begin or commit.
+func (t ticker) pushStatements(ctx context.Context, config *ConsumerConfig) error {
+	db := scope(t.db, ctx, t.logger)
+	index, err := config.mentions(ctx, db)
+	if err != nil {
+		t.logger.Warn("could not load tracked tickers, attributing statements to this ticker only", "err", err)
+	}
+	mentioned := map[int][]twitter.Statement{t.Id: t.Tweets}
+	tx, err := db.BeginTx()
+	if err != nil {
+		t.logger.Error("failed to push statements", "err", err)
+		tracing.SpanFromContext(ctx).RecordError(err)
+		return err
+	}
 	for _, tw := range t.Tweets {
-		fmt.Println("added statement to DB for:", tw.Subject)
-		db.AddStatements(tx, t.Id, tw.Expression, tw.TimeStamp, tw.Polarity, tw.PermanentURL, tw.ID, tw.Likes, tw.Replies, tw.Retweets, tw.Spam)
+		db.AddStatements(tx, t.Id, tw.Expression, tw.TimeStamp, tw.Polarity, tw.PermanentURL, tw.ID, tw.Likes, tw.Replies, tw.Retweets, tw.Spam, tw.User.UserID, tw.Source)
+		var others []int
+		for _, id := range index.tickers(tw.Expression) {
+			if id != t.Id {
+				others = append(others, id)
+				mentioned[id] = append(mentioned[id], tw)
+			}
+		}
+		db.AddStatementTickers(tx, tw.ID, others...)
+		// Spam would let anyone make a symbol trend.
+		if !tw.Spam {
+			db.AddUntrackedMentions(tx, tw.ID, tw.TimeStamp, index.untracked(tw.Expression)...)
+		}
 	}
 	if err := tx.Commit(); err != nil {
-		log.Printf("Error pushing %s tweets to DB: %v", t.Name, err)
+		t.logger.Error("failed to push statements", "err", err)
+		tracing.SpanFromContext(ctx).RecordError(err)
+		return err
+	}
+	// Before the buckets, so they are weighted by up to date
+	// influence.
+	if config.Authors != nil {
+		if err := config.Authors.Record(t.logger, t.Tweets); err != nil {
+			t.logger.Warn("failed to update authors", "err", err)
+		}
+	}
+	for id, tweets := range mentioned {
+		for _, size := range config.bucketSizes() {
+			for _, start := range bucketStarts(tweets, int64(size)) {
+				db.UpsertSentimentBucket(id, start, size)
+			}
+		}
+		for _, start := range bucketStarts(tweets, hour) {
+			db.UpsertCoMentions(id, start)
+		}
 	}
-	wg.Wait()
-	t.Tweets = nil
+	return nil
 }
 
-// Given lastScrapeTime, will scrape Twitter for all tweets
-// back to that time, then compute the hourly sentiment.
-func (t *ticker) scrape(lastScrapeTime int64) {
-	t.Tweets = twitter.TwitterScrape(t.Name, lastScrapeTime)
+// Given lastScrapeTime, will scrape source for all statements
+// matching query back to that time.
+func (t *ticker) scrape(ctx context.Context, source Source, query twitter.Query, lastScrapeTime int64) {
+	_, span := tracing.Start(ctx, "scrape", tracing.KIND_INTERNAL)
+	defer span.End()
+	start := time.Now()
+	t.Tweets = source.Scrape(t.logger, query, lastScrapeTime)
 	t.numTweets = len(t.Tweets)
 	t.LastScrapeTime = time.Now()
+	metrics.ScrapeDuration.Since(start, t.Name, source.Name())
+	metrics.ScrapedStatements.WithLabelValues(t.Name, source.Name()).Add(float64(t.numTweets))
+	span.SetAttribute("source", source.Name())
+	span.SetAttribute("statements", t.numTweets)
 }
 
-func (t *ticker) spamProcessor(config *ConsumerConfig) {
-	for _, tweet := range t.Tweets {
+// Flags each tweet the spam detector scores as more likely
+// spam than ham. Without a detector nothing is flagged.
+func (t *ticker) spamProcessor(ctx context.Context, config *ConsumerConfig) {
+	if config.SpamDetector == nil {
+		return
+	}
+	_, span := tracing.Start(ctx, "spamProcessor", tracing.KIND_INTERNAL)
+	defer span.End()
+	var spam int
+	for i, tweet := range t.Tweets {
 		cleaned := config.Cleaner.CleanText(tweet.Expression)
 		score, _, _ := config.SpamDetector.Classifier.ProbScores(cleaned)
-		if score[0] > score[1] {
-			tweet.Spam = false
-		} else {
-			tweet.Spam = true
+		t.Tweets[i].Spam = score[0] <= score[1]
+		if t.Tweets[i].Spam {
+			spam++
 		}
 	}
+	span.SetAttribute("spam", spam)
+	metrics.SpamStatements.WithLabelValues(t.Name).Add(float64(spam))
+	if len(t.Tweets) > 0 {
+		metrics.SpamRatio.WithLabelValues(t.Name).Set(float64(spam) / float64(len(t.Tweets)))
+	}
 }
 
 // Utilizes GRPC to communicate with our Python ancillary that performs
-// sentiment analysis on the tweets for a given ticker.
-func (t *ticker) computeHourlySentiment() {
+// sentiment analysis on the tweets for a given ticker. Returns an
+// error if any tweet could not be analyzed, rather than storing it
+// without a polarity.
+func (t *ticker) computeHourlySentiment(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "computeHourlySentiment", tracing.KIND_INTERNAL)
+	defer span.End()
 	var total float64
 	client := pb.NewSentimentClient(t.grpcServerConn)
 	for i, s := range t.Tweets {
 		request := pb.SentimentRequest{
 			Tweet: s.Expression,
 		}
-		response, err := client.Detect(context.Background(), &request)
+		response, err := client.Detect(ctx, &request)
 		if err != nil {
-			log.Printf("GRPC SentimentRequest: %v", err)
+			t.logger.Error("sentiment request failed", "err", err)
+			span.RecordError(err)
+			return fmt.Errorf("sentiment request failed: %w", err)
 		}
 		t.Tweets[i].Polarity = float64(response.Polarity)
 		total += float64(response.Polarity)
@@ -101,4 +186,5 @@ func (t *ticker) computeHourlySentiment() {
 	if total == 0 || t.numTweets == 0 {
 		t.HourlySentiment = 0
 	}
+	return nil
 }
@@ -0,0 +1,236 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+
+	kafka "github.com/segmentio/kafka-go"
+)
+
+// The partitions, replication and retention a topic should have.
+type TopicSpec struct {
+	Name              string        `json:"name"`
+	Partitions        int           `json:"partitions"`
+	ReplicationFactor int           `json:"replication_factor"`
+	Retention         time.Duration `json:"retention"`
+	// delete, compact, or both as "compact,delete".
+	CleanupPolicy string `json:"cleanup_policy"`
+}
+
+// The topic configs we manage, as the brokers name them.
+func (spec TopicSpec) configs() map[string]string {
+	return map[string]string{
+		"retention.ms":   strconv.FormatInt(spec.Retention.Milliseconds(), 10),
+		"cleanup.policy": spec.CleanupPolicy,
+	}
+}
+
+// Compares a topic on the brokers with its spec.
+type TopicState struct {
+	Spec              TopicSpec         `json:"desired"`
+	Exists            bool              `json:"exists"`
+	Partitions        int               `json:"partitions"`
+	ReplicationFactor int               `json:"replication_factor"`
+	Configs           map[string]string `json:"configs"`
+	// How the topic differs from its spec. Empty if it matches.
+	Drift []string `json:"drift"`
+}
+
+// Returns the topic that messages from topic are forwarded to
+// when they cannot be processed.
+func DeadLetterTopic(topic string) string {
+	return topic + ".dlq"
+}
+
+// Reports how each topic in specs differs from its spec.
+func DescribeTopics(ctx context.Context, brokers []string, specs []TopicSpec) ([]TopicState, error) {
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+	// Listing every topic, rather than naming ours, keeps
+	// brokers from auto-creating the ones that are missing.
+	meta, err := client.Metadata(ctx, &kafka.MetadataRequest{})
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]kafka.Topic)
+	for _, t := range meta.Topics {
+		existing[t.Name] = t
+	}
+
+	states := make([]TopicState, 0, len(specs))
+	var resources []kafka.DescribeConfigRequestResource
+	for _, spec := range specs {
+		state := TopicState{Spec: spec, Configs: make(map[string]string)}
+		if t, ok := existing[spec.Name]; ok {
+			state.Exists = true
+			state.Partitions = len(t.Partitions)
+			if len(t.Partitions) > 0 {
+				state.ReplicationFactor = len(t.Partitions[0].Replicas)
+			}
+			resources = append(resources, kafka.DescribeConfigRequestResource{
+				ResourceType: kafka.ResourceTypeTopic,
+				ResourceName: spec.Name,
+				ConfigNames:  []string{"retention.ms", "cleanup.policy"},
+			})
+		}
+		states = append(states, state)
+	}
+
+	if len(resources) > 0 {
+		resp, err := client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{Resources: resources})
+		if err != nil {
+			return nil, err
+		}
+		configs := make(map[string]map[string]string)
+		for _, r := range resp.Resources {
+			if r.Error != nil {
+				return nil, fmt.Errorf("describe configs of %s: %w", r.ResourceName, r.Error)
+			}
+			configs[r.ResourceName] = make(map[string]string)
+			for _, e := range r.ConfigEntries {
+				configs[r.ResourceName][e.ConfigName] = e.ConfigValue
+			}
+		}
+		for i := range states {
+			if c, ok := configs[states[i].Spec.Name]; ok {
+				states[i].Configs = c
+			}
+		}
+	}
+	for i := range states {
+		states[i].Drift = drift(states[i])
+	}
+	return states, nil
+}
+
+// Lists the differences between a topic and its spec.
+func drift(state TopicState) []string {
+	diffs := make([]string, 0)
+	if !state.Exists {
+		return append(diffs, "topic does not exist")
+	}
+	spec := state.Spec
+	if state.Partitions != spec.Partitions {
+		diffs = append(diffs, fmt.Sprintf("partitions: %d, want %d", state.Partitions, spec.Partitions))
+	}
+	if state.ReplicationFactor != spec.ReplicationFactor {
+		diffs = append(diffs, fmt.Sprintf("replication factor: %d, want %d", state.ReplicationFactor, spec.ReplicationFactor))
+	}
+	want := spec.configs()
+	names := make([]string, 0, len(want))
+	for name := range want {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if got := state.Configs[name]; got != want[name] {
+			diffs = append(diffs, fmt.Sprintf("%s: %q, want %q", name, got, want[name]))
+		}
+	}
+	return diffs
+}
+
+// Creates the topics in specs that are missing, adds partitions
+// to those that have too few, and sets their retention and
+// cleanup policy. Partitions cannot be removed nor replication
+// changed this way, so such drift is only logged.
+func EnsureTopics(ctx context.Context, brokers []string, specs []TopicSpec, logger *slog.Logger) error {
+	states, err := DescribeTopics(ctx, brokers, specs)
+	if err != nil {
+		return err
+	}
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+	var (
+		create     []kafka.TopicConfig
+		partitions []kafka.TopicPartitionsConfig
+		alter      []kafka.IncrementalAlterConfigsRequestResource
+		errs       []error
+	)
+	for _, state := range states {
+		spec := state.Spec
+		if len(state.Drift) == 0 {
+			continue
+		}
+		if !state.Exists {
+			topic := kafka.TopicConfig{
+				Topic:             spec.Name,
+				NumPartitions:     spec.Partitions,
+				ReplicationFactor: spec.ReplicationFactor,
+			}
+			for name, value := range spec.configs() {
+				topic.ConfigEntries = append(topic.ConfigEntries, kafka.ConfigEntry{ConfigName: name, ConfigValue: value})
+			}
+			create = append(create, topic)
+			continue
+		}
+		l := logger.With("topic", spec.Name)
+		switch {
+		case state.Partitions < spec.Partitions:
+			partitions = append(partitions, kafka.TopicPartitionsConfig{Name: spec.Name, Count: int32(spec.Partitions)})
+		case state.Partitions > spec.Partitions:
+			l.Warn("topic has more partitions than configured, they cannot be removed", "partitions", state.Partitions, "want", spec.Partitions)
+		}
+		if state.ReplicationFactor != spec.ReplicationFactor {
+			l.Warn("topic replication factor differs, reassign its partitions to change it", "replication_factor", state.ReplicationFactor, "want", spec.ReplicationFactor)
+		}
+		resource := kafka.IncrementalAlterConfigsRequestResource{ResourceType: kafka.ResourceTypeTopic, ResourceName: spec.Name}
+		for name, value := range spec.configs() {
+			if state.Configs[name] != value {
+				resource.Configs = append(resource.Configs, kafka.IncrementalAlterConfigsRequestConfig{
+					Name:            name,
+					Value:           value,
+					ConfigOperation: kafka.ConfigOperationSet,
+				})
+			}
+		}
+		if len(resource.Configs) > 0 {
+			alter = append(alter, resource)
+		}
+	}
+
+	if len(create) > 0 {
+		resp, err := client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: create})
+		if err != nil {
+			return err
+		}
+		for name, err := range resp.Errors {
+			// Another instance may have created it first.
+			if err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+				errs = append(errs, fmt.Errorf("create topic %s: %w", name, err))
+				continue
+			}
+			logger.Info("created topic", "topic", name)
+		}
+	}
+	if len(partitions) > 0 {
+		resp, err := client.CreatePartitions(ctx, &kafka.CreatePartitionsRequest{Topics: partitions})
+		if err != nil {
+			return err
+		}
+		for name, err := range resp.Errors {
+			if err != nil {
+				errs = append(errs, fmt.Errorf("add partitions to %s: %w", name, err))
+				continue
+			}
+			logger.Info("added partitions to topic", "topic", name)
+		}
+	}
+	if len(alter) > 0 {
+		resp, err := client.IncrementalAlterConfigs(ctx, &kafka.IncrementalAlterConfigsRequest{Resources: alter})
+		if err != nil {
+			return err
+		}
+		for _, r := range resp.Resources {
+			if r.Error != nil {
+				errs = append(errs, fmt.Errorf("alter configs of %s: %w", r.ResourceName, r.Error))
+				continue
+			}
+			logger.Info("updated topic configs", "topic", r.ResourceName)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,37 @@
+package kafka
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDrift(t *testing.T) {
+	spec := TopicSpec{Name: "scrape", Partitions: 10, ReplicationFactor: 3, Retention: 7 * 24 * time.Hour, CleanupPolicy: "delete"}
+	if got := drift(TopicState{Spec: spec}); !reflect.DeepEqual(got, []string{"topic does not exist"}) {
+		t.Errorf("missing topic: got %v", got)
+	}
+
+	state := TopicState{
+		Spec:              spec,
+		Exists:            true,
+		Partitions:        10,
+		ReplicationFactor: 3,
+		Configs:           map[string]string{"retention.ms": "604800000", "cleanup.policy": "delete"},
+	}
+	if got := drift(state); len(got) != 0 {
+		t.Errorf("matching topic: got %v", got)
+	}
+
+	state.Partitions = 4
+	state.ReplicationFactor = 1
+	state.Configs["retention.ms"] = "86400000"
+	want := []string{
+		"partitions: 4, want 10",
+		"replication factor: 1, want 3",
+		`retention.ms: "86400000", want "604800000"`,
+	}
+	if got := drift(state); !reflect.DeepEqual(got, want) {
+		t.Errorf("drifted topic: got %v, want %v", got, want)
+	}
+}
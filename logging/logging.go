@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Structured logging for the service. Loggers are built once in
+// main() and handed to each component, which adds its own fields
+// (ticker, topic, partition, offset, correlation id) with With().
+
+// HTTP header and Kafka message header carrying the correlation id,
+// so that one id follows a request from the API through Kafka.
+const CORRELATION_HEADER = "X-Correlation-Id"
+
+// Output formats accepted by New.
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+)
+
+// Returns a logger writing to w at the given level
+// (debug, info, warn or error) in the given format.
+func New(w io.Writer, level, format string) (*slog.Logger, error) {
+	var l slog.Level
+	if level != "" {
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q", level)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch strings.ToLower(format) {
+	case "", FORMAT_TEXT:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FORMAT_JSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q", format)
+}
+
+// Returns a logger that drops everything, for components
+// constructed without one.
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// Returns a new random correlation id.
+func NewCorrelationID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+type correlationKey struct{}
+
+// Returns a copy of ctx carrying the correlation id.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// Returns the correlation id carried by ctx, or "".
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// Key under which GinMiddleware stores the request's logger.
+const ginLoggerKey = "logger"
+
+// Assigns every request a correlation id, taken from the
+// X-Correlation-Id header when the caller sent one, echoes it
+// back, and logs each request once it completes.
+func GinMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(CORRELATION_HEADER)
+		if id == "" {
+			id = NewCorrelationID()
+		}
+		c.Header(CORRELATION_HEADER, id)
+		c.Request = c.Request.WithContext(WithCorrelationID(c.Request.Context(), id))
+
+		l := logger.With("correlation_id", id)
+		c.Set(ginLoggerKey, l)
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		l.Info("request", "method", c.Request.Method, "route", route, "status", c.Writer.Status())
+	}
+}
+
+// Returns the request's logger set by GinMiddleware,
+// or fallback if the middleware is not installed.
+func FromGin(c *gin.Context, fallback *slog.Logger) *slog.Logger {
+	if l, ok := c.Get(ginLoggerKey); ok {
+		return l.(*slog.Logger)
+	}
+	return fallback
+}
@@ -0,0 +1,94 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "warn", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("dropped")
+	logger.With("ticker", "AMD").Warn("kept", "offset", 42)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("got %d lines, want 1: %q", len(lines), buf.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["msg"] != "kept" || entry["ticker"] != "AMD" || entry["offset"] != float64(42) {
+		t.Errorf("unexpected entry %v", entry)
+	}
+
+	if _, err := New(&buf, "loud", "json"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+	if _, err := New(&buf, "info", "xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestCorrelationID(t *testing.T) {
+	if id := CorrelationID(context.Background()); id != "" {
+		t.Errorf("got %q from an empty context", id)
+	}
+	ctx := WithCorrelationID(context.Background(), "abc")
+	if id := CorrelationID(ctx); id != "abc" {
+		t.Errorf("got %q, want abc", id)
+	}
+	if a, b := NewCorrelationID(), NewCorrelationID(); a == b || len(a) != 16 {
+		t.Errorf("ids %q and %q are not unique 16 character ids", a, b)
+	}
+}
+
+func TestGinMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var buf bytes.Buffer
+	logger, _ := New(&buf, "info", "json")
+
+	var seen string
+	r := gin.New()
+	r.Use(GinMiddleware(logger))
+	r.GET("/tickers/:id", func(c *gin.Context) {
+		seen = CorrelationID(c.Request.Context())
+		FromGin(c, nil).Info("handler")
+		c.Status(http.StatusOK)
+	})
+
+	// A caller supplied id is kept.
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/tickers/1", nil)
+	req.Header.Set(CORRELATION_HEADER, "from-caller")
+	r.ServeHTTP(w, req)
+	if seen != "from-caller" || w.Header().Get(CORRELATION_HEADER) != "from-caller" {
+		t.Errorf("got id %q and header %q, want from-caller", seen, w.Header().Get(CORRELATION_HEADER))
+	}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if !strings.Contains(line, `"correlation_id":"from-caller"`) {
+			t.Errorf("log line without correlation id: %s", line)
+		}
+	}
+	if !strings.Contains(buf.String(), `"route":"/tickers/:id"`) {
+		t.Errorf("request log has no route: %s", buf.String())
+	}
+
+	// Otherwise one is generated.
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/tickers/1", nil))
+	if seen == "" || seen == "from-caller" || w.Header().Get(CORRELATION_HEADER) != seen {
+		t.Errorf("got id %q and header %q", seen, w.Header().Get(CORRELATION_HEADER))
+	}
+}
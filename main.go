@@ -1,159 +1,310 @@
 package main
 
 import (
-	"log"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
-	"strconv"
+	"sort"
+	"strings"
 	"syscall"
 	"time"
 
 	"net/http"
 	_ "net/http/pprof"
 
+	"github.com/jonreesman/watch-dog-kafka/alerts"
+	"github.com/jonreesman/watch-dog-kafka/authors"
 	"github.com/jonreesman/watch-dog-kafka/by"
 	"github.com/jonreesman/watch-dog-kafka/cleaner"
+	"github.com/jonreesman/watch-dog-kafka/config"
 	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/health"
 	"github.com/jonreesman/watch-dog-kafka/kafka"
+	"github.com/jonreesman/watch-dog-kafka/logging"
+	"github.com/jonreesman/watch-dog-kafka/metrics"
+	"github.com/jonreesman/watch-dog-kafka/scheduler"
+	"github.com/jonreesman/watch-dog-kafka/symbology"
+	"github.com/jonreesman/watch-dog-kafka/tracing"
+	"github.com/jonreesman/watch-dog-kafka/trending"
+	"github.com/jonreesman/watch-dog-kafka/twitter"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-const (
-	SLEEP_INTERVAL = 3600 * time.Second
-)
+// Creates the scheduler for our active stock tickers and
+// cryptocurrencies. When a ticker is due, it creates a message
+// on our Kafka `scrape` topic, which signals to our consumers
+// to scrape for that stock/crypto.
+func newScheduler(logger *slog.Logger, db db.DBManager, bus kafka.Bus, interval time.Duration) *scheduler.Scheduler {
+	ctx := context.Background()
+	s := scheduler.New(db, logger, func(ticker string) {
+		// Each scheduled scrape is the root of its own trace
+		// and carries its own correlation id.
+		id := logging.NewCorrelationID()
+		ctx := logging.WithCorrelationID(ctx, id)
+		ctx, span := tracing.Start(ctx, "schedule "+ticker, tracing.KIND_INTERNAL)
+		defer span.End()
+		l := logger.With("ticker", ticker, "correlation_id", id)
+		l.Info("scheduling scrape")
+		if err := kafka.Produce(ctx, bus, kafka.SCRAPE_TOPIC, ticker, ticker); err != nil {
+			l.Error("failed to publish scrape", "err", err)
+			span.RecordError(err)
+		}
+	})
+	s.Interval = interval
+	return s
+}
 
-var (
-	CONSUMERS_PER_TOPIC = 5
-)
+// Creates the discoverer of trending symbols, which adds them the
+// same way an admin would, by publishing them to the `add` topic.
+func newDiscoverer(logger *slog.Logger, db db.DBManager, symbols *symbology.Reference, bus kafka.Bus, cfg config.TrendingConfig) *trending.Discoverer {
+	return trending.NewDiscoverer(db, symbols, logger, trending.Policy{
+		AutoAdd:     cfg.AutoAdd,
+		MinVelocity: cfg.MinVelocity,
+		MinMentions: cfg.MinMentions,
+		MaxPerDay:   cfg.MaxPerDay,
+		MaxTracked:  cfg.MaxTracked,
+	}, func(ctx context.Context, symbol string) error {
+		return kafka.Produce(ctx, bus, kafka.ADD_TOPIC, symbol, symbol)
+	})
+}
 
-// Run is our central loop that signals hourly to scrape for
-// our active stock tickers and cryptocurrencies. Every hour,
-// it creates a message on our Kafka `scrape` topic, which
-// signals to our consumers to scrape for that stock/crypto.
-func run(db db.DBManager, kafkaURL string) error {
-	// Grabs all active stock tickers every hour, and generates
-	// a scrape message on the `scrape` Kafka topic.
-
-	//Give Kafka time to start up.
-	log.Printf("Waiting 5 minutes to start initial scrape...")
-	time.Sleep(5 * time.Minute)
-	log.Printf("5 minutes elapsed... starting scrape.")
-	for {
-		tickers, _ := db.ReturnActiveTickers(nil)
-		go func() {
-			for _, ticker := range tickers {
-				log.Printf("Ticker %s", ticker.Name)
-				go kafka.ProducerHandler(nil, kafkaURL, kafka.SCRAPE_TOPIC, ticker.Name)
-			}
-		}()
-		time.Sleep(SLEEP_INTERVAL)
+// Waits for Kafka to accept connections rather than guessing
+// at how long it takes to start up, then creates the topics.
+// Consumers must not start before this, or subscribing to a
+// missing topic auto-creates it without our configuration.
+func prepareBus(logger *slog.Logger, bus kafka.Bus, topics []kafka.TopicSpec) error {
+	ctx := context.Background()
+	if err := kafka.WaitForBus(ctx, bus, logger); err != nil {
+		return err
 	}
+	// Brokers we may not administer still auto-create topics,
+	// so a failure here is not fatal.
+	if err := bus.EnsureTopics(ctx, topics, logger); err != nil {
+		logger.Error("failed to ensure Kafka topics", "err", err)
+	}
+	logger.Info("kafka is ready")
+	return nil
+}
+
+// Run is our central loop that runs the scheduler. Only the
+// instance holding the scheduler lease publishes, so running
+// several replicas of the binary is safe.
+func run(logger *slog.Logger, s *scheduler.Scheduler) {
+	logger.Info("starting scheduler")
+	s.Run(context.Background())
 }
 
 func main() {
-	// Grab all our environment variables.
-	// Database environment variables.
-	dbUser := os.Getenv("DB_USER")
-	dbPwd := os.Getenv("DB_PWD")
-	dbName := os.Getenv("DB_NAME")
-	dbMasterURL := os.Getenv("DB_MASTER")
-	dbSlaveURL := os.Getenv("DB_SLAVE")
-
-	// GRPC environment variable
-	grpcHost := os.Getenv("GRPC_HOST")
-
-	// Kafka environment variables.
-	kafkaURL := os.Getenv("kafkaURL")
-	groupID := os.Getenv("groupID")
-	if _, exists := os.LookupEnv("CONSUMERS_PER_TOPIC"); exists {
-		var err error
-		CONSUMERS_PER_TOPIC, err = strconv.Atoi(os.Getenv("CONSUMERS_PER_TOPIC"))
-		if err != nil {
-			log.Printf("Failed to read CONSUMERS_PER_TOPIC env variable. Defaulting to 10.")
+	// Subcommands such as `backfill` run to completion
+	// instead of starting the service.
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", os.Args[1], err)
+			os.Exit(1)
 		}
+		return
 	}
 
-	// Set up our pprof server
-	go func() {
-		log.Println(http.ListenAndServe("localhost:6060", nil))
-	}()
+	// Configuration comes from the file given by --config or
+	// $WATCHDOG_CONFIG, overridden by env variables and flags.
+	loader := config.Bind(flag.CommandLine)
+	flag.Parse()
+	cfg, err := loader.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	kafkaURL := cfg.Kafka.URL()
 
-	main, err := db.NewManager(dbUser, dbPwd, dbName, dbMasterURL)
+	// The logger is handed to every component below.
+	logger, _ := logging.New(os.Stderr, cfg.Logging.Level, cfg.Logging.Format)
+
+	// Exports traces if OTEL_TRACES_EXPORTER is set.
+	shutdownTracing, err := tracing.InitFromEnv(logger)
 	if err != nil {
-		log.Fatalf("Error Opening DB connection in NewServer(): %v", err)
+		fatal(logger, "failed to set up tracing", err)
+	}
+
+	// Set up our pprof server
+	if cfg.Listen.Pprof != "" {
+		go func() {
+			logger.Error("pprof server stopped", "err", http.ListenAndServe(cfg.Listen.Pprof, nil))
+		}()
 	}
-	replica, err := db.NewManager(dbUser, dbPwd, dbName, dbSlaveURL)
+
+	// Writes go to the primary and reads to whichever replicas
+	// are keeping up. Components that read back their own
+	// writes use primary, whose reads never go to a replica.
+	dbConfig := cfg.Database
+	d, err := db.NewRouter(logger, dbConfig.User, dbConfig.Password, dbConfig.Name, dbConfig.Primary, dbConfig.Replicas, dbConfig.MaxReplicaLag)
 	if err != nil {
-		log.Fatalf("Error Opening DB connection in NewServer(): %v", err)
+		fatal(logger, "failed to open primary database connection", err)
 	}
-	grpcServerConn, err := grpc.Dial(grpcHost, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	go d.MonitorReplicas(context.Background(), db.REPLICA_CHECK_INTERVAL)
+	primary := d.ReadPrimary()
+	grpcServerConn, err := grpc.Dial(cfg.GRPC.Host,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(metrics.UnaryClientInterceptor(), tracing.UnaryClientInterceptor()),
+		grpc.WithBlock())
 	if err != nil {
-		log.Fatalf("main(): Failed to dial GRPC.")
-		return
+		fatal(logger, "failed to dial gRPC", err)
 	}
 
-	spamDetector, err := by.LoadModelFromFile("model.by")
+	spamDetector, err := by.LoadModelFromFile(cfg.Models.Spam)
 	if err != nil {
-		log.Fatalf("main(): Failed to load spam detection model %v", err)
+		fatal(logger, "failed to load spam detection model", err)
 	}
 
 	cleaner := cleaner.NewCleaner()
 
+	symbols, err := symbology.Load(cfg.Symbology.Reference)
+	if err != nil {
+		fatal(logger, "failed to load symbol reference list", err)
+	}
+
+	// Every message we publish or consume goes through one
+	// bus, which is flushed on shutdown.
+	bus, err := newBus(cfg)
+	if err != nil {
+		fatal(logger, "failed to create Kafka bus", err)
+	}
+
+	// Webhooks are sent in the background so that consumers
+	// only evaluate rules.
+	alerter := alerts.NewAlerter(primary, alerts.NewNotifier())
+	go alerter.Run(context.Background(), alerts.WORKERS)
+
+	// The index consumers attribute statements to tickers with,
+	// shared with the API so that metadata changes refresh it.
+	mentions := kafka.NewMentionCache()
+
 	consumerConfig := kafka.ConsumerConfig{
-		DbManager:      main,
-		GrpcServerConn: grpcServerConn,
-		SpamDetector:   &spamDetector,
-		Cleaner: 		cleaner,
+		Store:              primary,
+		GrpcServerConn:     grpcServerConn,
+		SpamDetector:       &spamDetector,
+		Cleaner:            cleaner,
+		Alerter:            alerter,
+		Logger:             logger.With("component", "consumer"),
+		Bus:                bus,
+		Symbols:            symbols,
+		DeadLetter:         deadLetterTopics(cfg),
+		QuarterHourBuckets: cfg.Sentiment.QuarterHourBuckets,
+		Authors:            authors.NewCache(primary, twitter.FetchProfile),
+		Mentions:           mentions,
 	}
 
-	// Utilizes goroutines to create concurrent Kafka Consumers.
-	go consumerFactory(consumerConfig, kafkaURL, groupID)
+	if err := prepareBus(logger, bus, topicSpecs(cfg)); err != nil {
+		fatal(logger, "failed to reach kafka", err)
+	}
+
+	// Runs the configured number of consumers on each topic,
+	// restarting any that fail. The API can resize it.
+	pool := kafka.NewPool(consumerConfig, cfg.Kafka.GroupID)
+	if err := pool.Start(context.Background(), cfg.Kafka.Consumers); err != nil {
+		fatal(logger, "failed to start consumers", err)
+	}
 
-	// Grabs an instance of our Gin server, passing the kafkaURL.
-	// Gin server requires the KafkaURL so that it can create
-	// its own Kafka producers.
-	s, err := NewServer(replica, grpcServerConn, kafkaURL)
+	// The scheduler persists its schedule and holds a lease,
+	// so it needs the primary.
+	sched := newScheduler(logger, primary, bus, cfg.Scheduler.ScrapeInterval)
+
+	// Everything /readyz checks before traffic is sent our way.
+	checker := health.NewChecker()
+	checker.Add("mysql_primary", d.Ping)
+	checker.AddOptional("mysql_replicas", d.CheckReplicas)
+	checker.Add("kafka", bus.Ping)
+	checker.Add("grpc_analyzer", health.GRPC(grpcServerConn, ""))
+	checker.Add("spam_model", health.Loaded("spam model not loaded", func() bool { return spamDetector.Classifier != nil }))
+
+	// Grabs an instance of our Gin server, passing the bus
+	// it publishes admin requests on, and the kafkaURL it
+	// describes the consumer group with. An admin's reads go to the
+	// primary for long enough for the consumers to apply their
+	// change and the replicas to catch up.
+	s, err := NewServer(logger, d, grpcServerConn, kafkaURL, bus, pool, symbols, mentions, dbConfig.MaxReplicaLag+time.Minute, monitor{
+		checker:   checker,
+		scheduler: sched,
+		groupID:   cfg.Kafka.GroupID,
+	})
 	if err != nil {
-		log.Fatal(err)
+		fatal(logger, "failed to create server", err)
 	}
 
 	// Fails and aborts if the Gin server fails to launch,
 	// since there is no reason to run without the API.
-	go s.startServer()
+	go func() {
+		fatal(logger, "API server stopped", s.startServer(cfg.Listen.API))
+	}()
+
+	// Launches the scheduler that results in a regular
+	// scraping for each stock ticker/crypto.
+	go run(logger, sched)
+
+	// Picks interrupted and failed backfill jobs back up, at
+	// startup and periodically after.
+	go kafka.RunBackfillResumer(context.Background(), primary, bus, logger, kafka.BACKFILL_RESUME_INTERVAL)
 
-	// Launches the hourly loop that results in a regular
-	// scraping for each stock ticker/crypto. If this fails,
-	// we will also abort.
-	go run(replica, kafkaURL)
+	// Prunes the mentions trends are ranked from and, if
+	// configured, adds trending symbols through the `add` topic.
+	go newDiscoverer(logger, primary, symbols, bus, cfg.Trending).Run(context.Background())
 
 	sc := make(chan os.Signal, 1)
 	signal.Notify(sc, syscall.SIGINT, syscall.SIGTERM, os.Interrupt, os.Kill)
 	<-sc
+
+	if err := bus.Close(); err != nil {
+		logger.Error("failed to flush Kafka bus", "err", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutdownTracing(ctx)
 }
 
-// Utilizes goroutines to create concurrent Kafka Consumers.
-func consumerFactory(config kafka.ConsumerConfig, kafkaURL string, groupID string) {
-	addChannel := make(chan int, CONSUMERS_PER_TOPIC)
-	deleteChannel := make(chan int, CONSUMERS_PER_TOPIC)
-	scrapeChannel := make(chan int, CONSUMERS_PER_TOPIC)
-	go consumerManager(addChannel, config, kafkaURL, kafka.ADD_TOPIC, groupID)
-	go consumerManager(deleteChannel, config, kafkaURL, kafka.DELETE_TOPIC, groupID)
-	go consumerManager(scrapeChannel, config, kafkaURL, kafka.SCRAPE_TOPIC, groupID)
+// Creates the bus shared by everything that publishes or consumes.
+func newBus(cfg config.Config) (*kafka.KafkaBus, error) {
+	p := cfg.Kafka.Producer
+	return kafka.NewKafkaBus(kafka.ProducerConfig{
+		Brokers:      cfg.Kafka.Brokers,
+		BatchSize:    p.BatchSize,
+		BatchTimeout: p.BatchTimeout,
+		Compression:  p.Compression,
+		RequiredAcks: p.RequiredAcks,
+	})
 }
 
-// Utilizes channels to maintain a set number of consumers per topic.
-// Will wait 5 minutes prior to respawning a consumer.
-func consumerManager(ch chan int, config kafka.ConsumerConfig, kafkaURL string, topic string, groupID string) {
-	for i := 0; i < CONSUMERS_PER_TOPIC; i++ {
-		go kafka.SpawnConsumer(ch, config, kafkaURL, topic, groupID)
+// Returns the topics configured under `kafka.topics`, by name.
+func topicSpecs(cfg config.Config) []kafka.TopicSpec {
+	specs := make([]kafka.TopicSpec, 0, len(cfg.Kafka.Topics))
+	for name, t := range cfg.Kafka.Topics {
+		specs = append(specs, kafka.TopicSpec{
+			Name:              name,
+			Partitions:        t.Partitions,
+			ReplicationFactor: t.ReplicationFactor,
+			Retention:         t.Retention,
+			CleanupPolicy:     t.CleanupPolicy,
+		})
 	}
-	for {
-		<-ch
-		log.Printf("Spawning new consumer in 5 minutes...")
-		go func() {
-			time.Sleep(time.Second * time.Duration(300))
-			go kafka.SpawnConsumer(ch, config, kafkaURL, topic, groupID)
-		}()
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Name < specs[j].Name })
+	return specs
+}
+
+// Returns the topics that have a dead letter topic configured.
+func deadLetterTopics(cfg config.Config) map[string]bool {
+	topics := make(map[string]bool)
+	for _, topic := range kafka.Topics {
+		if _, ok := cfg.Kafka.Topics[kafka.DeadLetterTopic(topic)]; ok {
+			topics[topic] = true
+		}
 	}
+	return topics
+}
+
+// Logs a startup failure and exits.
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "err", err)
+	os.Exit(1)
 }
@@ -0,0 +1,79 @@
+package metrics
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Defines every metric the service exports on /metrics.
+var (
+	MessagesConsumed = NewCounterVec("watchdog_kafka_messages_consumed_total",
+		"Kafka messages read by our consumers.", "topic")
+	MessagesFailed = NewCounterVec("watchdog_kafka_messages_failed_total",
+		"Kafka messages that could not be processed, or reads that failed.", "topic")
+	ConsumerLag = NewGaugeVec("watchdog_kafka_consumer_lag",
+		"Messages between the last consumed offset and the partition's high water mark.", "topic", "partition")
+	ConsumerWorkers = NewGaugeVec("watchdog_kafka_consumer_workers",
+		"Consumer workers the pool runs for each topic.", "topic")
+	ConsumerRestarts = NewCounterVec("watchdog_kafka_consumer_restarts_total",
+		"Consumer workers restarted after exiting or panicking.", "topic")
+
+	ScrapeDuration = NewHistogramVec("watchdog_scrape_duration_seconds",
+		"Time taken to scrape a source for a ticker.",
+		[]float64{.5, 1, 2.5, 5, 10, 30, 60, 120, 300}, "ticker", "source")
+	ScrapedStatements = NewCounterVec("watchdog_scraped_statements_total",
+		"Statements returned by scrapes.", "ticker", "source")
+	SpamStatements = NewCounterVec("watchdog_spam_statements_total",
+		"Scraped statements classified as spam.", "ticker")
+	SpamRatio = NewGaugeVec("watchdog_spam_ratio",
+		"Fraction of the most recent scrape classified as spam.", "ticker")
+
+	GRPCDuration = NewHistogramVec("watchdog_grpc_client_duration_seconds",
+		"Latency of outgoing gRPC calls.", nil, "method")
+	GRPCErrors = NewCounterVec("watchdog_grpc_client_errors_total",
+		"Outgoing gRPC calls that returned an error.", "method", "code")
+
+	DBQueryDuration = NewHistogramVec("watchdog_db_query_duration_seconds",
+		"Latency of database operations by DBManager method.", nil, "method")
+	DBReplicaLag = NewGaugeVec("watchdog_db_replica_lag_seconds",
+		"Last measured replication lag of each read replica, or -1 if it could not be measured.", "replica")
+	DBReads = NewCounterVec("watchdog_db_reads_total",
+		"Reads routed by the database router, by where they were served.", "target")
+
+	HTTPRequestDuration = NewHistogramVec("watchdog_http_request_duration_seconds",
+		"Latency of REST API requests by route.", nil, "method", "route", "status")
+)
+
+// Gin middleware recording the latency of every request by
+// its route template (e.g. /api/tickers/:id/time/:interval),
+// so that ids do not explode the number of series.
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		HTTPRequestDuration.Since(start, c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+	}
+}
+
+// gRPC client interceptor recording the latency and
+// errors of every unary call.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		GRPCDuration.Since(start, method)
+		if err != nil {
+			GRPCErrors.WithLabelValues(method, status.Code(err).String()).Inc()
+		}
+		return err
+	}
+}
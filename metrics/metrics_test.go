@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExposition(t *testing.T) {
+	r := &Registry{}
+	c := &CounterVec{newFamily("test_total", "A test counter.", "counter", []string{"topic"})}
+	g := &GaugeVec{newFamily("test_lag", "A test gauge.", "gauge", []string{"topic", "partition"})}
+	h := &HistogramVec{f: newFamily("test_seconds", "A test histogram.", "histogram", []string{"method"}), buckets: []float64{0.1, 1}}
+	r.register(c)
+	r.register(g)
+	r.register(h)
+
+	c.WithLabelValues("scrape").Inc()
+	c.WithLabelValues("scrape").Add(2)
+	c.WithLabelValues(`a"b`).Inc()
+	g.WithLabelValues("add", "3").Set(7)
+	h.WithLabelValues("Detect").Observe(0.05)
+	h.WithLabelValues("Detect").Observe(0.5)
+	h.WithLabelValues("Detect").Observe(5)
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+	want := `# HELP test_total A test counter.
+# TYPE test_total counter
+test_total{topic="a\"b"} 1
+test_total{topic="scrape"} 3
+# HELP test_lag A test gauge.
+# TYPE test_lag gauge
+test_lag{topic="add",partition="3"} 7
+# HELP test_seconds A test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{method="Detect",le="0.1"} 1
+test_seconds_bucket{method="Detect",le="1"} 2
+test_seconds_bucket{method="Detect",le="+Inf"} 3
+test_seconds_sum{method="Detect"} 5.55
+test_seconds_count{method="Detect"} 3
+`
+	if buf.String() != want {
+		t.Errorf("unexpected exposition:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for a missing label value")
+		}
+	}()
+	c := &CounterVec{newFamily("x_total", "x", "counter", []string{"a", "b"})}
+	c.WithLabelValues("only-one")
+}
+
+func TestDefaultRegistryServesDefinedMetrics(t *testing.T) {
+	MessagesConsumed.WithLabelValues("scrape").Inc()
+	var buf bytes.Buffer
+	Default.Write(&buf)
+	if !strings.Contains(buf.String(), `watchdog_kafka_messages_consumed_total{topic="scrape"}`) {
+		t.Errorf("consumed messages missing from /metrics output")
+	}
+}
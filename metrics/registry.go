@@ -0,0 +1,330 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A small, dependency free implementation of the Prometheus
+// text exposition format, covering the counters, gauges and
+// histograms this service needs.
+// See https://prometheus.io/docs/instrumenting/exposition_formats/
+
+// Default histogram buckets, in seconds, suited to request
+// and query latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type collector interface {
+	write(w io.Writer)
+}
+
+// Holds a set of metrics and renders them for scraping.
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+// The registry that every metric in this package belongs to.
+var Default = &Registry{}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Renders every registered metric in the text exposition format.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	bw.Flush()
+}
+
+// Returns an http.Handler serving the Default registry.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Default.Write(w)
+	})
+}
+
+// Shared bookkeeping for a metric family: its name, help
+// text, label names, and one child per label value set.
+type family struct {
+	name     string
+	help     string
+	kind     string
+	labels   []string
+	mu       sync.Mutex
+	children map[string]interface{}
+	values   map[string][]string
+}
+
+func newFamily(name, help, kind string, labels []string) *family {
+	return &family{
+		name:     name,
+		help:     help,
+		kind:     kind,
+		labels:   labels,
+		children: make(map[string]interface{}),
+		values:   make(map[string][]string),
+	}
+}
+
+// Returns the child for the given label values, creating it
+// with newChild if it does not exist yet.
+func (f *family) child(values []string, newChild func() interface{}) interface{} {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c, ok := f.children[key]
+	if !ok {
+		c = newChild()
+		f.children[key] = c
+		f.values[key] = append([]string(nil), values...)
+	}
+	return c
+}
+
+// Calls fn for every child, ordered by label values so that
+// output is stable between scrapes.
+func (f *family) each(fn func(labels string, child interface{})) {
+	f.mu.Lock()
+	keys := make([]string, 0, len(f.children))
+	for k := range f.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	type entry struct {
+		labels string
+		child  interface{}
+	}
+	entries := make([]entry, len(keys))
+	for i, k := range keys {
+		entries[i] = entry{formatLabels(f.labels, f.values[k]), f.children[k]}
+	}
+	f.mu.Unlock()
+	for _, e := range entries {
+		fn(e.labels, e.child)
+	}
+}
+
+func (f *family) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, strings.ReplaceAll(f.help, "\n", " "))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+}
+
+// Renders label pairs as the inside of a {...} block.
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i := range names {
+		pairs[i] = names[i] + `="` + escape(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func series(name, labels string) string {
+	if labels == "" {
+		return name
+	}
+	return name + "{" + labels + "}"
+}
+
+// A single float value guarded by a mutex, shared by
+// counters and gauges.
+type value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (v *value) add(d float64) {
+	v.mu.Lock()
+	v.v += d
+	v.mu.Unlock()
+}
+
+func (v *value) set(d float64) {
+	v.mu.Lock()
+	v.v = d
+	v.mu.Unlock()
+}
+
+func (v *value) get() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.v
+}
+
+// A monotonically increasing value.
+type Counter struct{ value }
+
+// Increments the counter by one.
+func (c *Counter) Inc() { c.add(1) }
+
+// Increments the counter by d, which must not be negative.
+func (c *Counter) Add(d float64) {
+	if d < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.add(d)
+}
+
+// A family of counters partitioned by labels.
+type CounterVec struct{ f *family }
+
+// Creates and registers a counter family.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newFamily(name, help, "counter", labels)}
+	Default.register(c)
+	return c
+}
+
+// Returns the counter for the given label values.
+func (c *CounterVec) WithLabelValues(values ...string) *Counter {
+	return c.f.child(values, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.f.writeHeader(w)
+	c.f.each(func(labels string, child interface{}) {
+		fmt.Fprintf(w, "%s %s\n", series(c.f.name, labels), formatFloat(child.(*Counter).get()))
+	})
+}
+
+// A value that can go up and down.
+type Gauge struct{ value }
+
+// Sets the gauge to v.
+func (g *Gauge) Set(v float64) { g.set(v) }
+
+// Adds d, which may be negative, to the gauge.
+func (g *Gauge) Add(d float64) { g.add(d) }
+
+// A family of gauges partitioned by labels.
+type GaugeVec struct{ f *family }
+
+// Creates and registers a gauge family.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newFamily(name, help, "gauge", labels)}
+	Default.register(g)
+	return g
+}
+
+// Returns the gauge for the given label values.
+func (g *GaugeVec) WithLabelValues(values ...string) *Gauge {
+	return g.f.child(values, func() interface{} { return &Gauge{} }).(*Gauge)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.f.writeHeader(w)
+	g.f.each(func(labels string, child interface{}) {
+		fmt.Fprintf(w, "%s %s\n", series(g.f.name, labels), formatFloat(child.(*Gauge).get()))
+	})
+}
+
+// Counts observations into cumulative buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// Records a single observation.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// A family of histograms partitioned by labels.
+type HistogramVec struct {
+	f       *family
+	buckets []float64
+}
+
+// Creates and registers a histogram family. If buckets is nil,
+// DefBuckets is used.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	h := &HistogramVec{f: newFamily(name, help, "histogram", labels), buckets: sorted}
+	Default.register(h)
+	return h
+}
+
+// Returns the histogram for the given label values.
+func (h *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	return h.f.child(values, func() interface{} {
+		return &Histogram{buckets: h.buckets, counts: make([]uint64, len(h.buckets))}
+	}).(*Histogram)
+}
+
+// Observes the seconds elapsed since start. Meant to be
+// deferred: `defer m.Since(time.Now(), "label")`.
+func (h *HistogramVec) Since(start time.Time, values ...string) {
+	h.WithLabelValues(values...).Observe(time.Since(start).Seconds())
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.f.writeHeader(w)
+	h.f.each(func(labels string, child interface{}) {
+		hist := child.(*Histogram)
+		hist.mu.Lock()
+		defer hist.mu.Unlock()
+		prefix := labels
+		if prefix != "" {
+			prefix += ","
+		}
+		for i, upper := range hist.buckets {
+			fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", h.f.name, prefix, formatFloat(upper), hist.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", h.f.name, prefix, hist.count)
+		fmt.Fprintf(w, "%s %s\n", series(h.f.name+"_sum", labels), formatFloat(hist.sum))
+		fmt.Fprintf(w, "%s %d\n", series(h.f.name+"_count", labels), hist.count)
+	})
+}
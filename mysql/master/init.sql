@@ -5,9 +5,30 @@ flush privileges;
 use app;
 CREATE TABLE IF NOT EXISTS tickers(ticker_id SERIAL PRIMARY KEY, name VARCHAR(255) NOT NULL, active INT, last_scrape_time BIGINT);
 ALTER TABLE tickers ADD CONSTRAINT ticker_Unique UNIQUE(name);
+ALTER TABLE tickers ADD COLUMN next_scrape_time BIGINT;
+ALTER TABLE tickers ADD COLUMN scrape_interval INT, ADD COLUMN priority INT NOT NULL DEFAULT 0, ADD COLUMN adaptive INT NOT NULL DEFAULT 0;
 
 CREATE TABLE IF NOT EXISTS statements(tweet_id BIGINT UNSIGNED PRIMARY KEY, ticker_id BIGINT UNSIGNED, expression VARCHAR(500), url VARCHAR(255), time_stamp BIGINT, polarity FLOAT, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
 ALTER TABLE statements ADD COLUMN likes INT, ADD COLUMN replies INT, ADD COLUMN retweets INT;
 ALTER TABLE statements ADD CONSTRAINT url_Unique UNIQUE(url);
+ALTER TABLE statements ADD COLUMN spam BOOLEAN, ADD COLUMN author_id VARCHAR(32), ADD INDEX (author_id);
+ALTER TABLE statements ADD COLUMN source VARCHAR(32) NOT NULL DEFAULT 'Twitter', ADD FULLTEXT INDEX statement_text (expression);
+CREATE TABLE IF NOT EXISTS statement_tickers(tweet_id BIGINT UNSIGNED, ticker_id BIGINT UNSIGNED, PRIMARY KEY (ticker_id, tweet_id), FOREIGN KEY (tweet_id) REFERENCES statements(tweet_id) ON DELETE CASCADE, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
+INSERT IGNORE INTO statement_tickers(tweet_id, ticker_id) SELECT tweet_id, ticker_id FROM statements;
 
 CREATE TABLE IF NOT EXISTS sentiments(sentiment_id SERIAL PRIMARY KEY, time_stamp BIGINT, ticker_id BIGINT UNSIGNED, hourly_sentiment FLOAT, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
+ALTER TABLE sentiments ADD COLUMN bucket_seconds INT NOT NULL DEFAULT 3600, ADD COLUMN statement_count INT;
+ALTER TABLE sentiments ADD CONSTRAINT sentiment_bucket_Unique UNIQUE(ticker_id, bucket_seconds, time_stamp);
+ALTER TABLE sentiments ADD COLUMN weighted_sentiment FLOAT;
+
+CREATE TABLE IF NOT EXISTS alert_rules(rule_id SERIAL PRIMARY KEY, ticker_id BIGINT UNSIGNED, kind VARCHAR(32), threshold FLOAT, window_hours INT, cooldown_seconds BIGINT, webhook_url VARCHAR(500), format VARCHAR(16), secret VARCHAR(255), active INT, last_fired BIGINT, last_observed BIGINT, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
+CREATE TABLE IF NOT EXISTS backfill_jobs(job_id SERIAL PRIMARY KEY, ticker_id BIGINT UNSIGNED, from_time BIGINT, to_time BIGINT, cursor_time BIGINT, status VARCHAR(16), updated_at BIGINT, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
+CREATE TABLE IF NOT EXISTS scheduler_leases(name VARCHAR(64) PRIMARY KEY, holder VARCHAR(255), expires_at BIGINT);
+CREATE TABLE IF NOT EXISTS ticker_metadata(ticker_id BIGINT UNSIGNED PRIMARY KEY, company_name VARCHAR(255), aliases TEXT, cashtag VARCHAR(32), negative_keywords TEXT, FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
+CREATE TABLE IF NOT EXISTS untracked_mentions(symbol VARCHAR(32), tweet_id BIGINT UNSIGNED, time_stamp BIGINT, PRIMARY KEY (symbol, tweet_id), INDEX (time_stamp));
+CREATE TABLE IF NOT EXISTS auto_added_tickers(symbol VARCHAR(32) PRIMARY KEY, added_at BIGINT);
+CREATE TABLE IF NOT EXISTS co_mentions(ticker_a BIGINT UNSIGNED, ticker_b BIGINT UNSIGNED, time_stamp BIGINT, mentions INT, PRIMARY KEY (ticker_a, ticker_b, time_stamp), INDEX (time_stamp), FOREIGN KEY (ticker_a) REFERENCES tickers(ticker_id) ON DELETE CASCADE, FOREIGN KEY (ticker_b) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
+INSERT IGNORE INTO co_mentions(ticker_a, ticker_b, time_stamp, mentions) SELECT a.ticker_id, b.ticker_id, FLOOR(statements.time_stamp / 3600) * 3600 AS hour, COUNT(*) FROM statements JOIN statement_tickers a ON a.tweet_id = statements.tweet_id JOIN statement_tickers b ON b.tweet_id = statements.tweet_id AND a.ticker_id <= b.ticker_id GROUP BY a.ticker_id, b.ticker_id, hour;
+CREATE TABLE IF NOT EXISTS authors(author_id VARCHAR(32) PRIMARY KEY, username VARCHAR(255), followers INT, joined BIGINT, verified BOOLEAN, statements INT, spam_statements INT, influence FLOAT, profile_updated_at BIGINT);
+CREATE TABLE IF NOT EXISTS quotes(ticker_id BIGINT UNSIGNED, time_stamp BIGINT, price DOUBLE, PRIMARY KEY (ticker_id, time_stamp), FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
+CREATE TABLE IF NOT EXISTS scraped_hours(ticker_id BIGINT UNSIGNED, time_stamp BIGINT, PRIMARY KEY (ticker_id, time_stamp), FOREIGN KEY (ticker_id) REFERENCES tickers(ticker_id) ON DELETE CASCADE);
@@ -3,6 +3,7 @@ import math
 from concurrent.futures import ThreadPoolExecutor
 
 import grpc
+from grpc_health.v1 import health, health_pb2, health_pb2_grpc
 from pydantic import BaseModel
 from textblob import TextBlob 
 
@@ -49,6 +50,10 @@ if __name__ == "__main__":
     server = grpc.server(ThreadPoolExecutor())
     add_SentimentServicer_to_server(SentimentServer() ,server)
     add_QuotesServicer_to_server(QuotesServer() , server)
+    # Standard gRPC health service, checked by the backend's /readyz.
+    health_servicer = health.HealthServicer()
+    health_servicer.set('', health_pb2.HealthCheckResponse.SERVING)
+    health_pb2_grpc.add_HealthServicer_to_server(health_servicer, server)
     port = 9999
     server.add_insecure_port(f'[::]:{port}')
     server.start()
@@ -1,9 +1,7 @@
 package main
 
 import (
-	"fmt"
-	"log"
-	"regexp"
+	"log/slog"
 
 	"github.com/piquette/finance-go/quote"
 )
@@ -16,10 +14,10 @@ import (
 	pull stock quote history, but it has less overhead than the Python
 	module used for quote history.
 */
-func priceCheck(ticker string) float64 {
+func priceCheck(logger *slog.Logger, ticker string) float64 {
 	q, err := quote.Get(ticker)
 	if err != nil {
-		log.Printf("Error getting quote")
+		logger.Warn("failed to get quote", "ticker", ticker, "err", err)
 		return 0
 	}
 	if q == nil {
@@ -27,24 +25,3 @@ func priceCheck(ticker string) float64 {
 	}
 	return q.RegularMarketPrice
 }
-
-// Uses the piquette Finance package to validate against known
-// exchanges that the specific stock ticker exists.
-func CheckTickerExists(ticker string) bool {
-	q, err := quote.Get(ticker)
-	fmt.Println(q)
-	if err != nil || q == nil {
-		return false
-	} else {
-		return true
-	}
-}
-
-func SanitizeTicker(s string) string {
-	regex := regexp.MustCompile("/[A-Za-z]")
-	s = regex.ReplaceAllLiteralString(s, "")
-	if len(s) == 0 {
-		return ""
-	}
-	return s
-}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"fmt"
+	"log/slog"
 	"math/rand"
 	"testing"
 	"time"
@@ -23,15 +23,6 @@ func randomTickerName() string {
 
 func TestPriceCheck(t *testing.T) {
 	for i := 0; i < 100; i++ {
-		priceCheck(randomTickerName())
-	}
-}
-
-func TestCheckTickerExists(t *testing.T) {
-	for i := 0; i < 100; i++ {
-		t := randomTickerName()
-		if CheckTickerExists(t) {
-			fmt.Println(t)
-		}
+		priceCheck(slog.Default(), randomTickerName())
 	}
 }
@@ -0,0 +1,227 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jonreesman/watch-dog-kafka/db"
+)
+
+// Name of the lease that elects the scheduling instance.
+const LEASE_NAME = "scrape-scheduler"
+
+const (
+	// A single search returns at most 100 tweets, so adaptive
+	// tickers aim for a cadence that yields about half that.
+	TARGET_STATEMENTS_PER_SCRAPE = 50
+	// Hours of mention volume an adaptive interval is based on.
+	ADAPTIVE_LOOKBACK_HOURS = 6
+	// Bounds on any interval the scheduler will use.
+	MIN_INTERVAL = 5 * time.Minute
+	MAX_INTERVAL = 24 * time.Hour
+)
+
+// Defines the database operations the scheduler depends on.
+// Satisfied by db.DBManager, which should be the primary.
+type Store interface {
+	AcquireLease(name, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(name, holder string) error
+	ReturnDueTickers(now int64) (db.TickerSlice, error)
+	SetNextScrapeTime(id int, next int64) error
+	ReturnMentionHistory(id int, fromTime int64) []db.IntervalQuote
+}
+
+// Decides when each active ticker is scraped. Every instance of
+// the service runs a Scheduler, but only the one holding the
+// lease publishes, so replicas never emit duplicate scrapes.
+// The next run of each ticker is persisted, so a restart neither
+// skips nor repeats a scrape.
+type Scheduler struct {
+	store   Store
+	publish func(ticker string)
+	id      string
+	logger  *slog.Logger
+
+	// How often a normal priority ticker is scraped when it
+	// has no interval of its own. High priority tickers default
+	// to a quarter of this, low priority ones to four times it.
+	Interval time.Duration
+	// Each next run is shifted by a random amount in
+	// [-Jitter, Jitter] to spread scrapes over the interval.
+	Jitter time.Duration
+	// How often due tickers are checked for.
+	Tick time.Duration
+	// How long the lease is held without renewal.
+	LeaseTTL time.Duration
+
+	mu        sync.Mutex
+	leader    bool
+	lastFired time.Time
+	rand      *rand.Rand
+}
+
+// Creates a Scheduler that hands due tickers to publish.
+func New(store Store, logger *slog.Logger, publish func(ticker string)) *Scheduler {
+	host, _ := os.Hostname()
+	id := fmt.Sprintf("%s-%s", host, uuid.New().String())
+	return &Scheduler{
+		store:    store,
+		publish:  publish,
+		id:       id,
+		logger:   logger.With("component", "scheduler", "instance", id),
+		Interval: time.Hour,
+		Jitter:   5 * time.Minute,
+		Tick:     time.Minute,
+		LeaseTTL: 3 * time.Minute,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Runs the scheduler until ctx is cancelled, releasing
+// the lease on the way out if this instance held it.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Tick)
+	defer ticker.Stop()
+	for {
+		s.tick(time.Now())
+		select {
+		case <-ctx.Done():
+			if s.IsLeader() {
+				if err := s.store.ReleaseLease(LEASE_NAME, s.id); err != nil {
+					s.logger.Error("failed to release lease", "err", err)
+				}
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Renews or takes the lease, and if we hold it, publishes every
+// due ticker. A ticker's next run is only persisted after it has
+// been published, so a crash in between repeats a scrape rather
+// than skipping one.
+func (s *Scheduler) tick(now time.Time) {
+	leader, err := s.store.AcquireLease(LEASE_NAME, s.id, s.LeaseTTL)
+	if err != nil {
+		s.logger.Error("failed to acquire lease", "err", err)
+		leader = false
+	}
+	s.mu.Lock()
+	if leader != s.leader {
+		s.logger.Info("leadership changed", "leader", leader)
+	}
+	s.leader = leader
+	s.mu.Unlock()
+	if !leader {
+		return
+	}
+
+	tickers, err := s.store.ReturnDueTickers(now.Unix())
+	if err != nil {
+		s.logger.Error("failed to retrieve due tickers", "err", err)
+		return
+	}
+	for _, t := range tickers {
+		s.publish(t.Name)
+		next := s.nextRun(t.NextScrapeTime, s.intervalFor(t, now), now)
+		if err := s.store.SetNextScrapeTime(t.Id, next); err != nil {
+			s.logger.Error("failed to persist next run", "ticker", t.Name, "err", err)
+		}
+	}
+	if len(tickers) > 0 {
+		s.mu.Lock()
+		s.lastFired = now
+		s.mu.Unlock()
+	}
+}
+
+// Returns how long to wait between scrapes of a ticker. An
+// explicit interval wins over the priority tier's default. For
+// adaptive tickers, that interval is then stretched or shrunk
+// (by up to 4x) so that each scrape sees roughly
+// TARGET_STATEMENTS_PER_SCRAPE statements.
+func (s *Scheduler) intervalFor(t db.Ticker, now time.Time) time.Duration {
+	interval := time.Duration(t.ScrapeInterval) * time.Second
+	if interval == 0 {
+		switch t.Priority {
+		case db.PRIORITY_HIGH:
+			interval = s.Interval / 4
+		case db.PRIORITY_LOW:
+			interval = s.Interval * 4
+		default:
+			interval = s.Interval
+		}
+	}
+	if t.Adaptive {
+		var mentions float64
+		for _, m := range s.store.ReturnMentionHistory(t.Id, now.Unix()-ADAPTIVE_LOOKBACK_HOURS*3600) {
+			mentions += m.CurrentPrice
+		}
+		perHour := mentions / ADAPTIVE_LOOKBACK_HOURS
+		ideal := 4 * interval
+		if perHour > 0 {
+			ideal = time.Duration(TARGET_STATEMENTS_PER_SCRAPE / perHour * float64(time.Hour))
+		}
+		interval = clamp(ideal, interval/4, interval*4)
+	}
+	return clamp(interval, MIN_INTERVAL, MAX_INTERVAL)
+}
+
+func clamp(d, min, max time.Duration) time.Duration {
+	if d < min {
+		return min
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// Returns when a ticker that was due at `due` should next run.
+// The schedule advances from the due time rather than from now,
+// so it does not drift, but a ticker that is far behind (e.g.
+// after downtime) is not fired repeatedly to catch up.
+func (s *Scheduler) nextRun(due int64, interval time.Duration, now time.Time) int64 {
+	base := time.Unix(due, 0)
+	if due == 0 || now.Sub(base) > interval {
+		base = now
+	}
+	next := base.Add(interval)
+	// Jitter never exceeds a tenth of the interval, so that
+	// short intervals are not swamped by it.
+	jitter := s.Jitter
+	if jitter > interval/10 {
+		jitter = interval / 10
+	}
+	if jitter > 0 {
+		s.mu.Lock()
+		next = next.Add(time.Duration(s.rand.Int63n(int64(2*jitter))) - jitter)
+		s.mu.Unlock()
+	}
+	if !next.After(now) {
+		next = now.Add(s.Tick)
+	}
+	return next.Unix()
+}
+
+// Reports whether this instance currently holds the lease.
+func (s *Scheduler) IsLeader() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.leader
+}
+
+// Returns when this instance last published a scrape,
+// or the zero time if it never has.
+func (s *Scheduler) LastFired() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastFired
+}
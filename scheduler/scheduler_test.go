@@ -0,0 +1,141 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/logging"
+)
+
+type fakeStore struct {
+	holder   string
+	expires  time.Time
+	next     map[int]int64
+	tickers  db.TickerSlice
+	mentions map[int][]db.IntervalQuote
+}
+
+func (f *fakeStore) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	if f.holder == "" || f.holder == holder || time.Now().After(f.expires) {
+		f.holder, f.expires = holder, time.Now().Add(ttl)
+	}
+	return f.holder == holder, nil
+}
+
+func (f *fakeStore) ReleaseLease(name, holder string) error {
+	if f.holder == holder {
+		f.expires = time.Time{}
+	}
+	return nil
+}
+
+func (f *fakeStore) ReturnDueTickers(now int64) (db.TickerSlice, error) {
+	var due db.TickerSlice
+	for _, t := range f.tickers {
+		t.NextScrapeTime = f.next[t.Id]
+		if t.NextScrapeTime <= now {
+			due = append(due, t)
+		}
+	}
+	return due, nil
+}
+
+func (f *fakeStore) SetNextScrapeTime(id int, next int64) error {
+	f.next[id] = next
+	return nil
+}
+
+func (f *fakeStore) ReturnMentionHistory(id int, fromTime int64) []db.IntervalQuote {
+	return f.mentions[id]
+}
+
+func TestOnlyLeaderPublishes(t *testing.T) {
+	store := &fakeStore{
+		next:    map[int]int64{},
+		tickers: db.TickerSlice{{Id: 1, Name: "AMD"}, {Id: 2, Name: "GME"}},
+	}
+	var published []string
+	a := New(store, logging.Discard(), func(name string) { published = append(published, "a:"+name) })
+	b := New(store, logging.Discard(), func(name string) { published = append(published, "b:"+name) })
+
+	now := time.Now()
+	a.tick(now)
+	b.tick(now)
+	if len(published) != 2 || published[0] != "a:AMD" || published[1] != "a:GME" {
+		t.Fatalf("expected only the leader to publish each ticker once, got %v", published)
+	}
+	if !a.IsLeader() || b.IsLeader() {
+		t.Errorf("expected a to lead and b to follow")
+	}
+
+	// Nothing is due again until the next run.
+	a.tick(now.Add(time.Minute))
+	if len(published) != 2 {
+		t.Errorf("ticker fired again before its next run: %v", published)
+	}
+
+	// After the leader gives up its lease, b takes over.
+	store.ReleaseLease(LEASE_NAME, a.id)
+	b.tick(now.Add(2 * time.Minute))
+	if !b.IsLeader() {
+		t.Errorf("expected b to take over the released lease")
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	s := New(&fakeStore{}, logging.Discard(), nil)
+	s.Jitter = 0
+	now := time.Unix(10_000, 0)
+
+	if got := s.nextRun(now.Unix()-60, time.Hour, now); got != now.Unix()-60+3600 {
+		t.Errorf("expected the schedule to advance from the due time, got %d", got)
+	}
+	if got := s.nextRun(now.Unix()-5*3600, time.Hour, now); got != now.Unix()+3600 {
+		t.Errorf("expected a ticker far behind to be rescheduled from now, got %d", got)
+	}
+
+	s.Jitter = 5 * time.Minute
+	for i := 0; i < 100; i++ {
+		got := s.nextRun(0, time.Hour, now)
+		if got < now.Unix()+3600-300 || got >= now.Unix()+3600+300 {
+			t.Fatalf("next run %d is outside the jitter window", got)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		got := s.nextRun(0, 10*time.Minute, now)
+		if got < now.Unix()+600-60 || got >= now.Unix()+600+60 {
+			t.Fatalf("jitter on a short interval was not capped: %d", got)
+		}
+	}
+}
+
+func TestIntervalFor(t *testing.T) {
+	store := &fakeStore{mentions: map[int][]db.IntervalQuote{
+		// 600 mentions over the lookback, 100 an hour.
+		1: {{TimeStamp: 0, CurrentPrice: 300}, {TimeStamp: 3600, CurrentPrice: 300}},
+		// 6 mentions over the lookback, 1 an hour.
+		2: {{TimeStamp: 0, CurrentPrice: 6}},
+	}}
+	s := New(store, logging.Discard(), nil)
+	now := time.Unix(10_000, 0)
+
+	for _, tc := range []struct {
+		name   string
+		ticker db.Ticker
+		want   time.Duration
+	}{
+		{"normal tier", db.Ticker{Priority: db.PRIORITY_NORMAL}, time.Hour},
+		{"high tier", db.Ticker{Priority: db.PRIORITY_HIGH}, 15 * time.Minute},
+		{"low tier", db.Ticker{Priority: db.PRIORITY_LOW}, 4 * time.Hour},
+		{"explicit interval wins", db.Ticker{Priority: db.PRIORITY_HIGH, ScrapeInterval: 7200}, 2 * time.Hour},
+		{"below the minimum", db.Ticker{ScrapeInterval: 60}, MIN_INTERVAL},
+		{"busy adaptive ticker", db.Ticker{Id: 1, Adaptive: true}, 30 * time.Minute},
+		{"quiet adaptive ticker", db.Ticker{Id: 2, Adaptive: true}, 4 * time.Hour},
+		{"silent adaptive ticker", db.Ticker{Id: 3, Adaptive: true}, 4 * time.Hour},
+	} {
+		if got := s.intervalFor(tc.ticker, now); got != tc.want {
+			t.Errorf("%s: intervalFor() = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
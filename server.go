@@ -1,10 +1,9 @@
 package main
 
 import (
-	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
@@ -15,9 +14,14 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/jonreesman/watch-dog-kafka/api"
 	"github.com/jonreesman/watch-dog-kafka/db"
 	"github.com/jonreesman/watch-dog-kafka/kafka"
+	"github.com/jonreesman/watch-dog-kafka/logging"
+	"github.com/jonreesman/watch-dog-kafka/metrics"
 	"github.com/jonreesman/watch-dog-kafka/pb"
+	"github.com/jonreesman/watch-dog-kafka/symbology"
+	"github.com/jonreesman/watch-dog-kafka/tracing"
 )
 
 type Server struct {
@@ -25,54 +29,145 @@ type Server struct {
 	router         *gin.Engine
 	grpcServerConn *grpc.ClientConn
 	kafkaURL       string
+	bus            kafka.Bus
+	pool           *kafka.Pool
+	symbols        *symbology.Reference
+	mentions       *kafka.MentionCache
+	logger         *slog.Logger
+	monitor        monitor
 }
 
 // Creates and returns a server instance to main.
 // This server struct contains an instance of our
-// database manager, the Gin router, and the kafkaURL
-// so that it can produce messages in our Kafk topics.
-func NewServer(db db.DBManager, grpcServerConn *grpc.ClientConn, kafkaURL string) (*Server, error) {
+// database manager, the Gin router, the bus so that it
+// can produce messages in our Kafk topics, and
+// the consumer pool so that it can be resized.
+// New tickers are validated against symbols, and mentions is
+// refreshed when a ticker's metadata changes.
+// Reads are routed to the replicas by db. After an admin
+// write, the client's reads go to the primary for
+// readYourWrites.
+func NewServer(logger *slog.Logger, db db.DBManager, grpcServerConn *grpc.ClientConn, kafkaURL string, bus kafka.Bus, pool *kafka.Pool, symbols *symbology.Reference, mentions *kafka.MentionCache, readYourWrites time.Duration, m monitor) (*Server, error) {
 	var (
 		s Server
 	)
+	s.logger = logger.With("component", "api")
 	s.d = db
-	s.router = gin.Default()
+	// Requests are logged by our own middleware rather
+	// than Gin's, so that they carry a correlation id.
+	s.router = gin.New()
+	s.router.Use(gin.Recovery())
+	s.router.Use(logging.GinMiddleware(s.logger))
 	s.router.Use(cors.Default())
+	s.router.Use(metrics.GinMiddleware())
+	s.router.Use(tracing.GinMiddleware())
+	s.router.Use(readPrimaryMiddleware())
 	s.kafkaURL = kafkaURL
+	s.bus = bus
+	s.pool = pool
+	s.symbols = symbols
+	s.mentions = mentions
 	s.grpcServerConn = grpcServerConn
+	s.monitor = m
 
-	// Basic routing to generate our REST API handlers.
-	api := s.router.Group("/api")
+	// Prometheus scrape endpoint.
+	s.router.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	// Liveness and readiness probes.
+	s.router.GET("/healthz", s.healthzHandler)
+	s.router.GET("/readyz", s.readyzHandler)
+
+	// Basic routing to generate our REST API handlers. Every
+	// route must have its entry in api.ROUTES, which the OpenAPI
+	// document is generated from.
+	public := s.router.Group("/api")
 	{
-		api.GET("/", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{
-				"message": "pong",
-			})
+		public.GET("/", func(c *gin.Context) {
+			c.JSON(http.StatusOK, api.Ping{Message: "pong"})
 		})
-		api.GET("/tickers", s.returnTickersHandler)
-		api.GET("/tickers/:id/time/:interval", s.returnTickerHandler)
+		public.GET("/openapi.json", func(c *gin.Context) {
+			c.JSON(http.StatusOK, api.Spec())
+		})
+		public.GET("/status", s.statusHandler)
+		public.GET("/tickers", s.returnTickersHandler)
+		public.GET("/tickers/:id/time/:interval", s.returnTickerHandler)
+		public.GET("/tickers/:id/metadata", s.returnTickerMetadataHandler)
+		public.GET("/tickers/:id/related", s.returnRelatedTickersHandler)
+		public.GET("/tickers/:id/top-authors", s.returnTopAuthorsHandler)
+		public.GET("/trending", s.returnTrendingHandler)
+		public.GET("/export/:dataset", s.exportHandler)
+		public.GET("/statements/search", s.searchStatementsHandler)
 	}
 	auth := s.router.Group("/auth")
+	auth.Use(pinReadsMiddleware(readYourWrites))
 	{
 		auth.POST("/tickers/", s.newTickerHandler)
 		auth.DELETE("/tickers/:id", s.deactivateTickerHandler)
+		auth.PUT("/tickers/:id/schedule", s.updateTickerScheduleHandler)
+		auth.PUT("/tickers/:id/metadata", s.updateTickerMetadataHandler)
+		auth.GET("/alerts", s.returnAlertRulesHandler)
+		auth.POST("/alerts", s.newAlertRuleHandler)
+		auth.PUT("/alerts/:id", s.updateAlertRuleHandler)
+		auth.DELETE("/alerts/:id", s.deleteAlertRuleHandler)
+		auth.GET("/consumers", s.returnConsumersHandler)
+		auth.PUT("/consumers/:topic", s.resizeConsumersHandler)
 	}
 	return &s, nil
 }
 
-func (server *Server) startServer() error {
-	err := server.router.Run(":3100")
+func (server *Server) startServer(addr string) error {
+	err := server.router.Run(addr)
 	return err
 }
 
-// This errorResponse handler is deprecated and will be removed.
-func errorResponse(err error) gin.H {
-	return gin.H{"error": err.Error()}
+// Returns the logger for a request, which carries its
+// correlation id.
+func (server Server) requestLogger(c *gin.Context) *slog.Logger {
+	return logging.FromGin(c, server.logger)
+}
+
+// Set after an admin write. While it lasts, the client's
+// reads are served by the primary.
+const READ_PRIMARY_COOKIE = "watchdog_read_primary"
+
+// Sends the reads of a request carrying READ_PRIMARY_COOKIE to
+// the primary, through the request's context.
+func readPrimaryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, err := c.Cookie(READ_PRIMARY_COOKIE); err == nil {
+			c.Request = c.Request.WithContext(db.ReadYourWrites(c.Request.Context()))
+		}
+		c.Next()
+	}
+}
+
+// Sets READ_PRIMARY_COOKIE for window on every write, so that
+// an admin who just added a ticker sees it before the replicas
+// do. The cookie is set up front, as the response headers are
+// written by the handler.
+func pinReadsMiddleware(window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.SetCookie(READ_PRIMARY_COOKIE, "1", int(window/time.Second), "/", "", false, true)
+			c.Request = c.Request.WithContext(db.ReadYourWrites(c.Request.Context()))
+		}
+		c.Next()
+	}
+}
+
+// Returns err as the body of a failed request.
+func errorResponse(err error) api.Error {
+	return api.Error{Error: err.Error()}
 }
 
+// The body of a request whose id parameter is not a number.
+var INVALID_ID = api.Error{Error: "Invalid id."}
+
 // Recieves a stock ticker name as a string via a POST request
-// then validates whether it is a valid ticker prior to publishing
-// it to be added and scraped on the `add` Kafka topic.
+// then resolves it to its canonical symbol, so that `$btc`, `BTCUSD`
+// and `BTC-USD` are the same ticker, prior to publishing it to be
+// added and scraped on the `add` Kafka topic. Input that cannot be a
+// symbol is a 400, a symbol missing from the reference list a 404.
 /*
 	POST Request Form: http://[ip]:[port]/auth/tickers/
 	Request Body (JSON): "name": "[ticker name]"
@@ -80,19 +175,22 @@ func errorResponse(err error) gin.H {
 		"success": true
 */
 func (server Server) newTickerHandler(c *gin.Context) {
-	var input db.Ticker
-	fmt.Println(c.Request.Body)
+	var input api.NewTickerRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, errorResponse(err))
 		return
 	}
-	sanitizedTicker := SanitizeTicker(input.Name)
-
-	if !CheckTickerExists(sanitizedTicker) {
-		c.JSON(http.StatusNotFound, gin.H{"Id:": 0, "Name": "None"})
+	symbol, err := server.symbols.Resolve(input.Name)
+	if errors.Is(err, symbology.ErrUnknownSymbol) {
+		c.JSON(http.StatusNotFound, errorResponse(err))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
 	}
 
-	kafka.ProducerHandler(c, server.kafkaURL, kafka.ADD_TOPIC, sanitizedTicker)
+	kafka.ProducerHandler(c, server.bus, kafka.ADD_TOPIC, symbol.Symbol)
 }
 
 // Returns only active tickers when called with a GET request.
@@ -104,32 +202,32 @@ func (server Server) newTickerHandler(c *gin.Context) {
 			LastScrapeTime: [lastScrapeTime (UNIX)],
 			HourlySentiment: [current hourly senitment],
 			Id: [ticker ID from database],
-			Quote: [current stock price]
+			Quote: [current stock price],
+			ScrapeInterval: [seconds between scrapes, 0 for the priority default],
+			Priority: [low | normal | high],
+			Adaptive: [whether the interval follows mention volume]
 		}
 */
 func (server Server) returnTickersHandler(c *gin.Context) {
-	tickers, err := server.d.ReturnActiveTickers(c.Request.Context())
+	logger := server.requestLogger(c)
+	tickers, err := server.d.WithContext(c.Request.Context()).WithLogger(logger).ReturnActiveTickers(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, nil)
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
 		return
 	}
 	//Add current prices to tickers
-	type payloadItem struct {
-		Name            string
-		LastScrapeTime  time.Time
-		HourlySentiment float64
-		Id              int
-		Quote           float64
-	}
-	payload := make([]payloadItem, 0)
+	payload := make([]api.TickerSummary, 0)
 
 	for _, ticker := range tickers {
-		it := payloadItem{
+		it := api.TickerSummary{
 			Name:            ticker.Name,
 			LastScrapeTime:  ticker.LastScrapeTime,
 			HourlySentiment: ticker.HourlySentiment,
 			Id:              ticker.Id,
-			Quote:           priceCheck(ticker.Name),
+			Quote:           priceCheck(logger, ticker.Name),
+			ScrapeInterval:  ticker.ScrapeInterval,
+			Priority:        priorityNames[ticker.Priority],
+			Adaptive:        ticker.Adaptive,
 		}
 		payload = append(payload, it)
 	}
@@ -141,10 +239,17 @@ func (server Server) returnTickersHandler(c *gin.Context) {
 // as a param via GET request. It will gather all tweets, hourly sentiment
 // averages, and quotes for a given timespan and return it.
 /*
-	Request Form: http://[ip]:[port]/api/tickers/{id}/time/{timespan}
+	Request Form: http://[ip]:[port]/api/tickers/{id}/time/{timespan}[?bucket=15m][&weighting=influence]
 	Valid `timespans`: [`day`, `week`, `month`, `2month`]
+	With weighting=influence, each statement counts towards the
+	sentiment in proportion to its author's influence.
 	Response Form:
-		TO DO
+		"ticker": { Name, LastScrapeTime, Id },
+		"quote_history": [ { TimeStamp, CurrentPrice } ],
+		"sentiment_history": [ { TimeStamp, CurrentPrice: [sentiment] } ],
+		"statement_history": [
+			{ Expression, TimeStamp, Polarity, PermanentURL, ID, Likes, Replies, Retweets }
+		]
 */
 func (server Server) returnTickerHandler(c *gin.Context) {
 	var (
@@ -158,12 +263,14 @@ func (server Server) returnTickerHandler(c *gin.Context) {
 		err      error
 	)
 	if id, err = strconv.Atoi(c.Param("id")); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id."})
+		c.JSON(http.StatusBadRequest, INVALID_ID)
 		return
 	}
-	t, err = server.d.RetrieveTickerById(id)
+	logger := server.requestLogger(c).With("ticker_id", id)
+	d := server.d.WithContext(c.Request.Context()).WithLogger(logger)
+	t, err = d.RetrieveTickerById(id)
 	if err != nil {
-		log.Print("Unable to retieve ticker")
+		logger.Warn("unable to retrieve ticker", "err", err)
 	}
 	name = t.Name
 
@@ -184,21 +291,36 @@ func (server Server) returnTickerHandler(c *gin.Context) {
 
 	}
 
-	if tick, err = server.d.RetrieveTickerById(id); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to retrieve ticker"})
+	if tick, err = d.RetrieveTickerById(id); err != nil {
+		c.JSON(http.StatusBadRequest, api.Error{Error: "Failed to retrieve ticker"})
 		return
 	}
 
-	sentimentHistory := server.d.ReturnSentimentHistory(id, fromTime)
+	// Sentiment is hourly unless quarter hour buckets are requested
+	// and being recorded.
+	bucketSeconds := db.HOURLY_BUCKET
+	if c.Query("bucket") == "15m" {
+		bucketSeconds = db.QUARTER_HOUR_BUCKET
+	}
+	var sentimentHistory []db.IntervalQuote
+	switch c.Query("weighting") {
+	case "":
+		sentimentHistory = d.ReturnSentimentBuckets(id, fromTime, bucketSeconds)
+	case "influence":
+		sentimentHistory = d.ReturnWeightedSentimentBuckets(id, fromTime, bucketSeconds)
+	default:
+		c.JSON(http.StatusBadRequest, errorResponse(fmt.Errorf("unknown weighting %q, expected influence", c.Query("weighting"))))
+		return
+	}
 	client := pb.NewQuotesClient(server.grpcServerConn)
 	request := pb.QuoteRequest{
 		Name:   name,
 		Period: period,
 	}
-	response, err := client.Detect(context.Background(), &request)
+	response, err := client.Detect(c.Request.Context(), &request)
 	if err != nil {
-		log.Printf("returnTickerHandler(): GRPC Detect Error: %v", err)
-		c.JSON(http.StatusBadRequest, errorResponse(errors.New("Ticker symbol could not be found. If crypto, please try with the relative currency (eg. BTC-USD).")))
+		logger.Error("quote request failed", "ticker", name, "err", err)
+		c.JSON(http.StatusBadRequest, errorResponse(fmt.Errorf("quote history for %s could not be retrieved", name)))
 		return
 	}
 	quoteHistory := make([]db.IntervalQuote, 0)
@@ -206,14 +328,33 @@ func (server Server) returnTickerHandler(c *gin.Context) {
 		quoteHistory = append(quoteHistory, db.IntervalQuote{TimeStamp: quote.Time.Seconds, CurrentPrice: float64(quote.Price)})
 	}
 
-	statementHistory := server.d.ReturnAllStatements(id, fromTime)
+	history := api.TickerHistory{
+		Ticker:           api.Ticker{Name: tick.Name, LastScrapeTime: tick.LastScrapeTime, Id: tick.Id},
+		QuoteHistory:     points(quoteHistory),
+		SentimentHistory: points(sentimentHistory),
+		StatementHistory: make([]api.Statement, 0),
+	}
+	for _, s := range d.ReturnAllStatements(id, fromTime) {
+		history.StatementHistory = append(history.StatementHistory, api.Statement{
+			Expression:   s.Expression,
+			TimeStamp:    s.TimeStamp,
+			Polarity:     s.Polarity,
+			PermanentURL: s.PermanentURL,
+			ID:           s.ID,
+			Likes:        s.Likes,
+			Replies:      s.Replies,
+			Retweets:     s.Retweets,
+		})
+	}
+	c.JSON(http.StatusOK, history)
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"ticker":            tick,
-		"quote_history":     quoteHistory,
-		"sentiment_history": sentimentHistory,
-		"statement_history": statementHistory,
-	})
+func points(quotes []db.IntervalQuote) []api.Point {
+	out := make([]api.Point, 0, len(quotes))
+	for _, q := range quotes {
+		out = append(out, api.Point(q))
+	}
+	return out
 }
 
 // Deactivates the ticker for hourly scraping and display
@@ -230,9 +371,65 @@ func (server Server) deactivateTickerHandler(c *gin.Context) {
 		err error
 	)
 	if id, err = strconv.Atoi(c.Param("id")); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid id."})
+		c.JSON(http.StatusBadRequest, INVALID_ID)
 		return
 	}
 
-	kafka.ProducerHandler(c, server.kafkaURL, kafka.DELETE_TOPIC, strconv.Itoa(id))
+	kafka.ProducerHandler(c, server.bus, kafka.DELETE_TOPIC, strconv.Itoa(id))
+}
+
+var priorityNames = map[int]string{
+	db.PRIORITY_LOW:    "low",
+	db.PRIORITY_NORMAL: "normal",
+	db.PRIORITY_HIGH:   "high",
+}
+
+// Changes how often and how urgently a ticker is scraped.
+// An interval of 0 falls back to the priority tier's default.
+/*
+	PUT Request Form: http://[ip]:[port]/auth/tickers/{id}/schedule
+	Request Body (JSON):
+		"scrape_interval": [seconds, 0 or 300-86400],
+		"priority": [low | normal | high],
+		"adaptive": [true | false]
+	Response Form:
+		"success": true
+*/
+func (server Server) updateTickerScheduleHandler(c *gin.Context) {
+	var input api.ScheduleRequest
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, INVALID_ID)
+		return
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if input.ScrapeInterval != 0 && (input.ScrapeInterval < 300 || input.ScrapeInterval > 86400) {
+		c.JSON(http.StatusBadRequest, api.Error{Error: "scrape_interval must be 0 or between 300 and 86400 seconds."})
+		return
+	}
+	priority := db.PRIORITY_NORMAL
+	if input.Priority != "" {
+		found := false
+		for p, name := range priorityNames {
+			if name == input.Priority {
+				priority, found = p, true
+			}
+		}
+		if !found {
+			c.JSON(http.StatusBadRequest, api.Error{Error: "priority must be one of low, normal or high."})
+			return
+		}
+	}
+	if err := server.d.WithContext(c.Request.Context()).WithLogger(server.requestLogger(c)).UpdateTickerSchedule(id, input.ScrapeInterval, priority, input.Adaptive); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, db.ErrNoTicker) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, errorResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, api.Success{Success: true})
 }
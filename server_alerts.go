@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonreesman/watch-dog-kafka/alerts"
+	"github.com/jonreesman/watch-dog-kafka/api"
+	"github.com/jonreesman/watch-dog-kafka/db"
+)
+
+// Defines the JSON body accepted when creating or updating
+// an alert rule. See the alerts package for valid kinds and formats.
+type alertRuleInput api.AlertRuleRequest
+
+// The queries that manage alert rules.
+type alertStore interface {
+	RetrieveTickerById(tickerId int) (db.Ticker, error)
+	AddAlertRule(r db.AlertRule) (int, error)
+	UpdateAlertRule(r db.AlertRule, secret *string) error
+	DeleteAlertRule(id int) error
+}
+
+func (input alertRuleInput) toRule() db.AlertRule {
+	r := db.AlertRule{
+		TickerId:        input.TickerId,
+		Kind:            input.Kind,
+		Threshold:       input.Threshold,
+		WindowHours:     input.WindowHours,
+		CooldownSeconds: input.CooldownSeconds,
+		WebhookURL:      input.WebhookURL,
+		Format:          input.Format,
+		Active:          1,
+	}
+	if input.Secret != nil {
+		r.Secret = *input.Secret
+	}
+	if r.Format == "" {
+		r.Format = alerts.FORMAT_JSON
+	}
+	if input.Active != nil && !*input.Active {
+		r.Active = 0
+	}
+	return r
+}
+
+// Returns every configured alert rule. Webhook secrets are never returned.
+/*
+	GET Request Form: http://[ip]:[port]/auth/alerts
+	Response Form:
+		[ { Id, TickerId, Kind, Threshold, WindowHours, CooldownSeconds,
+			WebhookURL, Format, Active, LastFired, LastObserved } ]
+*/
+func (server Server) returnAlertRulesHandler(c *gin.Context) {
+	rules, err := server.d.WithContext(c.Request.Context()).WithLogger(server.requestLogger(c)).ReturnAlertRules()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	response := make([]api.AlertRule, 0, len(rules))
+	for _, r := range rules {
+		response = append(response, api.AlertRule{
+			Id:              r.Id,
+			TickerId:        r.TickerId,
+			Kind:            r.Kind,
+			Threshold:       r.Threshold,
+			WindowHours:     r.WindowHours,
+			CooldownSeconds: r.CooldownSeconds,
+			WebhookURL:      r.WebhookURL,
+			Format:          r.Format,
+			Active:          r.Active,
+			LastFired:       r.LastFired,
+			LastObserved:    r.LastObserved,
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Creates a new alert rule for a tracked ticker. A ticker that
+// does not exist is a 404.
+/*
+	POST Request Form: http://[ip]:[port]/auth/alerts
+	Request Body (JSON):
+		"ticker_id": [ticker ID], "kind": [sentiment_above | sentiment_below | volume_zscore | sentiment_flip],
+		"threshold": [float], "window_hours": [int], "cooldown_seconds": [int],
+		"webhook_url": [url], "format": [json | slack | discord], "secret": [HMAC secret]
+	Response Form:
+		"id": [rule ID]
+*/
+func (server Server) newAlertRuleHandler(c *gin.Context) {
+	newAlertRule(c, server.d.WithContext(c.Request.Context()).WithLogger(server.requestLogger(c)))
+}
+
+func newAlertRule(c *gin.Context, d alertStore) {
+	var input alertRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	rule := input.toRule()
+	if err := alerts.ValidateRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if _, err := d.RetrieveTickerById(rule.TickerId); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, db.ErrNoTicker) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, errorResponse(err))
+		return
+	}
+	id, err := d.AddAlertRule(rule)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	c.JSON(http.StatusCreated, api.Created{Id: id})
+}
+
+// Replaces an existing alert rule. The body has the same form
+// as when creating a rule, except that the secret is kept when
+// the body has none.
+/*
+	PUT Request Form: http://[ip]:[port]/auth/alerts/{id}
+	Response Form:
+		"success": true
+*/
+func (server Server) updateAlertRuleHandler(c *gin.Context) {
+	updateAlertRule(c, server.d.WithContext(c.Request.Context()).WithLogger(server.requestLogger(c)))
+}
+
+func updateAlertRule(c *gin.Context, d alertStore) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, INVALID_ID)
+		return
+	}
+	var input alertRuleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	rule := input.toRule()
+	rule.Id = id
+	if err := alerts.ValidateRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if err := d.UpdateAlertRule(rule, input.Secret); err != nil {
+		c.JSON(alertRuleStatus(err), errorResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, api.Success{Success: true})
+}
+
+// Deletes an alert rule.
+/*
+	DELETE Request Form: http://[ip]:[port]/auth/alerts/{id}
+	Response Form:
+		"success": true
+*/
+func (server Server) deleteAlertRuleHandler(c *gin.Context) {
+	deleteAlertRule(c, server.d.WithContext(c.Request.Context()).WithLogger(server.requestLogger(c)))
+}
+
+func deleteAlertRule(c *gin.Context, d alertStore) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, INVALID_ID)
+		return
+	}
+	if err := d.DeleteAlertRule(id); err != nil {
+		c.JSON(alertRuleStatus(err), errorResponse(err))
+		return
+	}
+	c.JSON(http.StatusOK, api.Success{Success: true})
+}
+
+// Returns the status of a request that failed to change a rule:
+// 404 if the rule does not exist and 500 for anything else.
+func alertRuleStatus(err error) int {
+	if errors.Is(err, db.ErrNoAlertRule) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
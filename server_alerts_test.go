@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonreesman/watch-dog-kafka/db"
+)
+
+// Keeps alert rules in memory the way the database would. Every
+// query fails with err if it is set.
+type fakeAlertStore struct {
+	tickers map[int]bool
+	rules   map[int]db.AlertRule
+	err     error
+}
+
+func newFakeAlertStore() *fakeAlertStore {
+	return &fakeAlertStore{tickers: map[int]bool{1: true}, rules: make(map[int]db.AlertRule)}
+}
+
+func (f *fakeAlertStore) RetrieveTickerById(tickerId int) (db.Ticker, error) {
+	if f.err != nil {
+		return db.Ticker{}, f.err
+	}
+	if !f.tickers[tickerId] {
+		return db.Ticker{}, db.ErrNoTicker
+	}
+	return db.Ticker{Id: tickerId}, nil
+}
+
+func (f *fakeAlertStore) AddAlertRule(r db.AlertRule) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+	r.Id = len(f.rules) + 1
+	f.rules[r.Id] = r
+	return r.Id, nil
+}
+
+func (f *fakeAlertStore) UpdateAlertRule(r db.AlertRule, secret *string) error {
+	if f.err != nil {
+		return f.err
+	}
+	old, ok := f.rules[r.Id]
+	if !ok {
+		return db.ErrNoAlertRule
+	}
+	r.Secret = old.Secret
+	if secret != nil {
+		r.Secret = *secret
+	}
+	f.rules[r.Id] = r
+	return nil
+}
+
+func (f *fakeAlertStore) DeleteAlertRule(id int) error {
+	if f.err != nil {
+		return f.err
+	}
+	if _, ok := f.rules[id]; !ok {
+		return db.ErrNoAlertRule
+	}
+	delete(f.rules, id)
+	return nil
+}
+
+func (f *fakeAlertStore) serve(method, path, body string) int {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/auth/alerts", func(c *gin.Context) { newAlertRule(c, f) })
+	router.PUT("/auth/alerts/:id", func(c *gin.Context) { updateAlertRule(c, f) })
+	router.DELETE("/auth/alerts/:id", func(c *gin.Context) { deleteAlertRule(c, f) })
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+	return w.Code
+}
+
+const alertRuleBody = `{"ticker_id": 1, "kind": "sentiment_above", "threshold": 0.5, "webhook_url": "https://example.com/hook"`
+
+func TestUpdateAlertRuleKeepsSecret(t *testing.T) {
+	f := newFakeAlertStore()
+	if code := f.serve(http.MethodPost, "/auth/alerts", alertRuleBody+`, "secret": "s3cret"}`); code != http.StatusCreated {
+		t.Fatalf("create returned %d", code)
+	}
+
+	// As sent after editing a rule from the list, which has no secret.
+	if code := f.serve(http.MethodPut, "/auth/alerts/1", alertRuleBody+`, "threshold": 0.7}`); code != http.StatusOK {
+		t.Fatalf("update returned %d", code)
+	}
+	if r := f.rules[1]; r.Secret != "s3cret" || r.Threshold != 0.7 {
+		t.Errorf("update without a secret stored %+v, want the secret kept", r)
+	}
+
+	if code := f.serve(http.MethodPut, "/auth/alerts/1", alertRuleBody+`, "secret": ""}`); code != http.StatusOK {
+		t.Fatalf("update returned %d", code)
+	}
+	if r := f.rules[1]; r.Secret != "" {
+		t.Errorf("update with an empty secret kept %q", r.Secret)
+	}
+}
+
+func TestAlertRuleStatus(t *testing.T) {
+	f := newFakeAlertStore()
+	f.serve(http.MethodPost, "/auth/alerts", alertRuleBody+`}`)
+	cases := []struct {
+		method, path, body string
+		err                error
+		want               int
+	}{
+		{http.MethodPost, "/auth/alerts", `{"ticker_id": 2, "kind": "sentiment_above", "webhook_url": "https://example.com"}`, nil, http.StatusNotFound},
+		{http.MethodPost, "/auth/alerts", `{"ticker_id": 1, "kind": "moon", "webhook_url": "https://example.com"}`, nil, http.StatusBadRequest},
+		{http.MethodPost, "/auth/alerts", alertRuleBody + `}`, errors.New("connection refused"), http.StatusInternalServerError},
+		{http.MethodPut, "/auth/alerts/9", alertRuleBody + `}`, nil, http.StatusNotFound},
+		{http.MethodPut, "/auth/alerts/1", `{"ticker_id": 1, "kind": "moon", "webhook_url": "https://example.com"}`, nil, http.StatusBadRequest},
+		{http.MethodPut, "/auth/alerts/1", alertRuleBody + `}`, errors.New("connection refused"), http.StatusInternalServerError},
+		{http.MethodDelete, "/auth/alerts/9", "", nil, http.StatusNotFound},
+		{http.MethodDelete, "/auth/alerts/x", "", nil, http.StatusBadRequest},
+		{http.MethodDelete, "/auth/alerts/1", "", errors.New("connection refused"), http.StatusInternalServerError},
+		{http.MethodDelete, "/auth/alerts/1", "", nil, http.StatusOK},
+	}
+	for _, tc := range cases {
+		f.err = tc.err
+		if code := f.serve(tc.method, tc.path, tc.body); code != tc.want {
+			t.Errorf("%s %s (err %v) returned %d, want %d", tc.method, tc.path, tc.err, code, tc.want)
+		}
+	}
+}
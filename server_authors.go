@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonreesman/watch-dog-kafka/api"
+)
+
+// Defaults and bounds of the top authors' query parameters.
+const (
+	DEFAULT_TOP_AUTHORS_WINDOW_HOURS = 7 * 24
+	MAX_TOP_AUTHORS_WINDOW_HOURS     = 60 * 24
+	DEFAULT_TOP_AUTHORS_LIMIT        = 10
+	MAX_TOP_AUTHORS_LIMIT            = 100
+)
+
+// Returns the authors who weighed most on a ticker's sentiment over
+// the last `window` hours: those whose influence times number of
+// statements about the ticker is highest.
+/*
+	GET Request Form: http://[ip]:[port]/api/tickers/{id}/top-authors?window=[hours, default 168]&limit=[default 10]
+	Response Form:
+		"ticker": [name],
+		"window_hours": [hours],
+		"authors": [
+			{ author_id, username, followers, joined, verified, statements, spam_statements, influence, profile_updated_at, ticker_statements, average_polarity }
+		]
+*/
+func (server Server) returnTopAuthorsHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, INVALID_ID)
+		return
+	}
+	hours, err := queryInt(c, "window", DEFAULT_TOP_AUTHORS_WINDOW_HOURS, 1, MAX_TOP_AUTHORS_WINDOW_HOURS)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	limit, err := queryInt(c, "limit", DEFAULT_TOP_AUTHORS_LIMIT, 1, MAX_TOP_AUTHORS_LIMIT)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	d := server.d.WithContext(c.Request.Context()).WithLogger(server.requestLogger(c))
+	tick, err := d.RetrieveTickerById(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, errorResponse(err))
+		return
+	}
+	authors, err := d.ReturnTopAuthors(id, time.Now().Add(-time.Duration(hours)*time.Hour).Unix(), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	top := api.TopAuthors{Ticker: tick.Name, WindowHours: hours, Authors: make([]api.TopAuthor, 0, len(authors))}
+	for _, a := range authors {
+		top.Authors = append(top.Authors, api.TopAuthor{
+			AuthorId:         a.AuthorId,
+			Username:         a.Username,
+			Followers:        a.Followers,
+			Joined:           a.Joined,
+			Verified:         a.Verified,
+			Statements:       a.Statements,
+			SpamStatements:   a.SpamStatements,
+			Influence:        a.Influence,
+			ProfileUpdatedAt: a.ProfileUpdatedAt,
+			TickerStatements: a.TickerStatements,
+			AveragePolarity:  a.AveragePolarity,
+		})
+	}
+	c.JSON(http.StatusOK, top)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonreesman/watch-dog-kafka/api"
+	"github.com/jonreesman/watch-dog-kafka/kafka"
+)
+
+// Returns the consumer workers of every topic.
+/*
+	GET Request Form: http://[ip]:[port]/auth/consumers
+	Response Form:
+		[ { topic, workers: [ { id, state, since, restarts, last_error } ] } ]
+*/
+func (server Server) returnConsumersHandler(c *gin.Context) {
+	topics := make([]api.TopicStatus, 0)
+	for _, t := range server.pool.Status() {
+		status := api.TopicStatus{Topic: t.Topic, Workers: make([]api.Worker, 0, len(t.Workers))}
+		for _, w := range t.Workers {
+			status.Workers = append(status.Workers, api.Worker(w))
+		}
+		topics = append(topics, status)
+	}
+	c.JSON(http.StatusOK, topics)
+}
+
+// Changes how many consumers run on a topic. The change lasts
+// until the process restarts, `kafka.consumers` in the config
+// sets the count at startup.
+/*
+	PUT Request Form: http://[ip]:[port]/auth/consumers/{topic}
+	Request Body (JSON): "workers": [0-64]
+	Response Form:
+		"success": true
+*/
+func (server Server) resizeConsumersHandler(c *gin.Context) {
+	var input api.ResizeConsumersRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if err := server.pool.Resize(c.Param("topic"), *input.Workers); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, kafka.ErrUnknownTopic) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, errorResponse(err))
+		return
+	}
+	server.requestLogger(c).Info("resized consumers", "topic", c.Param("topic"), "workers", *input.Workers)
+	c.JSON(http.StatusOK, api.Success{Success: true})
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/export"
+	"github.com/jonreesman/watch-dog-kafka/kafka"
+)
+
+// How far back an export reaches without a `from`.
+const DEFAULT_EXPORT_PERIOD = 7 * 24 * time.Hour
+
+// Streams the statements, sentiment buckets or quotes of tickers
+// over a time range as a CSV, NDJSON or Parquet file. Rows are
+// written as they are read from the database, so any range can be
+// exported. Statements appear once for every ticker they mention.
+/*
+	GET Request Form: http://[ip]:[port]/api/export/{statements | sentiments | quotes}?tickers=[AMD,GME, default all active]&from=[RFC3339, YYYY-MM-DD or unix seconds, default a week ago]&to=[default now]&format=[csv | ndjson | parquet, default csv]
+	Response Form:
+		A file with a row per statement, bucket or quote.
+		statements: ticker, ticker_id, tweet_id, time_stamp, expression, url, polarity, likes, replies, retweets, spam, author_id
+		sentiments: ticker, ticker_id, time_stamp, bucket_seconds, sentiment, weighted_sentiment, statements
+		quotes: ticker, ticker_id, time_stamp, price
+*/
+func (server Server) exportHandler(c *gin.Context) {
+	dataset := c.Param("dataset")
+	columns, ok := export.DATASETS[dataset]
+	if !ok {
+		c.JSON(http.StatusNotFound, errorResponse(fmt.Errorf("unknown dataset %q, expected statements, sentiments or quotes", dataset)))
+		return
+	}
+	format := c.DefaultQuery("format", "csv")
+	contentType, ok := export.FORMATS[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, errorResponse(fmt.Errorf("unknown format %q, expected csv, ndjson or parquet", format)))
+		return
+	}
+	fromTime, toTime, err := exportRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	logger := server.requestLogger(c)
+	d := server.d.WithContext(c.Request.Context()).WithLogger(logger)
+	ids, err := exportTickers(c.Request.Context(), d, c.Query("tickers"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, dataset, format))
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	out, err := export.NewWriter(c.Writer, format, columns)
+	if err == nil {
+		err = export.Export(d, dataset, ids, fromTime, toTime, out)
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	// The status is already sent, so all that can be done is to
+	// cut the file short.
+	if err != nil {
+		logger.Error("export failed", "dataset", dataset, "err", err)
+	}
+}
+
+// Parses an export's time range, defaulting to the week up to now.
+func exportRange(from, to string) (fromTime, toTime int64, err error) {
+	toTime = time.Now().Unix()
+	if to != "" {
+		if toTime, err = kafka.ParseBackfillTime(to); err != nil {
+			return 0, 0, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	fromTime = toTime - int64(DEFAULT_EXPORT_PERIOD/time.Second)
+	if from != "" {
+		if fromTime, err = kafka.ParseBackfillTime(from); err != nil {
+			return 0, 0, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if fromTime >= toTime {
+		return 0, 0, errors.New("from must be before to")
+	}
+	return fromTime, toTime, nil
+}
+
+// The queries that find the tickers an export or search is for.
+type tickerStore interface {
+	ReturnActiveTickers(ctx context.Context) (db.TickerSlice, error)
+	RetrieveTickerIDByName(tickerName string) (int, error)
+}
+
+// Returns the ids of a comma separated list of ticker names, or of
+// every active ticker if the list is empty.
+func exportTickers(ctx context.Context, d tickerStore, names string) ([]int, error) {
+	var ids []int
+	if names == "" {
+		active, err := d.ReturnActiveTickers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range active {
+			ids = append(ids, t.Id)
+		}
+		return ids, nil
+	}
+	for _, name := range strings.Split(names, ",") {
+		id, err := d.RetrieveTickerIDByName(strings.TrimSpace(name))
+		if err != nil {
+			return nil, fmt.Errorf("unknown ticker %s: %w", name, err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonreesman/watch-dog-kafka/api"
+	"github.com/jonreesman/watch-dog-kafka/graph"
+)
+
+// Defaults and bounds of the co-mention graph's query parameters.
+const (
+	DEFAULT_RELATED_WINDOW_HOURS = 24
+	MAX_RELATED_WINDOW_HOURS     = 30 * 24
+	DEFAULT_RELATED_LIMIT        = 10
+	DEFAULT_RELATED_MIN_WEIGHT   = 0.05
+)
+
+// Returns the tickers mentioned together with a ticker over the
+// last `window` hours and the cluster it belongs to. An edge's
+// weight is the share of statements mentioning either ticker that
+// mention both; lighter edges than min_weight are ignored. With
+// format=graphml or format=json, the graph of the ticker, its
+// neighbours and its cluster is returned as a file instead.
+/*
+	GET Request Form: http://[ip]:[port]/api/tickers/{id}/related?window=[hours, default 24]&limit=[default 10]&min_weight=[0 to 1, default 0.05]&format=[graphml | json]
+	Response Form:
+		"ticker": [name],
+		"window_hours": [hours],
+		"neighbors": [
+			{ ticker_id, name, mentions, weight }
+		],
+		"cluster": [
+			{ id, name, mentions, cluster }
+		]
+*/
+func (server Server) returnRelatedTickersHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, INVALID_ID)
+		return
+	}
+	hours, err := queryInt(c, "window", DEFAULT_RELATED_WINDOW_HOURS, 1, MAX_RELATED_WINDOW_HOURS)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	limit, err := queryInt(c, "limit", DEFAULT_RELATED_LIMIT, 1, 100)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	minWeight := DEFAULT_RELATED_MIN_WEIGHT
+	if s, ok := c.GetQuery("min_weight"); ok {
+		if minWeight, err = strconv.ParseFloat(s, 64); err != nil || minWeight < 0 || minWeight > 1 {
+			c.JSON(http.StatusBadRequest, errorResponse(errors.New("min_weight must be a number between 0 and 1")))
+			return
+		}
+	}
+	format := c.Query("format")
+	if format != "" && format != "graphml" && format != "json" {
+		c.JSON(http.StatusBadRequest, errorResponse(fmt.Errorf("unknown format %q, expected graphml or json", format)))
+		return
+	}
+
+	d := server.d.WithContext(c.Request.Context()).WithLogger(server.requestLogger(c))
+	tick, err := d.RetrieveTickerById(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, errorResponse(err))
+		return
+	}
+	pairs, err := d.ReturnCoMentions(time.Now().Add(-time.Duration(hours) * time.Hour).Unix())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	g := graph.New()
+	for _, p := range pairs {
+		g.Add(p.TickerA, p.NameA, p.TickerB, p.NameB, p.Mentions)
+	}
+	g.Finish(minWeight)
+
+	switch format {
+	case "graphml":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-related.graphml"`, tick.Name))
+		c.Header("Content-Type", "application/graphml+xml")
+		c.Status(http.StatusOK)
+		if err := g.Around(id).WriteGraphML(c.Writer); err != nil {
+			server.requestLogger(c).Error("failed to write graph", "err", err)
+		}
+		return
+	case "json":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-related.json"`, tick.Name))
+		c.Header("Content-Type", "application/json")
+		c.Status(http.StatusOK)
+		if err := g.Around(id).WriteJSON(c.Writer); err != nil {
+			server.requestLogger(c).Error("failed to write graph", "err", err)
+		}
+		return
+	}
+
+	related := api.RelatedTickers{Ticker: tick.Name, WindowHours: hours, Neighbors: []api.Neighbor{}, Cluster: []api.Node{}}
+	for _, n := range g.Neighbors(id) {
+		if len(related.Neighbors) == limit {
+			break
+		}
+		related.Neighbors = append(related.Neighbors, api.Neighbor(n))
+	}
+	for _, n := range g.Cluster(id) {
+		related.Cluster = append(related.Cluster, api.Node(n))
+	}
+	c.JSON(http.StatusOK, related)
+}
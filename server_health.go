@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonreesman/watch-dog-kafka/api"
+	"github.com/jonreesman/watch-dog-kafka/health"
+	"github.com/jonreesman/watch-dog-kafka/kafka"
+	"github.com/jonreesman/watch-dog-kafka/scheduler"
+)
+
+// Defines what the health and status endpoints report on.
+type monitor struct {
+	checker   *health.Checker
+	scheduler *scheduler.Scheduler
+	groupID   string
+}
+
+// Reports that the process is up and serving HTTP. It checks
+// no dependencies, so a failing database never gets the
+// process restarted.
+/*
+	GET Request Form: http://[ip]:[port]/healthz
+	Response Form:
+		"status": "ok"
+*/
+func (server Server) healthzHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, api.Health{Status: "ok"})
+}
+
+// Runs every dependency check. Responds 503 if any required
+// check fails, so that traffic is routed elsewhere.
+/*
+	GET Request Form: http://[ip]:[port]/readyz
+	Response Form:
+		"ready": [bool],
+		"checks": [ { name, ok, error, latency, optional } ]
+*/
+func (server Server) readyzHandler(c *gin.Context) {
+	report := server.monitor.checker.Run(c.Request.Context())
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	readiness := api.Readiness{Ready: report.Ready, Checks: make([]api.Check, 0, len(report.Checks))}
+	for _, r := range report.Checks {
+		readiness.Checks = append(readiness.Checks, api.Check(r))
+	}
+	c.JSON(status, readiness)
+}
+
+// Reports the state of the pipeline: when each active ticker
+// was last scraped, the consumer group and the scheduler.
+/*
+	GET Request Form: http://[ip]:[port]/api/status
+	Response Form:
+		"tickers": [ { id, name, last_scrape_time, since_last_scrape_seconds } ],
+		"consumer_group": { group_id, state, members } | "consumer_group_error": [error],
+		"scheduler": { leader, last_fired, since_last_fired_seconds },
+		"replicas": [ { url, serving, lag_seconds, error, checked_at } ]
+*/
+func (server Server) statusHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+	now := time.Now()
+	var response api.Status
+
+	tickers, err := server.d.WithContext(ctx).WithLogger(server.requestLogger(c)).ReturnActiveTickers(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	response.Tickers = make([]api.TickerStatus, 0, len(tickers))
+	for _, t := range tickers {
+		s := api.TickerStatus{Id: t.Id, Name: t.Name, LastScrapeTime: t.LastScrapeTime, SinceLastScrape: -1}
+		if t.LastScrapeTime.Unix() > 0 {
+			s.SinceLastScrape = int64(now.Sub(t.LastScrapeTime) / time.Second)
+		}
+		response.Tickers = append(response.Tickers, s)
+	}
+
+	group, err := kafka.DescribeGroup(ctx, server.kafkaURL, server.monitor.groupID)
+	if err != nil {
+		response.ConsumerGroupError = err.Error()
+	} else {
+		response.ConsumerGroup = &api.ConsumerGroup{GroupID: group.GroupID, State: group.State, Members: make([]api.GroupMember, 0, len(group.Members))}
+		for _, m := range group.Members {
+			response.ConsumerGroup.Members = append(response.ConsumerGroup.Members, api.GroupMember(m))
+		}
+	}
+
+	// The scheduler only fires on the instance holding the
+	// lease, so other instances report that they are followers.
+	if sched := server.monitor.scheduler; sched != nil {
+		s := api.SchedulerStatus{Leader: sched.IsLeader(), SinceLastFired: -1}
+		if last := sched.LastFired(); !last.IsZero() {
+			s.LastFired = &last
+			s.SinceLastFired = int64(now.Sub(last) / time.Second)
+		}
+		response.Scheduler = &s
+	}
+	response.Replicas = make([]api.Replica, 0)
+	for _, r := range server.d.Replicas() {
+		response.Replicas = append(response.Replicas, api.Replica(r))
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonreesman/watch-dog-kafka/api"
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/kafka"
+	"github.com/jonreesman/watch-dog-kafka/symbology"
+)
+
+// Limits on what an admin may store as a ticker's metadata,
+// so that it fits the table and a source's query length.
+const (
+	MAX_METADATA_TERMS       = 20
+	MAX_METADATA_TERM_LENGTH = 64
+)
+
+// Defines the JSON body accepted when editing a ticker's metadata.
+type tickerMetadataInput api.TickerMetadataRequest
+
+// Checks the input and returns it as metadata for tickerId, with
+// terms trimmed, deduplicated and the cashtag in upper case.
+func (input tickerMetadataInput) toMetadata(tickerId int) (db.TickerMetadata, error) {
+	m := db.TickerMetadata{TickerId: tickerId, CompanyName: strings.TrimSpace(input.CompanyName)}
+	if len(m.CompanyName) > 255 {
+		return m, errors.New("company_name must be at most 255 characters")
+	}
+	if input.Cashtag != "" {
+		m.Cashtag = "$" + symbology.Normalize(input.Cashtag)
+		if !symbology.Valid(m.Cashtag[1:]) {
+			return m, fmt.Errorf("cashtag %q is not a symbol", input.Cashtag)
+		}
+	}
+	var err error
+	if m.Aliases, err = terms("aliases", input.Aliases); err != nil {
+		return m, err
+	}
+	if m.NegativeKeywords, err = terms("negative_keywords", input.NegativeKeywords); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+func terms(field string, input []string) ([]string, error) {
+	if len(input) > MAX_METADATA_TERMS {
+		return nil, fmt.Errorf("%s may have at most %d entries", field, MAX_METADATA_TERMS)
+	}
+	out := make([]string, 0, len(input))
+	seen := make(map[string]bool)
+	for _, t := range input {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			return nil, fmt.Errorf("%s must not contain empty entries", field)
+		}
+		if len(t) > MAX_METADATA_TERM_LENGTH {
+			return nil, fmt.Errorf("%s entries must be at most %d characters", field, MAX_METADATA_TERM_LENGTH)
+		}
+		if !seen[strings.ToLower(t)] {
+			seen[strings.ToLower(t)] = true
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// Returns a ticker's metadata and the search query the sources
+// build from it. A ticker that was never edited returns the
+// defaults from the symbol reference list.
+/*
+	GET Request Form: http://[ip]:[port]/api/tickers/{id}/metadata
+	Response Form:
+		"metadata": { ticker_id, company_name, aliases, cashtag, negative_keywords },
+		"search_query": [query, e.g. (AMD OR $AMD OR "Advanced Micro Devices") -amd64]
+*/
+func (server Server) returnTickerMetadataHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, INVALID_ID)
+		return
+	}
+	d := server.d.WithContext(c.Request.Context()).WithLogger(server.requestLogger(c))
+	tick, err := d.RetrieveTickerById(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, errorResponse(err))
+		return
+	}
+	m, err := d.RetrieveTickerMetadata(id)
+	if errors.Is(err, db.ErrNoMetadata) {
+		m = kafka.DefaultMetadata(server.symbols, id, tick.Name)
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	response := api.TickerMetadataResponse{Metadata: api.TickerMetadata(m), SearchQuery: kafka.SearchQuery(tick.Name, m).Search()}
+	if response.Metadata.Aliases == nil {
+		response.Metadata.Aliases = []string{}
+	}
+	if response.Metadata.NegativeKeywords == nil {
+		response.Metadata.NegativeKeywords = []string{}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Replaces a ticker's metadata. It is used from the ticker's
+// next scrape on.
+/*
+	PUT Request Form: http://[ip]:[port]/auth/tickers/{id}/metadata
+	Request Body (JSON):
+		"company_name": [name], "aliases": [list], "cashtag": [e.g. $AMD],
+		"negative_keywords": [list]
+	Response Form:
+		"success": true
+*/
+func (server Server) updateTickerMetadataHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, INVALID_ID)
+		return
+	}
+	var input tickerMetadataInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	m, err := input.toMetadata(id)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	d := server.d.WithContext(c.Request.Context()).WithLogger(server.requestLogger(c))
+	if _, err := d.RetrieveTickerById(id); err != nil {
+		c.JSON(http.StatusNotFound, errorResponse(err))
+		return
+	}
+	if err := d.UpsertTickerMetadata(m); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	server.mentions.Refresh()
+	c.JSON(http.StatusOK, api.Success{Success: true})
+}
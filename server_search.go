@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonreesman/watch-dog-kafka/api"
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/kafka"
+)
+
+// Defaults and bounds of the search's page size.
+const (
+	DEFAULT_SEARCH_LIMIT = 20
+	MAX_SEARCH_LIMIT     = 100
+)
+
+// The queries a search makes.
+type searchStore interface {
+	tickerStore
+	SearchStatements(search db.StatementSearch) ([]db.SearchResult, error)
+}
+
+// Searches stored statements for words and "quoted phrases", all of
+// which must appear. A leading - excludes a word or phrase and a
+// trailing * matches words starting with it. Results are ranked by
+// relevance, or newest first without q or when q only excludes
+// (so "-puts" returns every statement without puts), and filtered by ticker,
+// source, time range, polarity, spam and engagement (likes, replies
+// and retweets combined). Pass next_cursor back as cursor, with the
+// same filters, for the next page; it is empty on the last page.
+/*
+	GET Request Form: http://[ip]:[port]/api/statements/search?q=[earnings "beat estimates"]&tickers=[AMD,GME]&source=[Twitter]&from=[RFC3339, YYYY-MM-DD or unix seconds]&to=[...]&min_polarity=[-1 to 1]&max_polarity=[-1 to 1]&spam=[true | false]&min_engagement=[n]&limit=[default 20, max 100]&cursor=[next_cursor]
+	Response Form:
+		"results": [
+			{ tweet_id, time_stamp, expression, url, polarity, likes, replies, retweets, spam, source, tickers, relevance }
+		],
+		"next_cursor": [cursor, or "" on the last page]
+*/
+func (server Server) searchStatementsHandler(c *gin.Context) {
+	searchStatements(c, server.d.WithContext(c.Request.Context()).WithLogger(server.requestLogger(c)))
+}
+
+func searchStatements(c *gin.Context, d searchStore) {
+	search, err := parseSearch(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	if names := c.Query("tickers"); names != "" {
+		if search.TickerIds, err = exportTickers(c.Request.Context(), d, names); err != nil {
+			c.JSON(http.StatusBadRequest, errorResponse(err))
+			return
+		}
+	}
+
+	// One more than asked for tells whether there is another page.
+	limit := search.Limit
+	search.Limit++
+	results, err := d.SearchStatements(search)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	var response api.SearchResponse
+	if len(results) > limit {
+		results = results[:limit]
+		response.NextCursor = encodeCursor(results[limit-1].Cursor())
+	}
+	response.Results = make([]api.SearchResult, 0, len(results))
+	for _, r := range results {
+		response.Results = append(response.Results, api.SearchResult(r))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Reads a search's query parameters, all but its tickers.
+func parseSearch(c *gin.Context) (db.StatementSearch, error) {
+	search := db.StatementSearch{Text: c.Query("q"), Source: c.Query("source")}
+	var err error
+	if s := c.Query("from"); s != "" {
+		if search.FromTime, err = kafka.ParseBackfillTime(s); err != nil {
+			return search, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if s := c.Query("to"); s != "" {
+		if search.ToTime, err = kafka.ParseBackfillTime(s); err != nil {
+			return search, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	if search.MinPolarity, err = queryPolarity(c, "min_polarity"); err != nil {
+		return search, err
+	}
+	if search.MaxPolarity, err = queryPolarity(c, "max_polarity"); err != nil {
+		return search, err
+	}
+	if s, ok := c.GetQuery("spam"); ok {
+		spam, err := strconv.ParseBool(s)
+		if err != nil {
+			return search, errors.New("spam must be true or false")
+		}
+		search.Spam = &spam
+	}
+	if search.MinEngagement, err = queryInt(c, "min_engagement", 0, 0, math.MaxInt32); err != nil {
+		return search, err
+	}
+	if search.Limit, err = queryInt(c, "limit", DEFAULT_SEARCH_LIMIT, 1, MAX_SEARCH_LIMIT); err != nil {
+		return search, err
+	}
+	if s := c.Query("cursor"); s != "" {
+		cursor, err := decodeCursor(s)
+		if err != nil || cursor.TweetId == 0 {
+			return search, errors.New("invalid cursor")
+		}
+		search.After = &cursor
+	}
+	return search, nil
+}
+
+// Returns the polarity in a query parameter, or nil if it is absent.
+func queryPolarity(c *gin.Context, name string) (*float64, error) {
+	s, ok := c.GetQuery(name)
+	if !ok {
+		return nil, nil
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < -1 || v > 1 {
+		return nil, fmt.Errorf("%s must be a number between -1 and 1", name)
+	}
+	return &v, nil
+}
+
+func encodeCursor(cursor db.SearchCursor) string {
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (db.SearchCursor, error) {
+	var cursor db.SearchCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(b, &cursor)
+	return cursor, err
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonreesman/watch-dog-kafka/api"
+	"github.com/jonreesman/watch-dog-kafka/db"
+)
+
+// Searches statements in memory the way the database would, and
+// records every search asked of it.
+type fakeSearchStore struct {
+	tickers    map[string]int
+	statements []db.SearchResult
+	searches   []db.StatementSearch
+}
+
+func (f *fakeSearchStore) ReturnActiveTickers(ctx context.Context) (db.TickerSlice, error) {
+	var tickers db.TickerSlice
+	for name, id := range f.tickers {
+		tickers = append(tickers, db.Ticker{Id: id, Name: name})
+	}
+	return tickers, nil
+}
+
+func (f *fakeSearchStore) RetrieveTickerIDByName(tickerName string) (int, error) {
+	id, ok := f.tickers[tickerName]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	return id, nil
+}
+
+// Filters on everything but the text, and ranks by the statements'
+// own relevance when there is text to match.
+func (f *fakeSearchStore) SearchStatements(search db.StatementSearch) ([]db.SearchResult, error) {
+	f.searches = append(f.searches, search)
+	ranked := db.BooleanQuery(search.Text) != ""
+	results := []db.SearchResult{}
+	for _, r := range f.statements {
+		if !ranked {
+			r.Relevance = 0
+		}
+		if f.matches(search, r) && (search.After == nil || searchedBefore(*search.After, r.Cursor(), ranked)) {
+			results = append(results, r)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return searchedBefore(results[i].Cursor(), results[j].Cursor(), ranked)
+	})
+	if len(results) > search.Limit {
+		results = results[:search.Limit]
+	}
+	return results, nil
+}
+
+func (f *fakeSearchStore) matches(search db.StatementSearch, r db.SearchResult) bool {
+	if len(search.TickerIds) > 0 {
+		found := false
+		for _, name := range r.Tickers {
+			for _, id := range search.TickerIds {
+				found = found || f.tickers[name] == id
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	engagement := r.Likes + r.Replies + r.Retweets
+	return (search.Source == "" || r.Source == search.Source) &&
+		(search.FromTime == 0 || r.TimeStamp >= search.FromTime) &&
+		(search.ToTime == 0 || r.TimeStamp < search.ToTime) &&
+		(search.MinPolarity == nil || r.Polarity >= *search.MinPolarity) &&
+		(search.MaxPolarity == nil || r.Polarity <= *search.MaxPolarity) &&
+		(search.Spam == nil || r.Spam == *search.Spam) &&
+		engagement >= search.MinEngagement
+}
+
+// Whether a comes before b in the order the database returns
+// results: by relevance or time, then by tweet id, both descending.
+func searchedBefore(a, b db.SearchCursor, ranked bool) bool {
+	if ranked && math.Abs(a.Relevance-b.Relevance) >= db.RELEVANCE_EPSILON {
+		return a.Relevance > b.Relevance
+	}
+	if !ranked && a.TimeStamp != b.TimeStamp {
+		return a.TimeStamp > b.TimeStamp
+	}
+	return a.TweetId > b.TweetId
+}
+
+func newFakeSearchStore() *fakeSearchStore {
+	return &fakeSearchStore{
+		tickers: map[string]int{"AMD": 1, "GME": 2, "TSLA": 3},
+		statements: []db.SearchResult{
+			{TweetId: 101, TimeStamp: 1000, Polarity: 0.5, Likes: 10, Source: "Twitter", Tickers: []string{"AMD"}, Relevance: 2},
+			{TweetId: 102, TimeStamp: 1000, Polarity: -0.2, Source: "Twitter", Tickers: []string{"AMD", "GME"}, Relevance: 2},
+			{TweetId: 103, TimeStamp: 1000, Polarity: 0.9, Spam: true, Likes: 50, Source: "Twitter", Tickers: []string{"GME"}, Relevance: 2},
+			{TweetId: 104, TimeStamp: 2000, Polarity: 0.1, Replies: 4, Retweets: 8, Source: "Reddit", Tickers: []string{"AMD"}, Relevance: 1},
+			{TweetId: 105, TimeStamp: 3000, Polarity: 0, Source: "Twitter", Tickers: []string{"TSLA"}, Relevance: 3},
+			{TweetId: 106, TimeStamp: 3000, Polarity: 0.3, Likes: 1, Source: "Twitter", Tickers: []string{"GME"}, Relevance: 1},
+			{TweetId: 107, TimeStamp: 500, Polarity: -0.8, Likes: 100, Source: "Twitter", Tickers: []string{"AMD"}, Relevance: 2},
+		},
+	}
+}
+
+func (f *fakeSearchStore) serve(query string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/statements/search", func(c *gin.Context) { searchStatements(c, f) })
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/statements/search?"+query, nil))
+	return w
+}
+
+// Returns the ids of every result of a search, following its
+// cursors a page at a time.
+func (f *fakeSearchStore) searchAll(t *testing.T, query string) []uint64 {
+	var (
+		ids    []uint64
+		cursor string
+	)
+	for page := 0; page < 10; page++ {
+		q := query
+		if cursor != "" {
+			q += "&cursor=" + cursor
+		}
+		w := f.serve(q)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d %s", q, w.Code, w.Body)
+		}
+		var response api.SearchResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range response.Results {
+			ids = append(ids, r.TweetId)
+		}
+		if cursor = response.NextCursor; cursor == "" {
+			return ids
+		}
+	}
+	t.Fatalf("%s: cursor never ran out", query)
+	return nil
+}
+
+func TestSearchPagination(t *testing.T) {
+	f := newFakeSearchStore()
+	cases := map[string][]uint64{
+		// Newest first, ties on the time stamp broken by id.
+		"limit=2": {106, 105, 104, 103, 102, 101, 107},
+		"limit=1": {106, 105, 104, 103, 102, 101, 107},
+		"limit=7": {106, 105, 104, 103, 102, 101, 107},
+		"":        {106, 105, 104, 103, 102, 101, 107},
+		// Most relevant first, ties on relevance broken by id.
+		"q=earnings&limit=2": {105, 107, 103, 102, 101, 106, 104},
+		"q=earnings&limit=3": {105, 107, 103, 102, 101, 106, 104},
+	}
+	for query, want := range cases {
+		if got := f.searchAll(t, query); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", query, got, want)
+		}
+	}
+
+	// One more than the limit is asked for, to tell whether there
+	// is another page, and a full last page has no cursor.
+	f.searches = nil
+	w := f.serve("limit=7")
+	if f.searches[0].Limit != 8 || w.Code != http.StatusOK {
+		t.Errorf("asked for %d", f.searches[0].Limit)
+	}
+	var response api.SearchResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if len(response.Results) != 7 || response.NextCursor != "" {
+		t.Errorf("got %d results and cursor %q", len(response.Results), response.NextCursor)
+	}
+
+	// Nothing found is an empty list rather than null.
+	if w := f.serve("tickers=TSLA&source=Reddit"); w.Body.String() != `{"results":[],"next_cursor":""}` {
+		t.Errorf("got %s", w.Body)
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	f := newFakeSearchStore()
+	positive, mixed, spam := 0.0, 0.4, false
+	cases := []struct {
+		query  string
+		search db.StatementSearch
+		ids    []uint64
+	}{
+		{
+			query:  "tickers=AMD",
+			search: db.StatementSearch{TickerIds: []int{1}},
+			ids:    []uint64{104, 102, 101, 107},
+		},
+		{
+			query:  "tickers=AMD,GME&spam=false&min_polarity=0",
+			search: db.StatementSearch{TickerIds: []int{1, 2}, Spam: &spam, MinPolarity: &positive},
+			ids:    []uint64{106, 104, 101},
+		},
+		{
+			query:  "source=Twitter&min_engagement=10&max_polarity=0.4",
+			search: db.StatementSearch{Source: "Twitter", MinEngagement: 10, MaxPolarity: &mixed},
+			ids:    []uint64{107},
+		},
+		{
+			query:  "from=1000&to=3000&tickers=AMD",
+			search: db.StatementSearch{TickerIds: []int{1}, FromTime: 1000, ToTime: 3000},
+			ids:    []uint64{104, 102, 101},
+		},
+		{
+			query:  "from=1970-01-01T00:16:40Z&to=2000&min_polarity=0&max_polarity=0.4&spam=false",
+			search: db.StatementSearch{FromTime: 1000, ToTime: 2000, MinPolarity: &positive, MaxPolarity: &mixed, Spam: &spam},
+			ids:    []uint64{},
+		},
+		{
+			// Excluding alone is searched for, not rejected.
+			query:  "q=-puts&source=Reddit",
+			search: db.StatementSearch{Text: "-puts", Source: "Reddit"},
+			ids:    []uint64{104},
+		},
+	}
+	for _, c := range cases {
+		f.searches = nil
+		w := f.serve(c.query)
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: got %d %s", c.query, w.Code, w.Body)
+			continue
+		}
+		c.search.Limit = DEFAULT_SEARCH_LIMIT + 1
+		if !reflect.DeepEqual(f.searches[0], c.search) {
+			t.Errorf("%s: searched %+v, want %+v", c.query, f.searches[0], c.search)
+		}
+		var response api.SearchResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		ids := []uint64{}
+		for _, r := range response.Results {
+			ids = append(ids, r.TweetId)
+		}
+		if !reflect.DeepEqual(ids, c.ids) {
+			t.Errorf("%s: got %v, want %v", c.query, ids, c.ids)
+		}
+	}
+}
+
+func TestSearchCursor(t *testing.T) {
+	cursors := []db.SearchCursor{
+		{TimeStamp: 1650000000, TweetId: 1600000000000000001},
+		{Relevance: 0.1 + 0.2, TweetId: math.MaxUint64},
+		{TweetId: 1},
+	}
+	for _, want := range cursors {
+		got, err := decodeCursor(encodeCursor(want))
+		if err != nil || got != want {
+			t.Errorf("decoded %+v, %v, want %+v", got, err, want)
+		}
+	}
+
+	// The filters are searched for again with the cursor, which
+	// carries on from the last result.
+	f := newFakeSearchStore()
+	f.serve("tickers=GME&limit=1")
+	w := f.serve("tickers=GME&limit=1&cursor=" + encodeCursor(db.SearchCursor{TimeStamp: 3000, TweetId: 106}))
+	if w.Code != http.StatusOK || f.searches[1].After == nil || *f.searches[1].After != (db.SearchCursor{TimeStamp: 3000, TweetId: 106}) {
+		t.Fatalf("got %d %s after %+v", w.Code, w.Body, f.searches[1].After)
+	}
+
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+	valid := encodeCursor(db.SearchCursor{TimeStamp: 1000, TweetId: 102})
+	bad := map[string]string{
+		"not base64":      "!!!",
+		"padded":          valid + "==",
+		"truncated":       valid[:len(valid)-3],
+		"not json":        encode("cursor"),
+		"json array":      encode(`[1000,102]`),
+		"numeric id":      encode(`{"t":1000,"id":102}`),
+		"non-numeric id":  encode(`{"t":1000,"id":"abc"}`),
+		"negative id":     encode(`{"t":1000,"id":"-1"}`),
+		"missing id":      encode(`{"t":1000}`),
+		"wrong time type": encode(`{"t":"1000","id":"102"}`),
+	}
+	for name, cursor := range bad {
+		f.searches = nil
+		if w := f.serve("cursor=" + cursor); w.Code != http.StatusBadRequest || len(f.searches) != 0 {
+			t.Errorf("%s cursor: got %d %s", name, w.Code, w.Body)
+		}
+	}
+}
+
+func TestSearchInvalid(t *testing.T) {
+	f := newFakeSearchStore()
+	for _, query := range []string{
+		"limit=0",
+		"limit=101",
+		"limit=ten",
+		"min_polarity=1.5",
+		"max_polarity=-2",
+		"min_polarity=high",
+		"spam=maybe",
+		"min_engagement=-1",
+		"from=yesterday",
+		"to=2022-13-01",
+		"tickers=AMD,NOPE",
+	} {
+		if w := f.serve(query); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d %s", query, w.Code, w.Body)
+		}
+	}
+	if len(f.searches) != 0 {
+		t.Errorf("searched %d times", len(f.searches))
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jonreesman/watch-dog-kafka/api"
+	"github.com/jonreesman/watch-dog-kafka/trending"
+)
+
+// Most trends returned by a single request.
+const MAX_TRENDING_LIMIT = 100
+
+// Lists the symbols no ticker tracks that are mentioned in scraped
+// statements more than usual, fastest rising first. Velocity is
+// the mentions in the window over the symbol's own baseline for a
+// window of that length, taken from the previous week.
+/*
+	GET Request Form: http://[ip]:[port]/api/trending?window=[hours, default 1, at most 24]&limit=[default 20]&min_mentions=[default 5]
+	Response Form:
+		"window_hours": [hours],
+		"trending": [
+			{ symbol, name, asset_class, mentions, baseline, velocity }
+		]
+*/
+func (server Server) returnTrendingHandler(c *gin.Context) {
+	hours, err := queryInt(c, "window", int(trending.DEFAULT_WINDOW/time.Hour), 1, int(trending.MAX_WINDOW/time.Hour))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	limit, err := queryInt(c, "limit", 20, 1, MAX_TRENDING_LIMIT)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	minMentions, err := queryInt(c, "min_mentions", trending.MIN_MENTIONS, 1, 1<<20)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(err))
+		return
+	}
+	d := server.d.WithContext(c.Request.Context()).WithLogger(server.requestLogger(c))
+	trends, err := trending.Trending(c.Request.Context(), d, server.symbols, time.Now(), time.Duration(hours)*time.Hour, minMentions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		return
+	}
+	if len(trends) > limit {
+		trends = trends[:limit]
+	}
+	response := api.Trending{WindowHours: hours, Trending: make([]api.Trend, 0, len(trends))}
+	for _, t := range trends {
+		response.Trending = append(response.Trending, api.Trend(t))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Returns the integer query parameter name, or def if it is
+// absent, checking that it lies in [min, max].
+func queryInt(c *gin.Context, name string, def, min, max int) (int, error) {
+	s, ok := c.GetQuery(name)
+	if !ok {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < min || n > max {
+		return 0, fmt.Errorf("%s must be a whole number between %d and %d", name, min, max)
+	}
+	return n, nil
+}
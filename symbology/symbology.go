@@ -0,0 +1,203 @@
+package symbology
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// The asset classes a symbol may belong to.
+const (
+	EQUITY = "equity"
+	ETF    = "etf"
+	CRYPTO = "crypto"
+)
+
+// The currency a crypto symbol is quoted in when none is given.
+const DEFAULT_QUOTE_CURRENCY = "USD"
+
+var (
+	// Returned by Resolve() for input that cannot be a symbol.
+	ErrInvalidSymbol = errors.New("invalid symbol")
+	// Returned by Resolve() for a well formed symbol that is
+	// not in the reference list.
+	ErrUnknownSymbol = errors.New("unknown symbol")
+)
+
+// Canonical symbols are upper case letters and digits, with an
+// optional share class (BRK.B) or currency pair (BTC-USD) suffix.
+var validSymbol = regexp.MustCompile(`^[A-Z0-9]{1,12}([.-][A-Z0-9]{1,12})?$`)
+
+// The reference list shipped with the binary.
+//
+//go:embed reference.csv
+var builtin []byte
+
+// A tradable symbol as listed in the reference list.
+type Symbol struct {
+	Symbol     string `json:"symbol"`
+	Name       string `json:"name"`
+	AssetClass string `json:"asset_class"`
+	Exchange   string `json:"exchange"`
+}
+
+// Legal suffixes and share classes that people leave out when
+// they write a company's name.
+var nameSuffixes = []string{" Class A", " Class B", " Class C", " Inc.", " Corp.", " Ltd.", " Co.", " plc"}
+
+// Returns the name the symbol is usually referred to by, such as
+// "Advanced Micro Devices" for "Advanced Micro Devices Inc.".
+func (s Symbol) CommonName() string {
+	name := s.Name
+	for trimmed := true; trimmed; {
+		trimmed = false
+		for _, suffix := range nameSuffixes {
+			if strings.HasSuffix(name, suffix) {
+				name = strings.TrimSuffix(name, suffix)
+				trimmed = true
+			}
+		}
+	}
+	return strings.TrimPrefix(strings.TrimSuffix(name, ","), "The ")
+}
+
+// Returns the cashtag the symbol is written as on social media,
+// which for a crypto pair is that of its base, such as $BTC.
+func (s Symbol) Cashtag() string {
+	if s.AssetClass == CRYPTO {
+		base, _, _ := strings.Cut(s.Symbol, "-")
+		return "$" + base
+	}
+	return "$" + s.Symbol
+}
+
+// Maps what users type to canonical symbols. It is read once
+// from a local file, so validating a ticker needs no network.
+type Reference struct {
+	symbols map[string]Symbol
+	// Maps every alias to the symbol it stands for.
+	aliases map[string]string
+}
+
+// Reads the reference list at path, or the built-in list if
+// path is empty.
+func Load(path string) (*Reference, error) {
+	if path == "" {
+		return Parse(bytes.NewReader(builtin))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parses a reference list. It is a CSV file with a header and the
+// columns symbol, name, asset_class, exchange and aliases, where
+// aliases are separated by `|`. Crypto symbols must be pairs, such
+// as BTC-USD, and are also found by their unseparated pair (BTCUSD)
+// and, when quoted in DEFAULT_QUOTE_CURRENCY, by their base (BTC).
+func Parse(r io.Reader) (*Reference, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 5
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("reference list is empty")
+	}
+	ref := &Reference{symbols: make(map[string]Symbol), aliases: make(map[string]string)}
+	var derived [][2]string
+	for i, record := range records[1:] {
+		line := i + 2
+		s := Symbol{Symbol: record[0], Name: record[1], AssetClass: record[2], Exchange: record[3]}
+		if !validSymbol.MatchString(s.Symbol) {
+			return nil, fmt.Errorf("line %d: %w %q", line, ErrInvalidSymbol, s.Symbol)
+		}
+		switch s.AssetClass {
+		case EQUITY, ETF:
+		case CRYPTO:
+			base, quote, ok := strings.Cut(s.Symbol, "-")
+			if !ok {
+				return nil, fmt.Errorf("line %d: crypto symbol %q is not a pair such as BTC-USD", line, s.Symbol)
+			}
+			derived = append(derived, [2]string{base + quote, s.Symbol})
+			if quote == DEFAULT_QUOTE_CURRENCY {
+				derived = append(derived, [2]string{base, s.Symbol})
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unknown asset class %q", line, s.AssetClass)
+		}
+		if _, ok := ref.symbols[s.Symbol]; ok {
+			return nil, fmt.Errorf("line %d: duplicate symbol %q", line, s.Symbol)
+		}
+		ref.symbols[s.Symbol] = s
+		if record[4] == "" {
+			continue
+		}
+		for _, alias := range strings.Split(record[4], "|") {
+			alias = Normalize(alias)
+			if other, ok := ref.aliases[alias]; ok && other != s.Symbol {
+				return nil, fmt.Errorf("line %d: alias %q already stands for %s", line, alias, other)
+			}
+			ref.aliases[alias] = s.Symbol
+		}
+	}
+	// Derived aliases give way to listed symbols and aliases,
+	// so that the equity BTC is not taken for bitcoin.
+	for _, d := range derived {
+		if _, ok := ref.aliases[d[0]]; !ok {
+			ref.aliases[d[0]] = d[1]
+		}
+	}
+	return ref, nil
+}
+
+// Returns input as a symbol would be written: trimmed and upper
+// case, without a leading cashtag `$`, and with `/` or `_`
+// between the halves of a pair replaced by `-`.
+func Normalize(input string) string {
+	s := strings.ToUpper(strings.TrimSpace(input))
+	s = strings.TrimPrefix(s, "$")
+	return strings.NewReplacer("/", "-", "_", "-").Replace(s)
+}
+
+// Reports whether s is a well formed canonical symbol. It
+// does not check that the symbol is listed.
+func Valid(s string) bool {
+	return validSymbol.MatchString(s)
+}
+
+// Returns the symbol that input stands for.
+func (ref *Reference) Resolve(input string) (Symbol, error) {
+	s := Normalize(input)
+	if !Valid(s) {
+		return Symbol{}, fmt.Errorf("%w %q", ErrInvalidSymbol, input)
+	}
+	if symbol, ok := ref.symbols[s]; ok {
+		return symbol, nil
+	}
+	if canonical, ok := ref.aliases[s]; ok {
+		return ref.symbols[canonical], nil
+	}
+	return Symbol{}, fmt.Errorf("%w %q", ErrUnknownSymbol, input)
+}
+
+// Returns the symbol listed as s, which must be canonical.
+func (ref *Reference) Lookup(s string) (Symbol, bool) {
+	symbol, ok := ref.symbols[s]
+	return symbol, ok
+}
+
+// Returns the number of symbols listed.
+func (ref *Reference) Len() int {
+	return len(ref.symbols)
+}
@@ -0,0 +1,114 @@
+package symbology
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	ref, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]string{
+		"AMD":      "AMD",
+		" amd ":    "AMD",
+		"$TSLA":    "TSLA",
+		"brk-b":    "BRK.B",
+		"BRK/B":    "BRK.B",
+		"FB":       "META",
+		"$BTC":     "BTC-USD",
+		"BTC":      "BTC-USD",
+		"BTCUSD":   "BTC-USD",
+		"BTC-USD":  "BTC-USD",
+		"btc/usd":  "BTC-USD",
+		"ETHBTC":   "ETH-BTC",
+		"eth_btc":  "ETH-BTC",
+		"Bitcoin":  "BTC-USD",
+		"$spy":     "SPY",
+		"DOGE-USD": "DOGE-USD",
+		"$LLY":     "LLY",
+		"Monero":   "XMR-USD",
+		"NEARUSD":  "NEAR-USD",
+	}
+	for input, want := range cases {
+		s, err := ref.Resolve(input)
+		if err != nil {
+			t.Errorf("Resolve(%q) returned %v", input, err)
+			continue
+		}
+		if s.Symbol != want {
+			t.Errorf("Resolve(%q) = %s, want %s", input, s.Symbol, want)
+		}
+	}
+
+	if s, _ := ref.Resolve("BTC"); s.AssetClass != CRYPTO || s.Exchange != "CRYPTO" {
+		t.Errorf("BTC resolved to %+v", s)
+	}
+	if s, _ := ref.Resolve("SPY"); s.AssetClass != ETF {
+		t.Errorf("SPY resolved to %+v", s)
+	}
+	for _, input := range []string{"", "$", "AM D", "DROP TABLE", "A/B/C", strings.Repeat("A", 13)} {
+		if _, err := ref.Resolve(input); !errors.Is(err, ErrInvalidSymbol) {
+			t.Errorf("Resolve(%q) returned %v, want ErrInvalidSymbol", input, err)
+		}
+	}
+	if _, err := ref.Resolve("ZZZZ"); !errors.Is(err, ErrUnknownSymbol) {
+		t.Errorf("Resolve(ZZZZ) returned %v, want ErrUnknownSymbol", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	header := "symbol,name,asset_class,exchange,aliases\n"
+	// A listed symbol wins over a crypto base alias.
+	ref, err := Parse(strings.NewReader(header +
+		"BTC,Some Equity,equity,NYSE,\n" +
+		"BTC-USD,Bitcoin,crypto,CRYPTO,\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := ref.Resolve("$BTC"); s.Symbol != "BTC" {
+		t.Errorf("$BTC resolved to %s, want the listed equity", s.Symbol)
+	}
+	if s, _ := ref.Resolve("BTCUSD"); s.Symbol != "BTC-USD" {
+		t.Errorf("BTCUSD resolved to %s", s.Symbol)
+	}
+
+	bad := map[string]string{
+		"unknown class": "AMD,AMD,bond,NYSE,\n",
+		"unpaired":      "BTC,Bitcoin,crypto,CRYPTO,\n",
+		"duplicate":     "AMD,AMD,equity,NASDAQ,\nAMD,AMD,equity,NYSE,\n",
+		"lower case":    "amd,AMD,equity,NASDAQ,\n",
+		"shared alias":  "META,Meta,equity,NASDAQ,FB\nFBK,FB Financial,equity,NYSE,FB\n",
+		"short record":  "AMD,AMD,equity\n",
+	}
+	for name, body := range bad {
+		if _, err := Parse(strings.NewReader(header + body)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestCommonName(t *testing.T) {
+	ref, err := Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string][2]string{
+		"AMD":     {"Advanced Micro Devices", "$AMD"},
+		"BRK.B":   {"Berkshire Hathaway", "$BRK.B"},
+		"KO":      {"Coca-Cola Company", "$KO"},
+		"BTC-USD": {"Bitcoin", "$BTC"},
+		"SPY":     {"SPDR S&P 500 ETF Trust", "$SPY"},
+	}
+	for symbol, want := range cases {
+		s, _ := ref.Lookup(symbol)
+		if got := s.CommonName(); got != want[0] {
+			t.Errorf("%s.CommonName() = %q, want %q", symbol, got, want[0])
+		}
+		if got := s.Cashtag(); got != want[1] {
+			t.Errorf("%s.Cashtag() = %q, want %q", symbol, got, want[1])
+		}
+	}
+}
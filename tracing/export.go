@@ -0,0 +1,300 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Spans are exported when this many have finished,
+	// or every EXPORT_INTERVAL, whichever comes first.
+	EXPORT_BATCH_SIZE = 256
+	EXPORT_INTERVAL   = 5 * time.Second
+	// Finished spans waiting for export beyond this are dropped
+	// rather than blocking the code that ended them.
+	EXPORT_QUEUE_SIZE = 4096
+)
+
+// Sends finished spans somewhere.
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// Batches finished spans and hands them to an Exporter
+// from a background goroutine.
+type Provider struct {
+	exporter Exporter
+	logger   *slog.Logger
+	queue    chan *Span
+	flush    chan chan struct{}
+	done     chan struct{}
+}
+
+var (
+	globalMu sync.RWMutex
+	global   *Provider
+)
+
+func provider() *Provider {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return global
+}
+
+func (p *Provider) export(s *Span) {
+	if p == nil {
+		return
+	}
+	select {
+	case p.queue <- s:
+	default:
+	}
+}
+
+// Installs an exporter for every span ended from now on.
+// The returned function flushes queued spans and stops the
+// exporter; it should be called before the process exits.
+// Export failures are reported to logger.
+func Init(exporter Exporter, logger *slog.Logger) func(context.Context) {
+	p := &Provider{
+		exporter: exporter,
+		logger:   logger,
+		queue:    make(chan *Span, EXPORT_QUEUE_SIZE),
+		flush:    make(chan chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go p.run()
+	globalMu.Lock()
+	global = p
+	globalMu.Unlock()
+	return func(ctx context.Context) {
+		globalMu.Lock()
+		if global == p {
+			global = nil
+		}
+		globalMu.Unlock()
+		flushed := make(chan struct{})
+		select {
+		case p.flush <- flushed:
+			select {
+			case <-flushed:
+			case <-ctx.Done():
+			}
+		case <-ctx.Done():
+		}
+		close(p.done)
+	}
+}
+
+func (p *Provider) run() {
+	ticker := time.NewTicker(EXPORT_INTERVAL)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, EXPORT_BATCH_SIZE)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := p.exporter.Export(ctx, batch); err != nil {
+			p.logger.Error("failed to export spans", "spans", len(batch), "err", err)
+		}
+		cancel()
+		batch = make([]*Span, 0, EXPORT_BATCH_SIZE)
+	}
+	for {
+		select {
+		case s := <-p.queue:
+			batch = append(batch, s)
+			if len(batch) >= EXPORT_BATCH_SIZE {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case flushed := <-p.flush:
+			for len(p.queue) > 0 {
+				batch = append(batch, <-p.queue)
+			}
+			send()
+			close(flushed)
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Configures tracing from the standard OpenTelemetry environment
+// variables: OTEL_TRACES_EXPORTER (`otlp`, `console` or `none`,
+// the default), OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_SERVICE_NAME.
+// Returns the shutdown function from Init, or a no-op.
+func InitFromEnv(logger *slog.Logger) (func(context.Context), error) {
+	service := os.Getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = "watch-dog-kafka"
+	}
+	switch os.Getenv("OTEL_TRACES_EXPORTER") {
+	case "", "none":
+		return func(context.Context) {}, nil
+	case "console":
+		return Init(NewConsoleExporter(os.Stdout), logger), nil
+	case "otlp":
+		endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if endpoint == "" {
+			endpoint = "http://localhost:4318"
+		}
+		return Init(NewOTLPExporter(endpoint, service), logger), nil
+	}
+	return nil, fmt.Errorf("unsupported OTEL_TRACES_EXPORTER %q", os.Getenv("OTEL_TRACES_EXPORTER"))
+}
+
+// Writes one JSON object per span, for local runs.
+type consoleExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewConsoleExporter(w io.Writer) Exporter {
+	return &consoleExporter{w: w}
+}
+
+func (e *consoleExporter) Export(ctx context.Context, spans []*Span) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		s.mu.Lock()
+		out := map[string]interface{}{
+			"name":        s.Name,
+			"trace_id":    s.Context.TraceID.String(),
+			"span_id":     s.Context.SpanID.String(),
+			"start":       s.Start.Format(time.RFC3339Nano),
+			"duration_ms": float64(s.EndTime.Sub(s.Start).Microseconds()) / 1000,
+			"attributes":  s.Attributes,
+		}
+		if s.Parent != (SpanID{}) {
+			out["parent_id"] = s.Parent.String()
+		}
+		if s.Err != nil {
+			out["error"] = s.Err.Error()
+		}
+		s.mu.Unlock()
+		if err := enc.Encode(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Posts spans to an OTLP/HTTP collector using the JSON encoding.
+// See https://opentelemetry.io/docs/specs/otlp/#otlphttp
+type otlpExporter struct {
+	url     string
+	service string
+	client  *http.Client
+}
+
+func NewOTLPExporter(endpoint, serviceName string) Exporter {
+	return &otlpExporter{
+		url:     strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		service: serviceName,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+type otlpAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+func attribute(key, value string) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	a.Value.StringValue = value
+	return a
+}
+
+// Builds the ExportTraceServiceRequest body for a batch.
+func (e *otlpExporter) payload(spans []*Span) ([]byte, error) {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		o := otlpSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+		}
+		if s.Parent != (SpanID{}) {
+			o.ParentSpanID = s.Parent.String()
+		}
+		for k, v := range s.Attributes {
+			o.Attributes = append(o.Attributes, attribute(k, v))
+		}
+		if s.Err != nil {
+			o.Status.Code = 2
+			o.Status.Message = s.Err.Error()
+		}
+		s.mu.Unlock()
+		converted = append(converted, o)
+	}
+	body := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{attribute("service.name", e.service)},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "github.com/jonreesman/watch-dog-kafka/tracing"},
+				"spans": converted,
+			}},
+		}},
+	}
+	return json.Marshal(body)
+}
+
+func (e *otlpExporter) Export(ctx context.Context, spans []*Span) error {
+	body, err := e.payload(spans)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
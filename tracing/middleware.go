@@ -0,0 +1,48 @@
+package tracing
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Gin middleware starting a server span for every request,
+// continuing the caller's trace if it sent a traceparent.
+// Handlers reach the span through c.Request.Context().
+func GinMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		ctx := Extract(c.Request.Context(), c.GetHeader(TRACEPARENT))
+		ctx, span := Start(ctx, c.Request.Method+" "+route, KIND_SERVER)
+		defer span.End()
+		span.SetAttribute("http.method", c.Request.Method)
+		span.SetAttribute("http.route", route)
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		span.SetAttribute("http.status_code", strconv.Itoa(c.Writer.Status()))
+		if err := c.Errors.Last(); err != nil {
+			span.RecordError(err)
+		}
+	}
+}
+
+// gRPC client interceptor starting a client span for every
+// unary call and passing the trace on in the call's metadata.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := Start(ctx, method, KIND_CLIENT)
+		defer span.End()
+		span.SetAttribute("rpc.system", "grpc")
+		span.SetAttribute("rpc.method", method)
+		ctx = metadata.AppendToOutgoingContext(ctx, TRACEPARENT, Inject(ctx))
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		span.RecordError(err)
+		return err
+	}
+}
@@ -0,0 +1,177 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A minimal tracer following the OpenTelemetry data model. Spans
+// are propagated between processes with the W3C Trace Context
+// `traceparent` header and exported with OTLP, so any collector
+// that speaks OTLP/HTTP can receive them.
+// See https://www.w3.org/TR/trace-context/
+
+// Header (and Kafka message header) carrying the trace context.
+const TRACEPARENT = "traceparent"
+
+// Defines the role of a span, mirroring OTLP's SpanKind.
+type Kind int
+
+const (
+	KIND_INTERNAL Kind = 1
+	KIND_SERVER   Kind = 2
+	KIND_CLIENT   Kind = 3
+	KIND_PRODUCER Kind = 4
+	KIND_CONSUMER Kind = 5
+)
+
+type TraceID [16]byte
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// Identifies a span within a trace.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// A single timed operation. Spans are safe to use from
+// several goroutines.
+type Span struct {
+	mu         sync.Mutex
+	Name       string
+	Kind       Kind
+	Context    SpanContext
+	Parent     SpanID
+	Start      time.Time
+	EndTime    time.Time
+	Attributes map[string]string
+	Err        error
+	ended      bool
+}
+
+// Attaches a key/value attribute to the span.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes[key] = fmt.Sprint(value)
+}
+
+// Marks the span as failed. A nil error is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Err = err
+}
+
+// Finishes the span and hands it to the exporter. Calling
+// End more than once has no effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+	provider().export(s)
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// Returns the span active in ctx, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Starts a span as a child of the span in ctx, or of a remote
+// parent extracted into ctx, or as the root of a new trace.
+// The returned context carries the new span.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s := &Span{
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		Attributes: make(map[string]string),
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.Context.TraceID = parent.Context.TraceID
+		s.Parent = parent.Context.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(SpanContext); ok {
+		s.Context.TraceID = remote.TraceID
+		s.Parent = remote.SpanID
+	} else {
+		rand.Read(s.Context.TraceID[:])
+	}
+	rand.Read(s.Context.SpanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Returns the traceparent value for the span active in ctx,
+// or "" if there is none.
+func Inject(ctx context.Context) string {
+	s := SpanFromContext(ctx)
+	if s == nil {
+		return ""
+	}
+	return fmt.Sprintf("00-%s-%s-01", s.Context.TraceID, s.Context.SpanID)
+}
+
+// Returns a context whose next span continues the trace
+// described by a traceparent value. Invalid values are
+// ignored, in which case the next span starts a new trace.
+func Extract(ctx context.Context, traceparent string) context.Context {
+	sc, ok := parseTraceparent(traceparent)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+func parseTraceparent(v string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	traceID, err := hex.DecodeString(parts[1])
+	if err != nil || len(traceID) != 16 {
+		return sc, false
+	}
+	spanID, err := hex.DecodeString(parts[2])
+	if err != nil || len(spanID) != 8 {
+		return sc, false
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	return sc, sc.IsValid()
+}
@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordingExporter struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (r *recordingExporter) Export(ctx context.Context, spans []*Span) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func TestPropagationAcrossProcesses(t *testing.T) {
+	rec := &recordingExporter{}
+	shutdown := Init(rec, slog.Default())
+
+	ctx, produce := Start(context.Background(), "kafka.produce scrape", KIND_PRODUCER)
+	header := Inject(ctx)
+	produce.End()
+
+	// The consumer only sees the header value.
+	consumeCtx, consume := Start(Extract(context.Background(), header), "kafka.consume scrape", KIND_CONSUMER)
+	_, scrape := Start(consumeCtx, "scrape", KIND_INTERNAL)
+	scrape.RecordError(errors.New("rate limited"))
+	scrape.End()
+	consume.End()
+	shutdown(context.Background())
+
+	if len(rec.spans) != 3 {
+		t.Fatalf("expected 3 exported spans, got %d", len(rec.spans))
+	}
+	for _, s := range rec.spans {
+		if s.Context.TraceID != produce.Context.TraceID {
+			t.Errorf("span %s is not part of the producer's trace", s.Name)
+		}
+	}
+	if consume.Parent != produce.Context.SpanID {
+		t.Errorf("consumer span is not a child of the producer span")
+	}
+	if scrape.Parent != consume.Context.SpanID || scrape.Err == nil {
+		t.Errorf("scrape span has wrong parent or lost its error")
+	}
+}
+
+func TestExtractIgnoresInvalidHeaders(t *testing.T) {
+	for _, h := range []string{"", "garbage", "00-00000000000000000000000000000000-0000000000000000-01", "ff-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"} {
+		ctx, s := Start(Extract(context.Background(), h), "root", KIND_INTERNAL)
+		_ = ctx
+		if s.Parent != (SpanID{}) {
+			t.Errorf("header %q should not have produced a parent", h)
+		}
+	}
+	_, s := Start(Extract(context.Background(), "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"), "child", KIND_INTERNAL)
+	if s.Context.TraceID.String() != "0af7651916cd43dd8448eb211c80319c" || s.Parent.String() != "b7ad6b7169203331" {
+		t.Errorf("valid traceparent was not continued: %s %s", s.Context.TraceID, s.Parent)
+	}
+}
+
+func TestOTLPPayload(t *testing.T) {
+	_, s := Start(context.Background(), "pushToDb", KIND_INTERNAL)
+	s.SetAttribute("ticker", "AMD")
+	s.RecordError(errors.New("deadlock"))
+	s.EndTime = s.Start.Add(time.Millisecond)
+
+	e := NewOTLPExporter("http://collector:4318/", "watchdog").(*otlpExporter)
+	if e.url != "http://collector:4318/v1/traces" {
+		t.Errorf("unexpected url %s", e.url)
+	}
+	body, err := e.payload([]*Span{s})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []otlpSpan `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	got := decoded.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if got.Name != "pushToDb" || got.TraceID != s.Context.TraceID.String() || got.Status.Code != 2 {
+		t.Errorf("unexpected OTLP span %+v", got)
+	}
+	if len(got.Attributes) != 1 || got.Attributes[0].Value.StringValue != "AMD" {
+		t.Errorf("ticker attribute missing: %+v", got.Attributes)
+	}
+}
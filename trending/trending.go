@@ -0,0 +1,268 @@
+package trending
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/symbology"
+)
+
+// Name of the lease that elects the instance that prunes
+// mentions and adds tickers.
+const LEASE_NAME = "trending-discovery"
+
+const (
+	// How far back a symbol's own baseline is taken from.
+	// Older mentions are pruned.
+	BASELINE_PERIOD = 7 * 24 * time.Hour
+	// The window trends are measured over by default, and
+	// the longest that may be asked for.
+	DEFAULT_WINDOW = time.Hour
+	MAX_WINDOW     = 24 * time.Hour
+	// Fewest mentions in the window for a symbol to be listed,
+	// so that a couple of stray tweets are not a trend.
+	MIN_MENTIONS = 5
+)
+
+// Defines the database operations discovery depends on.
+// Satisfied by db.DBManager, which should be the primary.
+type Store interface {
+	AcquireLease(name, holder string, ttl time.Duration) (bool, error)
+	ReturnActiveTickers(ctx context.Context) (db.TickerSlice, error)
+	ReturnUntrackedMentionCounts(fromTime, toTime int64) (map[string]int, error)
+	PruneUntrackedMentions(before int64) error
+	RecordAutoAddition(symbol string, at int64) (bool, error)
+	DeleteAutoAddition(symbol string) error
+	CountAutoAdditions(since int64) (int, error)
+}
+
+// A symbol no ticker tracks that is being mentioned more than
+// usual.
+type Trend struct {
+	Symbol     string `json:"symbol"`
+	Name       string `json:"name"`
+	AssetClass string `json:"asset_class"`
+	// Tweets mentioning the symbol in the window.
+	Mentions int `json:"mentions"`
+	// Tweets the symbol would be mentioned in over a window
+	// of the same length, going by the baseline period.
+	Baseline float64 `json:"baseline"`
+	// Mentions over the baseline, with a baseline under one
+	// counted as one.
+	Velocity float64 `json:"velocity"`
+}
+
+// Ranks symbols by how much more they were mentioned in the
+// window than over the preceding baseline period, fastest first.
+// Symbols with fewer than minMentions mentions in the window are
+// left out.
+func Rank(recent, baseline map[string]int, window, baselinePeriod time.Duration, minMentions int) []Trend {
+	var trends []Trend
+	for symbol, n := range recent {
+		if n < minMentions {
+			continue
+		}
+		expected := float64(baseline[symbol]) * float64(window) / float64(baselinePeriod)
+		trends = append(trends, Trend{
+			Symbol:   symbol,
+			Mentions: n,
+			Baseline: expected,
+			Velocity: float64(n) / max(expected, 1),
+		})
+	}
+	sort.Slice(trends, func(i, j int) bool {
+		if trends[i].Velocity != trends[j].Velocity {
+			return trends[i].Velocity > trends[j].Velocity
+		}
+		if trends[i].Mentions != trends[j].Mentions {
+			return trends[i].Mentions > trends[j].Mentions
+		}
+		return trends[i].Symbol < trends[j].Symbol
+	})
+	return trends
+}
+
+// Returns the untracked symbols trending over the window ending
+// at now, with their names from the reference list.
+func Trending(ctx context.Context, store Store, symbols *symbology.Reference, now time.Time, window time.Duration, minMentions int) ([]Trend, error) {
+	end := now.Unix()
+	start := now.Add(-window).Unix()
+	recent, err := store.ReturnUntrackedMentionCounts(start, end)
+	if err != nil {
+		return nil, err
+	}
+	baseline, err := store.ReturnUntrackedMentionCounts(now.Add(-BASELINE_PERIOD).Unix(), start)
+	if err != nil {
+		return nil, err
+	}
+	// A symbol may have been added since it was mentioned.
+	tracked, err := store.ReturnActiveTickers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tracked {
+		delete(recent, t.Name)
+	}
+	trends := Rank(recent, baseline, window, BASELINE_PERIOD-window, minMentions)
+	if symbols == nil {
+		return trends, nil
+	}
+	for i, t := range trends {
+		if s, ok := symbols.Lookup(t.Symbol); ok {
+			trends[i].Name = s.Name
+			trends[i].AssetClass = s.AssetClass
+		}
+	}
+	return trends, nil
+}
+
+// Decides which trending symbols are added as tickers without
+// an admin. Caps bound how fast and how far it may grow the set
+// of tracked tickers.
+type Policy struct {
+	// Off unless set.
+	AutoAdd bool
+	// Least velocity and mentions in DEFAULT_WINDOW for a
+	// symbol to be added.
+	MinVelocity float64
+	MinMentions int
+	// Most symbols added in any 24 hours.
+	MaxPerDay int
+	// No symbol is added while this many tickers are active.
+	MaxTracked int
+}
+
+// Periodically prunes old mentions and, if the policy allows,
+// adds trending symbols. Every instance of the service runs one,
+// but only the instance holding the lease acts.
+type Discoverer struct {
+	store   Store
+	symbols *symbology.Reference
+	add     func(ctx context.Context, symbol string) error
+	id      string
+	logger  *slog.Logger
+	Policy  Policy
+
+	// How often trends are checked.
+	Interval time.Duration
+	// How long the lease is held without renewal.
+	LeaseTTL time.Duration
+
+	mu     sync.Mutex
+	leader bool
+}
+
+// Creates a Discoverer that adds symbols by calling add.
+func NewDiscoverer(store Store, symbols *symbology.Reference, logger *slog.Logger, policy Policy, add func(ctx context.Context, symbol string) error) *Discoverer {
+	host, _ := os.Hostname()
+	id := fmt.Sprintf("%s-%s", host, uuid.New().String())
+	return &Discoverer{
+		store:    store,
+		symbols:  symbols,
+		add:      add,
+		id:       id,
+		logger:   logger.With("component", "trending", "instance", id),
+		Policy:   policy,
+		Interval: 15 * time.Minute,
+		LeaseTTL: 45 * time.Minute,
+	}
+}
+
+// Runs discovery until ctx is cancelled.
+func (d *Discoverer) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		d.tick(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Discoverer) tick(ctx context.Context, now time.Time) {
+	leader, err := d.store.AcquireLease(LEASE_NAME, d.id, d.LeaseTTL)
+	if err != nil {
+		d.logger.Error("failed to acquire lease", "err", err)
+		leader = false
+	}
+	d.mu.Lock()
+	if leader != d.leader {
+		d.logger.Info("leadership changed", "leader", leader)
+	}
+	d.leader = leader
+	d.mu.Unlock()
+	if !leader {
+		return
+	}
+
+	if err := d.store.PruneUntrackedMentions(now.Add(-BASELINE_PERIOD).Unix()); err != nil {
+		d.logger.Error("failed to prune mentions", "err", err)
+	}
+	if d.Policy.AutoAdd {
+		d.autoAdd(ctx, now)
+	}
+}
+
+// Adds the fastest trending symbols that meet the policy, until
+// either cap is reached. Each symbol is only ever added once.
+func (d *Discoverer) autoAdd(ctx context.Context, now time.Time) {
+	tracked, err := d.store.ReturnActiveTickers(ctx)
+	if err != nil {
+		d.logger.Error("failed to retrieve active tickers", "err", err)
+		return
+	}
+	added, err := d.store.CountAutoAdditions(now.Add(-24 * time.Hour).Unix())
+	if err != nil {
+		d.logger.Error("failed to count recent additions", "err", err)
+		return
+	}
+	remaining := d.Policy.MaxPerDay - added
+	if room := d.Policy.MaxTracked - len(tracked); room < remaining {
+		remaining = room
+	}
+	if remaining <= 0 {
+		return
+	}
+	trends, err := Trending(ctx, d.store, d.symbols, now, DEFAULT_WINDOW, d.Policy.MinMentions)
+	if err != nil {
+		d.logger.Error("failed to compute trends", "err", err)
+		return
+	}
+	for _, t := range trends {
+		if remaining == 0 || t.Velocity < d.Policy.MinVelocity {
+			return
+		}
+		first, err := d.store.RecordAutoAddition(t.Symbol, now.Unix())
+		if err != nil || !first {
+			continue
+		}
+		d.logger.Info("adding trending symbol", "symbol", t.Symbol, "mentions", t.Mentions, "velocity", t.Velocity)
+		if err := d.add(ctx, t.Symbol); err != nil {
+			// Forgotten, so that it is tried again while
+			// it is still trending.
+			d.logger.Error("failed to add trending symbol", "symbol", t.Symbol, "err", err)
+			if err := d.store.DeleteAutoAddition(t.Symbol); err != nil {
+				d.logger.Error("failed to forget trending symbol", "symbol", t.Symbol, "err", err)
+			}
+			continue
+		}
+		remaining--
+	}
+}
+
+// Reports whether this instance currently holds the lease.
+func (d *Discoverer) IsLeader() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.leader
+}
@@ -0,0 +1,178 @@
+package trending
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jonreesman/watch-dog-kafka/db"
+	"github.com/jonreesman/watch-dog-kafka/logging"
+	"github.com/jonreesman/watch-dog-kafka/symbology"
+)
+
+type fakeStore struct {
+	holder   string
+	tickers  db.TickerSlice
+	recent   map[string]int
+	baseline map[string]int
+	added    map[string]int64
+	pruned   int64
+}
+
+func (f *fakeStore) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	if f.holder == "" {
+		f.holder = holder
+	}
+	return f.holder == holder, nil
+}
+
+func (f *fakeStore) ReturnActiveTickers(ctx context.Context) (db.TickerSlice, error) {
+	return f.tickers, nil
+}
+
+// Treats any range ending within the last hour as the window.
+func (f *fakeStore) ReturnUntrackedMentionCounts(fromTime, toTime int64) (map[string]int, error) {
+	counts := f.baseline
+	if toTime > time.Now().Add(-time.Minute).Unix() {
+		counts = f.recent
+	}
+	copied := make(map[string]int, len(counts))
+	for s, n := range counts {
+		copied[s] = n
+	}
+	return copied, nil
+}
+
+func (f *fakeStore) PruneUntrackedMentions(before int64) error {
+	f.pruned = before
+	return nil
+}
+
+func (f *fakeStore) RecordAutoAddition(symbol string, at int64) (bool, error) {
+	if _, ok := f.added[symbol]; ok {
+		return false, nil
+	}
+	f.added[symbol] = at
+	return true, nil
+}
+
+func (f *fakeStore) DeleteAutoAddition(symbol string) error {
+	delete(f.added, symbol)
+	return nil
+}
+
+func (f *fakeStore) CountAutoAdditions(since int64) (int, error) {
+	var n int
+	for _, at := range f.added {
+		if at >= since {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestRank(t *testing.T) {
+	// Over a baseline 10 times the window, NVDA usually sees
+	// 3 mentions per window and GME about none.
+	recent := map[string]int{"NVDA": 30, "GME": 8, "SPY": 2}
+	baseline := map[string]int{"NVDA": 30, "GME": 1}
+	trends := Rank(recent, baseline, time.Hour, 10*time.Hour, MIN_MENTIONS)
+	var got []string
+	for _, trend := range trends {
+		got = append(got, trend.Symbol)
+	}
+	if want := []string{"NVDA", "GME"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ranked %v, want %v", got, want)
+	}
+	if trends[0].Velocity != 10 || trends[0].Baseline != 3 {
+		t.Errorf("NVDA: got %+v", trends[0])
+	}
+	// A baseline under one mention counts as one.
+	if trends[1].Velocity != 8 {
+		t.Errorf("GME: got %+v", trends[1])
+	}
+}
+
+func TestAutoAdd(t *testing.T) {
+	symbols, err := symbology.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &fakeStore{
+		tickers: db.TickerSlice{{Id: 1, Name: "AMD"}},
+		recent:  map[string]int{"AMD": 100, "NVDA": 50, "GME": 40, "TSLA": 30, "SPY": 6},
+		added:   map[string]int64{},
+	}
+	var added []string
+	d := NewDiscoverer(store, symbols, logging.Discard(), Policy{
+		AutoAdd:     true,
+		MinVelocity: 10,
+		MinMentions: 10,
+		MaxPerDay:   2,
+		MaxTracked:  10,
+	}, func(ctx context.Context, symbol string) error {
+		added = append(added, symbol)
+		return nil
+	})
+	now := time.Now()
+	d.tick(context.Background(), now)
+	// AMD is tracked, and SPY has too few mentions.
+	if want := []string{"NVDA", "GME"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added %v, want %v", added, want)
+	}
+	if store.pruned != now.Add(-BASELINE_PERIOD).Unix() {
+		t.Errorf("pruned before %d", store.pruned)
+	}
+
+	// The daily cap is reached, so TSLA waits.
+	d.tick(context.Background(), now.Add(time.Hour))
+	if len(added) != 2 {
+		t.Errorf("added %v past the daily cap", added)
+	}
+
+	// Nothing is added once MaxTracked tickers are active, and
+	// a symbol is never added twice.
+	store.added = map[string]int64{"NVDA": 0}
+	d.Policy.MaxTracked = 1
+	d.tick(context.Background(), now)
+	d.Policy.MaxTracked = 10
+	store.recent = map[string]int{"NVDA": 50}
+	d.tick(context.Background(), now)
+	if len(added) != 2 {
+		t.Errorf("added %v, want no more", added)
+	}
+
+	// A symbol that fails to be added is tried again.
+	store.added = map[string]int64{}
+	store.recent = map[string]int{"TSLA": 30}
+	fail := true
+	d.add = func(ctx context.Context, symbol string) error {
+		if fail {
+			fail = false
+			return errors.New("broker unavailable")
+		}
+		added = append(added, symbol)
+		return nil
+	}
+	d.tick(context.Background(), now)
+	if _, ok := store.added["TSLA"]; ok || len(added) != 2 {
+		t.Errorf("TSLA recorded as added after failing, added %v", added)
+	}
+	d.tick(context.Background(), now)
+	if _, ok := store.added["TSLA"]; !ok || added[len(added)-1] != "TSLA" {
+		t.Errorf("TSLA not retried, added %v", added)
+	}
+
+	// Without the lease, nothing happens.
+	other := NewDiscoverer(store, symbols, logging.Discard(), d.Policy, func(ctx context.Context, symbol string) error {
+		t.Errorf("follower added %s", symbol)
+		return nil
+	})
+	store.recent = map[string]int{"TSLA": 30}
+	other.tick(context.Background(), now)
+	if other.IsLeader() {
+		t.Error("follower took the lease")
+	}
+}
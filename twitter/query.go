@@ -0,0 +1,117 @@
+package twitter
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Describes what to search a source for and which of the
+// results are actually about the ticker.
+type Query struct {
+	// The ticker's symbol, such as AMD or BTC-USD. It is only
+	// matched in upper case, so that "amd" in passing is not.
+	Ticker string
+	// Other ways the ticker is referred to, such as its cashtag,
+	// company name and aliases. Matched in any case.
+	Terms []string
+	// Results mentioning any of these are discarded.
+	Exclude []string
+}
+
+// Returns the search for statements mentioning the ticker by any
+// of its terms and none of the excluded keywords, in the search
+// syntax shared by Twitter and most other sources.
+func (q Query) Search() string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, t := range append([]string{q.Ticker}, q.Terms...) {
+		if t == "" || seen[strings.ToLower(t)] {
+			continue
+		}
+		seen[strings.ToLower(t)] = true
+		terms = append(terms, quote(t))
+	}
+	s := strings.Join(terms, " OR ")
+	if len(terms) > 1 {
+		s = "(" + s + ")"
+	}
+	for _, e := range q.Exclude {
+		s += " -" + quote(e)
+	}
+	return s
+}
+
+// Quotes a term that is not a single word, so that it is
+// searched for as a phrase. Cashtags are left bare.
+func quote(term string) string {
+	for _, r := range strings.TrimPrefix(term, "$") {
+		if !isWordRune(r) {
+			return `"` + strings.ReplaceAll(term, `"`, "") + `"`
+		}
+	}
+	return term
+}
+
+// Reports whether text mentions the ticker and none of the
+// excluded keywords. Terms must appear as whole words, so
+// that AMD does not match AMDOCS.
+func (q Query) Matches(text string) bool {
+	lower := strings.ToLower(text)
+	for _, e := range q.Exclude {
+		if e != "" && containsWord(lower, strings.ToLower(e)) {
+			return false
+		}
+	}
+	if q.Ticker != "" && containsWord(text, q.Ticker) {
+		return true
+	}
+	for _, t := range q.Terms {
+		if t != "" && containsWord(lower, strings.ToLower(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+// A `$` that does not follow a word, then a symbol that starts
+// with a letter, so that prices such as $100 are not cashtags.
+var cashtag = regexp.MustCompile(`(?:^|[^\p{L}\p{N}$])\$([A-Za-z][A-Za-z0-9]{0,11}(?:[.-][A-Za-z0-9]{1,12})?)\b`)
+
+// Returns the symbols of every cashtag in text, such as AMD for
+// $AMD or $amd, in upper case and in order of first appearance.
+func Cashtags(text string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, m := range cashtag.FindAllStringSubmatch(text, -1) {
+		tag := strings.ToUpper(m[1])
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Reports whether word appears in text without a letter or
+// digit directly before or after it.
+func containsWord(text, word string) bool {
+	for start := 0; ; {
+		i := strings.Index(text[start:], word)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(word)
+		before := i == 0 || !isWordRune(rune(text[i-1]))
+		after := end == len(text) || !isWordRune(rune(text[end]))
+		if before && after {
+			return true
+		}
+		start = i + 1
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
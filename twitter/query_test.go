@@ -0,0 +1,60 @@
+package twitter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuerySearch(t *testing.T) {
+	q := Query{
+		Ticker:  "AMD",
+		Terms:   []string{"$AMD", "Advanced Micro Devices", "amd"},
+		Exclude: []string{"amd64", "Radeon driver"},
+	}
+	want := `(AMD OR $AMD OR "Advanced Micro Devices") -amd64 -"Radeon driver"`
+	if got := q.Search(); got != want {
+		t.Errorf("Search() = %s, want %s", got, want)
+	}
+	if got := (Query{Ticker: "BTC-USD"}).Search(); got != `"BTC-USD"` {
+		t.Errorf("Search() = %s", got)
+	}
+}
+
+func TestQueryMatches(t *testing.T) {
+	q := Query{
+		Ticker:  "AMD",
+		Terms:   []string{"$AMD", "Advanced Micro Devices"},
+		Exclude: []string{"amd64"},
+	}
+	cases := map[string]bool{
+		"AMD beat earnings":                 true,
+		"loading up on $amd today":          true,
+		"advanced micro devices guidance":   true,
+		"AMD.":                              true,
+		"amd in lower case is not a ticker": false,
+		"AMDOCS reported":                   false,
+		"compiled for AMD amd64":            false,
+		"nothing to see here":               false,
+	}
+	for text, want := range cases {
+		if got := q.Matches(text); got != want {
+			t.Errorf("Matches(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestCashtags(t *testing.T) {
+	cases := map[string][]string{
+		"$AMD and $NVDA, not $amd again":   {"AMD", "NVDA"},
+		"$BRK.B. Also $btc-usd":            {"BRK.B", "BTC-USD"},
+		"($TSLA)":                          {"TSLA"},
+		"up $100 today, US$5 or $$SPY":     nil,
+		"no cashtags here":                 nil,
+		"$AAPL$MSFT counts only the first": {"AAPL"},
+	}
+	for text, want := range cases {
+		if got := Cashtags(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("Cashtags(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
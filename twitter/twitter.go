@@ -2,7 +2,7 @@ package twitter
 
 import (
 	"context"
-	"log"
+	"log/slog"
 	"regexp"
 	"strconv"
 	"strings"
@@ -32,12 +32,11 @@ type Statement struct {
 	Location     *twitterscraper.Place
 }
 
-// Returns most tweets for a given stock or ticker name with a given
-// fromTime. This fromTime is the last time Twitter was scraped for the
-// stock or crypto.
+// Returns most tweets matching query with a given fromTime. This
+// fromTime is the last time Twitter was scraped for the stock or crypto.
 // The addition of collecting the profiles of the users who made the
 // tweets doubles the time required for a query.
-func TwitterScrapeProfile(tickerName string, lastScrapeTime int64) []Statement {
+func TwitterScrapeProfile(logger *slog.Logger, query Query, lastScrapeTime int64) []Statement {
 	scraper := twitterscraper.New()
 
 	scraper.SetSearchMode(twitterscraper.SearchTop)
@@ -47,7 +46,7 @@ func TwitterScrapeProfile(tickerName string, lastScrapeTime int64) []Statement {
 	// Since we scrape hourly, we are only concerned
 	// with all the tweets within the past hour.
 	for tweet := range scraper.SearchTweets(context.Background(),
-		tickerName+" within_time:1h", 100) {
+		query.Search()+" within_time:1h", 100) {
 		if tweet.Error != nil {
 			return tweets
 		}
@@ -57,7 +56,7 @@ func TwitterScrapeProfile(tickerName string, lastScrapeTime int64) []Statement {
 
 		// Secondary check to ensure the tweet is actually
 		// about our stock of choice.
-		if !strings.Contains(tweet.Text, tickerName) {
+		if !query.Matches(tweet.Text) {
 			continue
 		}
 
@@ -67,16 +66,16 @@ func TwitterScrapeProfile(tickerName string, lastScrapeTime int64) []Statement {
 
 		id, err := strconv.ParseUint(tweet.ID, 10, 64)
 		if err != nil {
-			log.Printf("twitterScrape(): Error extracting tweet id")
+			logger.Warn("failed to parse tweet id", "tweet_id", tweet.ID, "err", err)
 		}
 
 		profile, err := scraper.GetProfile(tweet.Username)
 		if err != nil {
-			log.Printf("twitterScrape(): Error retrieving profile for user %s: %v", tweet.Username, err)
+			logger.Warn("failed to retrieve profile", "user", tweet.Username, "err", err)
 		}
 		s := Statement{
 			Expression:   tweet.Text,
-			Subject:      tickerName,
+			Subject:      query.Ticker,
 			Source:       "Twitter",
 			TimeStamp:    tweet.Timestamp,
 			Polarity:     0,
@@ -95,10 +94,9 @@ func TwitterScrapeProfile(tickerName string, lastScrapeTime int64) []Statement {
 	return tweets
 }
 
-// Returns most tweets for a given stock or ticker name with a given
-// fromTime. This fromTime is the last time Twitter was scraped for the
-// stock or crypto.
-func TwitterScrape(tickerName string, lastScrapeTime int64) []Statement {
+// Returns most tweets matching query with a given fromTime. This
+// fromTime is the last time Twitter was scraped for the stock or crypto.
+func TwitterScrape(logger *slog.Logger, query Query, lastScrapeTime int64) []Statement {
 	scraper := twitterscraper.New()
 
 	scraper.SetSearchMode(twitterscraper.SearchTop)
@@ -108,7 +106,7 @@ func TwitterScrape(tickerName string, lastScrapeTime int64) []Statement {
 	// Since we scrape hourly, we are only concerned
 	// with all the tweets within the past hour.
 	for tweet := range scraper.SearchTweets(context.Background(),
-		tickerName+" within_time:1h", 100) {
+		query.Search()+" within_time:1h", 100) {
 		if tweet.Error != nil {
 			return tweets
 		}
@@ -118,7 +116,7 @@ func TwitterScrape(tickerName string, lastScrapeTime int64) []Statement {
 
 		// Secondary check to ensure the tweet is actually
 		// about our stock of choice.
-		if !strings.Contains(tweet.Text, tickerName) {
+		if !query.Matches(tweet.Text) {
 			continue
 		}
 
@@ -128,12 +126,12 @@ func TwitterScrape(tickerName string, lastScrapeTime int64) []Statement {
 
 		id, err := strconv.ParseUint(tweet.ID, 10, 64)
 		if err != nil {
-			log.Printf("twitterScrape(): Error extracting tweet id")
+			logger.Warn("failed to parse tweet id", "tweet_id", tweet.ID, "err", err)
 		}
 
 		s := Statement{
 			Expression:   tweet.Text,
-			Subject:      tickerName,
+			Subject:      query.Ticker,
 			Source:       "Twitter",
 			TimeStamp:    tweet.Timestamp,
 			Polarity:     0,
@@ -143,6 +141,7 @@ func TwitterScrape(tickerName string, lastScrapeTime int64) []Statement {
 			Likes:        tweet.Likes,
 			Replies:      tweet.Replies,
 			Retweets:     tweet.Retweets,
+			User:         author(tweet.Tweet),
 			Location:     tweet.Place,
 		}
 		tweets = append(tweets, s)
@@ -151,7 +150,9 @@ func TwitterScrape(tickerName string, lastScrapeTime int64) []Statement {
 	return tweets
 }
 
-func TwitterScrapeRange(fromTime, toTime int64, tickerName string) []Statement {
+// Returns the tweets matching query posted in [fromTime, toTime),
+// or an error if the search fails part way.
+func TwitterScrapeRange(logger *slog.Logger, fromTime, toTime int64, query Query) ([]Statement, error) {
 	scraper := twitterscraper.New()
 
 	scraper.SetSearchMode(twitterscraper.SearchTop)
@@ -160,12 +161,12 @@ func TwitterScrapeRange(fromTime, toTime int64, tickerName string) []Statement {
 
 	// Since we scrape hourly, we are only concerned
 	// with all the tweets within the past hour.
-	log.Print(tickerName + " since_time:" + strconv.FormatInt(fromTime, 10) + " until_time:" + strconv.FormatInt(toTime, 10))
+	logger.Debug("searching tweets", "since_time", fromTime, "until_time", toTime)
 	for tweet := range scraper.SearchTweets(context.Background(),
-		tickerName+" since_time:"+strconv.FormatInt(fromTime, 10)+" until_time:"+strconv.FormatInt(toTime, 10), 100) {
+		query.Search()+" since_time:"+strconv.FormatInt(fromTime, 10)+" until_time:"+strconv.FormatInt(toTime, 10), 100) {
 		if tweet.Error != nil {
-			log.Printf("TwitterScrapeRange(): Error in SearchTweets() %v", tweet.Error)
-			return tweets
+			logger.Error("tweet search failed", "err", tweet.Error)
+			return nil, tweet.Error
 		}
 
 		// Removes certain characters and replaces Emojis.
@@ -173,27 +174,43 @@ func TwitterScrapeRange(fromTime, toTime int64, tickerName string) []Statement {
 
 		// Secondary check to ensure the tweet is actually
 		// about our stock of choice.
-		if !strings.Contains(tweet.Text, tickerName) {
+		if !query.Matches(tweet.Text) {
 			continue
 		}
 		id, err := strconv.ParseUint(tweet.ID, 10, 64)
 		if err != nil {
-			log.Printf("twitterScrape(): Error extracting tweet id")
+			logger.Warn("failed to parse tweet id", "tweet_id", tweet.ID, "err", err)
 		}
 		s := Statement{
 			Expression:   tweet.Text,
-			Subject:      tickerName,
+			Subject:      query.Ticker,
 			Source:       "Twitter",
 			TimeStamp:    tweet.Timestamp,
 			Polarity:     0,
 			URLs:         tweet.URLs,
 			PermanentURL: tweet.PermanentURL,
 			ID:           id,
+			Likes:        tweet.Likes,
+			Replies:      tweet.Replies,
+			Retweets:     tweet.Retweets,
+			User:         author(tweet.Tweet),
 		}
 		tweets = append(tweets, s)
 
 	}
-	return tweets
+	return tweets, nil
+}
+
+// Returns the profile of a tweet's author as far as the tweet
+// tells: its id and username. The rest is left for FetchProfile,
+// which costs a request per author.
+func author(tweet twitterscraper.Tweet) twitterscraper.Profile {
+	return twitterscraper.Profile{UserID: tweet.UserID, Username: tweet.Username}
+}
+
+// Fetches the full profile of the user with the given username.
+func FetchProfile(username string) (twitterscraper.Profile, error) {
+	return twitterscraper.New().GetProfile(username)
 }
 
 func SanitizeTweet(s string) string {
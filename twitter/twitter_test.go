@@ -2,13 +2,17 @@ package twitter
 
 import (
 	"fmt"
+	"log/slog"
 	"strconv"
 	"testing"
 	"time"
 )
 
 func TestTwitterScrapeRange(t *testing.T) {
-	statements := TwitterScrapeRange(1651691408, 1651777808, "AMD")
+	statements, err := TwitterScrapeRange(slog.Default(), 1651691408, 1651777808, Query{Ticker: "AMD"})
+	if err != nil {
+		t.Fatal(err)
+	}
 	var maxTime int64
 	minTime := time.Now().Unix()
 	for _, s := range statements {
@@ -24,7 +28,7 @@ func TestTwitterScrapeRange(t *testing.T) {
 }
 
 func TestTwitterScrapeProfile(t *testing.T) {
-	statements := TwitterScrapeProfile("AMD", 0)
+	statements := TwitterScrapeProfile(slog.Default(), Query{Ticker: "AMD"}, 0)
 	for i, tweet := range statements {
 		fmt.Printf("%d: ", i)
 		fmt.Println(tweet)
@@ -33,7 +37,7 @@ func TestTwitterScrapeProfile(t *testing.T) {
 
 }
 func TestTwitterScrape(t *testing.T) {
-	statements := TwitterScrape("AMD", 0)
+	statements := TwitterScrape(slog.Default(), Query{Ticker: "AMD"}, 0)
 	for i, tweet := range statements {
 		fmt.Printf("%d: ", i)
 		fmt.Println(tweet)